@@ -0,0 +1,89 @@
+// bdsiceemulator serves an emulation of the BDSICE download pages, so that bdsicego can be run and
+// tested offline, along with a stand-in of the INE Tempus JSON API. Point downloadurl, updateurl and
+// ineurl in config.yml to the URLs it prints.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/emulator"
+)
+
+// reads the updates in dirPath, one subdirectory per update named after its date, such as 20261019,
+// holding the .xer files of the update. They are returned most recent first, as they are listed.
+func loadUpdates(dirPath string) ([]emulator.Update, error) {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("loadUpdates(): %s", err.Error())
+	}
+
+	var updates []emulator.Update
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		date, err := time.Parse("20060102", entry.Name())
+		if err != nil {
+			continue
+		}
+
+		fixtures, err := emulator.LoadFixtures(filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("loadUpdates(): %s", err.Error())
+		}
+
+		updates = append(updates, emulator.Update{Date: date, Fixtures: fixtures})
+	}
+
+	sort.Slice(updates, func(i, j int) bool { return updates[i].Date.After(updates[j].Date) })
+
+	return updates, nil
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	databaseDir := flag.String("database", "", "directory with the .xer files of the full database (default: built-in fixtures)")
+	updatesDir := flag.String("updates", "", "directory with one subdirectory of .xer files per update, named YYYYMMDD (default: built-in fixtures)")
+	latest := flag.String("latest", time.Now().Format("20060102"), "date of the latest built-in update, YYYYMMDD")
+	flag.Parse()
+
+	latestDate, err := time.Parse("20060102", *latest)
+	if err != nil {
+		log.Fatalf("-latest: %s", err.Error())
+	}
+
+	server := emulator.NewDefault(latestDate)
+
+	if *databaseDir != "" {
+		server.Database, err = emulator.LoadFixtures(*databaseDir)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	if *updatesDir != "" {
+		server.Updates, err = loadUpdates(*updatesDir)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	var configuration config.BDSICEConfig
+	emulator.Configure(&configuration, "http://"+*addr)
+
+	fmt.Printf("serving %d series and %d updates on %s\n", len(server.Database), len(server.Updates), *addr)
+	fmt.Printf("downloadurl: %s\n", configuration.DownloadURL)
+	fmt.Printf("updateurl: %s\n", configuration.UpdateURL)
+	fmt.Printf("ineurl: %s\n", configuration.INEURL)
+
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
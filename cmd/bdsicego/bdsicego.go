@@ -2,19 +2,32 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"math"
 	"math/rand"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"time"
 
 	// "bdsice/decode"
 
+	"github.com/fabiansalazares/bdsicego/daemon"
 	"github.com/fabiansalazares/bdsicego/database"
 	"github.com/fabiansalazares/bdsicego/download"
 	"github.com/fabiansalazares/bdsicego/internal/config"
 	"github.com/fabiansalazares/bdsicego/internal/version"
 	"github.com/fabiansalazares/bdsicego/plot"
+	"github.com/fabiansalazares/bdsicego/progress"
+	"github.com/fabiansalazares/bdsicego/provider"
+	"github.com/fabiansalazares/bdsicego/saved"
+	"github.com/fabiansalazares/bdsicego/sdmx"
 	"github.com/fabiansalazares/bdsicego/series"
+	"github.com/fabiansalazares/bdsicego/tree"
 
 	// econseries "econdata/series"
 	//	econseries "fabiansalazares/bdsicego/series"
@@ -25,6 +38,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	// to print nicely formatted tables for show and compare commands
 	"github.com/c-bata/go-prompt"
@@ -41,18 +56,112 @@ const helpMessage = `
 	e | setup 			prints the current configuration parameters
 	d | download (force) 		downloads the full database from the BDSICE website
 	u | update 			downloads the most recent update from the BDSICE website
-	b | bulletin 			downloads the most recent coyuntura bulletin from BDSICE website
+	b | bulletin [dates]		downloads the most recent coyuntura bulletin from BDSICE website, and the
+					past ones of the given dates, such as 2026-09, to the bulletins directory
+	b | bulletin list		lists the bulletins available and the ones downloaded
+	b | bulletin open [date|n]	opens the latest bulletin, or the one of the given date or position in
+					the list, with the configured viewer, downloading it if needed
+	providers (refresh)		lists the providers of series and the size of their catalogs. Series of
+					providers other than BDSICE are given with their prefix, such as
+					ine:IPC206449, to search, show, info and plot. "refresh" fetches the
+					catalogs of the ineoperations in config.yml, such as IPC or EPA
+	sync (--once)			keeps the database up to date: checks for updates every syncinterval
+					in config.yml (6h by default) or at the synctimes of the day, applies
+					them and runs the synchooks commands, logging to synclog as JSON lines
+					until interrupted. --once checks once and exits
+	import <path>			imports the database from a local copy of its zip file, of the zip file of
+					an update, such as UltActualiz_20261019.zip, or of a directory with
+					their .xer files, for machines without access to BDSICE website.
+					SDMX-ML (.xml) and SDMX-JSON (.json) files, such as those of Eurostat
+					or the ECB, are imported as series of the sdmx provider, given as
+					sdmx:<series key>, as in sdmx:EXR.M.USD.EUR.SP00.A
+	export <file> [%%] [codes]	exports the series given, with their metadata, to an SDMX-ML data
+					message if file ends in .xml or to an SDMX-JSON one if it ends in .json
+	rollback (list)			makes the state of the database before the last download or update the
+					current one. "list" lists the states kept, as many as keepstates in
+					config.yml
+	--json-progress			prints the progress of download, update and bulletin as JSON lines,
+					one event per line, instead of progress bars
+	check (--repair)		checks that the catalog, the decoded series and the .xer files agree.
+					--repair re-decodes missing or outdated series, rebuilds catalog entries
+					and removes orphans
+	convert (remove)		converts the JSON series of former versions into the binary series store.
+					"remove" deletes the JSON files once converted
+	catalog list			lists the snapshots of the catalog kept by download, update and check
+	catalog diff [from] [to] [--json]
+					prints the series added, removed and changed, field by field, between
+					two snapshots. A snapshot is given by the beginning of its date, as in
+					20261019, by its position from the latest, as in -2, or as "current".
+					"to" defaults to current and "from" to the snapshot before it
 	i | info [codes]		prints information about the given codes
-	s | search [terms] 		searches the terms in the local BDSICE database
+	s | search [--limit n] [--expansions] [--active] [--current] [terms]
+					searches the terms in the local BDSICE database, best matches first.
+					Terms are expanded through the synonyms and abbreviations dictionary,
+					which can be extended in synonyms.yml in the configuration directory.
+					--expansions prints the expansions that were applied.
+					--active keeps only series still published, --current only those
+					whose last observation is as recent as their frequency allows
+	t | tree [--active] [--current] [path]
+					browses the series by topic, indicator, territory and transformation.
+					Each element of the path is the number or the name of a node, as in
+					"tree 3 1" or "tree prices/ipc". The series under the node are matched
+					by "%%" in show, compare, info and plot
+	saved list			lists the saved searches and watchlists
+	saved search [name] [--limit n] [--active] [--current] [terms]
+					saves a search under name. It is run again every time it is used
+	saved watch [name] [%%] [codes]	adds codes to the watchlist name, creating it if needed
+	saved unwatch [name] [codes]	removes codes from the watchlist name
+	saved rename [name] [new name]	renames a saved search or watchlist
+	saved delete [name]		deletes a saved search or watchlist
+	saved run [name]		prints the series of a saved search or watchlist, which are then
+					matched by "%%" as search results are.
+					Saved searches and watchlists are stored in saved.yml in the
+					configuration directory and can be given as @name to show, compare,
+					info and plot, as in "plot @labour-market"
 	w | show [%%] [codes] 		prints a summary of the specified codes or matched codes if "%%"
 	c | compare [codes] 		compares the series given
-	p | plot [%%] [sep] [codes]    	plots the series given. "%%" includes codes matched from search commands
-	r | random 			shows a randomly chosen serie
+	p | plot [%%] [sep] [save <file>] [--size <w>x<h>] [--dpi <n>] [--norm index|zscore] [--style <name>] [codes]
+					plots the series given. "%%" includes codes matched from search commands.
+					Series in two units are plotted against a left and a right axis. --norm
+					plots them as an index, 100 at the first date all of them have been
+					observed, or as standard deviations from their means, so that series
+					in more than two units can be compared.
+					"sep" plots each serie in a figure of its own. "save" writes the plot to
+					file instead of showing it, as SVG, PDF, EPS, PNG, JPEG or TIFF as told
+					by its extension. Separate figures are saved as the pages of a single
+					PDF file, or as numbered files for other formats. --size sets the size
+					in inches, 10x4 unless set in plotwidth and plotheight in config.yml,
+					and --dpi the resolution of PNG, JPEG and TIFF files, 96 unless set in
+					plotdpi. --style draws the plot in a style of plotting.yml in the
+					configuration directory, or in a built-in one: default, dark or print.
+					The style is default unless set in plotstyle in config.yml
+	r | random [--active] [--current]
+					shows a randomly chosen serie
+	stale (--discontinued)		lists the active series whose last observation is older than expected
+					for their frequency, by source. --discontinued also lists the series
+					that are no longer published
 `
 
+// handle on the local database shared by all commands. It keeps the catalog and the most recently
+// used series in memory, so that commands in a prompt session do not read them from disk again.
+var handle *database.Handle
+
+// providers of series, BDSICE first, through which search, show, info and plot reach series of
+// other sources given with prefixed codes such as ine:IPC206449
+var registry *provider.Registry
+
+// series imported from SDMX files, provided to the registry under the sdmx prefix
+var sdmxStore *provider.Local
+
+// whether the progress of downloads is printed as JSON lines, for programs running bdsicego
+var jsonProgress bool
+
 // custom type holding arguments to a search command
 type searchArgs struct {
-	terms []string
+	terms      []string
+	limit      int  // maximum number of results to show, 0 meaning all of them
+	expansions bool // print the synonyms and abbreviations the terms were expanded to
+	filter     database.FreshnessFilter
 }
 
 // custom type holding arguments to a show command
@@ -72,9 +181,44 @@ type plotArgs struct {
 	active   bool
 	separate bool
 	save     bool
+	filePath string  // file the plot is saved to rather than shown, if save
+	width    float64 // size in inches, from config.yml unless given
+	height   float64
+	dpi      int
+	norm     string // normalization of the series, plot.NormalizeIndex or plot.NormalizeZScore
+	style    string // style of plotting.yml, from config.yml unless given
 	codes    []string
 }
 
+// custom type holding arguments to an export command
+type exportArgs struct {
+	active   bool
+	filePath string
+	codes    []string
+}
+
+// custom type holding arguments to a tree command
+type treeArgs struct {
+	active bool
+	path   []string
+	filter database.FreshnessFilter
+}
+
+// custom type holding arguments to a saved command
+type savedArgs struct {
+	active     bool
+	subcommand string
+	args       []string
+}
+
+// custom type holding arguments to a catalog command
+type catalogArgs struct {
+	active     bool
+	subcommand string
+	args       []string
+	json       bool
+}
+
 type infoArgs struct {
 	active bool
 	codes  []string
@@ -87,10 +231,16 @@ type argsStruct struct {
 	searchToShow    bool
 	searchToCompare bool
 	searchToPlot    bool
+	searchToExport  bool
 	show            showArgs
 	compare         compareArgs
 	plot            plotArgs
+	export          exportArgs
 	info            infoArgs
+	tree            treeArgs
+	saved           savedArgs
+	catalog         catalogArgs
+	bulletin        []string
 	verbose         bool
 }
 
@@ -103,10 +253,22 @@ func promptCompleter(d prompt.Document) []prompt.Suggest {
 		{Text: "info", Description: "show basic information about specified serie(s)"},
 		{Text: "download", Description: "download the full database"},
 		{Text: "update", Description: "download the latest update"},
-		{Text: "bulletin", Description: "download and display the latest bulletin"},
+		{Text: "bulletin", Description: "download the latest bulletin, list or open bulletins"},
+		{Text: "providers", Description: "list the providers of series, refresh to fetch their catalogs"},
+		{Text: "sync", Description: "keep the database up to date in the background, --once to check once"},
+		{Text: "import", Description: "import the database or an update from a local zip file or directory, or series from an SDMX file"},
+		{Text: "export", Description: "export series to an SDMX-ML (.xml) or SDMX-JSON (.json) file"},
+		{Text: "rollback", Description: "restore the state of the database before the last update, list to list the states"},
+		{Text: "check", Description: "check the integrity of the database, --repair to fix it"},
+		{Text: "convert", Description: "convert JSON series into the binary series store"},
 		{Text: "info", Description: "display basic information about specified serie(s)"},
 		{Text: "search", Description: "search for series whose codes or titles contain given search terms"},
 		{Text: "show", Description: "show the specified serie(s)"},
+		{Text: "tree", Description: "browse the series by topic, indicator, territory and transformation"},
+		{Text: "catalog", Description: "list catalog snapshots or diff two of them"},
+		{Text: "saved", Description: "save, list, rename, delete and run saved searches and watchlists"},
+		{Text: "stale", Description: "list the series that are overdue, by source"},
+		{Text: "random", Description: "show a randomly chosen serie"},
 	}
 
 	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
@@ -128,25 +290,37 @@ func versionCommand(configuration *config.BDSICEConfig) {
 
 // prints basic information for the given code series
 func infoCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) {
-	for _, code := range commandArgs.info.codes {
-		serie, err := series.Load(configuration, code)
+	for _, code := range expandReferences(commandArgs.info.codes) {
+		serie, err := registry.Serie(context.Background(), code)
 		if err != nil {
-			fmt.Printf("Serie code %s does not exist in the BDSICE database.\n", code)
+			fmt.Printf("Serie code %s could not be loaded: %s\n", code, err.Error())
 			continue
 		}
 
+		namespace, _ := provider.Split(code)
+
+		// series without observations have no range
+		start, end := "n/a", "n/a"
+		if serie.Start != nil {
+			start = serie.Start.String()
+		}
+		if serie.End != nil {
+			end = serie.End.String()
+		}
+
 		fmt.Printf(`
-BDSICE Serie %s -- %s
+%s Serie %s -- %s
 Range: %s to %s
 Number of observations: %d
 Source: %s
 Units: %s
 Number of decimals: %d
 Frequency: %d
-`, serie.SerieCode,
+`, strings.ToUpper(namespace),
+			serie.SerieCode,
 			serie.Title,
-			serie.Start.String(),
-			serie.End.String(),
+			start,
+			end,
 			serie.NumberOfObservations,
 			serie.Source,
 			serie.Units,
@@ -179,16 +353,64 @@ func setupCommand(configuration *config.BDSICEConfig) {
 	return
 }
 
+// returns the context commands that download run with. It carries the reporter their progress is
+// rendered by, and it is canceled when the user interrupts the command with Ctrl+C, so that
+// downloads stop without leaving the database half-written. The returned function must be called
+// once the command is done.
+func commandContext() (context.Context, func()) {
+	var reporter progress.Reporter = progress.NewBar(os.Stdout)
+	if jsonProgress {
+		reporter = progress.NewJSONLines(os.Stdout)
+	}
+
+	ctx, cancel := context.WithCancel(progress.WithReporter(context.Background(), reporter))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-interrupt:
+			fmt.Printf("\nInterrupted.\n")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupt)
+		cancel()
+	}
+}
+
+// asks the user a yes/no question in the terminal
+func confirmInTerminal(question string) bool {
+	var s string
+	fmt.Printf("%s (y/n): ", question)
+	fmt.Scan(&s)
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == "y" || s == "yes"
+}
+
 // downloads the full database and process .xer files into .json loadable ones
 func downloadCommand(configuration *config.BDSICEConfig, force bool) {
+	ctx, stop := commandContext()
+	defer stop()
 
 	// _, err := download.DownloadFullDatabase(configuration, false)
-	_, err := download.DownloadFullDatabase(configuration, force)
+	_, err := download.DownloadFullDatabase(ctx, configuration, force, confirmInTerminal)
+
+	if errors.Is(err, download.ErrNotConfirmed) || errors.Is(err, context.Canceled) {
+		fmt.Printf("%s\n", err.Error())
+		return
+	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	handle.Invalidate()
+
 	return
 }
 
@@ -196,28 +418,373 @@ func downloadCommand(configuration *config.BDSICEConfig, force bool) {
 // TODO:
 //		- Implement force modifier to update command that forces the update even if it has already been deownloaded.
 func updateCommand(configuration *config.BDSICEConfig) {
+	ctx, stop := commandContext()
+	_, err := download.Update(ctx, configuration, false)
+	stop()
+
+	// updates that are no longer listed can only be recovered with a full download
+	var gap *download.GapError
+	if errors.As(err, &gap) {
+		if confirmInTerminal(fmt.Sprintf("%s.\nDownload the full database instead?", gap.Error())) {
+			downloadCommand(configuration, true)
+		}
+		return
+	}
 
-	_, err := download.Update(configuration, false)
+	if errors.Is(err, download.ErrAlreadyUpToDate) {
+		fmt.Printf("The database is up to date.\n")
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		fmt.Printf("%s\n", err.Error())
+		handle.Invalidate()
+		return
+	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Sprintln()
+
+	handle.Invalidate()
 	return
 
 }
 
-// TODO checks for the latest bulletin and download if available
-func bulletinCommand(configuration *config.BDSICEConfig) {
+// lists the providers of series and the number of series in their catalogs, after fetching the
+// catalogs of the providers that are not downloaded if refresh is true
+func providersCommand(configuration *config.BDSICEConfig, refresh bool) error {
+	ctx, stop := commandContext()
+	defer stop()
+
+	for _, p := range registry.Providers() {
+		if refresher, ok := p.(provider.Refresher); ok && refresh {
+			fmt.Printf("Refreshing the catalog of %s...\n", p.Namespace())
+			_, err := refresher.Refresh(ctx)
+			if err != nil {
+				fmt.Printf("%s\n", err.Error())
+			}
+		}
+	}
+
+	for _, p := range registry.Providers() {
+		catalog, err := p.Catalog(ctx)
+		switch {
+		case errors.Is(err, provider.ErrNoCatalog):
+			fmt.Printf("%s\tno catalog yet, run providers refresh\n", p.Namespace())
+		case err != nil:
+			fmt.Printf("%s\t%s\n", p.Namespace(), err.Error())
+		default:
+			fmt.Printf("%s\t%d series\n", p.Namespace(), len(catalog.Series))
+		}
+	}
+
+	return nil
+}
+
+// checks for updates and applies them on the schedule of config.yml until interrupted, or once.
+// The log is appended to synclog and printed.
+func syncCommand(configuration *config.BDSICEConfig, once bool) error {
+	logPath := daemon.LogPath(configuration)
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("syncCommand(): %s", err.Error())
+	}
+	defer logFile.Close()
+
+	d, err := daemon.New(configuration, io.MultiWriter(logFile, os.Stdout))
+	if err != nil {
+		return fmt.Errorf("syncCommand(): %s", err.Error())
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	// the log tells what happened, and progress is only printed when asked for as JSON lines
+	if !jsonProgress {
+		ctx = progress.WithReporter(ctx, progress.Discard)
+	}
+
+	if once {
+		d.Sync(ctx)
+	} else {
+		fmt.Printf("Syncing %s, logging to %s. Press Ctrl+C to stop.\n", d.Schedule.String(), logPath)
+		err = d.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("syncCommand(): %s", err.Error())
+		}
+	}
+
+	handle.Invalidate()
+
+	return nil
+}
+
+// imports the full database or an update from a local zip file or directory of .xer files
+func importCommand(configuration *config.BDSICEConfig, sourcePath string) error {
+	if sourcePath == "" {
+		return fmt.Errorf("importCommand(): a zip file or directory to import is needed")
+	}
+
+	// SDMX files hold series of other publishers rather than the database
+	switch strings.ToLower(filepath.Ext(sourcePath)) {
+	case ".xml", ".json":
+		seriesRead, err := sdmx.ReadFile(sourcePath)
+		if err != nil {
+			return fmt.Errorf("importCommand(): %s", err.Error())
+		}
+
+		report, err := sdmxStore.Import(seriesRead)
+		if err != nil {
+			return fmt.Errorf("importCommand(): %s", err.Error())
+		}
+
+		fmt.Printf("Imported %d series from %s as %s series: %s.\n", len(seriesRead), sourcePath, provider.SDMXNamespace, report.String())
+		return nil
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	seriesDecoded, err := download.Import(ctx, configuration, sourcePath)
+
+	var gap *download.GapError
+	if errors.As(err, &gap) {
+		fmt.Printf("%s. Import the zip file of the full database first.\n", gap.Error())
+		return nil
+	}
+
+	if errors.Is(err, download.ErrAlreadyUpToDate) || errors.Is(err, context.Canceled) {
+		fmt.Printf("%s\n", err.Error())
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("importCommand(): %s", err.Error())
+	}
+
+	handle.Invalidate()
+
+	fmt.Printf("Imported %d series from %s.\n", len(seriesDecoded), sourcePath)
+	return nil
+}
+
+// exports the series given to an SDMX data message, SDMX-ML or SDMX-JSON as told by the extension of
+// the file
+func exportCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) error {
+	if !commandArgs.export.active {
+		return nil
+	}
+
+	write := sdmx.WriteML
+	switch strings.ToLower(filepath.Ext(commandArgs.export.filePath)) {
+	case ".xml":
+	case ".json":
+		write = sdmx.WriteJSON
+	default:
+		return fmt.Errorf("exportCommand(): a file ending in .xml or .json to export to is needed")
+	}
+
+	var seriesToExport []*series.BDSICESerie
+	for _, code := range expandReferences(commandArgs.export.codes) {
+		s, err := registry.Serie(context.Background(), code)
+		if err != nil {
+			fmt.Printf("Export: %s could not be loaded, skipping...\n", err.Error())
+			continue
+		}
+		seriesToExport = append(seriesToExport, s)
+	}
+
+	if len(seriesToExport) == 0 {
+		return fmt.Errorf("exportCommand(): no series to export")
+	}
+
+	f, err := os.Create(commandArgs.export.filePath)
+	if err != nil {
+		return fmt.Errorf("exportCommand(): %s", err.Error())
+	}
+
+	err = write(f, seriesToExport)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("exportCommand(): %s", err.Error())
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("exportCommand(): %s", err.Error())
+	}
+
+	fmt.Printf("Exported %d series to %s.\n", len(seriesToExport), commandArgs.export.filePath)
+	return nil
+}
+
+// makes the previous state of the database the current one, or lists the states kept
+func rollbackCommand(configuration *config.BDSICEConfig, list bool) error {
+	if list {
+		states, err := download.ListStates(context.Background(), configuration)
+		if err != nil {
+			return fmt.Errorf("rollbackCommand(): %s", err.Error())
+		}
 
-	err := download.Bulletin(configuration)
+		if len(states) == 0 {
+			fmt.Printf("No states of the database kept yet. They are kept from the next download or update on.\n")
+			return nil
+		}
 
+		for _, state := range states {
+			current := ""
+			if state.Current {
+				current = "\t(current)"
+			}
+			fmt.Printf("%s\t%s%s\n", state.Name, state.Time.Local().Format("2006-01-02 15:04:05"), current)
+		}
+		return nil
+	}
+
+	state, err := download.Rollback(context.Background(), configuration)
+	if err != nil {
+		return fmt.Errorf("rollbackCommand(): %s", err.Error())
+	}
+
+	handle.Invalidate()
+
+	fmt.Printf("Rolled back to the state of %s.\n", state.Time.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// checks the integrity of the database and optionally repairs it. Returns false if problems remain
+func checkCommand(configuration *config.BDSICEConfig, repair bool) bool {
+
+	report, err := database.Check(configuration)
+	if err != nil {
+		fmt.Printf("checkCommand(): %s\n", err.Error())
+		return false
+	}
+
+	fmt.Printf("%s", report.String())
+
+	if report.Problems() == 0 {
+		fmt.Printf("No problems found.\n")
+		return true
+	}
+
+	if !repair {
+		fmt.Printf("%d problems found. Run check --repair to fix them.\n", report.Problems())
+		return false
+	}
+
+	fmt.Printf("Repairing...\n")
+	err = database.Repair(configuration, report)
+	handle.Invalidate()
+	if err != nil {
+		fmt.Printf("checkCommand(): %s\n", err.Error())
+		return false
+	}
+
+	report, err = database.Check(configuration)
+	if err != nil {
+		fmt.Printf("checkCommand(): %s\n", err.Error())
+		return false
+	}
+
+	if report.Problems() > 0 {
+		fmt.Printf("%s%d problems could not be repaired.\n", report.String(), report.Problems())
+		return false
+	}
+
+	fmt.Printf("Database repaired.\n")
+	return true
+}
+
+// converts the JSON files in DatabaseLocalPath into the binary series store
+func convertCommand(configuration *config.BDSICEConfig, remove bool) {
+
+	converted, err := series.ConvertJSONDirectory(configuration.DatabaseLocalPath, remove)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	handle.Invalidate()
+
+	fmt.Printf("Converted %d series into %s\n", converted, series.StoreFileName)
 	return
+}
+
+// downloads the latest coyuntura bulletin, or the past ones given, lists the bulletins available
+// or opens one with the configured viewer
+func bulletinCommand(configuration *config.BDSICEConfig, commandArgs []string) error {
+	ctx, stop := commandContext()
+	defer stop()
+
+	subcommand := ""
+	if len(commandArgs) > 0 {
+		subcommand = strings.ToLower(commandArgs[0])
+	}
+
+	switch subcommand {
+	case "list":
+		index, err := download.ListBulletins(ctx, configuration)
+		if err != nil {
+			// the bulletins indexed so far can still be listed offline
+			fmt.Printf("Could not refresh the list of bulletins: %s\n", err.Error())
+			index, err = download.LoadBulletinIndex(configuration)
+			if err != nil {
+				return fmt.Errorf("bulletinCommand(): %s", err.Error())
+			}
+		}
+
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"#", "Date", "Title", "Downloaded"})
+		for i, bulletin := range index.Bulletins {
+			downloaded := ""
+			if bulletin.Downloaded() {
+				downloaded = bulletin.File
+			}
+			t.AppendRow(table.Row{i + 1, bulletin.Date.Format("2006-01-02"), bulletin.Title, downloaded})
+		}
+		t.SetStyle(table.StyleLight)
+		t.Render()
+
+	case "open":
+		reference := "latest"
+		if len(commandArgs) > 1 {
+			reference = commandArgs[1]
+		}
+
+		index, err := download.ListBulletins(ctx, configuration)
+		if err != nil {
+			index, err = download.LoadBulletinIndex(configuration)
+			if err != nil {
+				return fmt.Errorf("bulletinCommand(): %s", err.Error())
+			}
+		}
+
+		bulletin, err := download.DownloadBulletin(ctx, configuration, index, reference)
+		if err != nil {
+			return fmt.Errorf("bulletinCommand(): %s", err.Error())
+		}
+
+		cmd := exec.Command(configuration.PlotViewer, index.Path(*bulletin))
+		err = cmd.Start()
+		if err != nil {
+			return fmt.Errorf("bulletinCommand(): could not open %s with %s: %s", bulletin.File, configuration.PlotViewer, err.Error())
+		}
+
+	default:
+		downloaded, err := download.Bulletin(ctx, configuration, commandArgs...)
+		if err != nil {
+			return fmt.Errorf("bulletinCommand(): %s", err.Error())
+		}
+
+		for _, bulletin := range downloaded {
+			fmt.Printf("%s\t%s\t%s\n", bulletin.Date.Format("2006-01-02"), bulletin.Title,
+				filepath.Join(configuration.DataLocalPath, download.BulletinsDirName, bulletin.File))
+		}
+	}
 
+	return nil
 }
 
 // searchs for the given terms. If commands show, plot or info contain % as an arg, the series returned by
@@ -255,21 +822,34 @@ func searchCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct,
 		}
 
 		// load database into 'db' variable
-		db, err := database.LoadDatabase(configuration)
+		db, err := handle.Database()
 		if err != nil {
 			return fmt.Errorf("searchCommand(): %s", err.Error())
 		}
 
-		// perform search using terms as variadic arguments
-		resultsDatabaseSeries, err := db.Search(searchCall.terms...)
+		if searchCall.expansions {
+			expansions, err := db.Expand(searchCall.terms...)
+			if err != nil {
+				return fmt.Errorf("searchCommand(): %s", err.Error())
+			}
+
+			for _, expansion := range expansions {
+				fmt.Printf("Expanded %q to: %s\n", expansion.Term, strings.Join(expansion.Alternatives, ", "))
+			}
+		}
+
+		// perform search using terms as variadic arguments, over the catalogs of all the providers.
+		// Results come sorted by relevance
+		resultsDatabaseSeries, err := registry.Search(context.Background(), database.SearchOptions{Limit: searchCall.limit, Filter: searchCall.filter}, searchCall.terms...)
 		if err != nil {
 			return fmt.Errorf("searchCommand(): %s", err.Error())
 		}
 
 		// show results
-		for code, title := range resultsDatabaseSeries {
+		for _, result := range resultsDatabaseSeries {
+			code, title := result.Code, result.Title
 
-			fmt.Printf("%s\t\t%s\n", code, title)
+			fmt.Printf("%s\t%6.2f\t%s\n", code, result.Score, title)
 
 			// load results into result stack, if a map reference was provided as argument
 			if resultsStack != nil {
@@ -289,14 +869,447 @@ func searchCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct,
 				commandArgs.plot.codes = append(commandArgs.plot.codes, code)
 			}
 
-			if commandArgs.searchToShow {
-				commandArgs.show.codes = append(commandArgs.show.codes, code)
-			}
-		}
+			if commandArgs.searchToShow {
+				commandArgs.show.codes = append(commandArgs.show.codes, code)
+			}
+
+			if commandArgs.searchToExport {
+				commandArgs.export.codes = append(commandArgs.export.codes, code)
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// browses the taxonomy of series. Prints the children of the node given by the path or, for the last
+// level of the tree, its series. As with searchCommand, the series under the node are taken as
+// arguments by show, compare, info and plot commands containing %, and are loaded into resultsStack
+func treeCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct, resultsStack map[string]string) error {
+	if !commandArgs.tree.active {
+		return nil
+	}
+
+	root, err := tree.Load(configuration)
+	if err != nil {
+		return fmt.Errorf("treeCommand(): %s", err.Error())
+	}
+
+	db, err := handle.Database()
+	if err != nil {
+		return fmt.Errorf("treeCommand(): %s", err.Error())
+	}
+
+	// nodes are numbered after pruning, so that numbers match those printed with the same options
+	filter := commandArgs.tree.filter
+	root = root.Prune(func(code string) bool { return db.Accept(filter, code) })
+
+	// path elements may also be separated by /
+	var path []string
+	for _, element := range commandArgs.tree.path {
+		for _, part := range strings.Split(element, "/") {
+			if part != "" {
+				path = append(path, part)
+			}
+		}
+	}
+
+	node, err := root.Find(path...)
+	if err != nil {
+		return fmt.Errorf("treeCommand(): %s", err.Error())
+	}
+
+	leaves := node.Leaves()
+
+	fmt.Printf("%s (%d series)\n", node.Name, len(leaves))
+	for i, child := range node.Children {
+		fmt.Printf("%4d  %s (%d)\n", i+1, child.Name, len(child.Leaves()))
+	}
+
+	if resultsStack != nil {
+		for k := range resultsStack {
+			delete(resultsStack, k)
+		}
+	}
+
+	for _, code := range leaves {
+		if len(node.Children) == 0 {
+			fmt.Printf("      %s\t%s\n", code, db.Series[code])
+		}
+
+		if resultsStack != nil {
+			resultsStack[code] = db.Series[code]
+		}
+
+		if commandArgs.searchToInfo {
+			commandArgs.info.codes = append(commandArgs.info.codes, code)
+		}
+
+		if commandArgs.searchToCompare {
+			commandArgs.compare.codes = append(commandArgs.compare.codes, code)
+		}
+
+		if commandArgs.searchToPlot {
+			commandArgs.plot.codes = append(commandArgs.plot.codes, code)
+		}
+
+		if commandArgs.searchToShow {
+			commandArgs.show.codes = append(commandArgs.show.codes, code)
+		}
+
+		if commandArgs.searchToExport {
+			commandArgs.export.codes = append(commandArgs.export.codes, code)
+		}
+	}
+
+	return nil
+}
+
+// lists the series that are overdue, grouped by source, and the discontinued ones if so requested
+func staleCommand(configuration *config.BDSICEConfig, discontinued bool) error {
+	db, err := handle.Database()
+	if err != nil {
+		return fmt.Errorf("staleCommand(): %s", err.Error())
+	}
+
+	stale := db.Stale(discontinued)
+
+	for i, s := range stale {
+		if i == 0 || stale[i-1].Source != s.Source {
+			count := 0
+			for _, other := range stale[i:] {
+				if other.Source != s.Source {
+					break
+				}
+				count++
+			}
+			fmt.Printf("%s (%d series)\n", s.Source, count)
+		}
+
+		end := "-"
+		if s.End != nil {
+			end = s.End.Format("2006-01-02")
+		}
+
+		if s.Freshness == database.FreshnessOverdue {
+			fmt.Printf("  %s\tlast %s\texpected since %s\t%s\n", s.Code, end, s.Expected.Format("2006-01-02"), s.Title)
+		} else {
+			fmt.Printf("  %s\tlast %s\t%s\t%s\n", s.Code, end, s.Freshness, s.Title)
+		}
+	}
+
+	fmt.Printf("%d series, reference date %s\n", len(stale), db.LastUpdate.Format("2006-01-02"))
+
+	return nil
+}
+
+// replaces the @name references to saved searches and watchlists among codes by the codes they refer
+// to. References that cannot be resolved are reported and dropped.
+func expandReferences(codes []string) []string {
+	var references bool
+	for _, code := range codes {
+		if _, ok := saved.Reference(code); ok {
+			references = true
+			break
+		}
+	}
+
+	if !references {
+		return codes
+	}
+
+	collection, err := saved.Load()
+	if err != nil {
+		fmt.Printf("expandReferences(): %s\n", err.Error())
+		return nil
+	}
+
+	db, err := handle.Database()
+	if err != nil {
+		fmt.Printf("expandReferences(): %s\n", err.Error())
+		return nil
+	}
+
+	var expanded []string
+	for _, code := range codes {
+		codesReferred, err := collection.Expand(db, []string{code})
+		if err != nil {
+			fmt.Printf("expandReferences(): %s\n", err.Error())
+			continue
+		}
+		expanded = append(expanded, codesReferred...)
+	}
+
+	return expanded
+}
+
+// manages saved searches and watchlists. saved run prints the series of a saved search or watchlist
+// and, as searchCommand does, passes them to show, compare, info and plot commands containing % and
+// loads them into resultsStack, which also supplies the codes given as % to saved watch
+func savedCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct, resultsStack map[string]string) error {
+	if !commandArgs.saved.active {
+		return nil
+	}
+
+	collection, err := saved.Load()
+	if err != nil {
+		return fmt.Errorf("savedCommand(): %s", err.Error())
+	}
+
+	subcommand, args := commandArgs.saved.subcommand, commandArgs.saved.args
+	if subcommand == "" {
+		subcommand = "list"
+	}
+
+	if subcommand != "list" && len(args) == 0 {
+		return fmt.Errorf("savedCommand(): saved %s expects a name", subcommand)
+	}
+
+	switch subcommand {
+	case "list":
+		for _, name := range collection.Names() {
+			if search, ok := collection.Searches[name]; ok {
+				var options []string
+				if search.Limit > 0 {
+					options = append(options, fmt.Sprintf("--limit %d", search.Limit))
+				}
+				if search.Active {
+					options = append(options, "--active")
+				}
+				if search.Current {
+					options = append(options, "--current")
+				}
+				fmt.Printf("@%s\tsearch\t%s\n", name, strings.Join(append(options, search.Terms...), " "))
+			} else {
+				fmt.Printf("@%s\twatchlist\t%s\n", name, strings.Join(collection.Watchlists[name], " "))
+			}
+		}
+		return nil
+	case "search":
+		var search saved.Search
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--limit" {
+				limit, err := parseLimit(args, i)
+				if err != nil {
+					return fmt.Errorf("savedCommand(): %s", err.Error())
+				}
+				search.Limit = limit
+				i++
+			} else if args[i] == "--active" {
+				search.Active = true
+			} else if args[i] == "--current" {
+				search.Current = true
+			} else {
+				search.Terms = append(search.Terms, args[i])
+			}
+		}
+		err = collection.SaveSearch(args[0], search)
+	case "watch":
+		var codes []string
+		for _, code := range args[1:] {
+			if code == "%" {
+				for k := range resultsStack {
+					codes = append(codes, k)
+				}
+				sort.Strings(codes[len(codes)-len(resultsStack):])
+			} else {
+				codes = append(codes, code)
+			}
+		}
+		err = collection.Watch(args[0], codes...)
+	case "unwatch":
+		err = collection.Unwatch(args[0], args[1:]...)
+	case "rename":
+		if len(args) != 2 {
+			return fmt.Errorf("savedCommand(): saved rename expects the current and the new name")
+		}
+		err = collection.Rename(args[0], args[1])
+	case "delete":
+		err = collection.Delete(args[0])
+	case "run":
+		db, err := handle.Database()
+		if err != nil {
+			return fmt.Errorf("savedCommand(): %s", err.Error())
+		}
+
+		codes, err := collection.Resolve(db, args[0])
+		if err != nil {
+			return fmt.Errorf("savedCommand(): %s", err.Error())
+		}
+
+		if resultsStack != nil {
+			for k := range resultsStack {
+				delete(resultsStack, k)
+			}
+		}
+
+		for _, code := range codes {
+			fmt.Printf("%s\t%s\n", code, db.Series[code])
+
+			if resultsStack != nil {
+				resultsStack[code] = db.Series[code]
+			}
+
+			if commandArgs.searchToInfo {
+				commandArgs.info.codes = append(commandArgs.info.codes, code)
+			}
+
+			if commandArgs.searchToCompare {
+				commandArgs.compare.codes = append(commandArgs.compare.codes, code)
+			}
+
+			if commandArgs.searchToPlot {
+				commandArgs.plot.codes = append(commandArgs.plot.codes, code)
+			}
+
+			if commandArgs.searchToShow {
+				commandArgs.show.codes = append(commandArgs.show.codes, code)
+			}
+
+			if commandArgs.searchToExport {
+				commandArgs.export.codes = append(commandArgs.export.codes, code)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("savedCommand(): unknown subcommand %q. Expected list, search, watch, unwatch, rename, delete or run", subcommand)
+	}
+
+	if err != nil {
+		return fmt.Errorf("savedCommand(): %s", err.Error())
+	}
+
+	err = collection.Save()
+	if err != nil {
+		return fmt.Errorf("savedCommand(): %s", err.Error())
+	}
+
+	fmt.Printf("Saved %s %s\n", subcommand, args[0])
+
+	return nil
+}
+
+// lists the snapshots of the catalog or prints the differences between two of them
+func catalogCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) error {
+	if !commandArgs.catalog.active {
+		return nil
+	}
+
+	dbLocalPath := configuration.DatabaseLocalPath
+
+	switch commandArgs.catalog.subcommand {
+	case "", "list":
+		snapshots, err := database.ListSnapshots(dbLocalPath)
+		if err != nil {
+			return fmt.Errorf("catalogCommand(): %s", err.Error())
+		}
+
+		for i, snapshot := range snapshots {
+			fmt.Printf("%4d  %s  %s\n", i-len(snapshots), snapshot.Time.Format("2006-01-02 15:04:05"), snapshot.Name)
+		}
+		return nil
+	case "diff":
+	default:
+		return fmt.Errorf("catalogCommand(): unknown subcommand %q. Expected list or diff", commandArgs.catalog.subcommand)
+	}
+
+	// the latest snapshot is taken when the catalog is saved, so by default the current catalog is
+	// compared with the one before it
+	from, to := "-2", database.CurrentSnapshot
+	switch len(commandArgs.catalog.args) {
+	case 0:
+	case 1:
+		from = commandArgs.catalog.args[0]
+	case 2:
+		from, to = commandArgs.catalog.args[0], commandArgs.catalog.args[1]
+	default:
+		return fmt.Errorf("catalogCommand(): catalog diff expects at most two snapshots")
+	}
+
+	older, fromSnapshot, err := database.LoadSnapshot(dbLocalPath, from)
+	if err != nil {
+		return fmt.Errorf("catalogCommand(): %s", err.Error())
+	}
+
+	newer, toSnapshot, err := database.LoadSnapshot(dbLocalPath, to)
+	if err != nil {
+		return fmt.Errorf("catalogCommand(): %s", err.Error())
+	}
+
+	diff := older.Diff(newer)
+	diff.From, diff.To = fromSnapshot.Name, toSnapshot.Name
+
+	if commandArgs.catalog.json {
+		diffJSON, err := json.MarshalIndent(diff, "", "   ")
+		if err != nil {
+			return fmt.Errorf("catalogCommand(): %s", err.Error())
+		}
+		fmt.Println(string(diffJSON))
+		return nil
+	}
+
+	fmt.Printf("%s -> %s: %d added, %d removed, %d changed\n", diff.From, diff.To, len(diff.Added), len(diff.Removed), len(diff.Changed))
+	if diff.Empty() {
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Code", "Change", "Field", "From", "To"})
+
+	for _, code := range sortedKeys(diff.Added) {
+		t.AppendRow(table.Row{code, "added", "Title", "", diff.Added[code]})
+	}
+	for _, code := range sortedKeys(diff.Removed) {
+		t.AppendRow(table.Row{code, "removed", "Title", diff.Removed[code], ""})
+	}
+	for _, change := range diff.Changed {
+		for _, field := range change.Changes {
+			t.AppendRow(table.Row{change.Code, "changed", field.Field, field.From, field.To})
+		}
+	}
+
+	t.SetStyle(table.StyleLight)
+	t.Render()
+
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parses a --active or --current option into filter. Returns false if arg is not one of them
+func parseFilter(arg string, filter *database.FreshnessFilter) bool {
+	switch arg {
+	case "--active":
+		filter.Active = true
+	case "--current":
+		filter.Current = true
+	default:
+		return false
 	}
+	return true
+}
 
-	return nil
+// parses the value following a --limit option at position i of args
+func parseLimit(args []string, i int) (int, error) {
+	if i+1 >= len(args) {
+		return 0, fmt.Errorf("Option --limit must be followed by the maximum number of results.")
+	}
 
+	limit, err := strconv.Atoi(args[i+1])
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("Option --limit expects a positive number, got %q.", args[i+1])
+	}
+
+	return limit, nil
 }
 
 // displays a table containing the data in the given serie, including max, min, average and period growth
@@ -416,8 +1429,8 @@ func showCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) {
 		return
 	}
 
-	for _, code := range commandArgs.show.codes {
-		s, err := series.Load(configuration, code)
+	for _, code := range expandReferences(commandArgs.show.codes) {
+		s, err := registry.Serie(context.Background(), code)
 		if err != nil {
 			fmt.Printf("Show: %s could not be loaded, skipping...\n", err.Error())
 			continue
@@ -434,14 +1447,15 @@ func compareCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct)
 		return
 	}
 
-	for i, code := range commandArgs.compare.codes {
+	for i, code := range expandReferences(commandArgs.compare.codes) {
 		fmt.Printf("term %d: %s\n", i, code)
 	}
 
 	return
 }
 
-// TODO plots the given serie codes in a single plot, or separatedly if so specified with "separate" command modifier
+// plotCommand plots the given serie codes in a single plot, or separatedly if so specified with "separate" command modifier.
+// The plots are shown with the configured viewer, or saved to a file if so specified with "save".
 func plotCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) {
 	if len(commandArgs.plot.codes) == 0 {
 		// nothing to plot if codes are not larger than 0!
@@ -449,6 +1463,8 @@ func plotCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) {
 		return
 	}
 
+	commandArgs.plot.codes = expandReferences(commandArgs.plot.codes)
+
 	// we are creating an array of EconSerie, the interface type and not directly an array of BDSICESeries
 	// Apparently, arrays of types that implement an interface cannot be passed as arguments to a function
 	// that takes an array of the implemented interface. plot.Plot() takes []series.EconSerie, so we could not
@@ -459,69 +1475,165 @@ func plotCommand(configuration *config.BDSICEConfig, commandArgs *argsStruct) {
 	//var seriesToPlot []series.EconSerie
 	var seriesToPlot []series.BDSICESerie
 
-	if commandArgs.plot.separate {
-		// we will plot each serie to a separate file
-		for _, code := range commandArgs.plot.codes {
-			serieToPlot, err := series.Load(configuration, code)
-			if err != nil {
-				fmt.Printf("Serie %s could not be loaded. It will not be plotted.\n", code)
-				continue
-			}
-			//tmpFile, err := plot.Plot(series.EconSerie(*(serieToPlot)))
-			tmpFile, err := plot.Plot(*(serieToPlot))
+	for i, code := range commandArgs.plot.codes {
+		serieToPlot, err := registry.Serie(context.Background(), code)
+		if err != nil {
+			fmt.Printf("Serie %s could not be loaded. It will not be plotted.\n", code)
+			continue
+		}
+		//seriesToPlot = append(seriesToPlot, series.EconSerie(*(serieToPlot)))
+		seriesToPlot = append(seriesToPlot, *(serieToPlot))
+		fmt.Printf("code %d: %s\n", i, code)
+	}
 
-			if err != nil {
-				fmt.Printf("plotCommand: an error ocurred while plotting: %s", err.Error())
-			}
+	if len(seriesToPlot) == 0 {
+		return
+	}
+
+	// joint plotting by default, each serie to a separate figure if so specified
+	figures := [][]series.BDSICESerie{seriesToPlot}
+	if commandArgs.plot.separate {
+		figures = nil
+		for _, serieToPlot := range seriesToPlot {
+			figures = append(figures, []series.BDSICESerie{serieToPlot})
+		}
+	}
 
-			cmd := exec.Command(configuration.PlotViewer, tmpFile)
+	options, err := plotOptions(configuration, &commandArgs.plot)
+	if err != nil {
+		fmt.Printf("plotCommand: %s\n", err.Error())
+		return
+	}
 
-			err = cmd.Start()
-			if err != nil {
-				fmt.Printf("plotCommand: an error ocurred while executing kitten: %s", err.Error())
+	if options.Normalize == "" {
+		for _, figure := range figures {
+			if groups := plot.UnitGroups(figure...); len(groups) > 2 {
+				fmt.Printf("The series are in %d different units and share an axis. Add --norm index or --norm zscore to compare them.\n", len(groups))
+				break
 			}
 		}
-	} else {
-		// joint plotting by default
-		for i, code := range commandArgs.plot.codes {
-			serieToPlot, err := series.Load(configuration, code)
-			if err != nil {
-				fmt.Printf("Serie %s could not be loaded. It will not be plotted.\n", code)
-				continue
-			}
-			//seriesToPlot = append(seriesToPlot, series.EconSerie(*(serieToPlot)))
-			seriesToPlot = append(seriesToPlot, *(serieToPlot))
-			fmt.Printf("code %d: %s\n", i, code)
+	}
+
+	if commandArgs.plot.save {
+		written, err := plot.Save(commandArgs.plot.filePath, options, figures...)
+		if err != nil {
+			fmt.Printf("plotCommand: an error ocurred while saving the plot: %s\n", err.Error())
 		}
 
-		if len(seriesToPlot) > 0 {
-			tmpFile, err := plot.Plot(seriesToPlot...)
-			if err != nil {
-				fmt.Printf("plotCommand: an error ocurred while plotting: %s", err.Error())
-			}
+		for _, filePath := range written {
+			fmt.Printf("Plot saved to %s\n", filePath)
+		}
+		return
+	}
+
+	for _, figure := range figures {
+		tmpFile, err := plot.Plot(options, figure...)
+		if err != nil {
+			fmt.Printf("plotCommand: an error ocurred while plotting: %s", err.Error())
+			continue
+		}
 
-			// cmd := exec.Command("kitty", "@ kitten icat", tmpFile)
-			//cmd := exec.Command("kitty", "+kitten icat", tmpFile)
-			cmd := exec.Command(configuration.PlotViewer, tmpFile)
+		// cmd := exec.Command("kitty", "@ kitten icat", tmpFile)
+		//cmd := exec.Command("kitty", "+kitten icat", tmpFile)
+		cmd := exec.Command(configuration.PlotViewer, tmpFile)
 
-			err = cmd.Start()
-			if err != nil {
-				fmt.Printf("plotCommand: an error ocurred while executing kitten: %s", err.Error())
-			}
+		err = cmd.Start()
+		if err != nil {
+			fmt.Printf("plotCommand: an error ocurred while executing kitten: %s", err.Error())
 		}
+	}
+}
 
-		// separate plots
-		return
+// returns the size, resolution and style of plots: those given to the plot command, those in
+// config.yml otherwise, and those of the style or the defaults of the plot package if neither are set
+func plotOptions(configuration *config.BDSICEConfig, plotArguments *plotArgs) (plot.Options, error) {
+	width, height, dpi := configuration.PlotWidth, configuration.PlotHeight, configuration.PlotDPI
+	styleName := configuration.PlotStyle
+
+	if plotArguments.width > 0 {
+		width, height = plotArguments.width, plotArguments.height
 	}
-	return
+	if plotArguments.dpi > 0 {
+		dpi = plotArguments.dpi
+	}
+	if plotArguments.style != "" {
+		styleName = plotArguments.style
+	}
+
+	styles, err := plot.LoadStyles()
+	if err != nil {
+		return plot.Options{}, err
+	}
+	style, err := styles.Style(styleName)
+	if err != nil {
+		return plot.Options{}, err
+	}
+
+	return plot.Options{
+		Width:     width,
+		Height:    height,
+		DPI:       dpi,
+		Normalize: plotArguments.norm,
+		Style:     style,
+	}, nil
+}
+
+// parses the modifier of a plot command at args[i], if it is one, into plotArguments and returns the
+// number of arguments it takes, or 0 if args[i] is not a modifier
+func parsePlotModifier(args []string, i int, plotArguments *plotArgs) (int, error) {
+	switch args[i] {
+	case "separate", "sep":
+		plotArguments.separate = true
+		return 1, nil
+	case "save":
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("Modifier save must be followed by the file to save the plot to.")
+		}
+		plotArguments.save = true
+		plotArguments.filePath = args[i+1]
+		return 2, nil
+	case "--size":
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("Option --size must be followed by the width and height in inches, as in 8x4.")
+		}
+		_, err := fmt.Sscanf(strings.ToLower(args[i+1]), "%gx%g", &plotArguments.width, &plotArguments.height)
+		if err != nil || plotArguments.width <= 0 || plotArguments.height <= 0 {
+			return 0, fmt.Errorf("Option --size expects the width and height in inches, as in 8x4, got %q.", args[i+1])
+		}
+		return 2, nil
+	case "--norm":
+		if i+1 >= len(args) || (args[i+1] != plot.NormalizeIndex && args[i+1] != plot.NormalizeZScore) {
+			return 0, fmt.Errorf("Option --norm must be followed by %s or %s.", plot.NormalizeIndex, plot.NormalizeZScore)
+		}
+		plotArguments.norm = args[i+1]
+		return 2, nil
+	case "--style":
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("Option --style must be followed by the name of a style of %s.", plot.StylesFileName)
+		}
+		plotArguments.style = args[i+1]
+		return 2, nil
+	case "--dpi":
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("Option --dpi must be followed by the dots per inch.")
+		}
+		dpi, err := strconv.Atoi(args[i+1])
+		if err != nil || dpi <= 0 {
+			return 0, fmt.Errorf("Option --dpi expects a positive number, got %q.", args[i+1])
+		}
+		plotArguments.dpi = dpi
+		return 2, nil
+	}
+
+	return 0, nil
 }
 
 // extracts a random serie code from the database and shows it
-func randomCommand(configuration *config.BDSICEConfig) error {
+func randomCommand(configuration *config.BDSICEConfig, filter database.FreshnessFilter) error {
 	rand.Seed(time.Now().UTC().UnixNano())
 	fmt.Println("Random serie")
 
-	db, err := database.LoadDatabase(configuration)
+	db, err := handle.Database()
 	if err != nil {
 		return fmt.Errorf("randomCommand(): %s", err.Error())
 	}
@@ -532,9 +1644,15 @@ func randomCommand(configuration *config.BDSICEConfig) error {
 			serieCodes = append(serieCodes, k)
 		}
 	*/
-	randomCode := db.Codes[rand.Int()%len(db.Series)]
+	codes := db.Filter(filter, db.Codes)
+	if len(codes) == 0 {
+		fmt.Println("No serie matches the given options")
+		return nil
+	}
+
+	randomCode := codes[rand.Int()%len(codes)]
 
-	s, err := series.Load(configuration, randomCode)
+	s, err := handle.Serie(randomCode)
 	if err != nil {
 		fmt.Printf("Show: %s could not be loaded, skipping...\n", err.Error())
 		return fmt.Errorf("randomCommand(): %s", err.Error())
@@ -553,6 +1671,10 @@ func main() {
 		log.Fatal(err)
 	}
 
+	handle = database.NewHandle(configuration, database.DefaultCacheSize)
+	sdmxStore = provider.NewLocal(configuration, provider.SDMXNamespace)
+	registry = provider.NewRegistry(provider.NewBDSICE(handle), provider.NewINE(configuration), sdmxStore)
+
 	/*
 		if len(os.Args) < 2 {
 			helpCommand(configuration)
@@ -578,8 +1700,27 @@ func main() {
 			compareActive  bool
 			plotActive     bool
 			randomActive   bool
+			convertActive  bool
+			checkActive    bool
+			rollbackActive bool
+			importActive   bool
+			exportActive   bool
+			syncActive     bool
+			providerActive bool
+			treeActive     bool
+			staleActive    bool
+			savedActive    bool
+			catalogActive  bool
 
 			forceDownload bool
+			listStates    bool
+			importPath    string
+			syncOnce      bool
+			refreshing    bool
+			removeJSON    bool
+			repair        bool
+			discontinued  bool
+			randomFilter  database.FreshnessFilter
 		)
 
 		for i := 1; i < len(os.Args); i++ {
@@ -677,10 +1818,181 @@ func main() {
 				}
 			} else if strings.EqualFold(os.Args[i], "random") || strings.EqualFold(os.Args[i], "r") {
 				randomActive = true
+				treeActive = false
+			} else if strings.EqualFold(os.Args[i], "saved") {
+				// the subcommand is taken right away, as "search" would otherwise start a search
+				savedActive = true
+				args.saved.active = true
+				if len(os.Args) > i+1 {
+					args.saved.subcommand = strings.ToLower(os.Args[i+1])
+					i++
+				}
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				treeActive = false
+			} else if strings.EqualFold(os.Args[i], "catalog") {
+				catalogActive = true
+				args.catalog.active = true
+				if len(os.Args) > i+1 {
+					args.catalog.subcommand = strings.ToLower(os.Args[i+1])
+					i++
+				}
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				treeActive = false
+				savedActive = false
+			} else if strings.EqualFold(os.Args[i], "stale") {
+				staleActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "--discontinued" {
+					discontinued = true
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "providers") {
+				providerActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "refresh" {
+					refreshing = true
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "sync") {
+				syncActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "--once" {
+					syncOnce = true
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "import") {
+				importActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 {
+					importPath = os.Args[i+1]
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "export") {
+				exportActive = true
+				args.export.active = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 {
+					args.export.filePath = os.Args[i+1]
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "rollback") {
+				rollbackActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "list" {
+					listStates = true
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "check") {
+				checkActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "--repair" {
+					repair = true
+					i++
+				}
+			} else if strings.EqualFold(os.Args[i], "tree") || strings.EqualFold(os.Args[i], "t") {
+				treeActive = true
+				args.tree.active = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+			} else if os.Args[i] == "--json-progress" {
+				jsonProgress = true
+			} else if strings.EqualFold(os.Args[i], "convert") {
+				convertActive = true
+
+				searchActive = false
+				infoActive = false
+				showActive = false
+				compareActive = false
+				plotActive = false
+				if len(os.Args) > i+1 && os.Args[i+1] == "remove" {
+					removeJSON = true
+					i++
+				}
 			} else {
-				if searchActive {
+				if searchActive && os.Args[i] == "--limit" {
+					limit, err := parseLimit(os.Args, i)
+					if err != nil {
+						fmt.Printf("%s\n", err.Error())
+						os.Exit(1)
+					}
+					args.search[len(args.search)-1].limit = limit
+					i++
+				} else if searchActive && os.Args[i] == "--expansions" {
+					args.search[len(args.search)-1].expansions = true
+				} else if searchActive && parseFilter(os.Args[i], &args.search[len(args.search)-1].filter) {
+					continue
+				} else if searchActive {
 					// then add argument to the last element of args.search
 					args.search[len(args.search)-1].terms = append(args.search[len(args.search)-1].terms, os.Args[i])
+				} else if catalogActive && os.Args[i] == "--json" {
+					args.catalog.json = true
+				} else if catalogActive && !infoActive && !showActive && !compareActive && !plotActive {
+					args.catalog.args = append(args.catalog.args, os.Args[i])
+				} else if bulletinActive && !infoActive && !showActive && !compareActive && !plotActive {
+					args.bulletin = append(args.bulletin, os.Args[i])
+				} else if exportActive && !infoActive && !showActive && !compareActive && !plotActive {
+					if os.Args[i] == "%" {
+						args.searchToExport = true
+					} else {
+						args.export.codes = append(args.export.codes, os.Args[i])
+					}
+				} else if savedActive && !infoActive && !showActive && !compareActive && !plotActive {
+					args.saved.args = append(args.saved.args, os.Args[i])
+				} else if treeActive && !infoActive && !showActive && !compareActive && !plotActive {
+					if !parseFilter(os.Args[i], &args.tree.filter) {
+						args.tree.path = append(args.tree.path, os.Args[i])
+					}
+				} else if randomActive && parseFilter(os.Args[i], &randomFilter) {
+					continue
 				} else if infoActive {
 					args.info.active = true
 					if os.Args[i] == "%" { // if % follows a plot command, infoCommand will be called upon the result from searches
@@ -706,10 +2018,11 @@ func main() {
 					args.plot.active = true
 					if os.Args[i] == "%" {
 						args.searchToPlot = true
-					} else if os.Args[i] == "separate" || os.Args[i] == "sep" {
-						args.plot.separate = true
-					} else if os.Args[i] == "save" {
-						args.plot.save = true
+					} else if taken, err := parsePlotModifier(os.Args, i, &args.plot); err != nil {
+						fmt.Printf("%s\n", err.Error())
+						os.Exit(1)
+					} else if taken > 0 {
+						i += taken - 1
 					} else {
 						args.plot.codes = append(args.plot.codes, os.Args[i])
 					}
@@ -740,14 +2053,78 @@ func main() {
 		}
 
 		if bulletinActive {
-			bulletinCommand(configuration)
+			err = bulletinCommand(configuration, args.bulletin)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if providerActive {
+			err = providersCommand(configuration, refreshing)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if syncActive {
+			err = syncCommand(configuration, syncOnce)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if importActive {
+			err = importCommand(configuration, importPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if rollbackActive {
+			err = rollbackCommand(configuration, listStates)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if convertActive {
+			convertCommand(configuration, removeJSON)
+		}
+
+		if checkActive && !checkCommand(configuration, repair) {
+			os.Exit(1)
 		}
 
 		if randomActive {
-			randomCommand(configuration)
+			randomCommand(configuration, randomFilter)
+		}
+
+		err = catalogCommand(configuration, &args)
+		if err != nil {
+			fmt.Printf("main: %s\n", err.Error())
+		}
+
+		if staleActive {
+			err = staleCommand(configuration, discontinued)
+			if err != nil {
+				fmt.Printf("main: %s\n", err.Error())
+			}
+		}
+
+		// results of searches, trees and saved searches run in this invocation, for saved watch %
+		var resultsStack = map[string]string{}
+
+		err = searchCommand(configuration, &args, resultsStack)
+		if err != nil {
+			fmt.Printf("main: %s\n", err.Error())
+		}
+
+		err = treeCommand(configuration, &args, resultsStack)
+		if err != nil {
+			fmt.Printf("main: %s\n", err.Error())
 		}
 
-		err = searchCommand(configuration, &args, nil)
+		err = savedCommand(configuration, &args, resultsStack)
 		if err != nil {
 			fmt.Printf("main: %s\n", err.Error())
 		}
@@ -757,6 +2134,11 @@ func main() {
 		compareCommand(configuration, &args)
 		plotCommand(configuration, &args)
 
+		err = exportCommand(configuration, &args)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 	} else {
 		// PROMPT MODE
 
@@ -794,8 +2176,55 @@ func main() {
 				downloadCommand(configuration, forceFlag)
 			case "update":
 				updateCommand(configuration)
-			case "bulletin":
-				bulletinCommand(configuration)
+			case "bulletin", "b":
+				err = bulletinCommand(configuration, commands[1:])
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "providers":
+				err := providersCommand(configuration, len(commands) > 1 && commands[1] == "refresh")
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "sync":
+				err := syncCommand(configuration, len(commands) > 1 && commands[1] == "--once")
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "import":
+				err := importCommand(configuration, strings.Join(commands[1:], " "))
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "export":
+				args.export.active = true
+				if len(commands) > 1 {
+					args.export.filePath = commands[1]
+				}
+
+				for i := 2; i < len(commands); i++ {
+					if commands[i] == "%" {
+						for k := range resultsStack {
+							args.export.codes = append(args.export.codes, k)
+						}
+					} else {
+						args.export.codes = append(args.export.codes, commands[i])
+					}
+				}
+
+				err := exportCommand(configuration, &args)
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "rollback":
+				err := rollbackCommand(configuration, len(commands) > 1 && commands[1] == "list")
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "check":
+				checkCommand(configuration, len(commands) > 1 && commands[1] == "--repair")
+			case "convert":
+				convertCommand(configuration, len(commands) > 1 && commands[1] == "remove")
 			case "info":
 				args.info.active = true
 				args.info.codes = commands[1:]
@@ -804,8 +2233,29 @@ func main() {
 			case "search":
 				args.search = append(args.search, searchArgs{})
 
-				for _, command := range commands[1:] { // : len(commands)-1] {
-					args.search[0].terms = append(args.search[0].terms, command)
+				for i := 1; i < len(commands); i++ {
+					if commands[i] == "--limit" {
+						limit, err := parseLimit(commands, i)
+						if err != nil {
+							fmt.Printf("%s\n", err.Error())
+							args.search = nil
+							break
+						}
+						args.search[0].limit = limit
+						i++
+						continue
+					} else if commands[i] == "--expansions" {
+						args.search[0].expansions = true
+						continue
+					} else if parseFilter(commands[i], &args.search[0].filter) {
+						continue
+					}
+					args.search[0].terms = append(args.search[0].terms, commands[i])
+				}
+
+				// a search with invalid options is not run
+				if args.search == nil {
+					break
 				}
 
 				// fmt.Printf("Search command: %v\n", args.search[0].terms)
@@ -815,6 +2265,18 @@ func main() {
 					fmt.Printf("main: %s\n", err.Error())
 				}
 
+			case "tree":
+				args.tree.active = true
+				for _, command := range commands[1:] {
+					if !parseFilter(command, &args.tree.filter) {
+						args.tree.path = append(args.tree.path, command)
+					}
+				}
+
+				err = treeCommand(configuration, &args, resultsStack)
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
 			case "show":
 				args.show.active = true
 
@@ -839,15 +2301,19 @@ func main() {
 			case "plot":
 				args.plot.active = true
 
-				for _, command := range commands[1:] { // : len(commands)-1] {
-					if command == "sep" {
-						args.plot.separate = true
-					} else if command == "%" {
+				for i := 1; i < len(commands); i++ {
+					if commands[i] == "%" {
 						for k, _ := range resultsStack {
 							args.plot.codes = append(args.plot.codes, k)
 						}
+					} else if taken, err := parsePlotModifier(commands, i, &args.plot); err != nil {
+						fmt.Printf("%s\n", err.Error())
+						args.plot.codes = nil
+						break
+					} else if taken > 0 {
+						i += taken - 1
 					} else {
-						args.plot.codes = append(args.plot.codes, command)
+						args.plot.codes = append(args.plot.codes, commands[i])
 					}
 				}
 
@@ -856,7 +2322,45 @@ func main() {
 				plotCommand(configuration, &args)
 			case "random":
 				fmt.Printf("Random command: %s\n", commands[0])
-				randomCommand(configuration)
+				var filter database.FreshnessFilter
+				for _, command := range commands[1:] {
+					parseFilter(command, &filter)
+				}
+				randomCommand(configuration, filter)
+			case "saved":
+				args.saved.active = true
+				if len(commands) > 1 {
+					args.saved.subcommand = strings.ToLower(commands[1])
+				}
+				if len(commands) > 2 {
+					args.saved.args = commands[2:]
+				}
+
+				err = savedCommand(configuration, &args, resultsStack)
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "catalog":
+				args.catalog.active = true
+				for i, command := range commands[1:] {
+					if i == 0 {
+						args.catalog.subcommand = strings.ToLower(command)
+					} else if command == "--json" {
+						args.catalog.json = true
+					} else {
+						args.catalog.args = append(args.catalog.args, command)
+					}
+				}
+
+				err = catalogCommand(configuration, &args)
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
+			case "stale":
+				err = staleCommand(configuration, len(commands) > 1 && commands[1] == "--discontinued")
+				if err != nil {
+					fmt.Printf("main: %s\n", err.Error())
+				}
 			}
 
 			if quitFlag {
@@ -0,0 +1,221 @@
+// package daemon keeps the database up to date in the background: it checks for updates on a
+// schedule, applies them as Update does, logs what changed as JSON lines and runs the hooks
+// configured after every update.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/download"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+)
+
+// what a record of the log tells
+const (
+	KindStart = "start" // sync started, with its schedule
+	KindSync  = "sync"  // updates were checked for
+	KindHook  = "hook"  // a hook was run after an update
+	KindStop  = "stop"  // sync stopped
+)
+
+// outcomes of checking for updates
+const (
+	ResultUpdated  = "updated"  // updates were applied
+	ResultUpToDate = "uptodate" // there was nothing to apply
+	ResultGap      = "gap"      // updates were missed, and only a full download can recover them
+	ResultError    = "error"    // the updates could not be applied, and are checked for again next time
+	ResultCanceled = "canceled" // sync was stopped while applying updates, which were discarded
+)
+
+// Record is a line of the log of sync
+type Record struct {
+	Time     time.Time  `json:"Time"`
+	Kind     string     `json:"Kind"`
+	Result   string     `json:"Result,omitempty"`
+	Updates  []string   `json:"Updates,omitempty"` // dates of the updates applied
+	Series   []string   `json:"Series,omitempty"`  // codes of the series they held
+	Hook     string     `json:"Hook,omitempty"`
+	Output   string     `json:"Output,omitempty"` // what the hook printed
+	Error    string     `json:"Error,omitempty"`
+	Schedule string     `json:"Schedule,omitempty"`
+	Next     *time.Time `json:"Next,omitempty"` // when updates are checked for next
+}
+
+// Daemon checks for updates and applies them on its schedule
+type Daemon struct {
+	Configuration *config.BDSICEConfig
+	Schedule      Schedule
+	Hooks         []string  // shell commands run after updates are applied
+	Log           io.Writer // records are written to it as JSON lines
+
+	mu sync.Mutex
+}
+
+// New returns a Daemon with the schedule and hooks of configuration, logging to log
+func New(configuration *config.BDSICEConfig, log io.Writer) (*Daemon, error) {
+	interval := configuration.SyncInterval
+	if interval == "" {
+		interval = config.DefaultSyncInterval
+	}
+
+	schedule, err := ParseSchedule(interval, configuration.SyncTimes)
+	if err != nil {
+		return nil, fmt.Errorf("daemon.New(): %w", err)
+	}
+
+	return &Daemon{Configuration: configuration, Schedule: schedule, Hooks: configuration.SyncHooks, Log: log}, nil
+}
+
+// LogPath returns the file sync logs to: synclog, or sync.log in the data path
+func LogPath(configuration *config.BDSICEConfig) string {
+	if configuration.SyncLog != "" {
+		return configuration.SyncLog
+	}
+	return filepath.Join(configuration.DataLocalPath, config.DefaultSyncLogFileName)
+}
+
+// Run checks for updates right away and then on the schedule, until ctx is done. Updates being
+// applied when ctx is done are discarded, leaving the database as it was.
+func (d *Daemon) Run(ctx context.Context) error {
+	d.write(Record{Time: time.Now(), Kind: KindStart, Schedule: d.Schedule.String()})
+
+	for {
+		record := d.check(ctx)
+
+		if record.Result == ResultCanceled {
+			d.write(record)
+			break
+		}
+
+		next := d.Schedule.Next(time.Now())
+		record.Next = &next
+		d.write(record)
+		d.runHooks(ctx, record)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	d.write(Record{Time: time.Now(), Kind: KindStop})
+
+	return nil
+}
+
+// Sync checks for updates once, applies them and runs the hooks, and returns the record logged
+func (d *Daemon) Sync(ctx context.Context) Record {
+	record := d.check(ctx)
+	d.write(record)
+	d.runHooks(ctx, record)
+	return record
+}
+
+// checks for updates and applies them
+func (d *Daemon) check(ctx context.Context) Record {
+	started := time.Now()
+	record := Record{Time: started, Kind: KindSync}
+
+	seriesDecoded, err := download.Update(ctx, d.Configuration, false)
+
+	var gap *download.GapError
+	switch {
+	case errors.Is(err, download.ErrAlreadyUpToDate):
+		record.Result = ResultUpToDate
+		return record
+	case errors.As(err, &gap):
+		record.Result = ResultGap
+		record.Error = gap.Error()
+		return record
+	case errors.Is(err, context.Canceled):
+		record.Result = ResultCanceled
+		return record
+	case err != nil:
+		record.Result = ResultError
+		record.Error = err.Error()
+		return record
+	}
+
+	record.Result = ResultUpdated
+	for _, serie := range seriesDecoded {
+		record.Series = append(record.Series, serie.SerieCode)
+	}
+
+	// the updates applied are the ones recorded in the ledger since the check started
+	ledger, err := download.LoadLedger(d.Configuration.DatabaseLocalPath)
+	if err == nil {
+		for _, entry := range ledger.Updates {
+			if !entry.Applied.Before(started) {
+				record.Updates = append(record.Updates, entry.Date.Format("2006-01-02"))
+			}
+		}
+	}
+
+	record.Time = time.Now()
+	return record
+}
+
+// runs the hooks after updates have been applied, as told by applied, and logs their outcome
+func (d *Daemon) runHooks(ctx context.Context, applied Record) {
+	if applied.Result != ResultUpdated {
+		return
+	}
+
+	for _, hook := range d.Hooks {
+		d.write(d.runHook(ctx, hook, applied))
+	}
+}
+
+// runs hook with the updates applied and the series they held in its environment
+func (d *Daemon) runHook(ctx context.Context, hook string, applied Record) Record {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"BDSICEGO_UPDATES="+strings.Join(applied.Updates, ","),
+		"BDSICEGO_SERIES="+strings.Join(applied.Series, ","),
+		"BDSICEGO_DATABASE="+d.Configuration.DatabaseLocalPath,
+	)
+
+	output, err := cmd.CombinedOutput()
+
+	record := Record{Time: time.Now(), Kind: KindHook, Hook: hook, Output: strings.TrimSpace(string(output))}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record
+}
+
+// writes record to the log as a line of JSON
+func (d *Daemon) write(record Record) {
+	if d.Log == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	json.NewEncoder(d.Log).Encode(record)
+}
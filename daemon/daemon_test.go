@@ -0,0 +1,178 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/download"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/emulator"
+)
+
+// returns a configuration pointing to an emulator of the BDSICE website, with the full database
+// downloaded already
+func downloadedConfiguration(t *testing.T) *config.BDSICEConfig {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	_, err := download.DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	return configuration
+}
+
+// returns the records written to log
+func records(t *testing.T, log *bytes.Buffer) []Record {
+	var logged []Record
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%q is not a record: %s", scanner.Text(), err.Error())
+		}
+		logged = append(logged, record)
+	}
+	return logged
+}
+
+func TestSync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a POSIX shell command")
+	}
+
+	configuration := downloadedConfiguration(t)
+
+	hookOutput := filepath.Join(configuration.DataLocalPath, "hook.txt")
+	configuration.SyncHooks = []string{
+		`echo "$BDSICEGO_UPDATES $BDSICEGO_SERIES" > ` + hookOutput,
+		"echo failing; exit 3",
+	}
+
+	var log bytes.Buffer
+	d, err := New(configuration, &log)
+	if err != nil {
+		t.Fatalf("New(): %s", err.Error())
+	}
+
+	record := d.Sync(context.Background())
+	if record.Result != ResultUpdated || len(record.Updates) != 1 || len(record.Series) != 2 {
+		t.Errorf("Sync(): unexpected record %+v", record)
+	}
+
+	content, err := ioutil.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatalf("Sync(): the hook was not run: %s", err.Error())
+	}
+	if fields := strings.Fields(string(content)); len(fields) != 2 || fields[0] != strings.Join(record.Updates, ",") {
+		t.Errorf("Sync(): the hook was not given the updates applied: %q", string(content))
+	}
+
+	logged := records(t, &log)
+	if len(logged) != 3 || logged[0].Kind != KindSync || logged[1].Kind != KindHook || logged[1].Error != "" {
+		t.Fatalf("Sync(): unexpected log %+v", logged)
+	}
+	if logged[2].Output != "failing" || logged[2].Error == "" {
+		t.Errorf("Sync(): the failing hook was not logged as such: %+v", logged[2])
+	}
+
+	// hooks only run after updates
+	if record := d.Sync(context.Background()); record.Result != ResultUpToDate {
+		t.Errorf("Sync(): expected the database to be up to date, got %+v", record)
+	}
+	if logged := records(t, &log); len(logged) != 1 {
+		t.Errorf("Sync(): unexpected log %+v", logged)
+	}
+}
+
+// cancels the context of Run once a sync record has been logged
+type cancelingLog struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (c *cancelingLog) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), `"Kind":"sync"`) {
+		defer c.cancel()
+	}
+	return c.Buffer.Write(p)
+}
+
+func TestRun(t *testing.T) {
+	configuration := downloadedConfiguration(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := &cancelingLog{cancel: cancel}
+	d, err := New(configuration, log)
+	if err != nil {
+		t.Fatalf("New(): %s", err.Error())
+	}
+	d.Schedule = Interval(time.Hour)
+
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run(): %s", err.Error())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Run(): did not stop once its context was canceled")
+	}
+
+	logged := records(t, &log.Buffer)
+	if len(logged) != 3 || logged[0].Kind != KindStart || logged[0].Schedule != "every 1h0m0s" || logged[2].Kind != KindStop {
+		t.Fatalf("Run(): unexpected log %+v", logged)
+	}
+
+	if logged[1].Result != ResultUpdated || logged[1].Next == nil || logged[1].Next.Sub(logged[1].Time) < 59*time.Minute {
+		t.Errorf("Run(): unexpected sync record %+v", logged[1])
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("", []string{"18:00", "09:30"})
+	if err != nil {
+		t.Fatalf("ParseSchedule(): %s", err.Error())
+	}
+
+	morning := time.Date(2026, time.October, 19, 8, 0, 0, 0, time.Local)
+	if next := schedule.Next(morning); !next.Equal(time.Date(2026, time.October, 19, 9, 30, 0, 0, time.Local)) {
+		t.Errorf("Daily.Next(): expected 09:30 of the same day, got %s", next)
+	}
+
+	if next := schedule.Next(time.Date(2026, time.October, 19, 9, 30, 0, 0, time.Local)); next.Hour() != 18 {
+		t.Errorf("Daily.Next(): expected 18:00 after 09:30, got %s", next)
+	}
+
+	night := time.Date(2026, time.October, 19, 20, 0, 0, 0, time.Local)
+	if next := schedule.Next(night); !next.Equal(time.Date(2026, time.October, 20, 9, 30, 0, 0, time.Local)) {
+		t.Errorf("Daily.Next(): expected 09:30 of the next day, got %s", next)
+	}
+
+	schedule, err = ParseSchedule("6h", nil)
+	if err != nil || schedule.Next(morning) != morning.Add(6*time.Hour) {
+		t.Errorf("ParseSchedule(): unexpected interval schedule %v, %v", schedule, err)
+	}
+
+	for _, invalid := range [][]string{{"25:00"}, {"9.30"}} {
+		if _, err := ParseSchedule("", invalid); err == nil {
+			t.Errorf("ParseSchedule(): expected an error for %q", invalid)
+		}
+	}
+
+	if _, err := ParseSchedule("1s", nil); err == nil {
+		t.Errorf("ParseSchedule(): expected an error for an interval shorter than a minute")
+	}
+}
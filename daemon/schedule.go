@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schedule tells when sync checks for updates next
+type Schedule interface {
+	// Next returns the first time after after when updates are checked
+	Next(after time.Time) time.Time
+	String() string
+}
+
+// Interval checks for updates at a fixed interval
+type Interval time.Duration
+
+// Next returns after plus the interval
+func (i Interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+func (i Interval) String() string {
+	return "every " + time.Duration(i).String()
+}
+
+// a time of the day, in local time
+type clock struct {
+	hour   int
+	minute int
+}
+
+// Daily checks for updates every day at the same times of the day, in local time
+type Daily []clock
+
+// Next returns the first of the times of the day after after, today or tomorrow
+func (d Daily) Next(after time.Time) time.Time {
+	for days := 0; days <= 1; days++ {
+		y, m, day := after.AddDate(0, 0, days).Date()
+		for _, c := range d {
+			t := time.Date(y, m, day, c.hour, c.minute, 0, 0, after.Location())
+			if t.After(after) {
+				return t
+			}
+		}
+	}
+
+	// only reached without any time of the day
+	return after.Add(24 * time.Hour)
+}
+
+func (d Daily) String() string {
+	var times []string
+	for _, c := range d {
+		times = append(times, fmt.Sprintf("%02d:%02d", c.hour, c.minute))
+	}
+	return "daily at " + strings.Join(times, ", ")
+}
+
+// ParseSchedule returns the schedule given by times, such as ["09:30", "18:00"], or by interval,
+// such as "6h", if there are no times
+func ParseSchedule(interval string, times []string) (Schedule, error) {
+	if len(times) > 0 {
+		var daily Daily
+		for _, t := range times {
+			parsed, err := time.Parse("15:04", strings.TrimSpace(t))
+			if err != nil {
+				return nil, fmt.Errorf("daemon.ParseSchedule(): %q is not a time of the day such as 09:30", t)
+			}
+			daily = append(daily, clock{hour: parsed.Hour(), minute: parsed.Minute()})
+		}
+
+		sort.Slice(daily, func(i, j int) bool {
+			return daily[i].hour*60+daily[i].minute < daily[j].hour*60+daily[j].minute
+		})
+		return daily, nil
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("daemon.ParseSchedule(): %q is not an interval such as 6h: %s", interval, err.Error())
+	}
+	if duration < time.Minute {
+		return nil, fmt.Errorf("daemon.ParseSchedule(): the interval %s is shorter than a minute", duration)
+	}
+
+	return Interval(duration), nil
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/decode"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// CheckReport lists the inconsistencies found by Check between the catalog, the decoded series
+// and the .xer files in the database path
+type CheckReport struct {
+	MissingCatalog bool     // db.json does not exist or cannot be read
+	Undecoded      []string // .xer files whose serie has not been decoded
+	Stale          []string // .xer files newer than their decoded serie
+	Unlisted       []string // decoded series missing from the catalog
+	Orphaned       []string // catalog entries whose serie has neither decoded data nor a .xer file
+	TempFiles      []string // temporary files left behind by interrupted writes
+}
+
+// Problems returns the number of problems in the report
+func (r *CheckReport) Problems() int {
+	problems := len(r.Undecoded) + len(r.Stale) + len(r.Unlisted) + len(r.Orphaned) + len(r.TempFiles)
+	if r.MissingCatalog {
+		problems++
+	}
+	return problems
+}
+
+// String returns a summary of the report
+func (r *CheckReport) String() string {
+	var b strings.Builder
+
+	if r.MissingCatalog {
+		fmt.Fprintf(&b, "Catalog %s is missing or unreadable\n", CatalogFileName)
+	}
+	fmt.Fprintf(&b, "Undecoded .xer files: %d\n", len(r.Undecoded))
+	fmt.Fprintf(&b, "Series older than their .xer file: %d\n", len(r.Stale))
+	fmt.Fprintf(&b, "Series missing from the catalog: %d\n", len(r.Unlisted))
+	fmt.Fprintf(&b, "Catalog entries without data: %d\n", len(r.Orphaned))
+	fmt.Fprintf(&b, "Temporary files: %d\n", len(r.TempFiles))
+
+	return b.String()
+}
+
+// what is known about a serie from the files in the database path
+type serieFiles struct {
+	xer     time.Time // modification time of the .xer file, zero if there is none
+	decoded time.Time // time at which the serie was decoded, zero if it was not
+}
+
+// Check compares the catalog with the .xer files, the series store and the JSON series left by
+// former versions in the database path. It does not modify anything; see Repair.
+func Check(configuration *config.BDSICEConfig) (*CheckReport, error) {
+	var report CheckReport
+
+	dbLocalPath := configuration.DatabaseLocalPath
+
+	files, err := inventory(dbLocalPath, &report)
+	if err != nil {
+		return nil, fmt.Errorf("database.Check(): %s", err.Error())
+	}
+
+	// a catalog that cannot be read is an error rather than a missing one, which Repair would
+	// overwrite
+	db := &BDSICEDatabase{}
+	if _, err := os.Stat(filepath.Join(dbLocalPath, CatalogFileName)); os.IsNotExist(err) {
+		report.MissingCatalog = true
+	} else {
+		db, err = LoadDatabase(configuration)
+		if err != nil {
+			return nil, fmt.Errorf("database.Check(): %s", err.Error())
+		}
+	}
+
+	for code, f := range files {
+		switch {
+		case !f.xer.IsZero() && f.decoded.IsZero():
+			report.Undecoded = append(report.Undecoded, code)
+		case !f.xer.IsZero() && f.xer.After(f.decoded):
+			report.Stale = append(report.Stale, code)
+		}
+
+		if _, ok := db.Series[code]; !ok && !f.decoded.IsZero() && !report.MissingCatalog {
+			report.Unlisted = append(report.Unlisted, code)
+		}
+	}
+
+	for code := range db.Series {
+		if _, ok := files[code]; !ok {
+			report.Orphaned = append(report.Orphaned, code)
+		}
+	}
+
+	sort.Strings(report.Undecoded)
+	sort.Strings(report.Stale)
+	sort.Strings(report.Unlisted)
+	sort.Strings(report.Orphaned)
+
+	return &report, nil
+}
+
+// JSON files in the database path that hold something other than a serie: the catalog, and the
+// tree, ledger and download manifest written by packages tree and download
+var metadataFiles = map[string]bool{
+	CatalogFileName:         true,
+	config.TreeFileName:     true,
+	config.LedgerFileName:   true,
+	config.ManifestFileName: true,
+}
+
+// lists the series with data in dbLocalPath and adds the temporary files found to the report
+func inventory(dbLocalPath string, report *CheckReport) (map[string]*serieFiles, error) {
+	files := make(map[string]*serieFiles)
+
+	get := func(code string) *serieFiles {
+		if files[code] == nil {
+			files[code] = &serieFiles{}
+		}
+		return files[code]
+	}
+
+	entries, err := ioutil.ReadDir(dbLocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		switch {
+		case strings.Contains(name, ".tmp"):
+			report.TempFiles = append(report.TempFiles, name)
+		case filepath.Ext(name) == ".xer":
+			get(strings.TrimSuffix(name, ".xer")).xer = entry.ModTime()
+		case filepath.Ext(name) == ".json" && !metadataFiles[name]:
+			// JSON series of databases that have not been converted to the series store
+			get(strings.TrimSuffix(name, ".json")).decoded = entry.ModTime()
+		}
+	}
+
+	storeFilePath := filepath.Join(dbLocalPath, series.StoreFileName)
+	if _, err := os.Stat(storeFilePath); err == nil {
+		st, err := series.OpenStore(storeFilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer st.Close()
+
+		for _, code := range st.Codes() {
+			modified, _ := st.Modified(code)
+			if f := get(code); modified.After(f.decoded) {
+				f.decoded = modified
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// Repair fixes the problems found by Check: it decodes the .xer files that are undecoded or newer
+// than their decoded serie into the series store, adds the missing entries to the catalog, removes
+// the entries without data and deletes temporary files. A missing catalog is rebuilt from the store.
+func Repair(configuration *config.BDSICEConfig, report *CheckReport) error {
+	dbLocalPath := configuration.DatabaseLocalPath
+	storeFilePath := filepath.Join(dbLocalPath, series.StoreFileName)
+
+	for _, name := range report.TempFiles {
+		if err := os.Remove(filepath.Join(dbLocalPath, name)); err != nil {
+			return fmt.Errorf("database.Repair(): %s", err.Error())
+		}
+	}
+
+	var decoded []*series.BDSICESerie
+	for _, code := range append(append([]string{}, report.Undecoded...), report.Stale...) {
+		serie, err := decode.Decode(dbLocalPath, code+".xer")
+		if err != nil {
+			return fmt.Errorf("database.Repair(): %s", err.Error())
+		}
+		decoded = append(decoded, serie)
+	}
+
+	if len(decoded) > 0 {
+		if err := series.UpdateStore(storeFilePath, decoded); err != nil {
+			return fmt.Errorf("database.Repair(): %s", err.Error())
+		}
+	}
+
+	db, err := LoadDatabase(configuration)
+	if err != nil {
+		db, err = BuildDatabase(nil)
+		if err != nil {
+			return fmt.Errorf("database.Repair(): %s", err.Error())
+		}
+	}
+
+	// series known to the store or to legacy JSON files that the catalog should list
+	toList := decoded
+	for _, code := range report.Unlisted {
+		serie, err := series.Load(configuration, code)
+		if err != nil {
+			return fmt.Errorf("database.Repair(): %s", err.Error())
+		}
+		toList = append(toList, serie)
+	}
+
+	files, err := inventory(dbLocalPath, &CheckReport{})
+	if err != nil {
+		return fmt.Errorf("database.Repair(): %s", err.Error())
+	}
+
+	if report.MissingCatalog {
+		inStore := make(map[string]bool)
+
+		if _, err := os.Stat(storeFilePath); err == nil {
+			all, err := series.LoadAll(configuration)
+			if err != nil {
+				return fmt.Errorf("database.Repair(): %s", err.Error())
+			}
+			for _, serie := range all {
+				inStore[serie.SerieCode] = true
+			}
+			toList = append(toList, all...)
+		}
+
+		// series of databases that have not been converted to the store
+		for code, f := range files {
+			if f.decoded.IsZero() || inStore[code] {
+				continue
+			}
+			serie, err := series.Load(configuration, code)
+			if err != nil {
+				return fmt.Errorf("database.Repair(): %s", err.Error())
+			}
+			toList = append(toList, serie)
+		}
+	}
+
+	available := make([]string, 0, len(files))
+	for code := range files {
+		available = append(available, code)
+	}
+
+	db.Merge(toList, available)
+
+	err = db.Save(dbLocalPath)
+	if err != nil {
+		return fmt.Errorf("database.Repair(): %s", err.Error())
+	}
+
+	return nil
+}
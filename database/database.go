@@ -14,12 +14,10 @@ import (
 	"io/ioutil"
 	"path"
 	"strings"
+	"sync"
 
 	//	"fmt"
 	"time"
-
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
 )
 
 // checks for unicode separator characters. Used by searchCommand to normalise search terms.
@@ -27,11 +25,35 @@ func isMn(r rune) bool {
 	return unicode.Is(unicode.Mn, r)
 }
 
+// metadata of a serie kept in the catalog, so that changes can be detected without loading the serie
+type CatalogEntry struct {
+	Title                string     `json:"Title"`
+	Units                string     `json:"Units"`
+	Source               string     `json:"Source"`
+	Frequency            int        `json:"Frequency"`
+	Start                *time.Time `json:"Start"`
+	End                  *time.Time `json:"End"`
+	NumberOfObservations int        `json:"NumberOfObservations"`
+	Active               bool       `json:"Active"`
+}
+
 type BDSICEDatabase struct {
-	Series       map[string]string `json:"Series"` // code: title
-	LastUpdate   time.Time         `json:"LastUpdate"`
-	DatabasePath string            `json:"Path"`
-	Codes        []string          `json:"Codes"`
+	Series       map[string]string       `json:"Series"` // code: title
+	Entries      map[string]CatalogEntry `json:"Entries"`
+	LastUpdate   time.Time               `json:"LastUpdate"`
+	DatabasePath string                  `json:"Path"`
+	Codes        []string                `json:"Codes"`
+
+	// synonyms and abbreviations used to expand search terms. Not stored in db.json, and loaded
+	// on the first search if nil, so that an invalid synonyms.yml only fails searches
+	Dictionary Dictionary `json:"-"`
+
+	index     *searchIndex // built on the first call to Rank
+	indexOnce sync.Once
+
+	compiledDictionary map[string][]compiledMember // members of Dictionary, compiled along with it
+	dictionaryErr      error
+	dictionaryOnce     sync.Once
 }
 
 // returns the series that contain all of the terms either in the title or in the serie code
@@ -64,53 +86,19 @@ func (db *BDSICEDatabase) Match(terms ...string) map[string]string { // []*BDSIC
 }
 
 // returns the series that contain all the terms either in the title or the serie code, and excludes all the series that contain the terms prefixed by "-" either in the title or the serie code.
+// It is a convenience wrapper around Rank for callers that do not care about the order of the results.
 func (db *BDSICEDatabase) Search(terms ...string) (map[string]string, error) {
 
-	var (
-		matchTerms   []string // terms that we will match the database against
-		excludeTerms []string // terms that are prefixed by "-": series that contain them in title or code will be excluded from results
-		cleanTerms   []string
-	)
-
-	transformChain := transform.Chain(norm.NFD, transform.RemoveFunc(isMn), norm.NFC)
-
-	for _, term := range terms {
-		termNormalized, _, err := transform.String(transformChain, term)
-		if err != nil {
-			return nil, fmt.Errorf("database.Search(): %s", err.Error())
-		}
-
-		//		termNormalizedUpper := strings.ToUpper(termNormalized)
-
-		//		cleanTerms = append(cleanTerms, termNormalizedUpper)
-
-		cleanTerms = append(cleanTerms, termNormalized)
+	rankedResults, err := db.Rank(SearchOptions{}, terms...)
+	if err != nil {
+		return nil, fmt.Errorf("database.Search(): %s", err.Error())
 	}
 
-	//fmt.Printf("cleanTerms: %s\n", cleanTerms)
-
-	for _, term := range cleanTerms {
-		if strings.HasPrefix(term, "-") {
-			excludeTerms = append(excludeTerms, term[1:])
-		} else {
-			matchTerms = append(matchTerms, term)
-		}
+	matchResults := make(map[string]string, len(rankedResults))
+	for _, result := range rankedResults {
+		matchResults[result.Code] = result.Title
 	}
 
-	matchResults := db.Match(matchTerms...)
-
-	if len(excludeTerms) > 0 {
-
-		fmt.Printf("Terms to exclude: %s\n", excludeTerms)
-		for _, termToExclude := range excludeTerms {
-			for code, title := range matchResults {
-				if strings.Contains(code, termToExclude) || strings.Contains(title, strings.ToUpper(termToExclude)) {
-					delete(matchResults, code)
-				}
-			}
-		}
-
-	}
 	return matchResults, nil
 
 }
@@ -128,6 +116,15 @@ func (db *BDSICEDatabase) AddSerie(serie *series.BDSICESerie) error {
 
 	db.Series[serie.SerieCode] = serie.Title
 
+	if db.Entries == nil {
+		db.Entries = make(map[string]CatalogEntry)
+	}
+	db.Entries[serie.SerieCode] = newCatalogEntry(serie)
+
+	// the search index no longer matches the catalog and will be rebuilt on the next search
+	db.index = nil
+	db.indexOnce = sync.Once{}
+
 	return nil
 
 }
@@ -140,6 +137,20 @@ func (d *BDSICEDatabase) Load(codes ...string) ([]*series.EconSerie, error) {
 }
 */
 
+// returns the catalog entry of a serie
+func newCatalogEntry(serie *series.BDSICESerie) CatalogEntry {
+	return CatalogEntry{
+		Title:                serie.Title,
+		Units:                serie.Units,
+		Source:               serie.Source,
+		Frequency:            serie.Frequency,
+		Start:                serie.Start,
+		End:                  serie.End,
+		NumberOfObservations: serie.NumberOfObservations,
+		Active:               serie.Active,
+	}
+}
+
 // returns a string slice containing a list of all the codes in the database
 func (db *BDSICEDatabase) GetCodes() []string {
 	return db.Codes
@@ -153,6 +164,7 @@ func BuildDatabase(seriesToBuild []*series.BDSICESerie) (*BDSICEDatabase, error)
 	var db BDSICEDatabase
 
 	db.Series = make(map[string]string)
+	db.Entries = make(map[string]CatalogEntry)
 	db.Codes = make([]string, 0, len(seriesToBuild))
 
 	// fmt.Println("Building database...")
@@ -179,13 +191,13 @@ func BuildDatabase(seriesToBuild []*series.BDSICESerie) (*BDSICEDatabase, error)
 func LoadDatabase(configuration *config.BDSICEConfig) (*BDSICEDatabase, error) {
 	var db BDSICEDatabase
 	db.Series = make(map[string]string)
-	dbJsonFilePath := path.Join(configuration.DatabaseLocalPath, "db.json")
+	dbJsonFilePath := path.Join(configuration.DatabaseLocalPath, CatalogFileName)
 
 	// fmt.Printf("Loading db from %s\n", dbJsonFilePath)
 
 	dbFileReader, err := ioutil.ReadFile(dbJsonFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("database.LoadDatabase(): %s", err.Error())
+		return nil, fmt.Errorf("database.LoadDatabase(): %w", err)
 	}
 
 	err = json.Unmarshal([]byte(dbFileReader), &db)
@@ -1,17 +1,23 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fabiansalazares/bdsicego/decode"
+	"github.com/fabiansalazares/bdsicego/internal/config"
 	"github.com/fabiansalazares/bdsicego/series"
-	"io/ioutil"
 )
 
 func TestBuild(t *testing.T) {
@@ -94,6 +100,555 @@ func TestLoadDatabase(t *testing.T) {
 	}
 }
 
+// builds a small in-memory database from the given code: title pairs
+func testDatabase(t *testing.T, titles map[string]string) *BDSICEDatabase {
+	var seriesToBuild []*series.BDSICESerie
+	for code, title := range titles {
+		seriesToBuild = append(seriesToBuild, &series.BDSICESerie{SerieCode: code, Title: title})
+	}
+
+	db, err := BuildDatabase(seriesToBuild)
+	if err != nil {
+		t.Fatalf("BuildDatabase(): %s", err.Error())
+	}
+
+	// built catalogs load the user's synonyms.yml on their first search, which tests must not depend on
+	if db.Dictionary != nil {
+		t.Errorf("BuildDatabase(): expected the dictionary to be left to load on the first search")
+	}
+	db.Dictionary = DefaultDictionary.Merge(nil)
+
+	return db
+}
+
+func TestRank(t *testing.T) {
+	db := testDatabase(t, map[string]string{
+		"100001": "EPA. OCUPADOS. TOTAL NACIONAL",
+		"100002": "EPA. OCUPADOS. AVILA",
+		"100003": "EPA. PARADOS. TOTAL NACIONAL",
+		"100004": "PARO REGISTRADO. DESEMPLEO. TOTAL NACIONAL",
+		"100005": "PRECIO PETROLEO BRENT",
+		"100006": "EPA. OCUPADOS. OCUPADOS A TIEMPO PARCIAL",
+	})
+
+	cases := []struct {
+		terms []string
+		codes []string
+	}{
+		// stemming: singular and plural forms match the same titles. Shorter titles rank higher
+		{[]string{"ocupado"}, []string{"100006", "100002", "100001"}},
+		{[]string{"ocupados", "avila"}, []string{"100002"}},
+		// typo tolerance
+		{[]string{"desempelo"}, []string{"100004"}},
+		// exclusion
+		{[]string{"ocupados", "-avila", "-parcial"}, []string{"100001"}},
+		// codes
+		{[]string{"100005"}, []string{"100005"}},
+		// diacritics and case
+		{[]string{"petróleo"}, []string{"100005"}},
+	}
+
+	for _, c := range cases {
+		results, err := db.Rank(SearchOptions{}, c.terms...)
+		if err != nil {
+			t.Fatalf("Rank(%v): %s", c.terms, err.Error())
+		}
+
+		var codes []string
+		for _, result := range results {
+			codes = append(codes, result.Code)
+		}
+
+		if strings.Join(codes, ",") != strings.Join(c.codes, ",") {
+			t.Errorf("Rank(%v): expected %v, got %v", c.terms, c.codes, codes)
+		}
+	}
+
+	results, err := db.Rank(SearchOptions{Limit: 1}, "nacional")
+	if err != nil {
+		t.Fatalf("Rank(): %s", err.Error())
+	}
+	if len(results) != 1 || results[0].Code != "100001" {
+		t.Errorf("Rank() with limit 1: expected [100001], got %v", results)
+	}
+
+	// exact matches of every term match fully, typos do not
+	results, err = db.Rank(SearchOptions{}, "ocupados", "avila")
+	if err != nil || len(results) != 1 || results[0].Match != 1 {
+		t.Errorf("Rank(): expected a full match, got %v, %v", results, err)
+	}
+	results, err = db.Rank(SearchOptions{}, "paro", "desempelo")
+	if err != nil || len(results) != 1 || results[0].Match <= 0.5 || results[0].Match >= 1 {
+		t.Errorf("Rank(): expected a partial match, got %v, %v", results, err)
+	}
+
+	results, err = db.Rank(SearchOptions{NoFuzzy: true}, "desempelo")
+	if err != nil {
+		t.Fatalf("Rank(): %s", err.Error())
+	}
+	if len(results) != 0 {
+		t.Errorf("Rank() without fuzzy matching: expected no results, got %v", results)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	db := testDatabase(t, map[string]string{
+		"200001": "IND. PREC. CONSUMO. TOTAL NACIONAL",
+		"200002": "AFILIADOS S.S. TOTAL CCAA",
+		"200003": "INDICE DE PRODUCCION INDUSTRIAL. TOTAL",
+		"200004": "PARO REGISTRADO. COMUNIDADES AUTONOMAS",
+	})
+
+	cases := []struct {
+		terms []string
+		codes []string
+	}{
+		{[]string{"indice", "precios", "consumo"}, []string{"200001"}},
+		{[]string{"ipc"}, []string{"200001"}},
+		{[]string{"afiliados", "seguridad", "social"}, []string{"200002"}},
+		{[]string{"comunidades", "autonomas"}, []string{"200004", "200002"}},
+		{[]string{"ipi"}, []string{"200003"}},
+	}
+
+	for _, c := range cases {
+		results, err := db.Rank(SearchOptions{}, c.terms...)
+		if err != nil {
+			t.Fatalf("Rank(%v): %s", c.terms, err.Error())
+		}
+
+		var codes []string
+		for _, result := range results {
+			codes = append(codes, result.Code)
+		}
+
+		if strings.Join(codes, ",") != strings.Join(c.codes, ",") {
+			t.Errorf("Rank(%v): expected %v, got %v", c.terms, c.codes, codes)
+		}
+	}
+
+	// abbreviations from the dictionary match title tokens exactly, not as prefixes of other words
+	unrelated := testDatabase(t, map[string]string{
+		"300001": "OCUPADOS. VARONES",
+		"300002": "NACIMIENTOS. TOTAL",
+		"300003": "LICENCIAS DE CONSTRUCCION. VIVIENDAS",
+		"300004": "PRODUCCION INDUSTRIAL. TOTAL",
+	})
+	for _, term := range []string{"variacion", "nacional", "consumo", "indice"} {
+		results, err := unrelated.Rank(SearchOptions{}, term)
+		if err != nil {
+			t.Fatalf("Rank(%s): %s", term, err.Error())
+		}
+		if len(results) != 0 {
+			t.Errorf("Rank(%s): expected no results, got %v", term, results)
+		}
+	}
+
+	results, err := db.Rank(SearchOptions{NoExpand: true}, "ipc")
+	if err != nil {
+		t.Fatalf("Rank(): %s", err.Error())
+	}
+	if len(results) != 0 {
+		t.Errorf("Rank() without expansion: expected no results, got %v", results)
+	}
+
+	expansions, err := db.Expand("seguridad", "social", "-ccaa")
+	if err != nil {
+		t.Fatalf("Expand(): %s", err.Error())
+	}
+	if len(expansions) != 2 || expansions[0].Term != "SEGURIDAD SOCIAL" || expansions[1].Term != "CCAA" {
+		t.Errorf("Expand(): unexpected expansions %v", expansions)
+	}
+
+	// an invalid synonyms.yml fails the searches that expand terms, not the loading of the catalog
+	invalid := testDatabase(t, map[string]string{"200001": "IND. PREC. CONSUMO. TOTAL NACIONAL"})
+	invalid.Dictionary = nil
+	invalid.dictionaryOnce.Do(func() { invalid.dictionaryErr = errors.New("yaml: line 1: did not find expected node content") })
+	if _, err := invalid.Rank(SearchOptions{}, "ipc"); err == nil {
+		t.Errorf("Rank(): expected the error loading the dictionary")
+	}
+	if _, err := invalid.Rank(SearchOptions{NoExpand: true}, "ipc"); err != nil {
+		t.Errorf("Rank() without expansion: %s", err.Error())
+	}
+
+	// user groups sharing a member with a default group are merged into it
+	dictionary := DefaultDictionary.Merge(Dictionary{{"IPC", "PRECIOS AL CONSUMO"}})
+	for _, group := range dictionary {
+		if containsString(group, "IPC") && !containsString(group, "PRECIOS AL CONSUMO") {
+			t.Errorf("Merge(): user synonym was not added to the default group %v", group)
+		}
+	}
+}
+
+func TestMergeAndSave(t *testing.T) {
+	db := testDatabase(t, map[string]string{
+		"300001": "EPA. OCUPADOS. TOTAL NACIONAL",
+		"300002": "EPA. PARADOS. TOTAL NACIONAL",
+		"300003": "PRECIO PETROLEO BRENT",
+	})
+
+	decoded := []*series.BDSICESerie{
+		{SerieCode: "300001", Title: "EPA. OCUPADOS. TOTAL NACIONAL"},
+		{SerieCode: "300002", Title: "EPA. PARADOS. TOTAL NACIONAL", NumberOfObservations: 10, Active: true},
+		{SerieCode: "300004", Title: "AFILIADOS S.S. TOTAL", Active: true},
+	}
+
+	report := db.Merge(decoded, []string{"300001", "300002", "300004"})
+
+	expected := MergeReport{
+		Added:        []string{"300004"},
+		Updated:      []string{"300002"},
+		Unchanged:    []string{"300001"},
+		Discontinued: nil,
+		Removed:      []string{"300003"},
+	}
+	if fmt.Sprint(*report) != fmt.Sprint(expected) {
+		t.Errorf("Merge(): expected report %+v, got %+v", expected, *report)
+	}
+
+	if strings.Join(db.Codes, ",") != "300001,300002,300004" {
+		t.Errorf("Merge(): unexpected codes %v", db.Codes)
+	}
+
+	// the merged catalog must be searchable straight away
+	results, err := db.Rank(SearchOptions{}, "afiliados")
+	if err != nil || len(results) != 1 {
+		t.Errorf("Rank() after Merge(): expected one result, got %v (%v)", results, err)
+	}
+
+	dir, err := ioutil.TempDir("", "bdsicego-catalog")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	if err := db.Save(dir); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	loaded, err := LoadDatabase(&config.BDSICEConfig{DatabaseLocalPath: dir})
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+	if len(loaded.Entries) != 3 || loaded.Entries["300002"].NumberOfObservations != 10 {
+		t.Errorf("LoadDatabase(): catalog entries were not saved: %+v", loaded.Entries)
+	}
+
+	// merging the same series again changes nothing
+	report = loaded.Merge(decoded, nil)
+	if len(report.Unchanged) != 3 {
+		t.Errorf("Merge(): expected 3 unchanged series, got %+v", *report)
+	}
+}
+
+// minimal .xer file of a monthly serie with three observations
+const testXer = "COD: %s\r\nTIT: %s\r\nUNI: MILES DE PERSONAS\r\nFUE: INE\r\nDEC: 1\r\nFRE: 12\r\n" +
+	"INI: 2000 1\r\nFIN: 2000 3\r\nNOB: 3\r\n1.0 2.0 OM\r\nPUB: 1\r\nPRI: 0\r\nDET: 1\r\n#\r\n"
+
+func TestCheckAndRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-check")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	configuration := &config.BDSICEConfig{DatabaseLocalPath: dir}
+
+	writeXer := func(code string, title string) {
+		err := ioutil.WriteFile(filepath.Join(dir, code+".xer"), []byte(fmt.Sprintf(testXer, code, title)), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile(): %s", err.Error())
+		}
+	}
+
+	writeXer("400001", "EPA. OCUPADOS. TOTAL NACIONAL")
+	writeXer("400002", "EPA. PARADOS. TOTAL NACIONAL")
+
+	// an interrupted update: a temporary file and a catalog that lists a serie without data
+	ioutil.WriteFile(filepath.Join(dir, "db.json.tmp123"), []byte("{"), 0644)
+	db := testDatabase(t, map[string]string{"400001": "EPA. OCUPADOS. TOTAL NACIONAL", "400003": "GONE"})
+	if err := db.Save(dir); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	report, err := Check(configuration)
+	if err != nil {
+		t.Fatalf("Check(): %s", err.Error())
+	}
+
+	if strings.Join(report.Undecoded, ",") != "400001,400002" || strings.Join(report.Orphaned, ",") != "400003" ||
+		len(report.TempFiles) != 1 || report.MissingCatalog {
+		t.Errorf("Check(): unexpected report %+v", *report)
+	}
+
+	if err := Repair(configuration, report); err != nil {
+		t.Fatalf("Repair(): %s", err.Error())
+	}
+
+	report, err = Check(configuration)
+	if err != nil {
+		t.Fatalf("Check(): %s", err.Error())
+	}
+	if report.Problems() != 0 {
+		t.Errorf("Check() after Repair(): expected no problems, got %+v", *report)
+	}
+
+	repaired, err := LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+	if strings.Join(repaired.Codes, ",") != "400001,400002" || repaired.Entries["400002"].NumberOfObservations != 3 {
+		t.Errorf("Repair(): unexpected catalog %v %+v", repaired.Codes, repaired.Entries)
+	}
+
+	// a lost catalog is rebuilt from the series store
+	os.Remove(filepath.Join(dir, CatalogFileName))
+
+	report, err = Check(configuration)
+	if err != nil {
+		t.Fatalf("Check(): %s", err.Error())
+	}
+	if !report.MissingCatalog {
+		t.Errorf("Check(): missing catalog was not reported")
+	}
+	if err := Repair(configuration, report); err != nil {
+		t.Fatalf("Repair(): %s", err.Error())
+	}
+	if repaired, err = LoadDatabase(configuration); err != nil || len(repaired.Codes) != 2 {
+		t.Errorf("Repair(): catalog was not rebuilt: %v", err)
+	}
+
+	// a catalog that cannot be read is reported as an error, not as missing
+	if err := ioutil.WriteFile(filepath.Join(dir, CatalogFileName), []byte("{"), 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err.Error())
+	}
+	if report, err := Check(configuration); err == nil {
+		t.Errorf("Check(): expected an error reading the catalog, got %+v", *report)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	date := func(year int, month time.Month) *time.Time {
+		d := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+
+	db := testDatabase(t, map[string]string{
+		"100001": "EPA. OCUPADOS",
+		"100002": "EPA. PARADOS",
+		"100003": "IPC. INDICE GENERAL",
+		"100004": "PIB. VOLUMEN",
+		"100005": "SERIE SIN FECHAS",
+	})
+	db.LastUpdate = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	db.Entries = map[string]CatalogEntry{
+		"100001": {Title: "EPA. OCUPADOS", Source: "INE", Frequency: 4, End: date(2026, time.April), Active: true},
+		"100002": {Title: "EPA. PARADOS", Source: "INE", Frequency: 4, End: date(2024, time.January), Active: true},
+		"100003": {Title: "IPC. INDICE GENERAL", Source: "INE", Frequency: 12, End: date(2019, time.March), Active: false},
+		"100004": {Title: "PIB. VOLUMEN", Source: "BDE", Frequency: 1, End: date(2025, time.January), Active: true},
+		"100005": {Title: "SERIE SIN FECHAS", Source: "BDE", Frequency: 12, Active: true},
+	}
+
+	expected := map[string]Freshness{
+		"100001": FreshnessCurrent,
+		"100002": FreshnessOverdue,
+		"100003": FreshnessDiscontinued,
+		"100004": FreshnessCurrent,
+		"100005": FreshnessUnknown,
+		"999999": FreshnessUnknown,
+	}
+	for code, freshness := range expected {
+		if got := db.Freshness(code); got != freshness {
+			t.Errorf("Freshness(%s): expected %s, got %s", code, freshness, got)
+		}
+	}
+
+	codes := db.Filter(FreshnessFilter{Current: true}, db.Codes)
+	sort.Strings(codes)
+	if strings.Join(codes, " ") != "100001 100004" {
+		t.Errorf("Filter(Current): expected [100001 100004], got %v", codes)
+	}
+	if codes := db.Filter(FreshnessFilter{Active: true}, db.Codes); len(codes) != 4 {
+		t.Errorf("Filter(Active): expected 4 series, got %v", codes)
+	}
+
+	results, err := db.Rank(SearchOptions{Filter: FreshnessFilter{Current: true}}, "epa")
+	if err != nil {
+		t.Fatalf("Rank(): %s", err.Error())
+	}
+	if len(results) != 1 || results[0].Code != "100001" {
+		t.Errorf("Rank(): expected only 100001, got %v", results)
+	}
+
+	stale := db.Stale(true)
+	if len(stale) != 2 || stale[0].Code != "100003" || stale[1].Code != "100002" {
+		t.Errorf("Stale(): expected 100003 and 100002, got %+v", stale)
+	}
+	if len(db.Stale(false)) != 1 {
+		t.Errorf("Stale(): expected discontinued series to be left out")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	dbLocalPath, err := ioutil.TempDir("", "bdsicego-handle")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dbLocalPath)
+
+	configuration := &config.BDSICEConfig{DatabaseLocalPath: dbLocalPath}
+	storeFilePath := filepath.Join(dbLocalPath, series.StoreFileName)
+
+	var decoded []*series.BDSICESerie
+	for i := 1; i <= 5; i++ {
+		code := fmt.Sprintf("10000%d", i)
+		xer := fmt.Sprintf(testXer, code, "EPA. OCUPADOS")
+		if err := ioutil.WriteFile(filepath.Join(dbLocalPath, code+".xer"), []byte(xer), 0644); err != nil {
+			t.Fatalf("WriteFile(): %s", err.Error())
+		}
+
+		serie, err := decode.Decode(dbLocalPath, code+".xer")
+		if err != nil {
+			t.Fatalf("Decode(): %s", err.Error())
+		}
+		decoded = append(decoded, serie)
+	}
+
+	if err := series.WriteStore(storeFilePath, decoded); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+
+	db, err := BuildDatabase(decoded)
+	if err != nil {
+		t.Fatalf("BuildDatabase(): %s", err.Error())
+	}
+	if err := db.Save(dbLocalPath); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	h := NewHandle(configuration, 3)
+
+	// concurrent readers share the catalog and the cache
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := h.Database(); err != nil {
+				errs <- err
+			}
+			if _, err := h.Serie(decoded[i%len(decoded)].SerieCode); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Handle: %s", err.Error())
+	}
+
+	if cached := h.Cached(); cached != 3 {
+		t.Errorf("Cached(): expected the cache to be bounded to 3 series, got %d", cached)
+	}
+
+	first, _ := h.Serie("100001")
+	if second, _ := h.Serie("100001"); first != second {
+		t.Errorf("Serie(): expected a cached serie to be returned")
+	}
+
+	// rewriting the store with a later modification time invalidates the cached series
+	if err := series.WriteStore(storeFilePath, decoded); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(storeFilePath, later, later); err != nil {
+		t.Fatalf("Chtimes(): %s", err.Error())
+	}
+	if reloaded, _ := h.Serie("100001"); reloaded == first {
+		t.Errorf("Serie(): expected the serie to be reloaded after the store changed")
+	}
+
+	catalog, _ := h.Database()
+	h.Invalidate()
+	if h.Cached() != 0 {
+		t.Errorf("Invalidate(): expected the cache to be empty")
+	}
+	if reloaded, _ := h.Database(); reloaded == catalog {
+		t.Errorf("Database(): expected the catalog to be reloaded after Invalidate()")
+	}
+}
+
+func TestSnapshotsAndDiff(t *testing.T) {
+	dbLocalPath, err := ioutil.TempDir("", "bdsicego-snapshots")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dbLocalPath)
+
+	end := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	db, err := BuildDatabase([]*series.BDSICESerie{
+		{SerieCode: "100001", Title: "EPA. OCUPADOS", Units: "MILES DE PERSONAS", Frequency: 4, End: &end, Active: true},
+		{SerieCode: "100002", Title: "EPA. PARADOS", Frequency: 4, Active: true},
+	})
+	if err != nil {
+		t.Fatalf("BuildDatabase(): %s", err.Error())
+	}
+	db.LastUpdate = time.Date(2026, time.October, 1, 10, 0, 0, 0, time.UTC)
+	if err := db.Save(dbLocalPath); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	newEnd := end.AddDate(0, 3, 0)
+	db.Merge([]*series.BDSICESerie{
+		{SerieCode: "100001", Title: "EPA. OCUPADOS. TOTAL", Units: "MILES DE PERSONAS", Frequency: 4, End: &newEnd, Active: true},
+		{SerieCode: "100003", Title: "EPA. ACTIVOS", Frequency: 4, Active: true},
+	}, []string{"100001", "100003"})
+	db.LastUpdate = time.Date(2026, time.October, 19, 10, 0, 0, 0, time.UTC)
+	if err := db.Save(dbLocalPath); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	snapshots, err := ListSnapshots(dbLocalPath)
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("ListSnapshots(): expected 2 snapshots, got %v (%v)", snapshots, err)
+	}
+
+	older, snapshot, err := LoadSnapshot(dbLocalPath, "20261001")
+	if err != nil {
+		t.Fatalf("LoadSnapshot(): %s", err.Error())
+	}
+	if snapshot.Name != snapshots[0].Name {
+		t.Errorf("LoadSnapshot(): expected %s, got %s", snapshots[0].Name, snapshot.Name)
+	}
+
+	current, _, err := LoadSnapshot(dbLocalPath, CurrentSnapshot)
+	if err != nil {
+		t.Fatalf("LoadSnapshot(): %s", err.Error())
+	}
+
+	diff := older.Diff(current)
+	if len(diff.Added) != 1 || diff.Added["100003"] != "EPA. ACTIVOS" {
+		t.Errorf("Diff(): expected 100003 to be added, got %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed["100002"] != "EPA. PARADOS" {
+		t.Errorf("Diff(): expected 100002 to be removed, got %v", diff.Removed)
+	}
+
+	expected := []FieldChange{
+		{Field: "Title", From: "EPA. OCUPADOS", To: "EPA. OCUPADOS. TOTAL"},
+		{Field: "End", From: "2020-03-01", To: "2020-06-01"},
+	}
+	if len(diff.Changed) != 1 || !reflect.DeepEqual(diff.Changed[0].Changes, expected) {
+		t.Errorf("Diff(): expected changes %v, got %+v", expected, diff.Changed)
+	}
+
+	if previous, _, err := LoadSnapshot(dbLocalPath, "-2"); err != nil || !previous.Diff(older).Empty() {
+		t.Errorf("LoadSnapshot(-2): expected the oldest snapshot (%v)", err)
+	}
+}
+
 /*
 func TestLoad(t *testing.T) {
 	t.Logf("Testing Load()")
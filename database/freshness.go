@@ -0,0 +1,185 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Freshness tells whether a serie is still being updated as its frequency would require
+type Freshness int
+
+const (
+	FreshnessUnknown      Freshness = iota // the serie has no end date or an unknown frequency
+	FreshnessCurrent                       // the last observation is as recent as can be expected
+	FreshnessOverdue                       // the serie is active but its last observation is older than expected
+	FreshnessDiscontinued                  // the serie is no longer published (DET: 0)
+)
+
+func (f Freshness) String() string {
+	switch f {
+	case FreshnessCurrent:
+		return "current"
+	case FreshnessOverdue:
+		return "overdue"
+	case FreshnessDiscontinued:
+		return "discontinued"
+	default:
+		return "unknown"
+	}
+}
+
+// maximum age of the last observation of a serie, from the start of its period, for each frequency.
+// It covers the length of the period plus the usual publication lag of BDSICE sources.
+var maxAge = map[int]struct{ years, months, days int }{
+	1:   {0, 21, 0}, // annual: last year's figure is expected by the autumn
+	4:   {0, 9, 0},  // quarterly
+	12:  {0, 5, 0},  // monthly
+	52:  {0, 0, 42}, // weekly
+	365: {0, 0, 30}, // daily
+}
+
+// ExpectedEnd returns the oldest date the last observation of a serie of the given frequency may
+// refer to at reference time. ok is false for unknown frequencies.
+func ExpectedEnd(frequency int, reference time.Time) (expected time.Time, ok bool) {
+	age, ok := maxAge[frequency]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// observations of annual, quarterly and monthly series are dated on the first day of their
+	// period, so the reference is moved to the start of its month
+	if age.days == 0 {
+		reference = time.Date(reference.Year(), reference.Month(), 1, 0, 0, 0, 0, reference.Location())
+	}
+
+	return reference.AddDate(-age.years, -age.months, -age.days), true
+}
+
+// Freshness classifies the entry at reference time
+func (e CatalogEntry) Freshness(reference time.Time) Freshness {
+	if !e.Active {
+		return FreshnessDiscontinued
+	}
+
+	if e.End == nil {
+		return FreshnessUnknown
+	}
+
+	expected, ok := ExpectedEnd(e.Frequency, reference)
+	if !ok {
+		return FreshnessUnknown
+	}
+
+	if e.End.Before(expected) {
+		return FreshnessOverdue
+	}
+
+	return FreshnessCurrent
+}
+
+// returns the time the freshness of the catalog is measured against: its last update or, for
+// catalogs that were never updated, the current time
+func (db *BDSICEDatabase) reference() time.Time {
+	if db.LastUpdate.IsZero() {
+		return time.Now()
+	}
+	return db.LastUpdate
+}
+
+// Freshness classifies the serie identified by code against the last update of the catalog
+func (db *BDSICEDatabase) Freshness(code string) Freshness {
+	entry, ok := db.Entries[code]
+	if !ok {
+		return FreshnessUnknown
+	}
+	return entry.Freshness(db.reference())
+}
+
+// FreshnessFilter selects series by their status and freshness. The zero value selects all series.
+type FreshnessFilter struct {
+	Active  bool // only series that are still published
+	Current bool // only series whose last observation is as recent as their frequency allows
+}
+
+// Accept reports whether the serie identified by code passes the filter. Series without an entry in
+// the catalog, as in catalogs written by former versions, only pass the zero filter.
+func (db *BDSICEDatabase) Accept(filter FreshnessFilter, code string) bool {
+	if !filter.Active && !filter.Current {
+		return true
+	}
+
+	entry, ok := db.Entries[code]
+	if !ok {
+		return false
+	}
+
+	if filter.Active && !entry.Active {
+		return false
+	}
+
+	return !filter.Current || entry.Freshness(db.reference()) == FreshnessCurrent
+}
+
+// Filter returns the codes that pass the filter, in the same order
+func (db *BDSICEDatabase) Filter(filter FreshnessFilter, codes []string) []string {
+	var accepted []string
+	for _, code := range codes {
+		if db.Accept(filter, code) {
+			accepted = append(accepted, code)
+		}
+	}
+	return accepted
+}
+
+// StaleSerie describes a serie that is overdue or discontinued
+type StaleSerie struct {
+	Code      string
+	Title     string
+	Source    string
+	End       *time.Time
+	Expected  time.Time // zero for discontinued series
+	Freshness Freshness
+}
+
+// Stale returns the active series whose last observation is older than expected for their frequency
+// and, if discontinued is true, the series that are no longer published. Series are sorted by source
+// and then by end date, the most outdated first.
+func (db *BDSICEDatabase) Stale(discontinued bool) []StaleSerie {
+	reference := db.reference()
+
+	var stale []StaleSerie
+	for code, entry := range db.Entries {
+		freshness := entry.Freshness(reference)
+		if freshness != FreshnessOverdue && (freshness != FreshnessDiscontinued || !discontinued) {
+			continue
+		}
+
+		s := StaleSerie{
+			Code:      code,
+			Title:     entry.Title,
+			Source:    entry.Source,
+			End:       entry.End,
+			Freshness: freshness,
+		}
+		if freshness == FreshnessOverdue {
+			s.Expected, _ = ExpectedEnd(entry.Frequency, reference)
+		}
+		stale = append(stale, s)
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		a, b := stale[i], stale[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.End != nil && b.End != nil && !a.End.Equal(*b.End) {
+			return a.End.Before(*b.End)
+		}
+		if (a.End == nil) != (b.End == nil) {
+			return a.End == nil
+		}
+		return a.Code < b.Code
+	})
+
+	return stale
+}
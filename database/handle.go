@@ -0,0 +1,177 @@
+package database
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// number of series kept in memory by a Handle unless told otherwise
+const DefaultCacheSize = 256
+
+// Handle gives access to the catalog and the series of a database and is safe for concurrent use.
+// The catalog is kept in memory and reloaded when db.json changes on disk. Loaded series are kept in
+// a bounded cache, least recently used first out, and reloaded when the file they were read from
+// changes. Invalidate drops everything, as after an update.
+//
+// The catalog and series returned by a Handle are shared between callers and must not be modified.
+type Handle struct {
+	configuration *config.BDSICEConfig
+
+	mu             sync.RWMutex
+	db             *BDSICEDatabase
+	catalogVersion time.Time // modification time of db.json when db was loaded
+
+	cacheMu  sync.Mutex
+	capacity int
+	lru      *list.List               // of *cachedSerie, most recently used at the front
+	cached   map[string]*list.Element // code: element in lru
+}
+
+// a serie held in the cache along with the modification time of the file it was loaded from
+type cachedSerie struct {
+	code    string
+	serie   *series.BDSICESerie
+	version time.Time
+}
+
+// NewHandle returns a handle on the database in configuration.DatabaseLocalPath that caches up to
+// capacity series. A capacity lower than 1 means DefaultCacheSize.
+func NewHandle(configuration *config.BDSICEConfig, capacity int) *Handle {
+	if capacity < 1 {
+		capacity = DefaultCacheSize
+	}
+
+	return &Handle{
+		configuration: configuration,
+		capacity:      capacity,
+		lru:           list.New(),
+		cached:        make(map[string]*list.Element),
+	}
+}
+
+// returns the modification time of a file, or the zero time if it does not exist
+func modTime(filePath string) time.Time {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Database returns the catalog, loading it if it has not been loaded yet or db.json has changed
+func (h *Handle) Database() (*BDSICEDatabase, error) {
+	version := modTime(filepath.Join(h.configuration.DatabaseLocalPath, CatalogFileName))
+
+	h.mu.RLock()
+	db := h.db
+	current := db != nil && h.catalogVersion.Equal(version)
+	h.mu.RUnlock()
+
+	if current {
+		return db, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// another goroutine may have reloaded the catalog while the lock was released
+	if h.db != nil && h.catalogVersion.Equal(version) {
+		return h.db, nil
+	}
+
+	db, err := LoadDatabase(h.configuration)
+	if err != nil {
+		return nil, fmt.Errorf("database.Handle.Database(): %w", err)
+	}
+
+	h.db = db
+	h.catalogVersion = version
+
+	return db, nil
+}
+
+// returns the modification time of the files a serie may be loaded from. series.Load() reads the
+// series store first and then the JSON files of former versions, so a change to either invalidates
+// the cached serie.
+func (h *Handle) serieVersion(code string) time.Time {
+	dbLocalPath := h.configuration.DatabaseLocalPath
+
+	version := modTime(filepath.Join(dbLocalPath, series.StoreFileName))
+	if jsonVersion := modTime(filepath.Join(dbLocalPath, code+".json")); jsonVersion.After(version) {
+		version = jsonVersion
+	}
+
+	return version
+}
+
+// Serie returns the serie identified by code, from the cache if it is there and up to date
+func (h *Handle) Serie(code string) (*series.BDSICESerie, error) {
+	version := h.serieVersion(code)
+
+	h.cacheMu.Lock()
+	if element, ok := h.cached[code]; ok {
+		entry := element.Value.(*cachedSerie)
+		if entry.version.Equal(version) {
+			h.lru.MoveToFront(element)
+			h.cacheMu.Unlock()
+			return entry.serie, nil
+		}
+		h.lru.Remove(element)
+		delete(h.cached, code)
+	}
+	h.cacheMu.Unlock()
+
+	// the serie is loaded without holding the lock, so that other series can be served meanwhile
+	serie, err := series.Load(h.configuration, code)
+	if err != nil {
+		return nil, fmt.Errorf("database.Handle.Serie(): %s", err.Error())
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	if element, ok := h.cached[code]; ok {
+		// loaded concurrently by another goroutine
+		h.lru.Remove(element)
+	}
+
+	h.cached[code] = h.lru.PushFront(&cachedSerie{code: code, serie: serie, version: version})
+
+	for h.lru.Len() > h.capacity {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.cached, oldest.Value.(*cachedSerie).code)
+	}
+
+	return serie, nil
+}
+
+// Cached returns the number of series in the cache
+func (h *Handle) Cached() int {
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	return h.lru.Len()
+}
+
+// Invalidate drops the catalog and all cached series, so that they are loaded again on next use.
+// It must be called after the database is changed by this process, as modification times may not
+// change when files are rewritten within the resolution of the file system clock.
+func (h *Handle) Invalidate() {
+	h.mu.Lock()
+	h.db = nil
+	h.catalogVersion = time.Time{}
+	h.mu.Unlock()
+
+	h.cacheMu.Lock()
+	h.lru.Init()
+	h.cached = make(map[string]*list.Element)
+	h.cacheMu.Unlock()
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// name of the catalog file in the database path
+const CatalogFileName = "db.json"
+
+// MergeReport lists the codes of the series changed by Merge
+type MergeReport struct {
+	Added        []string // series that were not in the catalog
+	Updated      []string // series in the catalog whose metadata changed
+	Unchanged    []string // series in the catalog whose metadata did not change
+	Discontinued []string // added or updated series that are no longer active (DET: 0)
+	Removed      []string // series in the catalog whose data no longer exists
+}
+
+// String returns a one-line summary of the report
+func (r *MergeReport) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d unchanged, %d discontinued, %d removed",
+		len(r.Added), len(r.Updated), len(r.Unchanged), len(r.Discontinued), len(r.Removed))
+}
+
+// Merge adds the decoded series to the catalog, replacing the entries of series that already
+// exist. If available is not nil, it must contain the codes of all the series whose data exist
+// in the database, and entries for any other serie are removed from the catalog.
+func (db *BDSICEDatabase) Merge(decoded []*series.BDSICESerie, available []string) *MergeReport {
+	var report MergeReport
+
+	if db.Series == nil {
+		db.Series = make(map[string]string)
+	}
+	if db.Entries == nil {
+		db.Entries = make(map[string]CatalogEntry)
+	}
+
+	for _, serie := range decoded {
+		entry := newCatalogEntry(serie)
+		previous, exists := db.Entries[serie.SerieCode]
+		_, listed := db.Series[serie.SerieCode]
+
+		switch {
+		case !exists && !listed:
+			report.Added = append(report.Added, serie.SerieCode)
+		case exists && reflect.DeepEqual(normalizeEntry(previous), normalizeEntry(entry)):
+			report.Unchanged = append(report.Unchanged, serie.SerieCode)
+		default:
+			report.Updated = append(report.Updated, serie.SerieCode)
+		}
+
+		if !serie.Active && (!exists || previous.Active) {
+			report.Discontinued = append(report.Discontinued, serie.SerieCode)
+		}
+
+		db.Series[serie.SerieCode] = serie.Title
+		db.Entries[serie.SerieCode] = entry
+	}
+
+	if available != nil {
+		availableSet := make(map[string]bool, len(available))
+		for _, code := range available {
+			availableSet[code] = true
+		}
+
+		for code := range db.Series {
+			if !availableSet[code] {
+				report.Removed = append(report.Removed, code)
+				delete(db.Series, code)
+				delete(db.Entries, code)
+			}
+		}
+		sort.Strings(report.Removed)
+	}
+
+	db.Codes = make([]string, 0, len(db.Series))
+	for code := range db.Series {
+		db.Codes = append(db.Codes, code)
+	}
+	sort.Strings(db.Codes)
+
+	db.LastUpdate = time.Now()
+
+	db.index = nil
+	db.indexOnce = sync.Once{}
+
+	return &report
+}
+
+// dates read from db.json lose their location, so entries are compared in UTC
+func normalizeEntry(entry CatalogEntry) CatalogEntry {
+	if entry.Start != nil {
+		start := entry.Start.UTC()
+		entry.Start = &start
+	}
+	if entry.End != nil {
+		end := entry.End.UTC()
+		entry.End = &end
+	}
+	return entry
+}
+
+// Save writes the catalog to db.json in dbLocalPath. The catalog is written to a temporary file
+// first, which then replaces db.json, so that an interrupted write never leaves a truncated catalog.
+// A copy is kept in the snapshots directory, dated after the last update of the catalog.
+func (db *BDSICEDatabase) Save(dbLocalPath string) error {
+	dbJSON, err := json.MarshalIndent(db, "", "   ")
+	if err != nil {
+		return fmt.Errorf("database.Save(): %s", err.Error())
+	}
+
+	err = utils.WriteFileAtomic(filepath.Join(dbLocalPath, CatalogFileName), dbJSON)
+	if err != nil {
+		return fmt.Errorf("database.Save(): %s", err.Error())
+	}
+
+	err = db.snapshot(dbLocalPath, dbJSON)
+	if err != nil {
+		return fmt.Errorf("database.Save(): %s", err.Error())
+	}
+
+	return nil
+}
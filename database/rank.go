@@ -0,0 +1,415 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BM25 parameters. These are the usual defaults; titles are short so length normalisation has
+// a mild effect anyway.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// weights applied to the BM25 score of a title token depending on how it matched a search term
+const (
+	exactMatchWeight  = 1.0
+	prefixMatchWeight = 0.75
+	fuzzyMatchWeight  = 0.5
+)
+
+// bonus added to the score of a serie whose code matches a search term
+const (
+	codeEqualBonus    = 10.0
+	codeContainsBonus = 2.0
+)
+
+// SearchResult holds a serie returned by Rank along with its relevance score
+type SearchResult struct {
+	Code  string
+	Title string
+	Score float64
+
+	// Match is how well the terms matched the serie, from 0 to 1: the mean over the terms of the
+	// weight of their best match, 1 being an exact match of a title token or of the code. Unlike
+	// Score, it does not depend on the catalog and can be compared across catalogs.
+	Match float64
+}
+
+// a serie matching some terms: its BM25 score and the sum of the weights of the matches
+type scoredMatch struct {
+	score  float64
+	weight float64
+}
+
+// SearchOptions tunes the behaviour of Rank
+type SearchOptions struct {
+	Limit    int  // maximum number of results to return. Zero means no limit
+	NoFuzzy  bool // disables typo-tolerant matching of search terms
+	NoExpand bool // disables the expansion of search terms through the dictionary
+
+	Filter FreshnessFilter // restricts results to active or current series
+}
+
+// inverted index over the stemmed tokens of the titles in the catalog
+type searchIndex struct {
+	postings   map[string]map[string]int // stem: code: term frequency
+	lengths    map[string]int            // code: number of tokens in title
+	vocabulary []string                  // sorted stems, used for prefix and fuzzy lookups
+	avgLength  float64
+}
+
+// a stem of the vocabulary matched by a search term and the weight given to the match
+type termMatch struct {
+	stem   string
+	weight float64
+}
+
+// normalizeTerm removes diacritics from a search term and uppercases it, so that it can be
+// compared with the titles in the catalog.
+func normalizeTerm(term string) (string, error) {
+	transformChain := transform.Chain(norm.NFD, transform.RemoveFunc(isMn), norm.NFC)
+
+	termNormalized, _, err := transform.String(transformChain, term)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToUpper(termNormalized), nil
+}
+
+// builds the inverted index of the titles in the database
+func buildSearchIndex(titles map[string]string) *searchIndex {
+	idx := &searchIndex{
+		postings: make(map[string]map[string]int),
+		lengths:  make(map[string]int, len(titles)),
+	}
+
+	var totalLength int
+	for code, title := range titles {
+		// titles are normalized as search terms are, so that "indice" matches "Índice"
+		normalized, err := normalizeTerm(title)
+		if err != nil {
+			normalized = strings.ToUpper(title)
+		}
+
+		tokens := tokenize(normalized)
+		idx.lengths[code] = len(tokens)
+		totalLength += len(tokens)
+
+		for _, token := range tokens {
+			s := stem(token)
+			if idx.postings[s] == nil {
+				idx.postings[s] = make(map[string]int)
+			}
+			idx.postings[s][code]++
+		}
+	}
+
+	if len(titles) > 0 {
+		idx.avgLength = float64(totalLength) / float64(len(titles))
+	}
+
+	idx.vocabulary = make([]string, 0, len(idx.postings))
+	for s := range idx.postings {
+		idx.vocabulary = append(idx.vocabulary, s)
+	}
+	sort.Strings(idx.vocabulary)
+
+	return idx
+}
+
+// returns the stems in the vocabulary that match the given stem exactly or, unless exact is
+// true, as a prefix or, unless fuzzy is false, within the edit distance allowed for its length.
+func (idx *searchIndex) lookup(s string, exact bool, fuzzy bool) []termMatch {
+	var matches []termMatch
+
+	if _, ok := idx.postings[s]; ok {
+		matches = append(matches, termMatch{stem: s, weight: exactMatchWeight})
+	}
+
+	if exact {
+		return matches
+	}
+
+	// prefix matches keep the behaviour of the former substring search for truncated terms
+	if len(s) >= 3 {
+		for i := sort.SearchStrings(idx.vocabulary, s); i < len(idx.vocabulary) && strings.HasPrefix(idx.vocabulary[i], s); i++ {
+			if idx.vocabulary[i] != s {
+				matches = append(matches, termMatch{stem: idx.vocabulary[i], weight: prefixMatchWeight})
+			}
+		}
+	}
+
+	if len(matches) > 0 || !fuzzy {
+		return matches
+	}
+
+	edits := maxEdits(len(s))
+	if edits == 0 {
+		return nil
+	}
+
+	for _, candidate := range idx.vocabulary {
+		if abs(len(candidate)-len(s)) > edits {
+			continue
+		}
+		if d := editDistance(s, candidate); d <= edits {
+			matches = append(matches, termMatch{stem: candidate, weight: fuzzyMatchWeight / float64(d)})
+		}
+	}
+
+	return matches
+}
+
+// BM25 score of a stem in the title of the serie identified by code
+func (idx *searchIndex) score(s string, code string) float64 {
+	postings := idx.postings[s]
+	tf := float64(postings[code])
+	if tf == 0 {
+		return 0
+	}
+
+	n := float64(len(idx.lengths))
+	df := float64(len(postings))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	length := float64(idx.lengths[code])
+	return idf * (tf * (bm25K1 + 1)) / (tf + bm25K1*(1-bm25B+bm25B*length/idx.avgLength))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// returns the dictionary of the database and its compiled members, loading the user's synonyms.yml
+// the first time it is needed if the database was not given one
+func (db *BDSICEDatabase) dictionary() (Dictionary, map[string][]compiledMember, error) {
+	db.dictionaryOnce.Do(func() {
+		if db.Dictionary == nil {
+			db.Dictionary, db.dictionaryErr = LoadDictionary()
+		}
+		db.compiledDictionary = db.Dictionary.compile()
+	})
+	return db.Dictionary, db.compiledDictionary, db.dictionaryErr
+}
+
+// returns the search index, building it the first time it is needed
+func (db *BDSICEDatabase) searchIndex() *searchIndex {
+	db.indexOnce.Do(func() {
+		db.index = buildSearchIndex(db.Series)
+	})
+	return db.index
+}
+
+// Rank returns the series that match all the terms either in their title or their code, sorted by
+// relevance. Titles are scored with BM25 over stemmed tokens, so that "ocupado" also matches
+// "OCUPADOS", and terms that do not match any title token are matched within a small edit
+// distance. Terms and phrases found in the dictionary of the database also match their synonyms
+// and abbreviations. Terms prefixed by "-" exclude the series that contain them. Ties are broken
+// by code.
+func (db *BDSICEDatabase) Rank(options SearchOptions, terms ...string) ([]SearchResult, error) {
+	matchClauses, excludeClauses, _, err := db.parseTerms(options, terms)
+	if err != nil {
+		return nil, fmt.Errorf("database.Rank(): %s", err.Error())
+	}
+
+	if len(matchClauses) == 0 {
+		return nil, nil
+	}
+
+	idx := db.searchIndex()
+
+	// every clause must match either the code or the title
+	var scores map[string]scoredMatch
+	for _, c := range matchClauses {
+		clauseScores := db.scoreClause(idx, c, !options.NoFuzzy)
+
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+
+		for code, scored := range scores {
+			if clauseScore, ok := clauseScores[code]; ok {
+				scores[code] = scoredMatch{score: scored.score + clauseScore.score, weight: scored.weight + clauseScore.weight}
+			} else {
+				delete(scores, code)
+			}
+		}
+	}
+
+	for _, c := range excludeClauses {
+		for code := range db.scoreClause(idx, c, false) {
+			delete(scores, code)
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for code, scored := range scores {
+		if !db.Accept(options.Filter, code) {
+			continue
+		}
+		results = append(results, SearchResult{
+			Code:  code,
+			Title: db.Series[code],
+			Score: scored.score,
+			Match: scored.weight / float64(len(matchClauses)),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Code < results[j].Code
+	})
+
+	if options.Limit > 0 && len(results) > options.Limit {
+		results = results[:options.Limit]
+	}
+
+	return results, nil
+}
+
+// Expand returns the expansions that Rank applies to the given terms through the dictionary of
+// the database. Excluded terms are expanded too.
+func (db *BDSICEDatabase) Expand(terms ...string) ([]Expansion, error) {
+	_, _, expansions, err := db.parseTerms(SearchOptions{}, terms)
+	if err != nil {
+		return nil, fmt.Errorf("database.Expand(): %s", err.Error())
+	}
+
+	return expansions, nil
+}
+
+// normalises the search terms, splits them between terms to match and terms to exclude and
+// expands both through the dictionary
+func (db *BDSICEDatabase) parseTerms(options SearchOptions, terms []string) ([]clause, []clause, []Expansion, error) {
+	var (
+		matchTerms   []string
+		excludeTerms []string
+		expansions   []Expansion
+	)
+
+	for _, term := range terms {
+		termNormalized, err := normalizeTerm(term)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if strings.HasPrefix(termNormalized, "-") {
+			excludeTerms = append(excludeTerms, termNormalized[1:])
+		} else if termNormalized != "" {
+			matchTerms = append(matchTerms, termNormalized)
+		}
+	}
+
+	var dictionary Dictionary
+	var compiled map[string][]compiledMember
+	if !options.NoExpand {
+		var err error
+		dictionary, compiled, err = db.dictionary()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	matchClauses, matchExpansions := dictionary.expand(compiled, matchTerms)
+	expansions = append(expansions, matchExpansions...)
+
+	// excluded terms are expanded one by one: "-ccaa -madrid" are not a phrase
+	var excludeClauses []clause
+	for _, term := range excludeTerms {
+		termClauses, termExpansions := dictionary.expand(compiled, []string{term})
+		excludeClauses = append(excludeClauses, termClauses...)
+		expansions = append(expansions, termExpansions...)
+	}
+
+	return matchClauses, excludeClauses, expansions, nil
+}
+
+// returns the score of every serie matching a clause, that is, matching any of its alternatives.
+// The weight of the match is that of the best alternative, or that of the code.
+func (db *BDSICEDatabase) scoreClause(idx *searchIndex, c clause, fuzzy bool) map[string]scoredMatch {
+	scores := make(map[string]scoredMatch)
+
+	for code := range db.Series {
+		upperCode := strings.ToUpper(code)
+		if upperCode == c.raw {
+			scores[code] = scoredMatch{score: codeEqualBonus, weight: exactMatchWeight}
+		} else if strings.Contains(upperCode, c.raw) {
+			scores[code] = scoredMatch{score: codeContainsBonus, weight: prefixMatchWeight}
+		}
+	}
+
+	for _, alternative := range c.alternatives {
+		for code, scored := range idx.scoreSlots(alternative, c.typed, fuzzy) {
+			current := scores[code]
+			if scored.score > current.score {
+				current.score = scored.score
+			}
+			if scored.weight > current.weight {
+				current.weight = scored.weight
+			}
+			scores[code] = current
+		}
+	}
+
+	return scores
+}
+
+// returns the score of every serie whose title matches all the given slots, a slot being matched
+// by any of its variants. Variants whose stem is not among those typed match exactly. The weight
+// of the match is the mean of the weights of the best match of every slot.
+func (idx *searchIndex) scoreSlots(slots [][]string, typed map[string]bool, fuzzy bool) map[string]scoredMatch {
+	var scores map[string]scoredMatch
+
+	for _, variants := range slots {
+		matched := make(map[string]scoredMatch)
+
+		for _, variant := range variants {
+			for _, m := range idx.lookup(stem(variant), !typed[stem(variant)], fuzzy) {
+				for code := range idx.postings[m.stem] {
+					current := matched[code]
+					if s := m.weight * idx.score(m.stem, code); s > current.score {
+						current.score = s
+					}
+					if m.weight > current.weight {
+						current.weight = m.weight
+					}
+					matched[code] = current
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = matched
+			continue
+		}
+
+		for code, scored := range scores {
+			if s, ok := matched[code]; ok {
+				scores[code] = scoredMatch{score: scored.score + s.score, weight: scored.weight + s.weight}
+			} else {
+				delete(scores, code)
+			}
+		}
+	}
+
+	for code, scored := range scores {
+		scored.weight /= float64(len(slots))
+		scores[code] = scored
+	}
+
+	return scores
+}
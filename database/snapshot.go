@@ -0,0 +1,258 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// directory within the database path holding the snapshots of the catalog
+const SnapshotsDirName = "snapshots"
+
+// number of snapshots kept. The oldest ones are removed when a new snapshot is taken.
+const MaxSnapshots = 30
+
+// snapshots are named after the last update of the catalog, in UTC
+const snapshotTimeFormat = "20060102T150405Z"
+
+// name given to the catalog in db.json when comparing it with snapshots
+const CurrentSnapshot = "current"
+
+// Snapshot identifies a copy of the catalog as it was saved at a given time
+type Snapshot struct {
+	Name string
+	Time time.Time
+}
+
+// writes a copy of the catalog to the snapshots directory and removes the oldest snapshots beyond
+// MaxSnapshots. The snapshot is named after db.LastUpdate, so saving the same state twice keeps a
+// single snapshot.
+func (db *BDSICEDatabase) snapshot(dbLocalPath string, dbJSON []byte) error {
+	snapshotsDir := filepath.Join(dbLocalPath, SnapshotsDirName)
+
+	err := os.MkdirAll(snapshotsDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	name := "db-" + db.LastUpdate.UTC().Format(snapshotTimeFormat) + ".json"
+
+	err = utils.WriteFileAtomic(filepath.Join(snapshotsDir, name), dbJSON)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := ListSnapshots(dbLocalPath)
+	if err != nil {
+		return err
+	}
+
+	for len(snapshots) > MaxSnapshots {
+		err = os.Remove(filepath.Join(snapshotsDir, snapshots[0].Name))
+		if err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the catalog in dbLocalPath, oldest first
+func ListSnapshots(dbLocalPath string) ([]Snapshot, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(dbLocalPath, SnapshotsDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("database.ListSnapshots(): %s", err.Error())
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "db-") || filepath.Ext(name) != ".json" {
+			continue
+		}
+
+		t, err := time.Parse(snapshotTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, "db-"), ".json"))
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, Snapshot{Name: name, Time: t})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+
+	return snapshots, nil
+}
+
+// LoadSnapshot returns the catalog stored in a snapshot. The snapshot is given by its name, by the
+// beginning of its name or time, such as 20261019, in which case the latest matching snapshot is
+// taken, or by its position counting back from the latest one, -1 being the latest. CurrentSnapshot
+// refers to db.json itself.
+func LoadSnapshot(dbLocalPath string, reference string) (*BDSICEDatabase, *Snapshot, error) {
+	filePath := filepath.Join(dbLocalPath, CatalogFileName)
+	snapshot := &Snapshot{Name: CurrentSnapshot}
+
+	if reference != CurrentSnapshot {
+		snapshots, err := ListSnapshots(dbLocalPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("database.LoadSnapshot(): %s", err.Error())
+		}
+
+		snapshot = findSnapshot(snapshots, reference)
+		if snapshot == nil {
+			return nil, nil, fmt.Errorf("database.LoadSnapshot(): no snapshot matches %q", reference)
+		}
+
+		filePath = filepath.Join(dbLocalPath, SnapshotsDirName, snapshot.Name)
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database.LoadSnapshot(): %s", err.Error())
+	}
+
+	var db BDSICEDatabase
+	err = json.Unmarshal(content, &db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database.LoadSnapshot(): %s: %s", filePath, err.Error())
+	}
+
+	if snapshot.Name == CurrentSnapshot {
+		snapshot.Time = db.LastUpdate
+	}
+
+	return &db, snapshot, nil
+}
+
+func findSnapshot(snapshots []Snapshot, reference string) *Snapshot {
+	if position, err := strconv.Atoi(reference); err == nil && position < 0 {
+		if -position > len(snapshots) {
+			return nil
+		}
+		return &snapshots[len(snapshots)+position]
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		name := strings.TrimPrefix(snapshots[i].Name, "db-")
+		if snapshots[i].Name == reference || strings.HasPrefix(name, reference) {
+			return &snapshots[i]
+		}
+	}
+
+	return nil
+}
+
+// FieldChange holds the former and the new value of a field of a catalog entry
+type FieldChange struct {
+	Field string `json:"Field"`
+	From  string `json:"From"`
+	To    string `json:"To"`
+}
+
+// SerieChange lists the fields that changed for a serie between two catalogs
+type SerieChange struct {
+	Code    string        `json:"Code"`
+	Title   string        `json:"Title"`
+	Changes []FieldChange `json:"Changes"`
+}
+
+// CatalogDiff holds the differences between two catalogs
+type CatalogDiff struct {
+	From    string            `json:"From"`
+	To      string            `json:"To"`
+	Added   map[string]string `json:"Added"`   // code: title
+	Removed map[string]string `json:"Removed"` // code: title
+	Changed []SerieChange     `json:"Changed"`
+}
+
+// Empty reports whether both catalogs list the same series with the same metadata
+func (d *CatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the catalog db with a newer one and returns the series added, removed and changed,
+// field by field. Catalogs written by former versions only hold titles, so for them only titles are
+// compared.
+func (db *BDSICEDatabase) Diff(newer *BDSICEDatabase) *CatalogDiff {
+	diff := &CatalogDiff{
+		Added:   make(map[string]string),
+		Removed: make(map[string]string),
+	}
+
+	for code, title := range newer.Series {
+		if _, ok := db.Series[code]; !ok {
+			diff.Added[code] = title
+		}
+	}
+
+	for code, title := range db.Series {
+		newTitle, ok := newer.Series[code]
+		if !ok {
+			diff.Removed[code] = title
+			continue
+		}
+
+		oldEntry, oldOk := db.Entries[code]
+		newEntry, newOk := newer.Entries[code]
+
+		var changes []FieldChange
+		if oldOk && newOk {
+			changes = entryChanges(normalizeEntry(oldEntry), normalizeEntry(newEntry))
+		} else if title != newTitle {
+			changes = []FieldChange{{Field: "Title", From: title, To: newTitle}}
+		}
+
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, SerieChange{Code: code, Title: newTitle, Changes: changes})
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Code < diff.Changed[j].Code })
+
+	return diff
+}
+
+// compares two catalog entries field by field
+func entryChanges(oldEntry CatalogEntry, newEntry CatalogEntry) []FieldChange {
+	var changes []FieldChange
+
+	oldValue := reflect.ValueOf(oldEntry)
+	newValue := reflect.ValueOf(newEntry)
+
+	for i := 0; i < oldValue.NumField(); i++ {
+		from := formatField(oldValue.Field(i).Interface())
+		to := formatField(newValue.Field(i).Interface())
+
+		if from != to {
+			changes = append(changes, FieldChange{Field: oldValue.Type().Field(i).Name, From: from, To: to})
+		}
+	}
+
+	return changes
+}
+
+func formatField(value interface{}) string {
+	switch v := value.(type) {
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format("2006-01-02")
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
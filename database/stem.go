@@ -0,0 +1,116 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isVowel reports whether b is an uppercase ASCII vowel. Titles in the catalog have their diacritics
+// removed by decode, so there is no need to check for accented vowels.
+func isVowel(b byte) bool {
+	return b == 'A' || b == 'E' || b == 'I' || b == 'O' || b == 'U'
+}
+
+// stem returns a light Spanish stem of an uppercase, diacritics-free word. It is not a full Snowball
+// stemmer: BDSICE titles are short and made of nouns and participles, so removing plural endings and
+// the final gender vowel is enough to make "OCUPADO", "OCUPADOS" and "OCUPADAS" share the same stem.
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+
+	// words containing digits are codes, years or periods and must be kept as they are
+	for _, r := range word {
+		if unicode.IsDigit(r) {
+			return word
+		}
+	}
+
+	// plural endings
+	switch {
+	case strings.HasSuffix(word, "CIONES"):
+		word = strings.TrimSuffix(word, "ES")
+	case strings.HasSuffix(word, "ES") && len(word) > 4 && !isVowel(word[len(word)-3]):
+		word = strings.TrimSuffix(word, "ES")
+	case strings.HasSuffix(word, "S") && isVowel(word[len(word)-2]):
+		word = strings.TrimSuffix(word, "S")
+	}
+
+	// final gender vowel
+	if len(word) > 4 {
+		switch word[len(word)-1] {
+		case 'O', 'A', 'E':
+			word = word[:len(word)-1]
+		}
+	}
+
+	return word
+}
+
+// tokenize splits an uppercase, diacritics-free string into words. Dots are removed rather than
+// used as separators so that abbreviations such as "S.S." or "IND." become single tokens.
+func tokenize(s string) []string {
+	s = strings.Replace(s, ".", "", -1)
+
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// editDistance returns the optimal string alignment distance between a and b: the number of
+// insertions, deletions, substitutions and transpositions of adjacent characters needed to turn
+// one into the other. Transpositions count as one edit so that "DESEMPELO" is close to "DESEMPLEO".
+func editDistance(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := 0; j <= len(b); j++ {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			rows[i][j] = minInt(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = minInt(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return rows[len(a)][len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// maxEdits returns the edit distance tolerated when fuzzy matching a term of the given length.
+// Short terms are matched exactly, since one edit on a three-letter word matches almost anything.
+func maxEdits(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
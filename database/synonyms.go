@@ -0,0 +1,332 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// name of the file in the configuration directory holding user-defined synonym groups
+const SynonymsFileName = "synonyms.yml"
+
+// Dictionary holds groups of equivalent terms used to expand search queries. Each group lists the
+// abbreviations, spellings and synonyms of a single concept. A search term or phrase matching any
+// member of a group also matches the titles that contain any other member of the group.
+type Dictionary [][]string
+
+// DefaultDictionary contains the abbreviations and terminology found in BDSICE titles.
+var DefaultDictionary = Dictionary{
+	{"INDICE", "IND"},
+	{"PRECIO", "PREC"},
+	{"COMUNIDADES AUTONOMAS", "COMUNIDAD AUTONOMA", "CCAA", "CC AA"},
+	{"ENCUESTA DE POBLACION ACTIVA", "EPA"},
+	{"SEGURIDAD SOCIAL", "SS", "SEG SOCIAL"},
+	{"AFILIADOS", "AFIL"},
+	{"PRODUCTO INTERIOR BRUTO", "PIB"},
+	{"VALOR ANADIDO BRUTO", "VAB"},
+	{"INDICE DE PRECIOS DE CONSUMO", "IPC"},
+	{"INDICE DE PRODUCCION INDUSTRIAL", "IPI"},
+	{"INDICE DE PRECIOS INDUSTRIALES", "IPRI"},
+	{"INDICE DE COMERCIO MINORISTA", "ICM"},
+	{"CORREGIDO DE VARIACIONES ESTACIONALES Y CALENDARIO", "CVEC"},
+	{"DESESTACIONALIZADO", "DESEST", "CVE"},
+	{"TASA DE VARIACION ANUAL", "TVA"},
+	{"PARO", "DESEMPLEO"},
+	{"PARADOS", "DESEMPLEADOS"},
+	{"OCUPADOS", "OCUP"},
+	{"EMPLEO", "EMPL"},
+	{"TOTAL", "TOT"},
+	{"NACIONAL", "NAC"},
+	{"INSTITUTO NACIONAL DE ESTADISTICA", "INE"},
+	{"BANCO DE ESPANA", "BE"},
+	{"UNION EUROPEA", "UE"},
+	{"ZONA EURO", "EUROZONA", "UEM"},
+	{"ESTADOS UNIDOS", "EEUU", "EE UU"},
+	{"MILLONES", "MILL"},
+	{"MILES", "MIL"},
+	{"EUROS", "EUR"},
+	{"VIVIENDA", "VIV"},
+	{"CONSTRUCCION", "CONSTR"},
+	{"PRODUCCION", "PROD"},
+	{"INDUSTRIA", "INDUSTRIAL", "INDUST"},
+	{"MATRICULACIONES", "MATRIC"},
+	{"TURISMOS", "TURIS"},
+	{"CONSUMO", "CONS"},
+	{"EXPORTACIONES", "EXPORT", "EXP"},
+	{"IMPORTACIONES", "IMPORT", "IMP"},
+	{"VARIACION", "VAR"},
+	{"MEDIA", "MED"},
+}
+
+// words ignored when matching phrases, so that "INDICE PRECIOS CONSUMO" matches "INDICE DE PRECIOS DE CONSUMO"
+var stopWords = map[string]bool{
+	"DE": true, "DEL": true, "LA": true, "LAS": true, "EL": true, "LOS": true,
+	"Y": true, "E": true, "EN": true, "A": true, "AL": true, "POR": true, "PARA": true,
+}
+
+// Expansion describes how a search term or phrase was expanded through the dictionary
+type Expansion struct {
+	Term         string   // term or phrase as it was typed
+	Alternatives []string // equivalent terms that were also searched for
+}
+
+// a group of search alternatives: a title matches the clause if it matches at least one of the
+// alternatives. An alternative is a sequence of slots, all of which must be matched by a token of
+// the title. A slot is matched by any of its variants, which are single-word synonyms. Only the
+// variants typed match title tokens by prefix or within an edit distance, so that abbreviations
+// from the dictionary, such as NAC, do not match unrelated words, such as NACIMIENTOS.
+type clause struct {
+	raw          string
+	alternatives [][][]string
+	typed        map[string]bool // stems of the tokens typed
+}
+
+// a dictionary member reduced to the stems of its tokens
+type compiledMember struct {
+	stems []string
+	group int
+}
+
+// Merge returns a dictionary containing the groups of d and other. Groups sharing a member are
+// joined into a single group, so that user extensions can add synonyms to a default group.
+func (d Dictionary) Merge(other Dictionary) Dictionary {
+	var merged Dictionary
+
+	for _, group := range append(append(Dictionary{}, d...), other...) {
+		var normalized []string
+		for _, member := range group {
+			if m := strings.Join(tokenize(strings.ToUpper(member)), " "); m != "" {
+				normalized = append(normalized, m)
+			}
+		}
+
+		target := -1
+		for i, existing := range merged {
+			if sharesMember(existing, normalized) {
+				target = i
+				break
+			}
+		}
+
+		if target == -1 {
+			merged = append(merged, nil)
+			target = len(merged) - 1
+		}
+
+		for _, member := range normalized {
+			if !containsString(merged[target], member) {
+				merged[target] = append(merged[target], member)
+			}
+		}
+	}
+
+	return merged
+}
+
+func sharesMember(a, b []string) bool {
+	for _, member := range b {
+		if containsString(a, member) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the tokens of s that are not stop words
+func phraseTokens(s string) []string {
+	var tokens []string
+	for _, token := range tokenize(s) {
+		if !stopWords[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// returns the stems of the tokens of s, ignoring stop words
+func phraseStems(s string) []string {
+	var stems []string
+	for _, token := range phraseTokens(s) {
+		stems = append(stems, stem(token))
+	}
+	return stems
+}
+
+// indexes the members of the dictionary by the stem of their first token
+func (d Dictionary) compile() map[string][]compiledMember {
+	compiled := make(map[string][]compiledMember)
+
+	for i, group := range d {
+		for _, member := range group {
+			stems := phraseStems(strings.ToUpper(member))
+			if len(stems) == 0 {
+				continue
+			}
+			compiled[stems[0]] = append(compiled[stems[0]], compiledMember{stems: stems, group: i})
+		}
+	}
+
+	return compiled
+}
+
+// turns normalised search terms into clauses, replacing the terms and phrases found in the
+// dictionary with the alternatives of their group. The longest matching phrase wins. compiled
+// holds the members of d as returned by compile.
+func (d Dictionary) expand(compiled map[string][]compiledMember, terms []string) ([]clause, []Expansion) {
+	var (
+		tokens     []string
+		raws       []string // what was typed for each token, used to match serie codes
+		clauses    []clause
+		expansions []Expansion
+	)
+
+	for _, term := range terms {
+		termTokens := tokenize(term)
+
+		for _, token := range termTokens {
+			if stopWords[token] {
+				continue
+			}
+
+			tokens = append(tokens, token)
+
+			// a single-token term is kept as typed so that "634814q" still matches its code
+			if len(termTokens) == 1 {
+				raws = append(raws, term)
+			} else {
+				raws = append(raws, token)
+			}
+		}
+	}
+
+	for i := 0; i < len(tokens); {
+		var best *compiledMember
+
+		candidates := compiled[stem(tokens[i])]
+		for j, member := range candidates {
+			if len(member.stems) > len(tokens)-i || (best != nil && len(member.stems) <= len(best.stems)) {
+				continue
+			}
+
+			matches := true
+			for k, s := range member.stems {
+				if stem(tokens[i+k]) != s {
+					matches = false
+					break
+				}
+			}
+
+			if matches {
+				best = &candidates[j]
+			}
+		}
+
+		if best == nil {
+			clauses = append(clauses, clause{raw: raws[i], alternatives: [][][]string{{{tokens[i]}}}, typed: map[string]bool{stem(tokens[i]): true}})
+			i++
+			continue
+		}
+
+		raw := strings.Join(raws[i:i+len(best.stems)], " ")
+		c := clause{raw: raw, typed: make(map[string]bool)}
+		for _, token := range tokens[i : i+len(best.stems)] {
+			c.typed[stem(token)] = true
+		}
+		expansion := Expansion{Term: raw}
+
+		for _, member := range d[best.group] {
+			// words within a phrase are expanded too, so that "INDICE DE PRECIOS DE CONSUMO"
+			// matches titles reading "IND. PREC. CONSUMO"
+			var alternative [][]string
+			for _, token := range phraseTokens(member) {
+				alternative = append(alternative, d.variants(compiled, token))
+			}
+			c.alternatives = append(c.alternatives, alternative)
+			if stems := phraseStems(member); strings.Join(stems, " ") != strings.Join(best.stems, " ") {
+				expansion.Alternatives = append(expansion.Alternatives, member)
+			}
+		}
+
+		clauses = append(clauses, c)
+		expansions = append(expansions, expansion)
+		i += len(best.stems)
+	}
+
+	return clauses, expansions
+}
+
+// returns the token along with the single-word members of the groups it belongs to
+func (d Dictionary) variants(compiled map[string][]compiledMember, token string) []string {
+	variants := []string{token}
+
+	for _, member := range compiled[stem(token)] {
+		if len(member.stems) != 1 {
+			continue
+		}
+
+		for _, synonym := range d[member.group] {
+			if synonymTokens := phraseTokens(synonym); len(synonymTokens) == 1 && !containsString(variants, synonymTokens[0]) {
+				variants = append(variants, synonymTokens[0])
+			}
+		}
+	}
+
+	return variants
+}
+
+// LoadDictionary returns the default dictionary merged with the groups defined by the user in
+// synonyms.yml in the configuration directory, if such a file exists. The file holds a list of
+// groups, each group being a list of equivalent terms:
+//
+//   - [IPC, INDICE DE PRECIOS DE CONSUMO]
+//   - [AAPP, ADMINISTRACIONES PUBLICAS]
+func LoadDictionary() (Dictionary, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("database.LoadDictionary(): %s", err.Error())
+	}
+
+	return loadDictionaryFile(filepath.Join(configDir, SynonymsFileName))
+}
+
+// merges the default dictionary with the groups in the given file. A missing file is not an error.
+func loadDictionaryFile(filePath string) (Dictionary, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return DefaultDictionary.Merge(nil), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("database.LoadDictionary(): %s", err.Error())
+	}
+
+	var userDictionary Dictionary
+	err = yaml.Unmarshal(content, &userDictionary)
+	if err != nil {
+		return nil, fmt.Errorf("database.LoadDictionary(): %s: %s", filePath, err.Error())
+	}
+
+	for i, group := range userDictionary {
+		for j, member := range group {
+			normalized, err := normalizeTerm(member)
+			if err != nil {
+				return nil, fmt.Errorf("database.LoadDictionary(): %s: %s", filePath, err.Error())
+			}
+			userDictionary[i][j] = normalized
+		}
+	}
+
+	return DefaultDictionary.Merge(userDictionary), nil
+}
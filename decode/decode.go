@@ -242,7 +242,7 @@ func Decode(dbLocalPath string, XerFile string) (*series.BDSICESerie, error) {
 						// -9999999.9999999 and toggle a field called ContainsNan
 						// When BDSICESerie.Data() gets implemented, it will have to check for
 						// ContainsNaN and substitute all -999999999.99999 values for a math.NaN
-						s.Observations.Values = append(s.Observations.Values, -99999999.999999)
+						s.Observations.Values = append(s.Observations.Values, series.MissingValue)
 						s.ContainsNan = true
 					} else {
 						value, err := strconv.ParseFloat(obs, 64)
@@ -7,10 +7,12 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDecode(t *testing.T) {
-	dbLocalPath := "/home/alibey/econdata/bdsice/data/db/"
+	// testdata holds series written as the emulator of the BDSICE website serves them
+	dbLocalPath := "testdata"
 
 	var freqs = make(map[string]bool)
 
@@ -19,14 +21,8 @@ func TestDecode(t *testing.T) {
 		t.Error("DecodeFullDatabase: got error ", err.Error())
 	}
 
-	fileCounter := 0
-	fileCounterTotal := len(files)
-
 	for _, file := range files {
 
-		fmt.Printf("Decoding test performed: %d\t\t%d\r", fileCounter, fileCounterTotal)
-		fileCounter = fileCounter + 1
-
 		if !strings.HasSuffix(file.Name(), ".xer") {
 			continue
 		}
@@ -111,7 +107,72 @@ func TestDecode(t *testing.T) {
 		*/
 
 	}
-	for k, _ := range freqs {
-		t.Logf("Freqs:\n%s\n", k)
+	for _, f := range []string{"1", "4", "12", "365"} {
+		if !freqs[f] {
+			t.Errorf("Expected a serie with frequency %s among the test series.", f)
+		}
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	var tests = []struct {
+		code         string
+		title        string
+		notes        int
+		frequency    int
+		start        time.Time
+		observations int
+		containsNan  bool
+		active       bool
+	}{
+		// quarters are dated at their last month
+		{"100001", "EPA. OCUPADOS. TOTAL NACIONAL", 1, 4, time.Date(2000, time.March, 1, 0, 0, 0, 0, time.UTC), 106, false, true},
+		{"100002", "EPA. PARADOS. AVILA", 0, 4, time.Date(2000, time.March, 1, 0, 0, 0, 0, time.UTC), 106, false, true},
+		{"200001", "IPC. INDICE GENERAL. TASA DE VARIACION ANUAL", 0, 12, time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC), 295, true, true},
+		{"300001", "PIB. VOLUMEN ENCADENADO", 0, 1, time.Date(1995, time.January, 1, 0, 0, 0, 0, time.UTC), 31, false, true},
+		{"634814", "PRECIO PETROLEO BRENT", 0, 365, time.Date(2026, time.August, 20, 0, 0, 0, 0, time.UTC), 58, false, true},
+		{"400001", "MATRICULACION DE TURISMOS. PLAN PIVE", 0, 12, time.Date(2012, time.October, 1, 0, 0, 0, 0, time.UTC), 40, false, false},
+	}
+
+	for _, test := range tests {
+		serie, err := Decode("testdata", test.code+".xer")
+		if err != nil {
+			t.Errorf("%s: %s", test.code, err.Error())
+			continue
+		}
+
+		if serie.Title != test.title {
+			t.Errorf("%s: expected title %q, got %q", test.code, test.title, serie.Title)
+		}
+
+		if len(serie.Notes) != test.notes {
+			t.Errorf("%s: expected %d notes, got %d", test.code, test.notes, len(serie.Notes))
+		}
+
+		if serie.Frequency != test.frequency {
+			t.Errorf("%s: expected frequency %d, got %d", test.code, test.frequency, serie.Frequency)
+		}
+
+		if !serie.Start.Equal(test.start) {
+			t.Errorf("%s: expected start %s, got %s", test.code, test.start, serie.Start)
+		}
+
+		if serie.NumberOfObservations != test.observations || len(serie.Observations.Values) != test.observations ||
+			len(serie.Observations.Dates) != test.observations {
+			t.Errorf("%s: expected %d observations, got NOB %d, %d values and %d dates", test.code, test.observations,
+				serie.NumberOfObservations, len(serie.Observations.Values), len(serie.Observations.Dates))
+		}
+
+		if serie.ContainsNan != test.containsNan {
+			t.Errorf("%s: expected ContainsNan %t, got %t", test.code, test.containsNan, serie.ContainsNan)
+		}
+
+		if serie.Active != test.active {
+			t.Errorf("%s: expected Active %t, got %t", test.code, test.active, serie.Active)
+		}
+
+		if !serie.Observations.Dates[len(serie.Observations.Dates)-1].Equal(*serie.End) {
+			t.Errorf("%s: last date %s does not match FIN %s", test.code, serie.Observations.Dates[len(serie.Observations.Dates)-1], serie.End)
+		}
 	}
 }
@@ -0,0 +1,384 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// directory within the data path holding the bulletins downloaded and their index
+const BulletinsDirName = "bulletins"
+
+// name of the index of the bulletins in the bulletins directory
+const BulletinIndexFileName = "index.json"
+
+// BulletinEntry is a coyuntura bulletin listed at BulletinURL
+type BulletinEntry struct {
+	Date   time.Time `json:"Date"`
+	Title  string    `json:"Title"`
+	URL    string    `json:"URL"`
+	File   string    `json:"File"`   // name of the PDF file in the bulletins directory, empty if not downloaded
+	SHA256 string    `json:"SHA256"` // checksum of the PDF file, if downloaded
+}
+
+// Downloaded reports whether the PDF of the bulletin has been downloaded
+func (b BulletinEntry) Downloaded() bool {
+	return b.File != ""
+}
+
+// BulletinIndex holds the bulletins listed at BulletinURL, the most recent first
+type BulletinIndex struct {
+	Bulletins []BulletinEntry `json:"Bulletins"`
+
+	dirPath string
+}
+
+// returns the directory holding the bulletins
+func bulletinsDir(configuration *config.BDSICEConfig) string {
+	return filepath.Join(configuration.DataLocalPath, BulletinsDirName)
+}
+
+// LoadBulletinIndex reads the index of the bulletins in the data path. A missing index yields an
+// empty one.
+func LoadBulletinIndex(configuration *config.BDSICEConfig) (*BulletinIndex, error) {
+	index := &BulletinIndex{dirPath: bulletinsDir(configuration)}
+
+	content, err := ioutil.ReadFile(filepath.Join(index.dirPath, BulletinIndexFileName))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("download.LoadBulletinIndex(): %w", err)
+	}
+
+	err = json.Unmarshal(content, index)
+	if err != nil {
+		return nil, fmt.Errorf("download.LoadBulletinIndex(): %s: %w", BulletinIndexFileName, err)
+	}
+
+	return index, nil
+}
+
+// Save writes the index to the bulletins directory
+func (index *BulletinIndex) Save() error {
+	err := os.MkdirAll(index.dirPath, 0755)
+	if err != nil {
+		return fmt.Errorf("download.BulletinIndex.Save(): %w", err)
+	}
+
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("download.BulletinIndex.Save(): %w", err)
+	}
+
+	filePath := filepath.Join(index.dirPath, BulletinIndexFileName)
+	err = utils.WriteFileAtomic(filePath, content)
+	if err != nil {
+		return fmt.Errorf("download.BulletinIndex.Save(): %w", err)
+	}
+
+	return nil
+}
+
+// Path returns the path of the PDF file of a bulletin that has been downloaded
+func (index *BulletinIndex) Path(b BulletinEntry) string {
+	return filepath.Join(index.dirPath, b.File)
+}
+
+// adds the bulletins listed to the index. Bulletins already indexed keep their downloaded file.
+func (index *BulletinIndex) merge(listed []BulletinEntry) {
+	known := make(map[string]int)
+	for i, b := range index.Bulletins {
+		known[b.URL] = i
+	}
+
+	for _, b := range listed {
+		if i, ok := known[b.URL]; ok {
+			index.Bulletins[i].Date = b.Date
+			index.Bulletins[i].Title = b.Title
+			continue
+		}
+		index.Bulletins = append(index.Bulletins, b)
+	}
+
+	sort.SliceStable(index.Bulletins, func(i, j int) bool { return index.Bulletins[i].Date.After(index.Bulletins[j].Date) })
+}
+
+// Find returns the bulletin a reference points to: "latest" or an empty string for the most
+// recent one, its position in the index starting at 1, or a date such as 2026-10 or 202610, in
+// which case the most recent bulletin of that date is returned
+func (index *BulletinIndex) Find(reference string) (*BulletinEntry, error) {
+	if len(index.Bulletins) == 0 {
+		return nil, fmt.Errorf("download.BulletinIndex.Find(): no bulletins indexed")
+	}
+
+	if reference == "" || strings.EqualFold(reference, "latest") {
+		return &index.Bulletins[0], nil
+	}
+
+	// positions are short numbers, dates have at least a year
+	if position, err := strconv.Atoi(reference); err == nil && len(reference) < 4 {
+		if position < 1 || position > len(index.Bulletins) {
+			return nil, fmt.Errorf("download.BulletinIndex.Find(): there are %d bulletins indexed", len(index.Bulletins))
+		}
+		return &index.Bulletins[position-1], nil
+	}
+
+	digits := strings.NewReplacer("-", "", "/", "").Replace(reference)
+	for i, b := range index.Bulletins {
+		if strings.HasPrefix(b.Date.Format("20060102"), digits) {
+			return &index.Bulletins[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("download.BulletinIndex.Find(): no bulletin matches %q", reference)
+}
+
+var spanishMonths = map[string]time.Month{
+	"enero": time.January, "febrero": time.February, "marzo": time.March, "abril": time.April,
+	"mayo": time.May, "junio": time.June, "julio": time.July, "agosto": time.August,
+	"septiembre": time.September, "setiembre": time.September, "octubre": time.October,
+	"noviembre": time.November, "diciembre": time.December,
+}
+
+// dates in link texts, such as 15/10/2026 or "octubre de 2026", and in file names, such as
+// BCE_202610.pdf or boletin-2026-10-15.pdf
+var (
+	numericDateRe  = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4})\b`)
+	monthYearRe    = regexp.MustCompile(`(?i)\b([a-záéíóú]+)\s+(?:de\s+)?(\d{4})\b`)
+	fileNameDateRe = regexp.MustCompile(`(\d{4})[-_]?(\d{2})(?:[-_]?(\d{2}))?`)
+)
+
+// returns the date of a bulletin from the text of its link or, failing that, from its file name
+func bulletinDate(text string, fileName string) (time.Time, bool) {
+	if m := numericDateRe.FindStringSubmatch(text); m != nil {
+		d, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		y, _ := strconv.Atoi(m[3])
+		if mo >= 1 && mo <= 12 {
+			return time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.UTC), true
+		}
+	}
+
+	for _, m := range monthYearRe.FindAllStringSubmatch(text, -1) {
+		if month, ok := spanishMonths[strings.ToLower(m[1])]; ok {
+			y, _ := strconv.Atoi(m[2])
+			return time.Date(y, month, 1, 0, 0, 0, 0, time.UTC), true
+		}
+	}
+
+	if m := fileNameDateRe.FindStringSubmatch(fileName); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d := 1
+		if m[3] != "" {
+			d, _ = strconv.Atoi(m[3])
+		}
+		if y >= 1990 && mo >= 1 && mo <= 12 && d >= 1 && d <= 31 {
+			return time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.UTC), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// returns the bulletins linked from the listing page at listingURL: links to PDF files whose date
+// can be told from their text or file name
+func parseBulletins(listingURL string, r io.Reader) ([]BulletinEntry, error) {
+	base, err := url.Parse(listingURL)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var bulletins []BulletinEntry
+	seen := make(map[string]bool)
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			href, err := url.Parse(strings.TrimSpace(attribute(n, "href")))
+			if err == nil && strings.EqualFold(path.Ext(href.Path), ".pdf") {
+				link := base.ResolveReference(href).String()
+				title := textContent(n)
+				if title == "" {
+					title = path.Base(href.Path)
+				}
+
+				if date, ok := bulletinDate(title, path.Base(href.Path)); ok && !seen[link] {
+					seen[link] = true
+					bulletins = append(bulletins, BulletinEntry{Date: date, Title: title, URL: link})
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(root)
+
+	sort.SliceStable(bulletins, func(i, j int) bool { return bulletins[i].Date.After(bulletins[j].Date) })
+
+	return bulletins, nil
+}
+
+// ListBulletins scrapes the bulletins listed at BulletinURL and adds them to the index, which is
+// returned. Nothing is downloaded.
+func ListBulletins(ctx context.Context, configuration *config.BDSICEConfig) (*BulletinIndex, error) {
+	index, err := LoadBulletinIndex(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", err)
+	}
+
+	session, err := NewSession(configuration.UserAgent)
+	if err != nil {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", err)
+	}
+
+	response, err := session.Open(ctx, configuration.BulletinURL, "")
+	if err != nil {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", err)
+	}
+	defer response.Body.Close()
+
+	listed, err := parseBulletins(configuration.BulletinURL, response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", err)
+	}
+
+	if len(listed) == 0 {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", &LayoutError{URL: configuration.BulletinURL, Element: "link to a bulletin PDF"})
+	}
+
+	index.merge(listed)
+
+	err = index.Save()
+	if err != nil {
+		return nil, fmt.Errorf("download.ListBulletins(): %w", err)
+	}
+
+	return index, nil
+}
+
+// checks that filePath holds a complete PDF document
+func validatePDF(filePath string) error {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return fmt.Errorf("not a PDF document")
+	}
+
+	// the end-of-file marker may be followed by a few bytes of whitespace
+	tail := content
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("the PDF document is truncated")
+	}
+
+	return nil
+}
+
+// DownloadBulletin downloads the PDF of the bulletin a reference points to, as understood by
+// BulletinIndex.Find(), unless it has been downloaded already, and records it in the index
+func DownloadBulletin(ctx context.Context, configuration *config.BDSICEConfig, index *BulletinIndex, reference string) (*BulletinEntry, error) {
+	bulletin, err := index.Find(reference)
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadBulletin(): %w", err)
+	}
+
+	if bulletin.Downloaded() {
+		if _, err := os.Stat(index.Path(*bulletin)); err == nil {
+			return bulletin, nil
+		}
+	}
+
+	err = os.MkdirAll(index.dirPath, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadBulletin(): %w", err)
+	}
+
+	session, err := NewSession(configuration.UserAgent)
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadBulletin(): %w", err)
+	}
+
+	// files are named after the date of the bulletin, so that they sort in order
+	fileName := fmt.Sprintf("%s_%s", bulletin.Date.Format("2006-01-02"), path.Base(bulletin.URL))
+	if u, err := url.Parse(bulletin.URL); err == nil {
+		fileName = fmt.Sprintf("%s_%s", bulletin.Date.Format("2006-01-02"), path.Base(u.Path))
+	}
+
+	file, err := fetchFile(ctx, index.dirPath, fileName, func(offset int64) (*http.Response, error) {
+		return session.OpenFrom(ctx, bulletin.URL, configuration.BulletinURL, offset)
+	}, validatePDF)
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadBulletin(): %w", err)
+	}
+
+	bulletin.File = filepath.Base(file.path)
+	bulletin.SHA256 = file.sha256
+
+	err = index.Save()
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadBulletin(): %w", err)
+	}
+
+	return bulletin, nil
+}
+
+// downloads the latest available "coyuntura" bulletin, and the past ones given as references as
+// understood by BulletinIndex.Find(), into the bulletins directory of the data path. Returns the
+// bulletins downloaded, the latest first, each of them once.
+func Bulletin(ctx context.Context, configuration *config.BDSICEConfig, references ...string) ([]BulletinEntry, error) {
+	index, err := ListBulletins(ctx, configuration)
+	if err != nil {
+		return nil, fmt.Errorf("download.Bulletin(): %w", err)
+	}
+
+	var downloaded []BulletinEntry
+	seen := make(map[string]bool)
+	for _, reference := range append([]string{"latest"}, references...) {
+		bulletin, err := index.Find(reference)
+		if err != nil {
+			return downloaded, fmt.Errorf("download.Bulletin(): %w", err)
+		}
+		if seen[bulletin.URL] {
+			continue
+		}
+		seen[bulletin.URL] = true
+
+		bulletin, err = DownloadBulletin(ctx, configuration, index, reference)
+		if err != nil {
+			return downloaded, fmt.Errorf("download.Bulletin(): %w", err)
+		}
+		downloaded = append(downloaded, *bulletin)
+	}
+
+	return downloaded, nil
+}
@@ -3,17 +3,15 @@ package download
 
 import (
 	"archive/zip"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 
 	"github.com/fabiansalazares/bdsicego/database"
 	"github.com/fabiansalazares/bdsicego/series"
-
-	"net/http/httputil"
+	"github.com/fabiansalazares/bdsicego/tree"
 
 	"net/url"
 	"os"
@@ -25,106 +23,87 @@ import (
 	//	"bytes"
 	//	"encoding/json"
 
-	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 
 	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/progress"
 )
 
-// copies from response to destination providing a visual lead on how much remains to be downloaded
-func downloadWithCounter(configuration *config.BDSICEConfig, response *http.Response) (string, int64, error) {
-	var byteCounter int64
-	var zipFileName string
-	var zipFileLength int
-	var zipFileLengthString string
-	var zipFilePath string
+// Should check if full db exists and ask user for confirmation
+// PLACEHOLDER for now
+func alreadyDownloadedFullDatabase(configuration *config.BDSICEConfig, databasePath string) bool {
 
-	// Check that there is actually a file waiting to be downloaded
-	// We do this by checking that there is a Content-Disposition header, and that the
-	// header includes a 'filename' variable.
-	if _, ok := response.Header["Content-Disposition"]; !ok {
-		log.Fatalln("BDSICE's response does not include a zip file to download.")
+	if _, err := os.Stat(databasePath); !os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(configuration.DatabaseLocalPath, database.CatalogFileName)); !os.IsNotExist(err) {
+			return true
+		}
 	}
 
-	if headerFileNameParts := strings.Split(response.Header["Content-Disposition"][0], "filename="); len(headerFileNameParts) > 1 {
-		zipFileName = headerFileNameParts[1]
-	} else {
-		log.Fatalln("No filename in Content-Disposition.")
-	}
+	return false
+}
 
-	// Join local database path and zip file name to get full path of database zip file
-	zipFilePath = path.Join(configuration.DatabaseLocalPath, zipFileName)
+// location of the page that serves the zip file of the update selected in the updates page,
+// relative to the updates page
+const archiveRelativeURL = "../DescargaArchivo.aspx?estadisticas=True&tipo=1"
 
-	// Extract content size by reading Content-Length header
-	zipFileLength, err := strconv.Atoi(response.Header["Content-Length"][0])
+// returns the URL of the page serving update zip files for the updates page at updateURL, so that
+// it follows the host configured in updateurl
+func archiveURL(updateURL string) (string, error) {
+	base, err := url.Parse(updateURL)
 	if err != nil {
-		log.Printf("Content-Length could not be read. Assuming length unknown")
-		// if we could not determine, we set the length string to "?K"
-		zipFileLengthString = "?K"
-	} else {
-		zipFileLengthString = fmt.Sprintf("%d", (zipFileLength / 1024))
+		return "", err
 	}
 
-	// Create an empty file at zipFilePath and return a file handler
-	out, err := os.Create(zipFilePath)
+	relative, err := url.Parse(archiveRelativeURL)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
-	defer out.Close()
-
-	// Download from response body into the zip file that we just created
-	fmt.Printf("Downloading...")
-	for {
-		bytesCopied, err := io.CopyN(out, response.Body, 1024*100)
-		if err != nil {
-			fmt.Printf("\rCopied: %sK\tTotal: %sK\n", zipFileLengthString, zipFileLengthString)
-			fmt.Printf("Download complete.\n")
-			fmt.Printf("\n")
-			break
-		} else {
-			byteCounter = byteCounter + bytesCopied
-			fmt.Printf("\rCopied %dK\tTotal: %sK\r", (byteCounter / 1024), zipFileLengthString)
-		}
-	}
-
-	return zipFilePath, byteCounter, err
+	return base.ResolveReference(relative).String(), nil
 }
 
-// check if an update has been applied already. This is somewhat of a placeholder
-// function. Currently it just checks if a folder named daymonthyear exists
-// and returns true if it exists. It should check against somekind of database
-// that tracked the integrity of the database and the updates that have been
-// applied.
-func alreadyDownloadedUpdate(updatePath string, day int, month int, year int) bool {
+// event target of the link to the full database in HomeBDSICE.aspx
+const fullDatabaseTarget = "lbutton_BdsiceCompleta"
 
-	pathToCheck := path.Join(updatePath, fmt.Sprintf("UltActualiz_%04d%02d%02d", year, month, day))
-	fmt.Printf("Checking path: %s\n", pathToCheck)
+// id of the grid listing the updates in Ultimasactualizaciones_new.aspx
+const updatesGridID = "dg_Actualizaciones"
 
-	if _, err := os.Stat(pathToCheck); !os.IsNotExist(err) {
-		// it does exists, thus update has been downloaded already
-		return true
-	} else {
-		fmt.Printf("There is an update that has not been downloaded yet.\n")
-		return false
-	}
+// an update listed in Ultimasactualizaciones_new.aspx and the event target of its link
+type updateLink struct {
+	date   time.Time
+	target string
 }
 
-// Should check if full db exists and ask user for confirmation
-// PLACEHOLDER for now
-func alreadyDownloadedFullDatabase(configuration *config.BDSICEConfig, databasePath string) bool {
+// returns the updates listed in the updates page, in the order they are listed
+func updateLinks(page *Page) ([]updateLink, error) {
+	rows, err := page.Grid(updatesGridID)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := os.Stat(databasePath); !os.IsNotExist(err) {
-		fmt.Printf("Checking %s\n", filepath.Join(configuration.DatabaseLocalPath, "db.json"))
+	var links []updateLink
+	for _, row := range rows {
+		// the header row has no link
+		if len(row.Targets) == 0 || len(row.Cells) == 0 {
+			continue
+		}
 
-		if _, err := os.Stat(filepath.Join(configuration.DatabaseLocalPath, "db.json")); !os.IsNotExist(err) {
-			return true
+		var day, month, year int
+		_, err := fmt.Sscanf(row.Cells[0], "Series actualizadas el día %d del %d de %d", &day, &month, &year)
+		if err != nil {
+			return nil, &LayoutError{URL: page.URL, Element: fmt.Sprintf("date of the update in %q", row.Cells[0])}
 		}
+
+		links = append(links, updateLink{
+			date:   time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC),
+			target: row.Targets[0],
+		})
 	}
 
-	return false
+	return links, nil
 }
 
 // returns DOM elements by id
@@ -142,8 +121,9 @@ func getElementById(id string, n *html.Node) (element *html.Node, ok bool) {
 	return
 }
 
-// unzips origin file to destination path, creating a folder if necessary
-func unzipFile(origin string, destination string, directExtract bool) ([]string, error) {
+// unzips origin file to destination path, creating a folder if necessary. The files extracted are
+// reported to the reporter of ctx.
+func unzipFile(ctx context.Context, origin string, destination string, directExtract bool) ([]string, error) {
 	var extractedFiles []string
 	var extractDirPath string
 
@@ -157,7 +137,9 @@ func unzipFile(origin string, destination string, directExtract bool) ([]string,
 	}
 	// check directory exists already. If not, create.
 	if _, err := os.Stat(extractDirPath); os.IsNotExist(err) {
-		os.Mkdir(extractDirPath, 0755) // rwxr-xr-x
+		if err = os.Mkdir(extractDirPath, 0755); err != nil { // rwxr-xr-x
+			return extractedFiles, err
+		}
 	}
 
 	r, err := zip.OpenReader(origin)
@@ -166,19 +148,23 @@ func unzipFile(origin string, destination string, directExtract bool) ([]string,
 	}
 	defer r.Close()
 
-	for _, f := range r.File {
+	progress.StartPhase(ctx, progress.PhaseExtract, filepath.Base(origin))
+
+	for i, f := range r.File {
 		fileToExtractPath := filepath.Join(extractDirPath, f.Name)
 
-		// fmt.Printf("Checking ZipSlip for: \nfileToExtractPath: %s\n%s\n", fileToExtractPath, filepath.Clean(extractDirPath)+string(os.PathSeparator))
 		// check for ZipSlip vulnerability.
 		if !strings.HasPrefix(fileToExtractPath, filepath.Clean(extractDirPath)+string(os.PathSeparator)) {
-			log.Fatalf("%s: illegal file path. Possible ZipSlip attack.\n", fileToExtractPath)
+			return extractedFiles, fmt.Errorf("%s: %w", f.Name, ErrZipSlip)
 		}
 
 		extractedFiles = append(extractedFiles, fileToExtractPath)
 
 		if f.FileInfo().IsDir() {
-			os.MkdirAll(fileToExtractPath, os.ModePerm)
+			if err = os.MkdirAll(fileToExtractPath, os.ModePerm); err != nil {
+				return extractedFiles, err
+			}
+			progress.Advance(ctx, progress.KindExtracted, filepath.Base(origin), int64(i+1), int64(len(r.File)))
 			continue
 		}
 
@@ -186,6 +172,9 @@ func unzipFile(origin string, destination string, directExtract bool) ([]string,
 			return extractedFiles, err
 		}
 
+		// files are replaced rather than overwritten, since they may be shared, as hard links, with
+		// other states of the database
+		os.Remove(fileToExtractPath)
 		outFile, err := os.OpenFile(fileToExtractPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
 		if err != nil {
 			return extractedFiles, err
@@ -203,64 +192,67 @@ func unzipFile(origin string, destination string, directExtract bool) ([]string,
 		if err != nil {
 			return extractedFiles, err
 		}
+
+		progress.Advance(ctx, progress.KindExtracted, filepath.Base(origin), int64(i+1), int64(len(r.File)))
 	}
 
 	return extractedFiles, nil
 }
 
-func DecodePartialDatabase(configuration *config.BDSICEConfig, filesToDecode []string) ([]*series.BDSICESerie, error) {
+// decodes the given .xer files and writes the resulting series to the binary store of the database,
+// replacing the series with the same codes that the store might already hold. Decoding stops when
+// ctx is done.
+func DecodePartialDatabase(ctx context.Context, configuration *config.BDSICEConfig, filesToDecode []string) ([]*series.BDSICESerie, error) {
 	var seriesDecoded []*series.BDSICESerie
 	var counter int
 	var lenSeriesToDecode = len(filesToDecode)
 
+	progress.StartPhase(ctx, progress.PhaseDecode, "")
+
 	for _, fileToDecode := range filesToDecode {
 		// decode only .xer files
 		if !strings.HasSuffix(fileToDecode, ".xer") {
 			continue
 		}
 
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("download.DecodePartialDatabase(): %w", ctx.Err())
+		}
+
 		// this is where CONCURRENCY should be added
 		serieToAdd, err := decode.Decode(configuration.DatabaseLocalPath, path.Base(fileToDecode))
 		if err != nil {
-			return nil, fmt.Errorf("download.DecodePartialDatabase(): %s", err.Error())
+			return nil, fmt.Errorf("download.DecodePartialDatabase(): %w", err)
 		}
 
 		seriesDecoded = append(seriesDecoded, serieToAdd)
 
-		serieJSON, err := json.MarshalIndent(serieToAdd, "", "   ")
-		if err != nil {
-			return nil, fmt.Errorf("download.DecodePartialDatabase(): %s", err.Error())
-		}
-
-		fileToWrite := path.Join(configuration.DatabaseLocalPath, serieToAdd.SerieCode+".json")
-		//fmt.Printf("File to write: %s\n", fileToWrite)
-
-		err = ioutil.WriteFile(fileToWrite, serieJSON, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("download.DecodePartialDatabase(): %s", err.Error())
-		}
-
 		counter = counter + 1
 
-		fmt.Printf("Decoded: %d\tTotal: %d\r", counter, lenSeriesToDecode)
+		progress.Advance(ctx, progress.KindDecoded, "", int64(counter), int64(lenSeriesToDecode))
 	}
 
-	fmt.Printf("\nDecoding completed.\n")
+	progress.StartPhase(ctx, progress.PhaseStore, series.StoreFileName)
+
+	err := series.UpdateStore(filepath.Join(configuration.DatabaseLocalPath, series.StoreFileName), seriesDecoded)
+	if err != nil {
+		return nil, fmt.Errorf("download.DecodePartialDatabase(): %w", err)
+	}
 
 	return seriesDecoded, nil
 
 }
 
-// decodes all the .xer files in dbLocalPath and saves the BDSICESeries objects into JSON files
-// with the series code as file name. It wraps DecodePartialDatabase() by calling it with
+// decodes all the .xer files in dbLocalPath and saves the BDSICESeries objects into the binary
+// store of the database. It wraps DecodePartialDatabase() by calling it with
 // an array containing all the files in configuration.DatabaseLocalPath
-func DecodeFullDatabase(configuration *config.BDSICEConfig) ([]*series.BDSICESerie, error) {
+func DecodeFullDatabase(ctx context.Context, configuration *config.BDSICEConfig) ([]*series.BDSICESerie, error) {
 
 	dbLocalPath := configuration.DatabaseLocalPath
 
 	filesToDecode, err := ioutil.ReadDir(dbLocalPath)
 	if err != nil {
-		return nil, fmt.Errorf("download.DecodeFullDatabase(): %s", err.Error())
+		return nil, fmt.Errorf("download.DecodeFullDatabase(): %w", err)
 	}
 
 	var filesToDecodePaths []string
@@ -270,9 +262,9 @@ func DecodeFullDatabase(configuration *config.BDSICEConfig) ([]*series.BDSICESer
 		}
 	}
 
-	seriesDecoded, err := DecodePartialDatabase(configuration, filesToDecodePaths)
+	seriesDecoded, err := DecodePartialDatabase(ctx, configuration, filesToDecodePaths)
 	if err != nil {
-		return nil, fmt.Errorf("download.DecodeFullDatabase(): error decoding files: %s", err.Error())
+		return nil, fmt.Errorf("download.DecodeFullDatabase(): error decoding files: %w", err)
 
 	}
 
@@ -281,681 +273,471 @@ func DecodeFullDatabase(configuration *config.BDSICEConfig) ([]*series.BDSICESer
 
 // writes the full database BDSICEDatabase object to dbLocalPath in JSON format
 // This function could be made redudant if no new series have been added. It would requiere
-// checking
-func BuildFullDatabase(configuration *config.BDSICEConfig, seriesDecoded []*series.BDSICESerie) error {
+// checking. The catalog is not written if ctx is done.
+func BuildFullDatabase(ctx context.Context, configuration *config.BDSICEConfig, seriesDecoded []*series.BDSICESerie) error {
 	dbLocalPath := configuration.DatabaseLocalPath
 
+	progress.StartPhase(ctx, progress.PhaseBuild, "")
+
 	db, err := database.BuildDatabase(seriesDecoded)
 
 	if err != nil {
-		return fmt.Errorf("download.BuildFullDatabase(): %s", err.Error())
+		return fmt.Errorf("download.BuildFullDatabase(): %w", err)
 	}
 
-	/*
-		randomSerie := "400000"
-
-		fmt.Printf("Printing a random db element: \nserieCode: %s\ntitle: %s\n", randomSerie, db.Series[randomSerie])
-	*/
+	if ctx.Err() != nil {
+		return fmt.Errorf("download.BuildFullDatabase(): %w", ctx.Err())
+	}
 
-	dbJSON, err := json.MarshalIndent(db, "", "   ")
+	err = db.Save(dbLocalPath)
 	if err != nil {
-		return fmt.Errorf("download.BuildFullDatabase(): %s", err.Error())
+		return fmt.Errorf("download.BuildFullDatabase(): %w", err)
 	}
 
-	fileToWrite := path.Join(dbLocalPath, "db.json")
-	//fmt.Printf("File to write: %s\n", fileToWrite)
-
-	err = ioutil.WriteFile(fileToWrite, dbJSON, 0644)
+	err = tree.Save(dbLocalPath, tree.Build(db))
 	if err != nil {
-		return fmt.Errorf("download.BuildFullDatabase(): %s", err.Error())
+		return fmt.Errorf("download.BuildFullDatabase(): %w", err)
 	}
 
-	// fmt.Printf("Database built succesfully\n")
+	progress.Advance(ctx, progress.KindBuilt, "", int64(len(seriesDecoded)), int64(len(seriesDecoded)))
 
 	return nil
 }
 
-// downloads the full BDSICE database and returns a slice containing the codes of the downloaded series
-func DownloadFullDatabase(configuration *config.BDSICEConfig, forceDownload bool) ([]*series.BDSICESerie, error) {
-	//	dbLocalPath := path.Join(configuration.DatabaseLocalPath, "db")
-
+// merges the series decoded from an update into the existing catalog and writes it back to
+// dbLocalPath. Series whose data can no longer be found in dbLocalPath are removed from the
+// catalog. If there is no catalog yet, a new one is built from the decoded series. The catalog is
+// not written if ctx is done.
+func UpdateDatabase(ctx context.Context, configuration *config.BDSICEConfig, seriesDecoded []*series.BDSICESerie) (*database.MergeReport, error) {
 	dbLocalPath := configuration.DatabaseLocalPath
-	// fmt.Println(dbLocalPath)
 
-	/////////////////
-	// first thing is to check if it exists already and if so, prompt unless force true
-	if !forceDownload {
-		if alreadyDownloadedFullDatabase(configuration, dbLocalPath) { // currently a placeholder: always true
-			fmt.Printf("Already existing DB. Do you want to proceed to download anyways?")
-			var s string
-			fmt.Printf(" (y/n): ")
-			fmt.Scan(&s)
-			s = strings.TrimSpace(s)
-			s = strings.ToLower(s)
-			if !(s == "y" || s == "yes") {
-				fmt.Printf("Want to proceed with the decoding?")
-				var s string
-				fmt.Printf(" (y/n): ")
-				fmt.Scan(&s)
-				s = strings.TrimSpace(s)
-				s = strings.ToLower(s)
-				if s == "y" || s == "yes" {
-					seriesDecoded, err := DecodeFullDatabase(configuration)
-					if err != nil {
-						return nil, fmt.Errorf("download.DownloadFullDatabase(): %s", err.Error())
-					}
-
-					err = BuildFullDatabase(configuration, seriesDecoded)
-					if err != nil {
-						return nil, fmt.Errorf("download.DownloadFullDatabase(): %s", err.Error())
-					}
-
-					return nil, nil
-				} else {
-					return nil, fmt.Errorf("download.DownloadFullDatabase(): database downloaded but not decoded.")
-				}
-			} else {
-				fmt.Printf("Continuing\n")
-			}
-		}
-	}
-
-	fmt.Printf("Downloading full database to path: %s\n", dbLocalPath)
+	progress.StartPhase(ctx, progress.PhaseBuild, "")
 
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	// FIRST PART:	initial GET request to get session's ids that will be
-	//				used after in POST requests.
-	client := &http.Client{}
+	var db *database.BDSICEDatabase
+	var err error
 
-	requestInitialGet, err := http.NewRequest("GET", configuration.DownloadURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("download.DownloadFullDatabase(): %s.", err.Error())
-	}
-
-	// dumping initial GET request
-	_, err = httputil.DumpRequestOut(requestInitialGet, true)
-	if err != nil {
-		return nil, fmt.Errorf("download.DownloadFullDatabase(): %s.", err.Error())
+	if _, statErr := os.Stat(filepath.Join(dbLocalPath, database.CatalogFileName)); os.IsNotExist(statErr) {
+		db, err = database.BuildDatabase(nil)
 	} else {
-		//fmt.Printf("Dumping Initial GET Request\n")
-		//fmt.Printf("%s", dump)
-	}
-
-	requestInitialGet.Host = "serviciosede.mineco.gob.es"
-
-	headersInitialGetMap := map[string]string{
-		"User-Agent":                configuration.UserAgent,
-		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"Accept-Encoding":           "gzip, deflate",
-		"DNT":                       "1",
-		"Connection":                "keep-alive",
-		"Upgrade-Insecure-Requests": "1"}
-
-	for k, v := range headersInitialGetMap {
-		requestInitialGet.Header.Set(k, v)
+		db, err = database.LoadDatabase(configuration)
 	}
-
-	responseInitialGet, err := client.Do(requestInitialGet)
 	if err != nil {
-		return nil, fmt.Errorf("download.DownloadFullDatabase(): %s.", err.Error())
+		return nil, fmt.Errorf("download.UpdateDatabase(): %w", err)
 	}
-	defer responseInitialGet.Body.Close()
-
-	// dumping initial GET response
-	//_, err = httputil.DumpResponse(responseInitialGet, true)
-	_, err = httputil.DumpResponse(responseInitialGet, true)
 
+	available, err := availableCodes(dbLocalPath)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	} else {
-		//fmt.Printf("Received response to initial GET request. Dumping\n")
-		//	fmt.Printf("%s", dump)
+		return nil, fmt.Errorf("download.UpdateDatabase(): %w", err)
 	}
 
-	// Extract all the session id parameters from the initial GET response
-
-	root, err := html.Parse(responseInitialGet.Body)
-
-	var eventTargetValue string
-	var eventArgumentValue string
-	var viewStateValue string
-	var viewStateGeneratorValue string
-	var eventValidationValue string
-	var SessionId string
+	report := db.Merge(seriesDecoded, available)
 
-	eventTarget, ok := getElementById("__EVENTTARGET", root)
-	if !ok {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range eventTarget.Attr {
-		if attr.Key == "value" {
-			eventTargetValue = attr.Val
-		}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("download.UpdateDatabase(): %w", ctx.Err())
 	}
 
-	eventArgument, _ := getElementById("__EVENTARGUMENT", root)
+	err = db.Save(dbLocalPath)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range eventArgument.Attr {
-		if attr.Key == "value" {
-			eventArgumentValue = attr.Val
-		}
+		return nil, fmt.Errorf("download.UpdateDatabase(): %w", err)
 	}
 
-	viewState, _ := getElementById("__VIEWSTATE", root)
+	err = tree.Save(dbLocalPath, tree.Build(db))
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range viewState.Attr {
-		if attr.Key == "value" {
-			viewStateValue = attr.Val
-		}
+		return nil, fmt.Errorf("download.UpdateDatabase(): %w", err)
 	}
 
-	viewStateGenerator, _ := getElementById("__VIEWSTATEGENERATOR", root)
-	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range viewStateGenerator.Attr {
-		if attr.Key == "value" {
-			viewStateGeneratorValue = attr.Val
-		}
-	}
+	return report, nil
+}
+
+// returns the codes of the series that have data in dbLocalPath, either as a .xer file or in the
+// series store
+func availableCodes(dbLocalPath string) ([]string, error) {
+	available := []string{}
 
-	eventValidation, _ := getElementById("__EVENTVALIDATION", root)
+	files, err := ioutil.ReadDir(dbLocalPath)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
-	for _, attr := range eventValidation.Attr {
-		if attr.Key == "value" {
-			eventValidationValue = attr.Val
+
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".xer" {
+			available = append(available, strings.TrimSuffix(file.Name(), ".xer"))
 		}
 	}
 
-	for _, cookie := range responseInitialGet.Cookies() {
-		if cookie.Name == "ASP.NET_SessionId" {
-			SessionId = cookie.Value
+	storeFilePath := filepath.Join(dbLocalPath, series.StoreFileName)
+	if _, err := os.Stat(storeFilePath); err == nil {
+		st, err := series.OpenStore(storeFilePath)
+		if err != nil {
+			return nil, err
 		}
+		available = append(available, st.Codes()...)
+		st.Close()
 	}
 
-	cookieSessionIdValue := fmt.Sprintf("ASP.NET_SessionId=%s", SessionId)
-	io.Copy(ioutil.Discard, responseInitialGet.Body)
-	responseInitialGet.Body.Close()
-
-	// fmt.Printf("Valores extraídos del primer GET:\neventTarget: %s\neventArgument: %s\nviewState: %s\nviewStateGenerator: %s\neventValidation: %s\ncookieSessionIdValue: %s\n", eventTargetValue, eventArgumentValue, viewStateValue, viewStateGeneratorValue, eventValidationValue, cookieSessionIdValue)
+	return available, nil
+}
 
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	// Second part:	build a post request with the session info that we got
-	//				from the initial GET request
-	//				Headers and data to be posted need to be built.
+// downloads the full BDSICE database and returns a slice containing the codes of the downloaded series.
+// If the database has been downloaded already, confirm is asked whether to download it again and,
+// if not, whether to decode the files downloaded instead, unless forceDownload is true. ctx
+// cancels the download and the decoding. The database is built as a new state, which only replaces
+// the current one once it is complete.
+func DownloadFullDatabase(ctx context.Context, configuration *config.BDSICEConfig, forceDownload bool, confirm ConfirmFunc) ([]*series.BDSICESerie, error) {
+	//	dbLocalPath := path.Join(configuration.DatabaseLocalPath, "db")
 
-	// __EVENTTARGET is an empty string in the answer but must be set to this
-	// to download the latest update.
+	dbLocalPath := configuration.DatabaseLocalPath
+	// fmt.Println(dbLocalPath)
 
-	client = &http.Client{}
+	/////////////////
+	// first thing is to check if it exists already and if so, ask for confirmation unless force true
+	if !forceDownload && alreadyDownloadedFullDatabase(configuration, dbLocalPath) {
+		if !ask(confirm, "Already existing DB. Do you want to proceed to download anyways?") {
+			if !ask(confirm, "Want to proceed with the decoding?") {
+				return nil, fmt.Errorf("download.DownloadFullDatabase(): database downloaded but not decoded: %w", ErrNotConfirmed)
+			}
 
-	eventTargetValue = "lbutton_BdsiceCompleta"
+			// the files of the current state are decoded again into a new state
+			stage, err := beginState(configuration, true)
+			if err != nil {
+				return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
+			}
 
-	dataPostMap := map[string]string{
-		"__EVENTTARGET":        eventTargetValue,
-		"__EVENTARGUMENT":      eventArgumentValue,
-		"__VIEWSTATE":          viewStateValue,
-		"__VIEWSTATEGENERATOR": viewStateGeneratorValue,
-		"__EVENTVALIDATION":    eventValidationValue}
+			seriesDecoded, err := DecodeFullDatabase(ctx, stage.configuration)
+			if err == nil {
+				err = BuildFullDatabase(ctx, stage.configuration, seriesDecoded)
+			}
+			if err == nil {
+				err = stage.commit(configuration)
+			}
+			if err != nil {
+				stage.discard()
+				return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
+			}
 
-	// as urlencoded form
-	postData := url.Values{}
-	for k, v := range dataPostMap {
-		postData.Set(k, v)
+			return nil, nil
+		}
 	}
 
-	postDataEncoded := postData.Encode()
+	progress.Messagef(ctx, "Downloading full database to path: %s", configuration.DatabaseRoot())
 
-	requestPost, err := http.NewRequest("POST", configuration.DownloadURL, strings.NewReader(postDataEncoded))
+	// HomeBDSICE.aspx serves the full database in response to a postback of its download link
+	session, err := NewSession(configuration.UserAgent)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
 	}
 
-	headersPostMap := map[string]string{
-		"User-Agent":                configuration.UserAgent,
-		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"Accept-Encoding":           "gzip, deflate",
-		"Connection":                "keep-alive",
-		"Content-Type":              "application/x-www-form-urlencoded",
-		"Content-Length":            strconv.Itoa(len(postDataEncoded)),
-		"Origin":                    "http://serviciosede.mineco.gob.es",
-		"DNT":                       "1",
-		"Referer":                   configuration.DownloadURL,
-		"Cookie":                    cookieSessionIdValue,
-		"Upgrade-Insecure-Requests": "1"}
+	page, err := session.Get(ctx, configuration.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
+	}
 
-	for k, v := range headersPostMap {
-		requestPost.Header.Set(k, v)
-		// fmt.Printf("%s : %s\n", k, v)
+	if _, err := page.Element(fullDatabaseTarget); err != nil {
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
 	}
 
-	requestPost.Host = "serviciosede.mineco.gob.es"
+	// download the database contained in a .zip file from POST response body. Dropped transfers are
+	// resumed by posting back again with a Range header.
+	zipFilePath, err := downloadFile(ctx, configuration, func(offset int64) (*http.Response, error) {
+		return page.PostbackFrom(ctx, fullDatabaseTarget, "", offset)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
+	}
 
-	//// Actual POST request
-	//fmt.Println("\nPerforming POST request")
-	responsePost, err := client.Do(requestPost)
+	// the database is built from scratch in a new state
+	stage, err := beginState(configuration, false)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
 	}
 
-	var zipFilePath string
+	ledgerEntry := LedgerEntry{Date: time.Now(), File: filepath.Base(zipFilePath)}
+	if manifest, err := LoadManifest(configuration.DatabaseRoot()); err == nil {
+		ledgerEntry.SHA256 = manifest[ledgerEntry.File].SHA256
+	}
 
-	// download the database contained in a .zip file from POST response body
-	zipFilePath, _, err = downloadWithCounter(configuration, responsePost)
+	seriesDecoded, err := buildFullState(ctx, stage.configuration, zipFilePath, ledgerEntry)
+	if err == nil {
+		err = stage.commit(configuration)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		stage.discard()
+		return nil, fmt.Errorf("download.DownloadFullDatabase(): %w", err)
 	}
 
+	return seriesDecoded, nil
+}
+
+// extracts the full database in zipFilePath into the database path of configuration, decodes it,
+// builds its catalog and records it in its ledger as ledgerEntry. If zipFilePath is a directory,
+// its .xer files are copied instead.
+func buildFullState(ctx context.Context, configuration *config.BDSICEConfig, zipFilePath string, ledgerEntry LedgerEntry) ([]*series.BDSICESerie, error) {
+	dbLocalPath := configuration.DatabaseLocalPath
+
 	// extract zip file into db folder
-	fmt.Printf("Unzipping database file...\n")
-	_, err = unzipFile(zipFilePath, dbLocalPath, true)
+	var err error
+	if info, statErr := os.Stat(zipFilePath); statErr == nil && info.IsDir() {
+		_, err = copyXerFiles(zipFilePath, dbLocalPath)
+	} else {
+		_, err = unzipFile(ctx, zipFilePath, dbLocalPath, true)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
-	fmt.Printf("Decoding .xer files into .json...\n")
 	// decode .xer files extracted into .json files
-	seriesDecoded, err := DecodeFullDatabase(configuration)
+	seriesDecoded, err := DecodeFullDatabase(ctx, configuration)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
 	// populate BDSICEDatabase with all the series available. BuildFullDatabase takes
 	// a slice of pointers to series.BDSICESerie objects.
-	err = BuildFullDatabase(configuration, seriesDecoded)
+	err = BuildFullDatabase(ctx, configuration, seriesDecoded)
+	if err != nil {
+		return nil, err
+	}
+
+	// updates published from now on are the ones to apply on top of this download
+	ledger, err := LoadLedger(dbLocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerEntry.Series = len(seriesDecoded)
+	ledgerEntry.Applied = time.Now()
+	ledger.RecordFullDatabase(ledgerEntry)
+	err = ledger.Save()
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
 	return seriesDecoded, nil
 }
 
-// checks for updates and download to local path
-// TODO:
-//			- Add updated series to json database
+// checks for updates and applies the ones missing from the local database, oldest first, recording
+// each of them in the ledger. If forceUpdate is true, the latest update is applied again even if it
+// has been applied already. If updates may have been missed because the site no longer lists them,
+// a *GapError is returned, so that a full download can be offered instead, and if there is no
+// update to apply, ErrAlreadyUpToDate. The updates are applied to a new state of the database,
+// which only replaces the current one once all of them have been applied, so that an error or ctx
+// being canceled leaves the current state untouched.
 // returns:
-// 	- slice containing extracted files
+// 	- slice containing the series decoded from the updates applied
 // 	- error
-func Update(configuration *config.BDSICEConfig, forceUpdate bool) ([]*series.BDSICESerie, error) {
+func Update(ctx context.Context, configuration *config.BDSICEConfig, forceUpdate bool) ([]*series.BDSICESerie, error) {
 
 	//	updateLocalPath := path.Join(configuration.DatabaseLocalPath, "updates")
 	updateLocalPath := configuration.DatabaseLocalPath
-	fmt.Printf("Updating to path: %s\n", updateLocalPath)
-
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	// FIRST PART:	initial GET request to get session's ids that will be
-	//				used after in POST requests.
-	client := &http.Client{}
+	progress.Messagef(ctx, "Updating to path: %s", updateLocalPath)
 
-	requestInitialGet, err := http.NewRequest("GET", configuration.UpdateURL, nil)
+	ledger, err := LoadLedger(configuration.DatabaseLocalPath)
 	if err != nil {
-		return nil, fmt.Errorf("Update(): %s.", err.Error())
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	// dumping initial GET request
-	_, err = httputil.DumpRequestOut(requestInitialGet, true)
+	// Ultimasactualizaciones_new.aspx lists the updates in a grid, the most recent first. Posting
+	// back the link of an update selects it, and DescargaArchivo.aspx then serves its zip file.
+	session, err := NewSession(configuration.UserAgent)
 	if err != nil {
-		return nil, fmt.Errorf("Update(): %s.", err.Error())
-	} else {
-		//		fmt.Printf("Initial GET Request\n")
-		//		fmt.Printf("%s", dump)
-	}
-
-	requestInitialGet.Host = "serviciosede.mineco.gob.es"
-
-	headersInitialGetMap := map[string]string{
-		"User-Agent":                configuration.UserAgent,
-		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"Accept-Encoding":           "gzip, deflate",
-		"DNT":                       "1",
-		"Connection":                "keep-alive",
-		"Upgrade-Insecure-Requests": "1"}
-
-	for k, v := range headersInitialGetMap {
-		requestInitialGet.Header.Set(k, v)
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	responseInitialGet, err := client.Do(requestInitialGet)
+	page, err := session.Get(ctx, configuration.UpdateURL)
 	if err != nil {
-		return nil, fmt.Errorf("Update(): %s.", err.Error())
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
-	defer responseInitialGet.Body.Close()
 
-	/* dumping initial GET response
-	_, err = httputil.DumpResponse(responseInitialGet, true)
+	links, err := updateLinks(page)
 	if err != nil {
-		return nil, fmt.Errorf("(): element dg_Actualizaiones_ctl2_boton could not be found.", err.Error())
-	} else {
-		//	fmt.Printf("Initial GET Request response\n")
-		//fmt.Printf("%s", dump)
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
-	*/
-
-	// Extract all the session id parameters from the initial GET response
-
-	root, err := html.Parse(responseInitialGet.Body)
-
-	/////////////////
-	// check if update exists already
-	if !forceUpdate {
-		lastUpdateLink, ok := getElementById("dg_Actualizaciones__ctl2_boton", root)
-		if !ok {
-			return nil, fmt.Errorf("Update(): %s.", err.Error())
-		}
 
-		lastUpdateText := lastUpdateLink.FirstChild.Data
-
-		var day, month, year int
-
-		fmt.Sscanf(lastUpdateText, "Series actualizadas el día %d del %d de %d",
-			&day, &month, &year)
-
-		if alreadyDownloadedUpdate(updateLocalPath, day, month, year) {
-			fmt.Printf("Update for %d-%d-%d has already been downloaded.\n",
-				day, month, year)
-			return nil, fmt.Errorf("Update(): Latest available update has been already downloaded.")
-		}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("download.Update(): %w", &LayoutError{URL: page.URL, Element: "link to an update in #" + updatesGridID})
 	}
 
-	// We have checked for updates already downloaded. We need to download the
-	// newest update that we don't have. First step is to extract the id's of
-	// the session that will be used to create a POST request that will
-	// give access to the file.
-
-	var eventTargetValue string
-	var eventArgumentValue string
-	var viewStateValue string
-	var viewStateGeneratorValue string
-	var eventValidationValue string
-	var SessionId string
-
-	eventTarget, ok := getElementById("__EVENTTARGET", root)
-	if !ok {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range eventTarget.Attr {
-		if attr.Key == "value" {
-			eventTargetValue = attr.Val
-		}
+	missing, err := pendingUpdates(ledger, links, forceUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	eventArgument, _ := getElementById("__EVENTARGUMENT", root)
+	stage, err := beginState(configuration, true)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-	for _, attr := range eventArgument.Attr {
-		if attr.Key == "value" {
-			eventArgumentValue = attr.Val
-		}
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	viewState, _ := getElementById("__VIEWSTATE", root)
-	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+	// another process may have applied some of the updates before the lock was taken, so the ones
+	// missing are those missing from the ledger of the state the new one is cloned from
+	ledger, err = LoadLedger(stage.configuration.DatabaseLocalPath)
+	if err == nil {
+		missing, err = pendingUpdates(ledger, links, forceUpdate)
 	}
-	for _, attr := range viewState.Attr {
-		if attr.Key == "value" {
-			viewStateValue = attr.Val
-		}
+	if err != nil {
+		stage.discard()
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	viewStateGenerator, _ := getElementById("__VIEWSTATEGENERATOR", root)
-	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+	progress.Messagef(ctx, "%d update(s) to apply.", len(missing))
+
+	seriesDecoded, err := applyUpdates(ctx, stage.configuration, session, missing)
+	if err == nil {
+		err = stage.commit(configuration)
 	}
-	for _, attr := range viewStateGenerator.Attr {
-		if attr.Key == "value" {
-			viewStateGeneratorValue = attr.Val
-		}
+	if err != nil {
+		stage.discard()
+		return nil, fmt.Errorf("download.Update(): %w", err)
 	}
 
-	eventValidation, _ := getElementById("__EVENTVALIDATION", root)
+	return seriesDecoded, nil
+}
+
+// returns the updates listed in links that are missing from ledger, oldest first, and the latest
+// one too if force is true. Returns ErrAlreadyUpToDate if there is none to apply.
+func pendingUpdates(ledger *Ledger, links []updateLink, force bool) ([]updateLink, error) {
+	missing, err := ledger.missing(links)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
-	for _, attr := range eventValidation.Attr {
-		if attr.Key == "value" {
-			eventValidationValue = attr.Val
-		}
+
+	if force && (len(missing) == 0 || !missing[len(missing)-1].date.Equal(links[0].date)) {
+		missing = append(missing, links[0])
 	}
 
-	for _, cookie := range responseInitialGet.Cookies() {
-		if cookie.Name == "ASP.NET_SessionId" {
-			SessionId = cookie.Value
-		}
+	if len(missing) == 0 {
+		return nil, ErrAlreadyUpToDate
 	}
 
-	cookieSessionIdValue := fmt.Sprintf("ASP.NET_SessionId=%s", SessionId)
-	io.Copy(ioutil.Discard, responseInitialGet.Body)
-	responseInitialGet.Body.Close()
+	return missing, nil
+}
 
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	///////////////////////////////////////////////////////////////
-	// Second part:	build a post request with the session info that we got
-	//				from the initial GET request
-	//				Headers and data to be posted need to be built.
+// applies the updates to the database path of configuration, oldest first, recording each of them
+// in its ledger
+func applyUpdates(ctx context.Context, configuration *config.BDSICEConfig, session *Session, updates []updateLink) ([]*series.BDSICESerie, error) {
+	ledger, err := LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		return nil, err
+	}
 
-	// __EVENTTARGET is an empty string in the answer but must be set to this
-	// to download the latest update.
+	var seriesDecoded []*series.BDSICESerie
+	for _, link := range updates {
+		progress.StartPhase(ctx, progress.PhaseUpdate, link.date.Format("2006-01-02"))
 
-	client = &http.Client{}
+		decoded, err := applyUpdate(ctx, configuration, session, link.date)
+		if err != nil {
+			return nil, fmt.Errorf("update of %s: %w", link.date.Format("2006-01-02"), err)
+		}
+		seriesDecoded = append(seriesDecoded, decoded...)
 
-	eventTargetValue = "dg_Actualizaciones$_ctl2$boton"
+		zipFileName := fmt.Sprintf("%s%s.zip", updateDirPrefix, link.date.Format("20060102"))
+		ledgerEntry := LedgerEntry{Date: link.date, File: zipFileName, Series: len(decoded), Applied: time.Now()}
 
-	dataPostMap := map[string]string{
-		"__EVENTTARGET":        eventTargetValue,
-		"__EVENTARGUMENT":      eventArgumentValue,
-		"__VIEWSTATE":          viewStateValue,
-		"__VIEWSTATEGENERATOR": viewStateGeneratorValue,
-		"__EVENTVALIDATION":    eventValidationValue}
+		if manifest, err := LoadManifest(configuration.DatabaseRoot()); err == nil {
+			ledgerEntry.SHA256 = manifest[zipFileName].SHA256
+		}
 
-	// as urlencoded form
-	postData := url.Values{}
-	for k, v := range dataPostMap {
-		postData.Set(k, v)
+		ledger.Record(ledgerEntry)
 	}
 
-	postDataEncoded := postData.Encode()
-
-	requestPost, err := http.NewRequest("POST", configuration.UpdateURL, strings.NewReader(postDataEncoded))
+	err = ledger.Save()
 	if err != nil {
-		//log.Fatalln(err)
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
-	headersPostMap := map[string]string{
-		"User-Agent":      configuration.UserAgent,
-		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"Accept-Encoding": "gzip, deflate",
-		"Connection":      "keep-alive",
-		"Content-Type":    "application/x-www-form-urlencoded",
-		"Content-Length":  strconv.Itoa(len(postDataEncoded)),
-		"Origin":          "http://serviciosede.mineco.gob.es",
-		"DNT":             "1",
-		//"Referer":                   "http://serviciosede.mineco.gob.es/Indeco/BDSICE/UltimasActualizaciones_new.aspx",
-		// "Referer":                   configuration.UpdateURL,
-		"Referer":                   "http://serviciosede.mineco.gob.es/Indeco/BDSICE/Ultimasactualizaciones_new.aspx",
-		"Cookie":                    cookieSessionIdValue,
-		"Upgrade-Insecure-Requests": "1"}
-
-	for k, v := range headersPostMap {
-		requestPost.Header.Set(k, v)
-		//fmt.Printf("%s : %s\n", k, v)
-	}
+	return seriesDecoded, nil
+}
 
-	requestPost.Host = "serviciosede.mineco.gob.es"
+// downloads the update published on date and merges its series into the database
+func applyUpdate(ctx context.Context, configuration *config.BDSICEConfig, session *Session, date time.Time) ([]*series.BDSICESerie, error) {
+	updateLocalPath := configuration.DatabaseLocalPath
 
-	responsePost, err := client.Do(requestPost)
+	// the page is fetched again for every update, so that every postback carries fresh form fields
+	page, err := session.Get(ctx, configuration.UpdateURL)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
-	}
-
-	// POST must return 200 OK. But it is not a sufficient condition. DownloadWithCounter will further
-	// check for a Content-Disposition header in the response to the final GET
-	if responsePost.StatusCode == 200 {
-		//fmt.Println("\nResponse to POST is 200 OK")
-	} else {
-		//log.Fatalln("Response to POST was not 200 OK. Has the website changed?")
-		return nil, fmt.Errorf("POST request did not return 200 OK")
+		return nil, err
 	}
 
-	/////////////////////////////////////
-	// THIRD PART: Second GET: using the link returned to the POST request, an .zip should be returned
-	/////////////////////////////////////
-
-	//requestGetSecond, err := http.NewRequest("GET", configuration.UpdateURL, strings.NewReader(postDataEncoded))
-
-	client = &http.Client{}
-
-	requestFinalGet, err := http.NewRequest("GET", "http://serviciosede.mineco.gob.es/Indeco/DescargaArchivo.aspx?estadisticas=True&tipo=1", nil)
+	links, err := updateLinks(page)
 	if err != nil {
-		// log.Fatalln(err)
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
-	requestFinalGet.Host = "serviciosede.mineco.gob.es"
-
-	headersFinalGetMap := map[string]string{
-		"User-Agent":                configuration.UserAgent,
-		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
-		"Accept-Encoding":           "gzip, deflate",
-		"Connection":                "keep-alive",
-		"Origin":                    "http://serviciosede.mineco.gob.es",
-		"DNT":                       "1",
-		"Referer":                   "http://serviciosede.mineco.gob.es/Indeco/BDSICE/Ultimasactualizaciones_new.aspx",
-		"Cookie":                    cookieSessionIdValue,
-		"Upgrade-Insecure-Requests": "1"}
-
-	for k, v := range headersFinalGetMap {
-		//fmt.Printf("Setting --- %s\t%s\n", k, v)
-		requestFinalGet.Header.Set(k, v)
+	var target string
+	for _, link := range links {
+		if link.date.Equal(date) {
+			target = link.target
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("the update is no longer listed")
 	}
 
-	// dumping final GET request
-	/* dump, err = httputil.DumpRequestOut(requestFinalGet, true)
+	responsePost, err := page.Postback(ctx, target, "")
 	if err != nil {
-		log.Fatal(err)
-	} else {
-		fmt.Printf("\n\n\n\nFinal GET Request\n")
-		fmt.Printf("%s", dump)
+		return nil, err
 	}
-	*/
+	io.Copy(ioutil.Discard, responsePost.Body)
+	responsePost.Body.Close()
 
-	responseFinalGet, err := client.Do(requestFinalGet)
+	finalGetURL, err := archiveURL(configuration.UpdateURL)
 	if err != nil {
-		//log.Fatal(err)
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
-	defer responseFinalGet.Body.Close()
-
-	// dumping final GET response
-	/*
-		dump, err = httputil.DumpResponse(responseFinalGet, true)
-		if err != nil {
-			log.Fatal(err)
-		} else {
-			fmt.Printf("%s\n", dump)
-		}
-	*/
-
-	// Printing headers of the final GET, without gibberish body (since it should be a zip file)
-	/*
-		fmt.Println("Headers of the final GET")
-		for k, v := range responseFinalGet.Header {
-			fmt.Printf("%s:\t%s\n", k, v)
-		}
-	*/
-
-	var zipFilePath string
 
 	// download from GET response body into .zip file
-	zipFilePath, _, err = downloadWithCounter(configuration, responseFinalGet)
-
-	// unzip files into update folder
-	extractedFiles, err := unzipFile(zipFilePath, updateLocalPath, false)
+	zipFilePath, err := downloadFile(ctx, configuration, func(offset int64) (*http.Response, error) {
+		return session.OpenFrom(ctx, finalGetURL, configuration.UpdateURL, offset)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
-	/* We might want to print all the series to be updated.
-
-	db, err := database.LoadDatabase(configuration)
+	// unzip files into update folder
+	extractedFiles, err := unzipFile(ctx, zipFilePath, updateLocalPath, false)
 	if err != nil {
-		return nil, fmt.Errorf("LoadDatabase(): %s", err.Error())
+		return nil, err
 	}
 
-	fmt.Println("Series to update:")
-	for _, extractedFile := range extractedFiles {
-		// fmt.Printf("extractedFile: %s\n", extractedFile)
-		extension := filepath.Ext(extractedFile)
-		if extension == ".xer" {
-			baseName := filepath.Base(extractedFile)
-			serie := strings.TrimSuffix(baseName, extension)
-			// fmt.Printf("%s\t\t%s\n", serie, db.Series[serie])
-		}
-
-	}
-	*/
+	return mergeUpdate(ctx, configuration, extractedFiles)
+}
 
-	fmt.Println("Moving updated series to database folder...")
+// copies the files of an update into the database path of configuration, decodes them and merges
+// their series into the catalog
+func mergeUpdate(ctx context.Context, configuration *config.BDSICEConfig, extractedFiles []string) ([]*series.BDSICESerie, error) {
 	var copiedFiles []string
 	for _, extractedFile := range extractedFiles {
 		input, err := ioutil.ReadFile(extractedFile)
 		if err != nil {
-			return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+			return nil, err
 		}
 
 		base := filepath.Base(extractedFile)
 		output := filepath.Join(configuration.DatabaseLocalPath, base)
-		//fmt.Printf("Copying to %s\n", output)
 
+		// the former file is removed rather than overwritten, since it may be shared, as a hard
+		// link, with other states of the database
+		os.Remove(output)
 		err = ioutil.WriteFile(output, input, 0644)
 		if err != nil {
-			return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+			return nil, err
 		}
 
 		copiedFiles = append(copiedFiles, output)
-
 	}
 
 	// Firstly, let's decode the series that have been updated (and only them)
-	fmt.Printf("Decoding database...\n")
-	seriesDecoded, err := DecodePartialDatabase(configuration, copiedFiles)
+	seriesDecoded, err := DecodePartialDatabase(ctx, configuration, copiedFiles)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
 
-	// Secondly, rebuild database file (althought it probably shouldn't, but in case a new serie has been added)
-	fmt.Printf("Rebuilding database...\n")
-	err = BuildFullDatabase(configuration, seriesDecoded)
+	// Secondly, merge the updated series into the catalog. Rebuilding it from the updated series
+	// alone would drop all the series that were not part of the update.
+	report, err := UpdateDatabase(ctx, configuration, seriesDecoded)
 	if err != nil {
-		return nil, fmt.Errorf("DownloadFullDatabase(): %s.", err.Error())
+		return nil, err
 	}
+	progress.Messagef(ctx, "Catalog updated: %s", report.String())
 
 	return seriesDecoded, nil
 }
-
-// download latest available "coyuntura" bulletin
-func Bulletin(configuration *config.BDSICEConfig) error {
-	fmt.Printf("Bulletin download not yet implemented.\n")
-	return nil
-}
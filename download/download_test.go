@@ -1,18 +1,38 @@
 package download
 
 import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/fabiansalazares/bdsicego/database"
 	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/emulator"
+	"github.com/fabiansalazares/bdsicego/progress"
+	"github.com/fabiansalazares/bdsicego/tree"
 )
 
 func TestUpdate(t *testing.T) {
-	configuration, err := config.GetConfig()
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase() returned an error: %s\n", err.Error())
+	}
+
+	before, err := database.LoadDatabase(configuration)
 	if err != nil {
-		t.Errorf("TestUpdate: %s", err.Error())
+		t.Fatalf("LoadDatabase(): %s", err.Error())
 	}
 
-	extractedFiles, err := Update(configuration, true)
+	extractedFiles, err := Update(context.Background(), configuration, false)
 
 	if (extractedFiles == nil || len(extractedFiles) == 0) && (err == nil) {
 		t.Fatalf("Update() failed: returned an empty slice, meaning no files were eextracted. No error was reported.")
@@ -22,17 +42,349 @@ func TestUpdate(t *testing.T) {
 		t.Fatalf("Update() returned an error: %s\n", err.Error())
 	}
 
-	// we should also check that the .xer files with the updated series have actually been copied correctly
-	// how to do that? calculate some hash files? or just rely on Update() return?
+	latest := emu.Updates[0]
+	if len(extractedFiles) != len(latest.Fixtures) {
+		t.Errorf("Update(): expected %d series, got %d", len(latest.Fixtures), len(extractedFiles))
+	}
+
+	if _, err := os.Stat(filepath.Join(configuration.DatabaseLocalPath, strings.TrimSuffix(latest.FileName(), ".zip"))); err != nil {
+		t.Errorf("Update(): update was not extracted: %s", err.Error())
+	}
+
+	after, err := database.LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+
+	if len(after.Codes) != len(before.Codes)+1 {
+		t.Errorf("Update(): expected the new serie to be added to the catalog, got %d codes", len(after.Codes))
+	}
+
+	if after.Entries["200001"].NumberOfObservations != before.Entries["200001"].NumberOfObservations+1 {
+		t.Errorf("Update(): expected the revised serie to have one more observation")
+	}
+
+	// the same update is not downloaded twice
+	_, err = Update(context.Background(), configuration, false)
+	if !errors.Is(err, ErrAlreadyUpToDate) {
+		t.Errorf("Update(): expected ErrAlreadyUpToDate for an update already downloaded, got %v", err)
+	}
 }
 
-func TestDownloadFullDatabase(t *testing.T) {
-	configuration, err := config.GetConfig()
+func TestCatchUp(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	// the database is made to look as if it had been downloaded on the day of the older update, which
+	// is then applied too, since the full database may not include it
+	ledger, err := LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		t.Fatalf("LoadLedger(): %s", err.Error())
+	}
+	ledger.FullDatabase.Date = emu.Updates[1].Date
+	ledger.Save()
+
+	stale := *configuration
+	_, err = Update(context.Background(), configuration, false)
+	if err != nil {
+		t.Fatalf("Update(): %s", err.Error())
+	}
+
+	// a process that read the ledger before the updates were applied does not apply them again
+	if _, err := Update(context.Background(), &stale, false); !errors.Is(err, ErrAlreadyUpToDate) {
+		t.Errorf("Update(): expected ErrAlreadyUpToDate, got %v", err)
+	}
+
+	ledger, err = LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		t.Fatalf("LoadLedger(): %s", err.Error())
+	}
+
+	if len(ledger.Updates) != 2 || !ledger.Updates[0].Date.Equal(emu.Updates[1].Date) || !ledger.Updates[1].Date.Equal(emu.Updates[0].Date) {
+		t.Fatalf("Update(): expected both updates in the ledger, oldest first, got %+v", ledger.Updates)
+	}
+
+	if ledger.Updates[1].Series != len(emu.Updates[0].Fixtures) || ledger.Updates[1].SHA256 == "" {
+		t.Errorf("Update(): incomplete ledger entry %+v", ledger.Updates[1])
+	}
+
+	if !ledger.Baseline().Equal(emu.Updates[0].Date) {
+		t.Errorf("Baseline(): expected %s, got %s", emu.Updates[0].Date, ledger.Baseline())
+	}
+
+	// updates no longer listed cannot be applied
+	ledger.FullDatabase.Date = emu.Updates[1].Date.AddDate(0, -1, 0)
+	ledger.Updates = nil
+	ledger.Save()
+
+	_, err = Update(context.Background(), configuration, false)
+	var gap *GapError
+	if !errors.As(err, &gap) {
+		t.Errorf("Update(): expected a *GapError, got %v", err)
+	}
+}
+
+func TestStates(t *testing.T) {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	root := configuration.DatabaseRoot()
+	configuration.KeepStates = 2
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+	downloaded := configuration.DatabaseLocalPath
+
+	before, err := database.LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+	revised, _ := ioutil.ReadFile(filepath.Join(downloaded, "200001.xer"))
+
+	// an update that fails halfway leaves the current state as it was
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Update(ctx, configuration, false)
+	if err == nil || configuration.DatabaseLocalPath != downloaded {
+		t.Fatalf("Update(): expected a canceled update to keep the current state, got %v", err)
+	}
+
+	_, err = Update(context.Background(), configuration, false)
+	if err != nil {
+		t.Fatalf("Update(): %s", err.Error())
+	}
+
+	states, err := ListStates(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("ListStates(): %s", err.Error())
+	}
+	if len(states) != 2 || !states[1].Current || filepath.Join(root, config.StatesDirName, states[0].Name) != downloaded {
+		t.Fatalf("ListStates(): expected the downloaded state and the updated one, got %+v", states)
+	}
+
+	// the pointer file names the updated state
+	resolved := &config.BDSICEConfig{DatabaseLocalPath: root}
+	if err := config.ResolveDatabaseState(resolved); err != nil || resolved.DatabaseLocalPath != configuration.DatabaseLocalPath {
+		t.Errorf("ResolveDatabaseState(): expected %s, got %s (%v)", configuration.DatabaseLocalPath, resolved.DatabaseLocalPath, err)
+	}
+
+	// files shared with the former state, as hard links, are replaced rather than rewritten
+	if content, _ := ioutil.ReadFile(filepath.Join(downloaded, "200001.xer")); string(content) != string(revised) {
+		t.Errorf("Update(): the former state was modified")
+	}
+
+	state, err := Rollback(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("Rollback(): %s", err.Error())
+	}
+	if state.Name != states[0].Name || configuration.DatabaseLocalPath != downloaded {
+		t.Errorf("Rollback(): expected to roll back to %s, got %s", states[0].Name, state.Name)
+	}
+
+	after, err := database.LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+	if len(after.Codes) != len(before.Codes) {
+		t.Errorf("Rollback(): expected the catalog to have %d codes, got %d", len(before.Codes), len(after.Codes))
+	}
+
+	if _, err := Rollback(context.Background(), configuration); !errors.Is(err, ErrNoPreviousState) {
+		t.Errorf("Rollback(): expected ErrNoPreviousState, got %v", err)
+	}
+
+	// only the last KeepStates states are kept
+	updated := states[1].Name
+	stale := *configuration
+	_, err = Update(context.Background(), configuration, false)
+	if err != nil {
+		t.Fatalf("Update(): %s", err.Error())
+	}
+
+	states, _ = ListStates(context.Background(), configuration)
+	if len(states) != 2 || states[0].Name != updated || !states[1].Current {
+		t.Errorf("ListStates(): expected the two updated states, got %+v", states)
+	}
+
+	// a rollback resolved before the update still rolls back from the state the update made current
+	state, err = Rollback(context.Background(), &stale)
+	if err != nil || state.Name != updated {
+		t.Errorf("Rollback(): expected to roll back to %s, got %+v (%v)", updated, state, err)
+	}
+}
+
+func TestStateLock(t *testing.T) {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	// a state being built, as by bdsicego sync, keeps other processes from changing the states
+	stage, err := beginState(configuration, true)
+	if err != nil {
+		t.Fatalf("beginState(): %s", err.Error())
+	}
+
+	other := *configuration
+	if _, err := beginState(&other, true); !errors.Is(err, ErrLocked) {
+		t.Errorf("beginState(): expected ErrLocked, got %v", err)
+	}
+	if _, err := Update(context.Background(), &other, false); !errors.Is(err, ErrLocked) {
+		t.Errorf("Update(): expected ErrLocked, got %v", err)
+	}
+	if _, err := Rollback(context.Background(), &other); !errors.Is(err, ErrLocked) {
+		t.Errorf("Rollback(): expected ErrLocked, got %v", err)
+	}
+	if _, err := os.Stat(stage.dirPath); err != nil {
+		t.Errorf("beginState(): the state being built was removed: %s", err.Error())
+	}
+
+	stage.discard()
+
+	stage, err = beginState(&other, true)
+	if err != nil {
+		t.Fatalf("beginState(): expected the lock to be released by discard, got %s", err.Error())
+	}
+	stage.discard()
+}
+
+func TestSnapshotsAcrossStates(t *testing.T) {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	// a snapshot taken before the database is downloaded again
+	older := "db-20200101T000000Z.json"
+	err = ioutil.WriteFile(filepath.Join(configuration.DatabaseLocalPath, database.SnapshotsDirName, older), []byte("{}"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile(): %s", err.Error())
+	}
+
+	downloaded := configuration.DatabaseLocalPath
+	_, err = DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+	if configuration.DatabaseLocalPath == downloaded {
+		t.Fatalf("DownloadFullDatabase(): expected a new state")
+	}
+
+	snapshots, err := database.ListSnapshots(configuration.DatabaseLocalPath)
+	if err != nil {
+		t.Fatalf("ListSnapshots(): %s", err.Error())
+	}
+	if len(snapshots) < 2 || snapshots[0].Name != older {
+		t.Errorf("DownloadFullDatabase(): expected the snapshots of the former state to be kept, got %+v", snapshots)
+	}
+}
+
+func TestAdoptRootState(t *testing.T) {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	// databases of former versions are kept in the root itself
+	root := configuration.DatabaseRoot()
+	entries, _ := ioutil.ReadDir(configuration.DatabaseLocalPath)
+	for _, entry := range entries {
+		os.Rename(filepath.Join(configuration.DatabaseLocalPath, entry.Name()), filepath.Join(root, entry.Name()))
+	}
+	os.RemoveAll(filepath.Join(root, config.StatesDirName))
+	os.Remove(filepath.Join(root, config.CurrentStateFileName))
+
+	// the data path is the root too, and holds the catalogs of other providers
+	os.MkdirAll(filepath.Join(root, config.ProvidersDirName, "ine"), 0755)
+	ioutil.WriteFile(filepath.Join(root, config.DefaultSyncLogFileName), []byte("{}\n"), 0644)
+
+	configuration.DatabaseLocalPath = root
+	if err := config.ResolveDatabaseState(configuration); err != nil || configuration.DatabaseLocalPath != root {
+		t.Fatalf("ResolveDatabaseState(): expected the root, got %s (%v)", configuration.DatabaseLocalPath, err)
+	}
+
+	_, err = Update(context.Background(), configuration, false)
+	if err != nil {
+		t.Fatalf("Update(): %s", err.Error())
+	}
+
+	states, _ := ListStates(context.Background(), configuration)
+	if len(states) != 2 {
+		t.Fatalf("Update(): expected the former database to be kept as a state, got %+v", states)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, database.CatalogFileName)); !os.IsNotExist(err) {
+		t.Errorf("Update(): the former database was left in the root")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, emulator.DatabaseFileName)); err != nil {
+		t.Errorf("Update(): the files downloaded should stay in the root: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(root, config.ProvidersDirName, "ine")); err != nil {
+		t.Errorf("Update(): the catalogs of other providers should stay in the data path: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(root, config.DefaultSyncLogFileName)); err != nil {
+		t.Errorf("Update(): the log of sync should stay in the data path: %s", err.Error())
+	}
+
+	if _, err := Rollback(context.Background(), configuration); err != nil {
+		t.Errorf("Rollback(): %s", err.Error())
+	}
+}
+
+func TestLedgerBootstrap(t *testing.T) {
+	dbLocalPath, err := ioutil.TempDir("", "bdsicego-ledger")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dbLocalPath)
+
+	// databases updated before the ledger existed only hold the folders of the updates
+	os.Mkdir(filepath.Join(dbLocalPath, "UltActualiz_20261012"), 0755)
+	os.Mkdir(filepath.Join(dbLocalPath, "UltActualiz_20261005"), 0755)
+	ioutil.WriteFile(filepath.Join(dbLocalPath, database.CatalogFileName), []byte("{}"), 0644)
+
+	ledger, err := LoadLedger(dbLocalPath)
 	if err != nil {
-		t.Errorf("TestDownloadFullDatabase: %s", err.Error())
+		t.Fatalf("LoadLedger(): %s", err.Error())
+	}
+
+	if !ledger.Applied(time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC)) || len(ledger.Updates) != 2 {
+		t.Errorf("LoadLedger(): expected the updates found in the database path, got %+v", ledger.Updates)
+	}
+
+	if ledger.FullDatabase == nil || !ledger.FullDatabase.Date.Equal(time.Date(2026, time.October, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("LoadLedger(): expected the full download to date back to the oldest update, got %+v", ledger.FullDatabase)
 	}
+}
+
+func TestDownloadFullDatabase(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	// the last event of every kind is kept
+	last := make(map[progress.Kind]progress.Event)
+	var phases []progress.Phase
+	ctx := progress.WithReporter(context.Background(), progress.ReporterFunc(func(event progress.Event) {
+		last[event.Kind] = event
+		if event.Kind == progress.KindPhase {
+			phases = append(phases, event.Phase)
+		}
+	}))
 
-	extractedFiles, err := DownloadFullDatabase(configuration, true)
+	extractedFiles, err := DownloadFullDatabase(ctx, configuration, true, nil)
 
 	if (extractedFiles == nil || len(extractedFiles) == 0) && err == nil {
 		t.Fatalf("DownloadFullDatabase() failed: returned an empty slice, meaning no files were eextracted. No error was reported.")
@@ -41,17 +393,426 @@ func TestDownloadFullDatabase(t *testing.T) {
 	if err != nil {
 		t.Fatalf("DownloadFullDatabase() returned an error: %s\n", err.Error())
 	}
+
+	if len(extractedFiles) != len(emu.Database) {
+		t.Errorf("DownloadFullDatabase(): expected %d series, got %d", len(emu.Database), len(extractedFiles))
+	}
+
+	db, err := database.LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+
+	if title := db.Series["100002"]; title != "EPA. PARADOS. AVILA" {
+		t.Errorf("DownloadFullDatabase(): expected Latin-1 titles to be decoded, got %q", title)
+	}
+
+	if _, err := tree.Load(configuration); err != nil {
+		t.Errorf("DownloadFullDatabase(): tree was not built: %s", err.Error())
+	}
+
+	expectedPhases := []progress.Phase{progress.PhaseDownload, progress.PhaseValidate, progress.PhaseExtract,
+		progress.PhaseDecode, progress.PhaseStore, progress.PhaseBuild}
+	if len(phases) != len(expectedPhases) {
+		t.Errorf("DownloadFullDatabase(): expected phases %v, got %v", expectedPhases, phases)
+	}
+
+	for _, kind := range []progress.Kind{progress.KindBytes, progress.KindExtracted, progress.KindDecoded, progress.KindBuilt} {
+		if event, ok := last[kind]; !ok || event.Done != event.Total || event.Done == 0 {
+			t.Errorf("DownloadFullDatabase(): expected %s events up to the total, got %+v", kind, event)
+		}
+	}
+
+	// a database downloaded already is only downloaded again, or decoded again, if confirmed
+	var questions []string
+	requests := emu.Requests(emulator.HomePath)
+
+	_, err = DownloadFullDatabase(context.Background(), configuration, false, func(question string) bool {
+		questions = append(questions, question)
+		return false
+	})
+	if !errors.Is(err, ErrNotConfirmed) || len(questions) != 2 {
+		t.Errorf("DownloadFullDatabase(): expected ErrNotConfirmed after two questions, got %v after %d", err, len(questions))
+	}
+
+	_, err = DownloadFullDatabase(context.Background(), configuration, false, func(question string) bool {
+		return strings.Contains(question, "decoding")
+	})
+	if err != nil {
+		t.Errorf("DownloadFullDatabase(): decoding again returned an error: %s", err.Error())
+	}
+
+	if emu.Requests(emulator.HomePath) != requests {
+		t.Errorf("DownloadFullDatabase(): the database was downloaded again without confirmation")
+	}
 }
 
-func TestBulletin(t *testing.T) {
-	configuration, err := config.GetConfig()
+func TestCanceledDownload(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	// every transfer drops, and the context is canceled while waiting to retry
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	retryBackoff = time.Hour
+	emu.Drops = maxAttempts
+	emu.DropAfter = 300
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := DownloadFullDatabase(ctx, configuration, true, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DownloadFullDatabase(): expected the deadline of the context to be reported, got %v", err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	configuration := emulator.TestConfiguration(t, emulator.NewDefault(time.Now()))
+
+	sourceDir, err := ioutil.TempDir("", "bdsicego-import")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(sourceDir)
+
+	now := time.Now()
+	updates := emulator.DefaultUpdates(now)
+
+	// updates cannot be imported before the full database
+	previous, _ := emulator.Zip(updates[1].Fixtures)
+	previousPath := filepath.Join(sourceDir, updates[1].FileName())
+	ioutil.WriteFile(previousPath, previous, 0644)
+
+	var gap *GapError
+	if _, err := Import(context.Background(), configuration, previousPath); !errors.As(err, &gap) {
+		t.Errorf("Import(): expected a *GapError for an update imported into an empty database, got %v", err)
+	}
+
+	// the fixtures zip files do not record the times of their files, so the full database is
+	// dated after the zip file itself
+	full, _ := emulator.Zip(emulator.DefaultDatabase(now))
+	fullPath := filepath.Join(sourceDir, emulator.DatabaseFileName)
+	ioutil.WriteFile(fullPath, full, 0644)
+	fullDate := now.AddDate(0, 0, -10)
+	os.Chtimes(fullPath, fullDate, fullDate)
+
+	seriesDecoded, err := Import(context.Background(), configuration, fullPath)
+	if err != nil {
+		t.Fatalf("Import() returned an error: %s", err.Error())
+	}
+	if len(seriesDecoded) != len(emulator.DefaultDatabase(now)) {
+		t.Errorf("Import(): expected %d series, got %d", len(emulator.DefaultDatabase(now)), len(seriesDecoded))
+	}
+
+	ledger, err := LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		t.Fatalf("LoadLedger(): %s", err.Error())
+	}
+	if ledger.FullDatabase == nil || ledger.FullDatabase.Imported != fullPath || ledger.FullDatabase.SHA256 == "" || !ledger.FullDatabase.Date.Equal(day(fullDate)) {
+		t.Errorf("Import(): unexpected ledger entry for the full database: %+v", ledger.FullDatabase)
+	}
+
+	_, err = Import(context.Background(), configuration, previousPath)
+	if err != nil {
+		t.Fatalf("Import() returned an error for the update zip file: %s", err.Error())
+	}
+
+	// the latest update, as a directory of .xer files
+	latestDir := filepath.Join(sourceDir, strings.TrimSuffix(updates[0].FileName(), ".zip"))
+	os.Mkdir(latestDir, 0755)
+	for _, fixture := range updates[0].Fixtures {
+		ioutil.WriteFile(filepath.Join(latestDir, fixture.Code+".xer"), fixture.Xer, 0644)
+	}
+
+	_, err = Import(context.Background(), configuration, latestDir)
 	if err != nil {
-		t.Errorf("TestBulletin: %s", err.Error())
+		t.Fatalf("Import() returned an error for the update directory: %s", err.Error())
 	}
 
-	err = Bulletin(configuration)
+	ledger, err = LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		t.Fatalf("LoadLedger(): %s", err.Error())
+	}
+	if !ledger.Applied(updates[0].Date) || !ledger.Applied(updates[1].Date) || ledger.Updates[1].Imported != latestDir {
+		t.Errorf("Import(): updates missing from the ledger: %+v", ledger.Updates)
+	}
+
+	db, err := database.LoadDatabase(configuration)
+	if err != nil {
+		t.Fatalf("LoadDatabase(): %s", err.Error())
+	}
+	if _, ok := db.Entries["500001"]; !ok {
+		t.Errorf("Import(): the serie added by the update is missing from the catalog")
+	}
+
+	// the imported database is brought up to date by Update as a downloaded one would be
+	if _, err := Update(context.Background(), configuration, false); !errors.Is(err, ErrAlreadyUpToDate) {
+		t.Errorf("Update(): expected ErrAlreadyUpToDate after importing the updates, got %v", err)
+	}
+
+	emptyDir := filepath.Join(sourceDir, "empty")
+	os.Mkdir(emptyDir, 0755)
+	if _, err := Import(context.Background(), configuration, emptyDir); !errors.Is(err, ErrNothingToImport) {
+		t.Errorf("Import(): expected ErrNothingToImport for a directory without .xer files, got %v", err)
+	}
+}
+
+func TestZipSlip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-zip")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	zipFilePath := filepath.Join(dir, "evil.zip")
+	f, err := os.Create(zipFilePath)
+	if err != nil {
+		t.Fatalf("Create(): %s", err.Error())
+	}
+	w := zip.NewWriter(f)
+	entry, _ := w.Create("../evil.xer")
+	entry.Write([]byte("evil"))
+	w.Close()
+	f.Close()
+
+	_, err = unzipFile(context.Background(), zipFilePath, filepath.Join(dir, "db"), true)
+	if !errors.Is(err, ErrZipSlip) {
+		t.Errorf("unzipFile(): expected ErrZipSlip, got %v", err)
+	}
 
+	if _, err := os.Stat(filepath.Join(dir, "evil.xer")); !os.IsNotExist(err) {
+		t.Errorf("unzipFile(): a file was written outside the destination path")
+	}
+}
+
+func TestResumedDownload(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	retryBackoff = time.Millisecond
+
+	// the first two transfers drop, and the third one resumes where the second one stopped
+	emu.Drops = 2
+	emu.DropAfter = 300
+
+	_, err := DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err != nil {
+		t.Fatalf("DownloadFullDatabase(): %s", err.Error())
+	}
+
+	if requests := emu.Requests(emulator.HomePath); requests != 4 {
+		t.Errorf("DownloadFullDatabase(): expected a GET and three postbacks, got %d requests", requests)
+	}
+
+	zipFilePath := filepath.Join(configuration.DatabaseRoot(), emulator.DatabaseFileName)
+	if _, err := os.Stat(zipFilePath + partialSuffix); !os.IsNotExist(err) {
+		t.Errorf("DownloadFullDatabase(): the .part file was not removed")
+	}
+
+	manifest, err := LoadManifest(configuration.DatabaseRoot())
+	if err != nil {
+		t.Fatalf("LoadManifest(): %s", err.Error())
+	}
+
+	if err := manifest.Verify(configuration.DatabaseRoot(), emulator.DatabaseFileName); err != nil {
+		t.Errorf("Verify(): %s", err.Error())
+	}
+
+	// a download that keeps dropping is given up on, and leaves the former zip file untouched
+	emu.Drops = maxAttempts
+	_, err = DownloadFullDatabase(context.Background(), configuration, true, nil)
+	if err == nil {
+		t.Errorf("DownloadFullDatabase(): expected an error after %d dropped transfers", maxAttempts)
+	}
+
+	if err := manifest.Verify(configuration.DatabaseRoot(), emulator.DatabaseFileName); err != nil {
+		t.Errorf("Verify(): %s", err.Error())
+	}
+}
+
+func TestValidateZip(t *testing.T) {
+	content, err := emulator.Zip(emulator.DefaultDatabase(time.Now()))
+	if err != nil {
+		t.Fatalf("Zip(): %s", err.Error())
+	}
+
+	dir, err := ioutil.TempDir("", "bdsicego-zip")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.zip")
+	ioutil.WriteFile(valid, content, 0644)
+	if err := validateZip(valid); err != nil {
+		t.Errorf("validateZip(): %s", err.Error())
+	}
+
+	truncated := filepath.Join(dir, "truncated.zip")
+	ioutil.WriteFile(truncated, content[:len(content)/2], 0644)
+	if err := validateZip(truncated); err == nil {
+		t.Errorf("validateZip(): expected an error for a truncated zip file")
+	}
+
+	// a flipped byte in the data of the first file fails its CRC-32
+	corrupt := append([]byte{}, content...)
+	corrupt[40] ^= 0xff
+	ioutil.WriteFile(filepath.Join(dir, "corrupt.zip"), corrupt, 0644)
+	if err := validateZip(filepath.Join(dir, "corrupt.zip")); err == nil {
+		t.Errorf("validateZip(): expected an error for a corrupt zip file")
+	}
+}
+
+func TestArchiveURL(t *testing.T) {
+	archive, err := archiveURL("http://serviciosede.mineco.gob.es/Indeco/BDSICE/Ultimasactualizaciones_new.aspx")
+	if err != nil {
+		t.Fatalf("archiveURL(): %s", err.Error())
+	}
+
+	if expected := "http://serviciosede.mineco.gob.es/Indeco/DescargaArchivo.aspx?estadisticas=True&tipo=1"; archive != expected {
+		t.Errorf("archiveURL(): expected %s, got %s", expected, archive)
+	}
+}
+
+func TestSession(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	session, err := NewSession(configuration.UserAgent)
+	if err != nil {
+		t.Fatalf("NewSession(): %s", err.Error())
+	}
+
+	page, err := session.Get(context.Background(), configuration.UpdateURL)
+	if err != nil {
+		t.Fatalf("Get(): %s", err.Error())
+	}
+
+	for _, field := range []string{"__VIEWSTATE", "__VIEWSTATEGENERATOR", "__EVENTVALIDATION"} {
+		if page.Fields.Get(field) == "" {
+			t.Errorf("Get(): hidden field %s was not collected", field)
+		}
+	}
+
+	rows, err := page.Grid(updatesGridID)
+	if err != nil {
+		t.Fatalf("Grid(): %s", err.Error())
+	}
+	if len(rows) != len(emu.Updates)+1 {
+		t.Fatalf("Grid(): expected %d rows, got %d", len(emu.Updates)+1, len(rows))
+	}
+	if len(rows[1].Targets) != 1 || rows[1].Targets[0] != "dg_Actualizaciones$_ctl2$boton" {
+		t.Errorf("Grid(): unexpected targets %q", rows[1].Targets)
+	}
+
+	links, err := updateLinks(page)
+	if err != nil {
+		t.Fatalf("updateLinks(): %s", err.Error())
+	}
+	for i, link := range links {
+		if !link.date.Equal(emu.Updates[i].Date) {
+			t.Errorf("updateLinks(): expected %s, got %s", emu.Updates[i].Date, link.date)
+		}
+	}
+
+	text, err := page.Text("dg_Actualizaciones__ctl3_boton")
+	if err != nil || !strings.HasPrefix(text, "Series actualizadas el día") {
+		t.Errorf("Text(): unexpected text %q (%v)", text, err)
+	}
+
+	// elements that are missing are reported as layout changes
+	_, err = page.Element("lbutton_BdsiceCompleta")
+	if _, ok := err.(*LayoutError); !ok || !errors.Is(err, ErrLayoutChanged) {
+		t.Errorf("Element(): expected a *LayoutError, got %v", err)
+	}
+
+	// the site rejects postbacks naming controls that the page does not hold
+	_, err = page.Postback(context.Background(), "dg_Actualizaciones$_ctl9$boton", "")
+	if err == nil || !strings.Contains(err.Error(), "Invalid postback") {
+		t.Errorf("Postback(): expected the error reported by the site, got %v", err)
+	}
+
+	// and postbacks from another session, which lacks the session cookie
+	other, _ := NewSession(configuration.UserAgent)
+	page.session = other
+	_, err = page.Postback(context.Background(), "dg_Actualizaciones$_ctl2$boton", "")
+	if err == nil {
+		t.Errorf("Postback(): expected an error for a postback without the session cookie")
+	}
+}
+
+func TestBulletin(t *testing.T) {
+	emu := emulator.NewDefault(time.Now())
+	configuration := emulator.TestConfiguration(t, emu)
+
+	configuration.DataLocalPath = configuration.DatabaseLocalPath
+
+	downloaded, err := Bulletin(context.Background(), configuration)
 	if err != nil {
 		t.Fatalf("Bulletin() returned an error: %s\n", err.Error())
 	}
+
+	if len(downloaded) != 1 || !downloaded[0].Date.Equal(emu.Bulletins[0].Date) {
+		t.Fatalf("Bulletin(): expected the latest bulletin, got %+v", downloaded)
+	}
+
+	index, err := LoadBulletinIndex(configuration)
+	if err != nil {
+		t.Fatalf("LoadBulletinIndex(): %s", err.Error())
+	}
+
+	if len(index.Bulletins) != len(emu.Bulletins) {
+		t.Errorf("Bulletin(): expected %d bulletins indexed, got %d", len(emu.Bulletins), len(index.Bulletins))
+	}
+
+	if index.Bulletins[0].Title != emu.Bulletins[0].Title {
+		t.Errorf("Bulletin(): expected title %q, got %q", emu.Bulletins[0].Title, index.Bulletins[0].Title)
+	}
+
+	if err := validatePDF(index.Path(index.Bulletins[0])); err != nil {
+		t.Errorf("Bulletin(): %s", err.Error())
+	}
+
+	// past bulletins are selected by date or position, downloaded along with the latest one and only once
+	past := emu.Bulletins[2].Date.Format("2006-01")
+	downloaded, err = Bulletin(context.Background(), configuration, past, "1")
+	if err != nil {
+		t.Fatalf("Bulletin(%s): %s", past, err.Error())
+	}
+
+	if len(downloaded) != 2 || !downloaded[0].Date.Equal(emu.Bulletins[0].Date) || !downloaded[1].Date.Equal(emu.Bulletins[2].Date) || !downloaded[1].Downloaded() {
+		t.Errorf("Bulletin(%s): unexpected bulletins %+v", past, downloaded)
+	}
+
+	if requests := emu.Requests(emulator.BulletinFilesPath + emu.Bulletins[0].File); requests != 1 {
+		t.Errorf("Bulletin(): expected the latest bulletin to be downloaded once, got %d requests", requests)
+	}
+
+	if _, err := index.Find("1999-01"); err == nil {
+		t.Errorf("Find(): expected an error for a date without bulletin")
+	}
+}
+
+func TestBulletinDate(t *testing.T) {
+	var tests = []struct {
+		text     string
+		fileName string
+		expected time.Time
+	}{
+		{"Boletín de Coyuntura. Octubre de 2026", "x.pdf", time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)},
+		{"Informe publicado el 15/09/2026", "x.pdf", time.Date(2026, time.September, 15, 0, 0, 0, 0, time.UTC)},
+		{"Último boletín", "boletin-2026-08-03.pdf", time.Date(2026, time.August, 3, 0, 0, 0, 0, time.UTC)},
+		{"Boletín", "BCE_202607.pdf", time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		date, ok := bulletinDate(test.text, test.fileName)
+		if !ok || !date.Equal(test.expected) {
+			t.Errorf("bulletinDate(%q, %q): expected %s, got %s", test.text, test.fileName, test.expected, date)
+		}
+	}
+
+	if _, ok := bulletinDate("Aviso legal", "aviso.pdf"); ok {
+		t.Errorf("bulletinDate(): expected no date for a link without one")
+	}
 }
@@ -0,0 +1,49 @@
+package download
+
+import "errors"
+
+// errors returned by the functions of the package, wrapped with the name of the function that
+// returned them. They can be told apart with errors.Is().
+var (
+	// ErrAlreadyUpToDate is returned by Update when every update listed has been applied already
+	ErrAlreadyUpToDate = errors.New("the latest available update has been applied already")
+
+	// ErrLayoutChanged is returned when a page lacks an element that bdsicego relies on. Its
+	// details are held by a *LayoutError.
+	ErrLayoutChanged = errors.New("the layout of the BDSICE website has changed")
+
+	// ErrZipSlip is returned for zip files holding paths that point outside the directory they are
+	// extracted to
+	ErrZipSlip = errors.New("illegal file path in zip file, possible ZipSlip attack")
+
+	// ErrNotConfirmed is returned when the confirmation asked for before replacing a database that
+	// has been downloaded already is not given
+	ErrNotConfirmed = errors.New("not confirmed")
+
+	// ErrNoPreviousState is returned by Rollback when there is no state older than the current one
+	ErrNoPreviousState = errors.New("there is no previous state of the database to roll back to")
+
+	// ErrInconsistentState is returned when a new state of the database fails the checks it must
+	// pass before it replaces the current one, which is then kept
+	ErrInconsistentState = errors.New("the new state of the database is not consistent")
+
+	// ErrNothingToImport is returned by Import when the directory given holds no .xer files
+	ErrNothingToImport = errors.New("no .xer files to import")
+
+	// ErrLocked is returned when another process, such as bdsicego sync, is building a new state of
+	// the database or switching to another one
+	ErrLocked = errors.New("the database is being changed by another process")
+)
+
+// ConfirmFunc is called with a yes/no question before an action that needs the confirmation of the
+// user, such as downloading again a database that has been downloaded already. It returns true to
+// proceed. A nil ConfirmFunc answers no to every question.
+type ConfirmFunc func(question string) bool
+
+// asks question through confirm, if there is one
+func ask(confirm ConfirmFunc, question string) bool {
+	if confirm == nil {
+		return false
+	}
+	return confirm(question)
+}
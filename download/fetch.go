@@ -0,0 +1,310 @@
+package download
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/progress"
+)
+
+// suffix of the file a download is written to until it is complete and validated
+const partialSuffix = ".part"
+
+// number of requests made for a file before giving up
+const maxAttempts = 6
+
+// wait before the first retry, doubled after every failed attempt. It is a variable so that tests
+// do not have to wait.
+var retryBackoff = 2 * time.Second
+
+// a download is abandoned, and retried, when no data is received for this long
+var stallTimeout = 60 * time.Second
+
+// returns the response to a request for a file, starting at byte offset. Responses to requests
+// with an offset may be 206 Partial Content, or 200 OK if the server ignored the range.
+type fetcher func(offset int64) (*http.Response, error)
+
+// returns the name of the file announced in Content-Disposition
+func attachmentName(response *http.Response) (string, error) {
+	disposition := response.Header.Get("Content-Disposition")
+	if disposition == "" {
+		return "", fmt.Errorf("the response holds no file to download: no Content-Disposition header")
+	}
+
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil || params["filename"] == "" {
+		return "", fmt.Errorf("no file name in Content-Disposition %q", disposition)
+	}
+
+	// only the base name is kept, so that the name cannot point outside the database path
+	return filepath.Base(params["filename"]), nil
+}
+
+// returns the total size of the file served in response, or -1 if it is unknown
+func totalSize(response *http.Response) int64 {
+	if response.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes 1000-4999/5000
+		contentRange := response.Header.Get("Content-Range")
+		if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+			if total, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+				return total
+			}
+		}
+		return -1
+	}
+	return response.ContentLength
+}
+
+// returns the first byte served in a 206 Partial Content response
+func rangeStart(response *http.Response) int64 {
+	var start, end, total int64
+	_, err := fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// downloads the zip file served by fetch into the database root and returns its path. The file
+// only replaces a former one once it has been validated as a complete zip file, and it is recorded
+// in the download manifest.
+func downloadFile(ctx context.Context, configuration *config.BDSICEConfig, fetch fetcher) (string, error) {
+	file, err := fetchFile(ctx, configuration.DatabaseRoot(), "", fetch, validateZip)
+	if err != nil {
+		return "", fmt.Errorf("download.downloadFile(): %w", err)
+	}
+
+	err = recordDownload(configuration.DatabaseRoot(), ManifestEntry{
+		File:   filepath.Base(file.path),
+		URL:    file.url,
+		Size:   file.size,
+		SHA256: file.sha256,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("download.downloadFile(): %w", err)
+	}
+
+	return file.path, nil
+}
+
+// a file downloaded by fetchFile
+type fetchedFile struct {
+	path   string
+	url    string
+	size   int64
+	sha256 string
+}
+
+// downloads the file served by fetch into dirPath, under fileName or, if fileName is empty, under
+// the name given in Content-Disposition. The file is written to a .part file first, which is
+// resumed with a Range request when a transfer drops, and which only replaces the file once
+// validate accepts it. Failed attempts are retried with exponential backoff, until ctx is done.
+func fetchFile(ctx context.Context, dirPath string, fileName string, fetch fetcher, validate func(filePath string) error) (*fetchedFile, error) {
+	var response *http.Response
+	var err error
+
+	backoff := retryBackoff
+	attempt := 1
+
+	// waits before the next attempt, or returns false if there are none left or ctx is done
+	retry := func(cause error) bool {
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return false
+		}
+		progress.Messagef(ctx, "Download failed (%s). Retrying in %s...", cause.Error(), backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+		backoff = backoff * 2
+		attempt++
+		return true
+	}
+
+	for {
+		response, err = fetch(0)
+		if err == nil {
+			break
+		}
+		if !retry(err) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+
+	if fileName == "" {
+		fileName, err = attachmentName(response)
+		if err != nil {
+			response.Body.Close()
+			return nil, err
+		}
+	}
+
+	sourceURL := response.Request.URL.String()
+	filePath := filepath.Join(dirPath, fileName)
+	partPath := filePath + partialSuffix
+	total := totalSize(response)
+
+	// a .part file left by an interrupted run is resumed, unless it cannot belong to this file
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		if total > 0 && info.Size() > 0 && info.Size() < total {
+			offset = info.Size()
+			progress.Messagef(ctx, "Resuming download of %s at %dK", fileName, offset/1024)
+			response.Body.Close()
+			response = nil
+		} else {
+			os.Remove(partPath)
+		}
+	}
+
+	progress.StartPhase(ctx, progress.PhaseDownload, fileName)
+
+	for {
+		if response == nil {
+			response, err = fetch(offset)
+		}
+
+		if err == nil {
+			offset, err = writePart(ctx, partPath, response, offset, total)
+			response.Body.Close()
+			response = nil
+		}
+
+		if err == nil && (total < 0 || offset == total) {
+			break
+		}
+
+		if err == nil {
+			err = fmt.Errorf("transfer ended at %d of %d bytes", offset, total)
+		}
+
+		if !retry(err) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%s: giving up after %d attempts: %w", fileName, attempt, err)
+		}
+	}
+
+	progress.StartPhase(ctx, progress.PhaseValidate, fileName)
+
+	err = validate(partPath)
+	if err != nil {
+		// a corrupt file cannot be resumed
+		os.Remove(partPath)
+		return nil, fmt.Errorf("%s is not valid: %s", fileName, err.Error())
+	}
+
+	checksum, size, err := fileChecksum(partPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(partPath, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fetchedFile{path: filePath, url: sourceURL, size: size, sha256: checksum}, nil
+}
+
+// appends the body of response to the .part file, which holds offset bytes already, and returns
+// the size of the .part file afterwards. Responses that do not continue at offset restart the file.
+// Progress is reported to the reporter of ctx as the file is written.
+func writePart(ctx context.Context, partPath string, response *http.Response, offset int64, total int64) (int64, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if response.StatusCode != http.StatusPartialContent || rangeStart(response) != offset {
+		// the server ignored the range and sends the whole file again
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		offset = 0
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return offset, err
+	}
+	defer out.Close()
+
+	// closing the body aborts a transfer that has stalled
+	stalled := time.AfterFunc(stallTimeout, func() { response.Body.Close() })
+	defer stalled.Stop()
+
+	for {
+		bytesCopied, err := io.CopyN(out, response.Body, 1024*100)
+		offset = offset + bytesCopied
+		stalled.Reset(stallTimeout)
+
+		progress.Advance(ctx, progress.KindBytes, filepath.Base(strings.TrimSuffix(partPath, partialSuffix)), offset, total)
+
+		if err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return offset, err
+		}
+	}
+}
+
+// checks that filePath is a complete zip file: its central directory can be read and the CRC-32 of
+// every file in it matches its content
+func validateZip(filePath string) error {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if len(r.File) == 0 {
+		return fmt.Errorf("the zip file is empty")
+	}
+
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.Name, err.Error())
+		}
+
+		// archive/zip checks the CRC-32 when the whole file has been read
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// returns the hex-encoded SHA-256 and the size of filePath
+func fileChecksum(filePath string) (string, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
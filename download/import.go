@@ -0,0 +1,258 @@
+package download
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/progress"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// Import builds the database from a local copy of the files BDSICE publishes, for machines that
+// cannot reach the site: the zip file of the full database or of an update, or a directory holding
+// their .xer files. Updates are told apart by their names, such as UltActualiz_20261019.zip, from
+// which their date is taken, and are applied on top of the current database, which must hold the
+// full database already. Anything else is imported as the full database. As with downloads, the
+// files are imported into a new state of the database, and the zip file or directory is recorded
+// in the ledger.
+func Import(ctx context.Context, configuration *config.BDSICEConfig, sourcePath string) ([]*series.BDSICESerie, error) {
+	sourcePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("download.Import(): %w", err)
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("download.Import(): %w", err)
+	}
+
+	ledgerEntry := LedgerEntry{File: info.Name(), Imported: sourcePath}
+
+	if info.IsDir() {
+		files, err := xerFiles(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("download.Import(): %w", err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("download.Import(): %s: %w", sourcePath, ErrNothingToImport)
+		}
+	} else {
+		progress.StartPhase(ctx, progress.PhaseValidate, info.Name())
+		err = validateZip(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("download.Import(): %s is not a valid zip file: %w", sourcePath, err)
+		}
+
+		ledgerEntry.SHA256, _, err = fileChecksum(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("download.Import(): %w", err)
+		}
+	}
+
+	if date, ok := updateDate(info.Name()); ok {
+		ledgerEntry.Date = date
+		seriesDecoded, err := importUpdate(ctx, configuration, sourcePath, info.IsDir(), ledgerEntry)
+		if err != nil {
+			return nil, fmt.Errorf("download.Import(): %w", err)
+		}
+		return seriesDecoded, nil
+	}
+
+	// the full database is as recent as the latest file it holds. The modification time of the
+	// zip file itself is not used, since copying it around may have changed it.
+	ledgerEntry.Date, err = contentDate(sourcePath, info)
+	if err != nil {
+		return nil, fmt.Errorf("download.Import(): %w", err)
+	}
+
+	progress.Messagef(ctx, "Importing full database from: %s", sourcePath)
+
+	stage, err := beginState(configuration, false)
+	if err != nil {
+		return nil, fmt.Errorf("download.Import(): %w", err)
+	}
+
+	seriesDecoded, err := buildFullState(ctx, stage.configuration, sourcePath, ledgerEntry)
+	if err == nil {
+		err = stage.commit(configuration)
+	}
+	if err != nil {
+		stage.discard()
+		return nil, fmt.Errorf("download.Import(): %w", err)
+	}
+
+	return seriesDecoded, nil
+}
+
+// applies the update in sourcePath, a zip file or a directory, on top of the current state of the
+// database, and records it in the ledger as ledgerEntry
+func importUpdate(ctx context.Context, configuration *config.BDSICEConfig, sourcePath string, isDir bool, ledgerEntry LedgerEntry) ([]*series.BDSICESerie, error) {
+	ledger, err := LoadLedger(configuration.DatabaseLocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// an update only holds the series that changed, so it needs the full database to be applied to
+	if ledger.FullDatabase == nil {
+		return nil, &GapError{Baseline: ledger.Baseline(), Oldest: ledgerEntry.Date}
+	}
+
+	// the full database includes the updates published before it
+	if day(ledgerEntry.Date).Before(ledger.FullDatabase.Date) {
+		return nil, fmt.Errorf("the update of %s is older than the full database: %w", ledgerEntry.Date.Format("2006-01-02"), ErrAlreadyUpToDate)
+	}
+
+	progress.Messagef(ctx, "Importing update from: %s", sourcePath)
+
+	stage, err := beginState(configuration, true)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesDecoded, err := func() ([]*series.BDSICESerie, error) {
+		progress.StartPhase(ctx, progress.PhaseUpdate, ledgerEntry.Date.Format("2006-01-02"))
+
+		var files []string
+		if isDir {
+			files, err = xerFiles(sourcePath)
+		} else {
+			// extracted to a folder named after the zip file, as downloaded updates are
+			files, err = unzipFile(ctx, sourcePath, stage.configuration.DatabaseLocalPath, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := mergeUpdate(ctx, stage.configuration, files)
+		if err != nil {
+			return nil, err
+		}
+
+		stagedLedger, err := LoadLedger(stage.configuration.DatabaseLocalPath)
+		if err != nil {
+			return nil, err
+		}
+
+		ledgerEntry.Series = len(decoded)
+		ledgerEntry.Applied = time.Now()
+		stagedLedger.Record(ledgerEntry)
+
+		return decoded, stagedLedger.Save()
+	}()
+	if err == nil {
+		err = stage.commit(configuration)
+	}
+	if err != nil {
+		stage.discard()
+		return nil, err
+	}
+
+	return seriesDecoded, nil
+}
+
+// returns the date of the update named name, a zip file or the directory it was extracted to
+func updateDate(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, ".zip")
+	if !strings.HasPrefix(name, updateDirPrefix) {
+		return time.Time{}, false
+	}
+
+	date, err := time.Parse("20060102", strings.TrimPrefix(name, updateDirPrefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// returns the paths of the .xer files in dirPath and its subdirectories
+func xerFiles(dirPath string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(filePath) == ".xer" {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// copies the .xer files in dirPath and its subdirectories to destination, and returns their paths
+// in destination
+func copyXerFiles(dirPath string, destination string) ([]string, error) {
+	files, err := xerFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var copiedFiles []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// removed first, since destination may share the file with other states as a hard link
+		output := filepath.Join(destination, filepath.Base(file))
+		os.Remove(output)
+		err = copyFile(file, output, info)
+		if err != nil {
+			return nil, err
+		}
+
+		copiedFiles = append(copiedFiles, output)
+	}
+
+	return copiedFiles, nil
+}
+
+// returns the modification time of the latest .xer file in sourcePath, a zip file or a directory,
+// or that of sourcePath itself if the zip file does not record the times of its files
+func contentDate(sourcePath string, info os.FileInfo) (time.Time, error) {
+	var latest time.Time
+
+	if info.IsDir() {
+		files, err := xerFiles(sourcePath)
+		if err != nil {
+			return latest, err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				return latest, err
+			}
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+	} else {
+		r, err := zip.OpenReader(sourcePath)
+		if err != nil {
+			return latest, err
+		}
+		defer r.Close()
+
+		// files without a time get the start of MS-DOS dates, 1980
+		for _, f := range r.File {
+			if f.Modified.Year() > 1980 && f.Modified.After(latest) {
+				latest = f.Modified
+			}
+		}
+	}
+
+	if latest.IsZero() {
+		latest = info.ModTime()
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,220 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// name of the file in the database path recording the full download and the updates applied
+const LedgerFileName = config.LedgerFileName
+
+// updates are extracted to folders named after their zip files, such as UltActualiz_20261019
+const updateDirPrefix = "UltActualiz_"
+
+// LedgerEntry records the full database or an update applied to the local database
+type LedgerEntry struct {
+	Date    time.Time `json:"Date"`    // publication date of the update, or day of the full download
+	File    string    `json:"File"`    // zip file downloaded
+	SHA256  string    `json:"SHA256"`  // checksum of the zip file
+	Series  int       `json:"Series"`  // number of series it held
+	Applied time.Time `json:"Applied"` // when it was applied
+
+	// path of the zip file or directory it was imported from, empty if it was downloaded
+	Imported string `json:"Imported,omitempty"`
+}
+
+// Ledger records the last full download of the database and the updates applied since
+type Ledger struct {
+	FullDatabase *LedgerEntry  `json:"FullDatabase"`
+	Updates      []LedgerEntry `json:"Updates"` // by date
+
+	filePath string
+}
+
+// returns the day of t, at midnight UTC, which is how update dates are compared
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LoadLedger reads the ledger in dbLocalPath. Databases downloaded before the ledger existed get
+// one built from what can be found in dbLocalPath: the update folders, and the catalog as the full
+// download.
+func LoadLedger(dbLocalPath string) (*Ledger, error) {
+	ledger := &Ledger{filePath: filepath.Join(dbLocalPath, LedgerFileName)}
+
+	content, err := ioutil.ReadFile(ledger.filePath)
+	if os.IsNotExist(err) {
+		err = ledger.bootstrap(dbLocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("download.LoadLedger(): %w", err)
+		}
+		return ledger, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("download.LoadLedger(): %w", err)
+	}
+
+	err = json.Unmarshal(content, ledger)
+	if err != nil {
+		return nil, fmt.Errorf("download.LoadLedger(): %s: %w", LedgerFileName, err)
+	}
+
+	return ledger, nil
+}
+
+// fills the ledger from the folders of the updates extracted in dbLocalPath and the date of its
+// catalog
+func (l *Ledger) bootstrap(dbLocalPath string) error {
+	entries, err := ioutil.ReadDir(dbLocalPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), updateDirPrefix) {
+			continue
+		}
+
+		date, err := time.Parse("20060102", strings.TrimPrefix(entry.Name(), updateDirPrefix))
+		if err != nil {
+			continue
+		}
+
+		l.Record(LedgerEntry{Date: date, File: entry.Name() + ".zip", Applied: entry.ModTime()})
+	}
+
+	// the catalog was written by the full download, or by the updates applied on top of it, so the
+	// full download is at least as old as the catalog and as the oldest update
+	if info, err := os.Stat(filepath.Join(dbLocalPath, database.CatalogFileName)); err == nil {
+		fullDay := day(info.ModTime())
+		if len(l.Updates) > 0 && l.Updates[0].Date.Before(fullDay) {
+			fullDay = l.Updates[0].Date
+		}
+		l.FullDatabase = &LedgerEntry{Date: fullDay, Applied: info.ModTime()}
+	}
+
+	return nil
+}
+
+// Save writes the ledger back to the database path
+func (l *Ledger) Save() error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("download.Ledger.Save(): %w", err)
+	}
+
+	err = utils.WriteFileAtomic(l.filePath, content)
+	if err != nil {
+		return fmt.Errorf("download.Ledger.Save(): %w", err)
+	}
+
+	return nil
+}
+
+// Applied reports whether the update published on date has been applied
+func (l *Ledger) Applied(date time.Time) bool {
+	for _, entry := range l.Updates {
+		if entry.Date.Equal(day(date)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record adds an applied update to the ledger, replacing a former entry for the same date
+func (l *Ledger) Record(entry LedgerEntry) {
+	entry.Date = day(entry.Date)
+
+	for i := range l.Updates {
+		if l.Updates[i].Date.Equal(entry.Date) {
+			l.Updates[i] = entry
+			return
+		}
+	}
+
+	l.Updates = append(l.Updates, entry)
+	sort.Slice(l.Updates, func(i, j int) bool { return l.Updates[i].Date.Before(l.Updates[j].Date) })
+}
+
+// RecordFullDatabase records a full download. Updates published before it are included in it.
+func (l *Ledger) RecordFullDatabase(entry LedgerEntry) {
+	entry.Date = day(entry.Date)
+	l.FullDatabase = &entry
+}
+
+// Baseline returns the date the local database is up to: the latest of the full download and the
+// updates applied. It is the zero time if the full database has never been downloaded.
+func (l *Ledger) Baseline() time.Time {
+	if l.FullDatabase == nil {
+		return time.Time{}
+	}
+
+	baseline := l.FullDatabase.Date
+	for _, entry := range l.Updates {
+		if entry.Date.After(baseline) {
+			baseline = entry.Date
+		}
+	}
+	return baseline
+}
+
+// GapError is returned by Update when updates published since the local database was last brought
+// up to date are no longer listed by the site, so that only a full download can bring it up to date
+type GapError struct {
+	Baseline time.Time // date the local database is up to, zero if it was never downloaded
+	Oldest   time.Time // oldest update listed by the site
+}
+
+func (e *GapError) Error() string {
+	if e.Baseline.IsZero() {
+		return "the full database has not been downloaded yet: a full download is needed"
+	}
+	return fmt.Sprintf("the database is up to %s, but the oldest update listed is from %s: updates may have been missed and a full download is needed",
+		e.Baseline.Format("2006-01-02"), e.Oldest.Format("2006-01-02"))
+}
+
+// returns the updates among links that have to be applied, oldest first. Updates published on the
+// day of the full download are applied, since it cannot be told whether the full database already
+// included them. If the oldest update listed is more recent than the date the database is up to,
+// updates in between may no longer be listed, and a *GapError is returned.
+func (l *Ledger) missing(links []updateLink) ([]updateLink, error) {
+	baseline := l.Baseline()
+
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	oldest := links[0].date
+	for _, link := range links {
+		if link.date.Before(oldest) {
+			oldest = link.date
+		}
+	}
+
+	if baseline.IsZero() || oldest.After(baseline) {
+		return nil, &GapError{Baseline: baseline, Oldest: oldest}
+	}
+
+	var missing []updateLink
+	for _, link := range links {
+		if link.date.Before(l.FullDatabase.Date) || l.Applied(link.date) {
+			continue
+		}
+		missing = append(missing, link)
+	}
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i].date.Before(missing[j].date) })
+
+	return missing, nil
+}
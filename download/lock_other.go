@@ -0,0 +1,65 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package download
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// takes an exclusive lock by creating the file at filePath, holding the id of the process, on
+// platforms without flock. The file is removed when the lock is released. A file left by a process
+// that ended without releasing the lock is removed if that process can no longer be found, and
+// otherwise ErrLocked is returned, naming the file to remove by hand.
+func lockFile(filePath string) (func() error, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) && staleLock(filePath) {
+		os.Remove(filePath)
+		file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: remove %s if no other bdsicego process is running", ErrLocked, filePath)
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return nil, err
+	}
+
+	return func() error {
+		return os.Remove(filePath)
+	}, nil
+}
+
+// reports whether the lock file at filePath was left by a process that is gone. Files that do not
+// hold a process id, such as those being written, are not stale.
+func staleLock(filePath string) bool {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+
+	// os.FindProcess fails for processes that no longer exist on Windows
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	process.Release()
+
+	return false
+}
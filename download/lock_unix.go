@@ -0,0 +1,33 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package download
+
+import (
+	"os"
+	"syscall"
+)
+
+// takes an exclusive lock on the file at filePath, creating it if needed, or returns ErrLocked if
+// another process holds it. The lock is released by the system if the process ends, so the file
+// is left in place.
+func lockFile(filePath string) (func() error, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		file.Close()
+		return nil, ErrLocked
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() error {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		return file.Close()
+	}, nil
+}
@@ -0,0 +1,86 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// name of the file in the database root recording the files downloaded and their checksums
+const ManifestFileName = config.ManifestFileName
+
+// ManifestEntry records a downloaded file once it has been validated
+type ManifestEntry struct {
+	File   string    `json:"File"`
+	URL    string    `json:"URL"`
+	Size   int64     `json:"Size"`
+	SHA256 string    `json:"SHA256"`
+	Time   time.Time `json:"Time"`
+}
+
+// Manifest holds the last download of every file, by file name
+type Manifest map[string]ManifestEntry
+
+// LoadManifest reads the download manifest in dbLocalPath, the database root. A missing manifest yields an empty one.
+func LoadManifest(dbLocalPath string) (Manifest, error) {
+	manifest := Manifest{}
+
+	content, err := ioutil.ReadFile(filepath.Join(dbLocalPath, ManifestFileName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("download.LoadManifest(): %w", err)
+	}
+
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("download.LoadManifest(): %s: %w", ManifestFileName, err)
+	}
+
+	return manifest, nil
+}
+
+// Verify checks that the file of an entry, in dbLocalPath, still has the size and checksum it had
+// when it was downloaded
+func (m Manifest) Verify(dbLocalPath string, fileName string) error {
+	entry, ok := m[fileName]
+	if !ok {
+		return fmt.Errorf("download.Manifest.Verify(): %s is not in the download manifest", fileName)
+	}
+
+	checksum, size, err := fileChecksum(filepath.Join(dbLocalPath, fileName))
+	if err != nil {
+		return fmt.Errorf("download.Manifest.Verify(): %w", err)
+	}
+
+	if size != entry.Size || checksum != entry.SHA256 {
+		return fmt.Errorf("download.Manifest.Verify(): %s has changed since it was downloaded on %s",
+			fileName, entry.Time.Format("2006-01-02 15:04"))
+	}
+
+	return nil
+}
+
+// adds entry to the download manifest in dbLocalPath, replacing any former download of the same file
+func recordDownload(dbLocalPath string, entry ManifestEntry) error {
+	manifest, err := LoadManifest(dbLocalPath)
+	if err != nil {
+		return err
+	}
+
+	manifest[entry.File] = entry
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(dbLocalPath, ManifestFileName)
+	return utils.WriteFileAtomic(filePath, content)
+}
@@ -0,0 +1,477 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// states are named after the time they were staged, in UTC
+const stateTimeFormat = "20060102T150405Z"
+
+// states are built in a directory of the states directory with this prefix, which is renamed to
+// the name of the state once the state is complete
+const stagingPrefix = ".staging-"
+
+// file in the database root locked while a state is built and made the current one, so that
+// processes such as bdsicego sync and the commands of the user do not change the states at once
+const lockFileName = ".bdsicego.lock"
+
+// State is a complete copy of the database, as left by a full download or an update
+type State struct {
+	Name    string
+	Time    time.Time
+	Current bool
+}
+
+// ListStates returns the states of the database kept in the database root, oldest first
+func ListStates(ctx context.Context, configuration *config.BDSICEConfig) ([]State, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("download.ListStates(): %w", ctx.Err())
+	}
+
+	states, err := currentStates(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("download.ListStates(): %w", err)
+	}
+
+	return states, nil
+}
+
+// returns the states kept in the database root, oldest first, marking the current one
+func currentStates(configuration *config.BDSICEConfig) ([]State, error) {
+	states, err := listStates(configuration.DatabaseRoot())
+	if err != nil {
+		return nil, err
+	}
+
+	current := filepath.Base(configuration.DatabaseLocalPath)
+	for i := range states {
+		states[i].Current = states[i].Name == current && configuration.DatabaseLocalPath != configuration.DatabaseRoot()
+	}
+
+	return states, nil
+}
+
+func listStates(root string) ([]State, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(root, config.StatesDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+
+		t, err := time.Parse(stateTimeFormat, strings.SplitN(entry.Name(), "-", 2)[0])
+		if err != nil {
+			continue
+		}
+		states = append(states, State{Name: entry.Name(), Time: t})
+	}
+
+	// names sort in the order the states were staged, including those staged within a second
+	sort.Slice(states, func(i, j int) bool {
+		if !states[i].Time.Equal(states[j].Time) {
+			return states[i].Time.Before(states[j].Time)
+		}
+		return stateSequence(states[i].Name) < stateSequence(states[j].Name)
+	})
+
+	return states, nil
+}
+
+// returns the number appended to the name of a state staged within the same second as another one
+func stateSequence(name string) int {
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) < 2 {
+		return 0
+	}
+	n, _ := strconv.Atoi(parts[1])
+	return n
+}
+
+// a state of the database being built. Files are written to it as they are to the database path,
+// and the state only becomes the current one once it is complete and consistent.
+type stagedState struct {
+	configuration *config.BDSICEConfig // configuration with DatabaseLocalPath pointing to the staging directory
+	root          string
+	dirPath       string
+	unlock        func() error // releases the lock on the database root, nil once released
+}
+
+// entries of the database root that belong to the root rather than to a state: the files
+// downloaded, their manifest, the states and the pointer to the current one, and the bulletins,
+// the catalogs of other providers and the log of sync if the data path and the database path are
+// the same
+func rootEntry(configuration *config.BDSICEConfig, name string) bool {
+	switch name {
+	case config.StatesDirName, config.CurrentStateFileName, ManifestFileName, BulletinsDirName, lockFileName,
+		config.ProvidersDirName, config.DefaultSyncLogFileName:
+		return true
+	}
+	if configuration.SyncLog != "" && filepath.Clean(configuration.SyncLog) == filepath.Join(configuration.DatabaseRoot(), name) {
+		return true
+	}
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, partialSuffix) || strings.Contains(name, ".tmp")
+}
+
+// starts building a new state of the database. If clone is true, the new state starts as a copy of
+// the current one, and otherwise it starts with only the snapshots of the catalog. Files are copied
+// as hard links where possible, so the files of a state must be replaced rather than rewritten in
+// place. The database root is locked until the state is committed or discarded, and ErrLocked is
+// returned if another process holds the lock.
+func beginState(configuration *config.BDSICEConfig, clone bool) (*stagedState, error) {
+	root := configuration.DatabaseRoot()
+	statesDir := filepath.Join(root, config.StatesDirName)
+
+	err := os.MkdirAll(statesDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockFile(filepath.Join(root, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// another process may have made another state the current one since configuration was resolved
+	err = config.ResolveDatabaseState(configuration)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	s, err := stageState(configuration, clone)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	s.unlock = unlock
+
+	return s, nil
+}
+
+// creates the staging directory of a new state, with the database root locked
+func stageState(configuration *config.BDSICEConfig, clone bool) (*stagedState, error) {
+	root := configuration.DatabaseRoot()
+	statesDir := filepath.Join(root, config.StatesDirName)
+
+	// a database used from the root itself is moved to a state of its own first, so that it can
+	// be rolled back to
+	if configuration.DatabaseLocalPath == root {
+		err := adoptRootState(configuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// leftovers of states whose building was interrupted, as no other process is building one
+	// while the lock is held
+	if entries, err := ioutil.ReadDir(statesDir); err == nil {
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), stagingPrefix) {
+				os.RemoveAll(filepath.Join(statesDir, entry.Name()))
+			}
+		}
+	}
+
+	dirPath, err := ioutil.TempDir(statesDir, stagingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(dirPath, 0755)
+
+	if clone && configuration.DatabaseLocalPath != root {
+		err = linkTree(configuration.DatabaseLocalPath, dirPath)
+		if err != nil {
+			os.RemoveAll(dirPath)
+			return nil, err
+		}
+	}
+
+	// a state built from scratch keeps the snapshots of the catalog, so that it can be compared
+	// with those taken before it
+	snapshotsDir := filepath.Join(configuration.DatabaseLocalPath, database.SnapshotsDirName)
+	if _, err := os.Stat(snapshotsDir); !clone && configuration.DatabaseLocalPath != root && err == nil {
+		err = linkTree(snapshotsDir, filepath.Join(dirPath, database.SnapshotsDirName))
+		if err != nil {
+			os.RemoveAll(dirPath)
+			return nil, err
+		}
+	}
+
+	stagingConfiguration := *configuration
+	stagingConfiguration.DatabaseRootPath = root
+	stagingConfiguration.DatabaseLocalPath = dirPath
+	stagingConfiguration.UpdateLocalPath = dirPath
+
+	return &stagedState{configuration: &stagingConfiguration, root: root, dirPath: dirPath}, nil
+}
+
+// moves the database files in the root into a state, and makes it the current one
+func adoptRootState(configuration *config.BDSICEConfig) error {
+	root := configuration.DatabaseRoot()
+
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	var toMove []os.FileInfo
+	stateTime := time.Now()
+	for _, entry := range entries {
+		if rootEntry(configuration, entry.Name()) {
+			continue
+		}
+		toMove = append(toMove, entry)
+		if entry.Name() == database.CatalogFileName {
+			stateTime = entry.ModTime()
+		}
+	}
+
+	// an empty root has no state to keep
+	if len(toMove) == 0 {
+		return nil
+	}
+
+	name, err := newStateName(root, stateTime)
+	if err != nil {
+		return err
+	}
+
+	dirPath := filepath.Join(root, config.StatesDirName, name)
+	err = os.Mkdir(dirPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range toMove {
+		err = os.Rename(filepath.Join(root, entry.Name()), filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return switchState(configuration, name)
+}
+
+// returns an unused name for a state staged at t
+func newStateName(root string, t time.Time) (string, error) {
+	base := t.UTC().Format(stateTimeFormat)
+
+	name := base
+	for i := 1; ; i++ {
+		_, err := os.Stat(filepath.Join(root, config.StatesDirName, name))
+		if os.IsNotExist(err) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// recreates the directory tree at origin in destination, with hard links to the files of origin.
+// Files that cannot be linked, for instance across file systems, are copied.
+func linkTree(origin string, destination string) error {
+	return filepath.Walk(origin, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(origin, filePath)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		if os.Link(filePath, target) == nil {
+			return nil
+		}
+		return copyFile(filePath, target, info)
+	})
+}
+
+// copies the file at origin to destination, keeping its modification time, which Check compares
+func copyFile(origin string, destination string, info os.FileInfo) error {
+	in, err := os.Open(origin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(destination, info.ModTime(), info.ModTime())
+}
+
+// checks that the staged state is a consistent database, names it and makes it the current state
+// of configuration. The oldest states beyond the number to keep are removed. The lock on the
+// database root is released unless the state is left to be discarded.
+func (s *stagedState) commit(configuration *config.BDSICEConfig) error {
+	err := s.promote(configuration)
+	if err == nil {
+		s.release()
+	}
+	return err
+}
+
+func (s *stagedState) promote(configuration *config.BDSICEConfig) error {
+	report, err := database.Check(s.configuration)
+	if err != nil {
+		return err
+	}
+	if report.Problems() > 0 {
+		return fmt.Errorf("%w, keeping the current one:\n%s", ErrInconsistentState, report.String())
+	}
+
+	name, err := newStateName(s.root, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(s.dirPath, filepath.Join(s.root, config.StatesDirName, name))
+	if err != nil {
+		return err
+	}
+
+	err = switchState(configuration, name)
+	if err != nil {
+		return err
+	}
+
+	return pruneStates(configuration)
+}
+
+// removes the staged state and releases the lock on the database root
+func (s *stagedState) discard() {
+	os.RemoveAll(s.dirPath)
+	s.release()
+}
+
+// releases the lock on the database root, if it is still held
+func (s *stagedState) release() {
+	if s.unlock != nil {
+		s.unlock()
+		s.unlock = nil
+	}
+}
+
+// makes the state name the current one. The pointer file is replaced by renaming, so that it
+// always names a complete state.
+func switchState(configuration *config.BDSICEConfig, name string) error {
+	root := configuration.DatabaseRoot()
+	pointerPath := filepath.Join(root, config.CurrentStateFileName)
+
+	err := utils.WriteFileAtomic(pointerPath, []byte(name+"\n"))
+	if err != nil {
+		return err
+	}
+
+	configuration.DatabaseRootPath = root
+	configuration.DatabaseLocalPath = filepath.Join(root, config.StatesDirName, name)
+	configuration.UpdateLocalPath = configuration.DatabaseLocalPath
+
+	return nil
+}
+
+// removes the oldest states beyond configuration.KeepStates, never the current one
+func pruneStates(configuration *config.BDSICEConfig) error {
+	keep := configuration.KeepStates
+	if keep < 1 {
+		keep = config.DefaultKeepStates
+	}
+
+	states, err := currentStates(configuration)
+	if err != nil {
+		return err
+	}
+
+	toRemove := len(states) - keep
+	for _, state := range states {
+		if toRemove <= 0 {
+			break
+		}
+		if state.Current {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(configuration.DatabaseRoot(), config.StatesDirName, state.Name))
+		if err != nil {
+			return err
+		}
+		toRemove--
+	}
+
+	return nil
+}
+
+// Rollback makes the state before the current one the current state of the database, and returns
+// it. The state rolled back from is kept until it is pruned by later updates.
+func Rollback(ctx context.Context, configuration *config.BDSICEConfig) (*State, error) {
+	unlock, err := lockFile(filepath.Join(configuration.DatabaseRoot(), lockFileName))
+	if err != nil {
+		return nil, fmt.Errorf("download.Rollback(): %w", err)
+	}
+	defer unlock()
+
+	// another process may have made another state the current one since configuration was resolved
+	err = config.ResolveDatabaseState(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("download.Rollback(): %w", err)
+	}
+
+	states, err := ListStates(ctx, configuration)
+	if err != nil {
+		return nil, fmt.Errorf("download.Rollback(): %w", err)
+	}
+
+	for i := range states {
+		if states[i].Current {
+			if i == 0 {
+				return nil, fmt.Errorf("download.Rollback(): %w", ErrNoPreviousState)
+			}
+
+			err = switchState(configuration, states[i-1].Name)
+			if err != nil {
+				return nil, fmt.Errorf("download.Rollback(): %w", err)
+			}
+
+			previous := states[i-1]
+			previous.Current = true
+			return &previous, nil
+		}
+	}
+
+	return nil, fmt.Errorf("download.Rollback(): %w", ErrNoPreviousState)
+}
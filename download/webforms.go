@@ -0,0 +1,334 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// hidden field that every WebForms page must hold for a postback to be accepted
+const viewStateField = "__VIEWSTATE"
+
+// links and buttons of WebForms pages post back through javascript:__doPostBack('target','argument')
+var doPostBackRe = regexp.MustCompile(`__doPostBack\('([^']*)'\s*,\s*'([^']*)'\)`)
+
+// LayoutError is returned when a page lacks an element that bdsicego relies on, which most likely
+// means that the layout of the BDSICE website has changed
+type LayoutError struct {
+	URL     string
+	Element string
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("%s has no element %s: the layout of the page may have changed", e.URL, e.Element)
+}
+
+// Is makes errors.Is(err, ErrLayoutChanged) true for every *LayoutError
+func (e *LayoutError) Is(target error) bool {
+	return target == ErrLayoutChanged
+}
+
+// Session browses an ASP.NET WebForms site. Its cookie jar keeps the ASP.NET_SessionId cookie the
+// site hands out, without which postbacks are rejected.
+type Session struct {
+	client    *http.Client
+	userAgent string
+}
+
+// NewSession returns a session sending requests with the given User-Agent header
+func NewSession(userAgent string) (*Session, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("download.NewSession(): %w", err)
+	}
+
+	// no overall timeout, since the full database takes minutes to download, but connections and
+	// servers that do not answer are given up on
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 2 * time.Minute,
+	}
+
+	return &Session{
+		client:    &http.Client{Jar: jar, Transport: transport},
+		userAgent: userAgent,
+	}, nil
+}
+
+// builds a request with the headers a browser would send, which is abandoned when ctx is done.
+// referer may be empty. A positive offset requests the resource from that byte on.
+func (s *Session) newRequest(ctx context.Context, method string, requestURL string, body io.Reader, referer string, offset int64) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", s.userAgent)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	request.Header.Set("DNT", "1")
+	request.Header.Set("Upgrade-Insecure-Requests", "1")
+
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	if referer != "" {
+		request.Header.Set("Referer", referer)
+		if r, err := url.Parse(referer); err == nil {
+			request.Header.Set("Origin", r.Scheme+"://"+r.Host)
+		}
+	}
+
+	return request, nil
+}
+
+// Open sends a GET request for resourceURL within the session and returns the response, whose body
+// must be closed by the caller. Responses other than 200 OK are returned as errors. The request, and
+// the reading of the body, are abandoned when ctx is done.
+func (s *Session) Open(ctx context.Context, resourceURL string, referer string) (*http.Response, error) {
+	return s.OpenFrom(ctx, resourceURL, referer, 0)
+}
+
+// OpenFrom is like Open, but requests the resource from byte offset on. The response is either
+// 206 Partial Content or, if the server ignores the range, 200 OK with the whole resource.
+func (s *Session) OpenFrom(ctx context.Context, resourceURL string, referer string, offset int64) (*http.Response, error) {
+	request, err := s.newRequest(ctx, "GET", resourceURL, nil, referer, offset)
+	if err != nil {
+		return nil, fmt.Errorf("download.Session.Open(): %w", err)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("download.Session.Open(): %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		response.Body.Close()
+		return nil, fmt.Errorf("download.Session.Open(): GET %s: %s", resourceURL, response.Status)
+	}
+
+	return response, nil
+}
+
+// Page is a WebForms page fetched within a session
+type Page struct {
+	URL    string
+	Root   *html.Node
+	Fields url.Values // hidden form fields, such as __VIEWSTATE and __EVENTVALIDATION
+
+	session *Session
+}
+
+// Get fetches and parses the page at pageURL
+func (s *Session) Get(ctx context.Context, pageURL string) (*Page, error) {
+	response, err := s.Open(ctx, pageURL, "")
+	if err != nil {
+		return nil, fmt.Errorf("download.Session.Get(): %w", err)
+	}
+	defer response.Body.Close()
+
+	root, err := html.Parse(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download.Session.Get(): %s: %w", pageURL, err)
+	}
+
+	page := &Page{
+		URL:     pageURL,
+		Root:    root,
+		Fields:  url.Values{},
+		session: s,
+	}
+	page.collectFields(root)
+
+	return page, nil
+}
+
+// gathers the hidden inputs of the page into p.Fields
+func (p *Page) collectFields(n *html.Node) {
+	if n.Type == html.ElementNode && n.Data == "input" && strings.EqualFold(attribute(n, "type"), "hidden") {
+		if name := attribute(n, "name"); name != "" {
+			p.Fields.Set(name, attribute(n, "value"))
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.collectFields(c)
+	}
+}
+
+// returns the value of the attribute key of n, or an empty string
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// returns the text held by n and its descendants, with spaces collapsed
+func textContent(n *html.Node) string {
+	var b strings.Builder
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Element returns the element of the page with the given id
+func (p *Page) Element(id string) (*html.Node, error) {
+	element, ok := getElementById(id, p.Root)
+	if !ok {
+		return nil, &LayoutError{URL: p.URL, Element: "#" + id}
+	}
+	return element, nil
+}
+
+// Text returns the text of the element of the page with the given id
+func (p *Page) Text(id string) (string, error) {
+	element, err := p.Element(id)
+	if err != nil {
+		return "", err
+	}
+	return textContent(element), nil
+}
+
+// GridRow is a row of a DataGrid: the text of its cells and the event targets of the links it holds
+type GridRow struct {
+	Cells   []string
+	Targets []string
+}
+
+// Grid returns the rows of the DataGrid with the given id, including its header row
+func (p *Page) Grid(id string) ([]GridRow, error) {
+	table, err := p.Element(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []GridRow
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "tr" {
+			rows = append(rows, gridRow(n))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(table)
+
+	return rows, nil
+}
+
+func gridRow(tr *html.Node) GridRow {
+	var row GridRow
+
+	var collectTargets func(*html.Node)
+	collectTargets = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, key := range []string{"href", "onclick"} {
+				if m := doPostBackRe.FindStringSubmatch(attribute(n, key)); m != nil {
+					row.Targets = append(row.Targets, m[1])
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collectTargets(c)
+		}
+	}
+
+	for c := tr.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+			row.Cells = append(row.Cells, textContent(c))
+			collectTargets(c)
+		}
+	}
+
+	return row
+}
+
+// Postback submits the form of the page as if the control target had been clicked, and returns the
+// response, whose body must be closed by the caller. The hidden fields of the page are sent back
+// along with __EVENTTARGET and __EVENTARGUMENT.
+func (p *Page) Postback(ctx context.Context, target string, argument string) (*http.Response, error) {
+	return p.PostbackFrom(ctx, target, argument, 0)
+}
+
+// PostbackFrom is like Postback, but requests the response from byte offset on, to resume the
+// download of a file served in response to the postback
+func (p *Page) PostbackFrom(ctx context.Context, target string, argument string, offset int64) (*http.Response, error) {
+	if _, ok := p.Fields[viewStateField]; !ok {
+		return nil, &LayoutError{URL: p.URL, Element: viewStateField}
+	}
+
+	form := url.Values{}
+	for name, values := range p.Fields {
+		form[name] = append([]string{}, values...)
+	}
+	form.Set("__EVENTTARGET", target)
+	form.Set("__EVENTARGUMENT", argument)
+
+	request, err := p.session.newRequest(ctx, "POST", p.URL, strings.NewReader(form.Encode()), p.URL, offset)
+	if err != nil {
+		return nil, fmt.Errorf("download.Page.Postback(): %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := p.session.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("download.Page.Postback(): %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		// ASP.NET describes rejected postbacks in the title of its error page
+		message := response.Status
+		if root, err := html.Parse(io.LimitReader(response.Body, 1<<16)); err == nil {
+			if title := findElement(root, "title"); title != nil {
+				message = message + ": " + textContent(title)
+			}
+		}
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		return nil, fmt.Errorf("download.Page.Postback(): POST %s (%s): %s", p.URL, target, message)
+	}
+
+	return response, nil
+}
+
+// returns the first element named tag under n
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
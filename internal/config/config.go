@@ -40,15 +40,114 @@ type BDSICEConfig struct {
 	UserAgent         string `yaml:"useragent"`
 	Debug             bool   `yaml:"debug"`
 	PlotViewer        string `yaml:"plotviewer"`
+	KeepStates        int    `yaml:"keepstates"` // states of the database kept for rollback
+
+	// size of plots in inches, and dots per inch of those saved to PNG, JPEG and TIFF files, over
+	// those of the style of plots, one of plotting.yml or a built-in one
+	PlotWidth  float64 `yaml:"plotwidth"`
+	PlotHeight float64 `yaml:"plotheight"`
+	PlotDPI    int     `yaml:"plotdpi"`
+	PlotStyle  string  `yaml:"plotstyle"`
+
+	// schedule of sync: every syncinterval, such as 6h, or at the times of the day in synctimes,
+	// such as 09:30
+	SyncInterval string   `yaml:"syncinterval"`
+	SyncTimes    []string `yaml:"synctimes"`
+	SyncLog      string   `yaml:"synclog"`   // file sync writes its log to, sync.log in path if empty
+	SyncHooks    []string `yaml:"synchooks"` // commands run by sync after applying updates
+
+	// INE Tempus JSON API, and the INE operations, such as IPC or EPA, whose series are listed in
+	// the catalog of the ine provider
+	INEURL        string   `yaml:"ineurl"`
+	INEOperations []string `yaml:"ineoperations"`
+
+	// dblocalpath as configured. DatabaseLocalPath points to the current state of the database
+	// within it once ResolveDatabaseState has been called.
+	DatabaseRootPath string `yaml:"-"`
 }
 
-// returns a hard-coded and architecture-dependant path to the config file.
-func GetDefaultConfigFilePath() (string, error) {
-	var filePath string
+// directory within dblocalpath holding the states of the database, each of them a complete database
+const StatesDirName = "states"
+
+// file in dblocalpath holding the name of the current state of the database
+const CurrentStateFileName = "current"
+
+// files written to the database by packages tree and download, named here so that package
+// database can tell them from the files of the series
+const (
+	TreeFileName     = "tree.json"      // taxonomy of the series, next to the catalog
+	LedgerFileName   = "ledger.json"    // full download and updates applied, next to the catalog
+	ManifestFileName = "downloads.json" // files downloaded and their checksums, in the database root
+)
+
+// directory within the data path holding the catalogs of the providers other than BDSICE, named
+// here so that package download keeps it out of the states of the database when the data path is
+// also the database root
+const ProvidersDirName = "providers"
+
+// number of states of the database kept when keepstates is not set
+const DefaultKeepStates = 3
+
+// interval between the checks of sync when neither syncinterval nor synctimes are set
+const DefaultSyncInterval = "6h"
+
+// file in path sync writes its log to when synclog is not set
+const DefaultSyncLogFileName = "sync.log"
+
+// base URL of the INE Tempus JSON API when ineurl is not set
+const DefaultINEURL = "https://servicios.ine.es/wstempus/js/ES/"
+
+// DatabaseRoot returns the directory configured as dblocalpath, which holds the states of the
+// database, the files downloaded and their manifest
+func (c *BDSICEConfig) DatabaseRoot() string {
+	if c.DatabaseRootPath != "" {
+		return c.DatabaseRootPath
+	}
+	return c.DatabaseLocalPath
+}
+
+// ResolveDatabaseState points DatabaseLocalPath to the current state of the database, as named in
+// the current file of dblocalpath. Databases that have never been updated since states were
+// introduced have no such file, and are used from dblocalpath itself.
+func ResolveDatabaseState(configuration *BDSICEConfig) error {
+	root := configuration.DatabaseRoot()
+	configuration.DatabaseRootPath = root
+
+	content, err := ioutil.ReadFile(filepath.Join(root, CurrentStateFileName))
+	if os.IsNotExist(err) {
+		configuration.DatabaseLocalPath = root
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("config.ResolveDatabaseState(): %s", err.Error())
+	}
+
+	name := strings.TrimSpace(string(content))
+	if name == "" || filepath.Base(name) != name {
+		return fmt.Errorf("config.ResolveDatabaseState(): %s does not name a state: %q", CurrentStateFileName, name)
+	}
 
+	configuration.DatabaseLocalPath = filepath.Join(root, StatesDirName, name)
+	return nil
+}
+
+// returns the architecture-dependant configuration directory, creating it if it does not exist.
+// Files other than config.yml that tune the behaviour of bdsicego are also stored there.
+func GetConfigDir() (string, error) {
 	configDir := configdir.LocalConfig("bdsicego")
 	err := configdir.MakePath(configDir)
 
+	if err != nil {
+		return "", fmt.Errorf("config.GetConfigDir(): %s", err.Error())
+	}
+
+	return configDir, nil
+}
+
+// returns a hard-coded and architecture-dependant path to the config file.
+func GetDefaultConfigFilePath() (string, error) {
+	var filePath string
+
+	configDir, err := GetConfigDir()
 	if err != nil {
 		return "", fmt.Errorf("config.GetConfig(): %s", err.Error())
 	}
@@ -158,6 +257,11 @@ func GetConfig() (*BDSICEConfig, error) {
 				return nil, fmt.Errorf("config.GetConfig(): %s", err.Error())
 			}
 
+			err = ResolveDatabaseState(&configuration)
+			if err != nil {
+				return nil, fmt.Errorf("config.GetConfig(): %s", err.Error())
+			}
+
 			return &configuration, nil
 		}
 	}
@@ -181,5 +285,10 @@ func GetConfig() (*BDSICEConfig, error) {
 		return nil, fmt.Errorf("config.GetConfig(): %s", err.Error())
 	}
 
+	err = ResolveDatabaseState(&configuration)
+	if err != nil {
+		return nil, fmt.Errorf("config.GetConfig(): %s", err.Error())
+	}
+
 	return &configuration, nil
 }
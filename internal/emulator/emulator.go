@@ -0,0 +1,505 @@
+// package emulator serves an imitation of the pages of the BDSICE website used by bdsicego to
+// download the database and its updates, so that downloads can be tested offline. Pages are
+// ASP.NET WebForms pages: postbacks must carry the __VIEWSTATE and __EVENTVALIDATION issued to the
+// session identified by the ASP.NET_SessionId cookie, as the real site requires.
+package emulator
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+)
+
+// paths of the pages served, as in the BDSICE website
+const (
+	HomePath    = "/Indeco/BDSICE/HomeBDSICE.aspx"
+	UpdatesPath = "/Indeco/BDSICE/Ultimasactualizaciones_new.aspx"
+	ArchivePath = "/Indeco/DescargaArchivo.aspx"
+
+	BulletinsPath = "/indeco/"
+	// bulletins are served from this directory, below BulletinsPath
+	BulletinFilesPath = "/indeco/boletines/"
+)
+
+// name of the cookie holding the session id
+const SessionCookieName = "ASP.NET_SessionId"
+
+// name of the zip file holding the full database
+const DatabaseFileName = "BDSICE.zip"
+
+// event target of the link to the full database in HomeBDSICE.aspx
+const fullDatabaseTarget = "lbutton_BdsiceCompleta"
+
+// Server emulates the BDSICE website. It implements http.Handler and can be run in-process with
+// net/http/httptest or as a standalone server.
+type Server struct {
+	Database  []Fixture  // series in the full database
+	Updates   []Update   // partial updates, most recent first
+	Bulletins []Bulletin // coyuntura bulletins, most recent first
+
+	// INE Tempus JSON API, served below TempusPath
+	Tempus *Tempus
+
+	// the next Drops zip files served are cut after DropAfter bytes, to test resumed downloads
+	Drops     int
+	DropAfter int64
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	requests map[string]int // path: number of requests received
+}
+
+// state of a client session
+type session struct {
+	viewStates map[string]string // path: view state issued with the last page served
+	pending    *Update           // update selected by a postback, served by DescargaArchivo.aspx
+}
+
+// New returns an emulator serving the given full database and updates
+func New(database []Fixture, updates []Update, bulletins []Bulletin) *Server {
+	return &Server{
+		Database:  database,
+		Updates:   updates,
+		Bulletins: bulletins,
+		sessions:  make(map[string]*session),
+		requests:  make(map[string]int),
+	}
+}
+
+// NewDefault returns an emulator serving the default fixtures, with the latest update published
+// on the given date
+func NewDefault(latest time.Time) *Server {
+	s := New(DefaultDatabase(latest), DefaultUpdates(latest), DefaultBulletins(latest))
+	s.Tempus = NewDefaultTempus(latest)
+	return s
+}
+
+// Configure points the URLs in configuration to the emulator listening at baseURL, such as
+// http://127.0.0.1:8080
+func Configure(configuration *config.BDSICEConfig, baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	configuration.DownloadURL = baseURL + HomePath
+	configuration.UpdateURL = baseURL + UpdatesPath
+	configuration.BulletinURL = baseURL + BulletinsPath
+	configuration.INEURL = baseURL + TempusPath
+}
+
+// Requests returns the number of requests received for path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	s.mu.Unlock()
+
+	// IIS paths are case-insensitive
+	switch strings.ToLower(r.URL.Path) {
+	case strings.ToLower(HomePath):
+		s.serveHome(w, r)
+	case strings.ToLower(UpdatesPath):
+		s.serveUpdates(w, r)
+	case strings.ToLower(ArchivePath):
+		s.serveArchive(w, r)
+	case strings.ToLower(BulletinsPath):
+		s.serveBulletins(w, r)
+	default:
+		if s.Tempus != nil && strings.HasPrefix(r.URL.Path, TempusPath) {
+			s.Tempus.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(strings.ToLower(r.URL.Path), BulletinFilesPath) {
+			s.serveBulletin(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// returns the session of the request or, if it has none or an unknown one, starts a new session
+// and sets its cookie
+func (s *Server) session(w http.ResponseWriter, r *http.Request) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if sess, ok := s.sessions[cookie.Value]; ok {
+			return sess
+		}
+	}
+
+	// ASP.NET session ids are 24 lowercase characters
+	id := randomHex(12)
+	sess := &session{viewStates: make(map[string]string)}
+	s.sessions[id] = sess
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookieName, Value: id, Path: "/", HttpOnly: true})
+
+	return sess
+}
+
+// returns the session of the request without starting a new one
+func (s *Server) existingSession(r *http.Request) *session {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions[cookie.Value]
+}
+
+// hidden fields of a WebForms page
+type formState struct {
+	ViewState          string
+	ViewStateGenerator string
+	EventValidation    string
+}
+
+// issues a new view state for the page at path and returns the hidden fields to render with it.
+// Event validation lists the targets that a postback of the page may name.
+func (s *Server) issue(sess *session, path string, targets []string) formState {
+	viewState := base64.StdEncoding.EncodeToString([]byte("/wEPDwUK" + randomHex(16)))
+
+	s.mu.Lock()
+	sess.viewStates[path] = viewState
+	s.mu.Unlock()
+
+	return formState{
+		ViewState:          viewState,
+		ViewStateGenerator: strings.ToUpper(randomHex(4)),
+		EventValidation:    eventValidation(viewState, targets),
+	}
+}
+
+// event validation depends on the view state, so that both must come from the same page
+func eventValidation(viewState string, targets []string) string {
+	return base64.StdEncoding.EncodeToString([]byte(viewState + "|" + strings.Join(targets, "|")))
+}
+
+// checks a postback of the page at path and returns its event target. ASP.NET answers invalid
+// postbacks with a server error page, which is what is written to w if ok is false.
+func (s *Server) postback(w http.ResponseWriter, r *http.Request, path string, targets []string) (target string, sess *session, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		serverError(w, "Bad request: "+err.Error())
+		return "", nil, false
+	}
+
+	sess = s.existingSession(r)
+	if sess == nil {
+		serverError(w, "Validation of viewstate MAC failed. The session has expired or the ASP.NET_SessionId cookie is missing.")
+		return "", nil, false
+	}
+
+	s.mu.Lock()
+	viewState := sess.viewStates[path]
+	s.mu.Unlock()
+
+	if viewState == "" || r.PostForm.Get("__VIEWSTATE") != viewState {
+		serverError(w, "Validation of viewstate MAC failed.")
+		return "", nil, false
+	}
+
+	target = r.PostForm.Get("__EVENTTARGET")
+	if r.PostForm.Get("__EVENTVALIDATION") != eventValidation(viewState, targets) || !contains(targets, target) {
+		serverError(w, "Invalid postback or callback argument. Event validation is enabled using <pages enableEventValidation=\"true\"/>.")
+		return "", nil, false
+	}
+
+	return target, sess, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func serverError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	errorPage.Execute(w, message)
+}
+
+// writes a zip file as BDSICE does, with its name in Content-Disposition and its length. Range
+// requests for the rest of the file, from a given byte on, are answered with 206 Partial Content.
+func (s *Server) serveZip(w http.ResponseWriter, r *http.Request, fileName string, fixtures []Fixture) {
+	content, err := Zip(fixtures)
+	if err != nil {
+		serverError(w, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	var start int64
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		_, err := fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		if err != nil || start < 0 || start >= int64(len(content)) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+	}
+
+	body := content[start:]
+
+	w.Header().Set("Content-Type", "application/x-zip-compressed")
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+
+	s.mu.Lock()
+	drop := s.Drops > 0 && s.DropAfter < int64(len(body))
+	if drop {
+		s.Drops--
+	}
+	s.mu.Unlock()
+
+	if drop {
+		// the connection is closed short of Content-Length, as when a transfer drops
+		w.Write(body[:s.DropAfter])
+		return
+	}
+
+	w.Write(body)
+}
+
+// HomeBDSICE.aspx: the link to the full database posts back to the page, which answers with the zip
+func (s *Server) serveHome(w http.ResponseWriter, r *http.Request) {
+	targets := []string{fullDatabaseTarget}
+
+	if r.Method == http.MethodPost {
+		if _, _, ok := s.postback(w, r, HomePath, targets); !ok {
+			return
+		}
+		s.serveZip(w, r, DatabaseFileName, s.Database)
+		return
+	}
+
+	sess := s.session(w, r)
+	page := struct {
+		Action string
+		formState
+	}{HomePath, s.issue(sess, HomePath, targets)}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	homePage.Execute(w, page)
+}
+
+// returns the event target of the button of the n-th update in the grid. WebForms numbers the
+// rows of a DataGrid from _ctl2, the header row being _ctl1.
+func updateTarget(n int) string {
+	return fmt.Sprintf("dg_Actualizaciones$_ctl%d$boton", n+2)
+}
+
+// Ultimasactualizaciones_new.aspx: a grid with a button per update. Posting back a button selects
+// the update and answers with a page that opens DescargaArchivo.aspx, which serves the zip.
+func (s *Server) serveUpdates(w http.ResponseWriter, r *http.Request) {
+	targets := make([]string, len(s.Updates))
+	for i := range s.Updates {
+		targets[i] = updateTarget(i)
+	}
+
+	if r.Method == http.MethodPost {
+		target, sess, ok := s.postback(w, r, UpdatesPath, targets)
+		if !ok {
+			return
+		}
+
+		for i := range s.Updates {
+			if targets[i] == target {
+				s.mu.Lock()
+				sess.pending = &s.Updates[i]
+				s.mu.Unlock()
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		downloadPage.Execute(w, ArchivePath+"?estadisticas=True&tipo=1")
+		return
+	}
+
+	type row struct {
+		ID     string
+		Target string
+		Text   string
+		Date   string
+	}
+
+	var rows []row
+	for i, update := range s.Updates {
+		rows = append(rows, row{
+			ID:     fmt.Sprintf("dg_Actualizaciones__ctl%d_boton", i+2),
+			Target: targets[i],
+			Text:   fmt.Sprintf("Series actualizadas el día %d del %d de %d", update.Date.Day(), update.Date.Month(), update.Date.Year()),
+			Date:   update.Date.Format("02/01/2006"),
+		})
+	}
+
+	sess := s.session(w, r)
+	page := struct {
+		Action string
+		formState
+		Rows []row
+	}{UpdatesPath, s.issue(sess, UpdatesPath, targets), rows}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	updatesPage.Execute(w, page)
+}
+
+// DescargaArchivo.aspx: serves the update selected by the last postback of the session
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request) {
+	sess := s.existingSession(r)
+
+	var pending *Update
+	if sess != nil {
+		s.mu.Lock()
+		pending = sess.pending
+		s.mu.Unlock()
+	}
+
+	if pending == nil || r.URL.Query().Get("estadisticas") != "True" {
+		// the real site answers with an empty page rather than an error
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body></body></html>"))
+		return
+	}
+
+	s.serveZip(w, r, pending.FileName(), pending.Fixtures)
+}
+
+// the bulletins page links to the PDF files of the bulletins
+func (s *Server) serveBulletins(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	bulletinsPage.Execute(w, struct {
+		FilesPath string
+		Bulletins []Bulletin
+	}{BulletinFilesPath, s.Bulletins})
+}
+
+// serves the PDF file of a bulletin. Range requests are supported, as by IIS for static files.
+func (s *Server) serveBulletin(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	for _, bulletin := range s.Bulletins {
+		if strings.EqualFold(bulletin.File, name) {
+			w.Header().Set("Content-Type", "application/pdf")
+			http.ServeContent(w, r, bulletin.File, bulletin.Date, bytes.NewReader(bulletin.PDF()))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+var homePage = template.Must(template.New("home").Parse(`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>BDSICE - Base de Datos de Series de Indicadores de Coyuntura Econ&#243;mica</title></head>
+<body>
+<form name="form1" method="post" action="{{.Action}}" id="form1">
+<div>
+<input type="hidden" name="__EVENTTARGET" id="__EVENTTARGET" value="" />
+<input type="hidden" name="__EVENTARGUMENT" id="__EVENTARGUMENT" value="" />
+<input type="hidden" name="__VIEWSTATE" id="__VIEWSTATE" value="{{.ViewState}}" />
+</div>
+<script type="text/javascript">
+//<![CDATA[
+var theForm = document.forms['form1'];
+function __doPostBack(eventTarget, eventArgument) {
+    if (!theForm.onsubmit || (theForm.onsubmit() != false)) {
+        theForm.__EVENTTARGET.value = eventTarget;
+        theForm.__EVENTARGUMENT.value = eventArgument;
+        theForm.submit();
+    }
+}
+//]]>
+</script>
+<div>
+<input type="hidden" name="__VIEWSTATEGENERATOR" id="__VIEWSTATEGENERATOR" value="{{.ViewStateGenerator}}" />
+<input type="hidden" name="__EVENTVALIDATION" id="__EVENTVALIDATION" value="{{.EventValidation}}" />
+</div>
+<h1>Base de Datos de Series de Indicadores de Coyuntura Econ&#243;mica</h1>
+<a id="lbutton_BdsiceCompleta" href="javascript:__doPostBack('lbutton_BdsiceCompleta','')">Descarga de la BDSICE completa</a>
+</form>
+</body>
+</html>
+`))
+
+var updatesPage = template.Must(template.New("updates").Parse(`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>BDSICE - &#218;ltimas actualizaciones</title></head>
+<body>
+<form name="Form1" method="post" action="{{.Action}}" id="Form1">
+<div>
+<input type="hidden" name="__EVENTTARGET" id="__EVENTTARGET" value="" />
+<input type="hidden" name="__EVENTARGUMENT" id="__EVENTARGUMENT" value="" />
+<input type="hidden" name="__VIEWSTATE" id="__VIEWSTATE" value="{{.ViewState}}" />
+</div>
+<div>
+<input type="hidden" name="__VIEWSTATEGENERATOR" id="__VIEWSTATEGENERATOR" value="{{.ViewStateGenerator}}" />
+<input type="hidden" name="__EVENTVALIDATION" id="__EVENTVALIDATION" value="{{.EventValidation}}" />
+</div>
+<table cellspacing="0" rules="all" border="1" id="dg_Actualizaciones">
+<tr><td>Actualizaci&#243;n</td><td>Fecha</td></tr>
+{{range .Rows}}<tr><td><a id="{{.ID}}" href="javascript:__doPostBack('{{.Target}}','')">{{.Text}}</a></td><td>{{.Date}}</td></tr>
+{{end}}</table>
+</form>
+</body>
+</html>
+`))
+
+var bulletinsPage = template.Must(template.New("bulletins").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Boletines de coyuntura</title></head>
+<body>
+<h1>Boletines de coyuntura econ&#243;mica</h1>
+<ul class="boletines">
+{{range .Bulletins}}<li><a href="{{$.FilesPath}}{{.File}}" target="_blank">{{.Title}}</a> (PDF)</li>
+{{end}}</ul>
+<a href="/indeco/aviso_legal.htm">Aviso legal</a>
+</body>
+</html>
+`))
+
+var downloadPage = template.Must(template.New("download").Parse(`<html><head>
+<script type="text/javascript">window.open('{{.}}', '_self');</script>
+</head><body></body></html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<html>
+<head><title>{{.}}</title></head>
+<body>
+<h1>Server Error in '/Indeco' Application.</h1>
+<h2><i>{{.}}</i></h2>
+</body>
+</html>
+`))
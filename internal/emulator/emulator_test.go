@@ -0,0 +1,83 @@
+package emulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// returns the value of the hidden input named name in page
+func hiddenField(page []byte, name string) string {
+	m := regexp.MustCompile(`id="` + name + `" value="([^"]*)"`).FindSubmatch(page)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
+
+func TestPostback(t *testing.T) {
+	emu := NewDefault(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC))
+	server := httptest.NewServer(emu)
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	response, err := client.Get(server.URL + UpdatesPath)
+	if err != nil {
+		t.Fatalf("GET: %s", err.Error())
+	}
+	page, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if !bytes.Contains(page, []byte(`href="javascript:__doPostBack('dg_Actualizaciones$_ctl2$boton','')">Series actualizadas el día 19 del 10 de 2026`)) {
+		t.Errorf("GET: latest update missing from the updates page")
+	}
+
+	form := url.Values{
+		"__EVENTTARGET":     {"dg_Actualizaciones$_ctl2$boton"},
+		"__VIEWSTATE":       {hiddenField(page, "__VIEWSTATE")},
+		"__EVENTVALIDATION": {hiddenField(page, "__EVENTVALIDATION")},
+	}
+
+	// postbacks without the session cookie, with a view state from another page or naming a
+	// target that the page does not hold are rejected
+	if response, _ := http.PostForm(server.URL+UpdatesPath, form); response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("POST without session: expected status 500, got %d", response.StatusCode)
+	}
+
+	tampered := url.Values{"__EVENTTARGET": {"dg_Actualizaciones$_ctl9$boton"}, "__VIEWSTATE": form["__VIEWSTATE"], "__EVENTVALIDATION": form["__EVENTVALIDATION"]}
+	if response, _ := client.PostForm(server.URL+UpdatesPath, tampered); response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("POST with an invalid target: expected status 500, got %d", response.StatusCode)
+	}
+
+	if response, _ := client.PostForm(server.URL+UpdatesPath, form); response.StatusCode != http.StatusOK {
+		t.Fatalf("POST: expected status 200, got %d", response.StatusCode)
+	}
+
+	response, err = client.Get(server.URL + ArchivePath + "?estadisticas=True&tipo=1")
+	if err != nil {
+		t.Fatalf("GET archive: %s", err.Error())
+	}
+	content, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if disposition := response.Header.Get("Content-Disposition"); disposition != "attachment; filename=UltActualiz_20261019.zip" {
+		t.Errorf("GET archive: unexpected Content-Disposition %q", disposition)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("GET archive: %s", err.Error())
+	}
+	if len(r.File) != len(emu.Updates[0].Fixtures) {
+		t.Errorf("GET archive: expected %d files, got %d", len(emu.Updates[0].Fixtures), len(r.File))
+	}
+}
@@ -0,0 +1,309 @@
+package emulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Fixture is a serie served by the emulator, as the .xer file found in BDSICE zip files
+type Fixture struct {
+	Code string
+	Xer  []byte
+}
+
+// Update is a partial update listed in Ultimasactualizaciones_new.aspx
+type Update struct {
+	Date     time.Time
+	Fixtures []Fixture
+}
+
+// FileName returns the name of the zip file of the update, which bdsicego uses to tell whether the
+// update has been applied
+func (u Update) FileName() string {
+	return fmt.Sprintf("UltActualiz_%04d%02d%02d.zip", u.Date.Year(), u.Date.Month(), u.Date.Day())
+}
+
+// description of a fixture serie, from which its .xer file is written
+type spec struct {
+	code      string
+	title     string // in Latin-1, as in the files served by BDSICE
+	units     string
+	source    string
+	decimals  int
+	frequency int
+	start     time.Time
+	values    []string
+	notes     []string
+	active    bool
+}
+
+// returns the INI or FIN field of a .xer file for a date of the given frequency
+func xerPeriod(t time.Time, frequency int) string {
+	switch frequency {
+	case 1:
+		return fmt.Sprintf("%d", t.Year())
+	case 4:
+		return fmt.Sprintf("%d %d", t.Year(), (int(t.Month())+2)/3)
+	case 365:
+		return fmt.Sprintf("%d %d %d", t.Year(), t.Month(), t.Day())
+	default:
+		return fmt.Sprintf("%d %d", t.Year(), t.Month())
+	}
+}
+
+// returns the date of the observation that follows t for the given frequency
+func nextPeriod(t time.Time, frequency int) time.Time {
+	switch frequency {
+	case 1:
+		return t.AddDate(1, 0, 0)
+	case 4:
+		return t.AddDate(0, 3, 0)
+	case 365:
+		return t.AddDate(0, 0, 1)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// writes the .xer file of the serie, with the CRLF line endings of BDSICE files
+func (s spec) xer() Fixture {
+	var b bytes.Buffer
+
+	end := s.start
+	for i := 1; i < len(s.values); i++ {
+		end = nextPeriod(end, s.frequency)
+	}
+
+	fmt.Fprintf(&b, "COD: %s\r\n", s.code)
+	fmt.Fprintf(&b, "TIT: %s\r\n", s.title)
+	fmt.Fprintf(&b, "UNI: %s\r\n", s.units)
+	fmt.Fprintf(&b, "FUE: %s\r\n", s.source)
+	if len(s.notes) > 0 {
+		b.WriteString("NOT: \r\n")
+		for _, note := range s.notes {
+			fmt.Fprintf(&b, "%s\r\n", note)
+		}
+		b.WriteString("@\r\n")
+	}
+	fmt.Fprintf(&b, "DEC: %d\r\n", s.decimals)
+	fmt.Fprintf(&b, "FRE: %d\r\n", s.frequency)
+	fmt.Fprintf(&b, "INI: %s\r\n", xerPeriod(s.start, s.frequency))
+	fmt.Fprintf(&b, "FIN: %s\r\n", xerPeriod(end, s.frequency))
+	fmt.Fprintf(&b, "NOB: %d\r\n", len(s.values))
+	for i := 0; i < len(s.values); i += 10 {
+		j := i + 10
+		if j > len(s.values) {
+			j = len(s.values)
+		}
+		fmt.Fprintf(&b, "%s\r\n", strings.Join(s.values[i:j], " "))
+	}
+	b.WriteString("PUB: 1\r\n")
+	b.WriteString("PRI: 0\r\n")
+	if s.active {
+		b.WriteString("DET: 1\r\n")
+	} else {
+		b.WriteString("DET: 0\r\n")
+	}
+	b.WriteString("#\r\n")
+
+	return Fixture{Code: s.code, Xer: b.Bytes()}
+}
+
+// returns n values following a smooth trend, formatted with the given decimals. Every missing-th
+// value is reported as missing (OM), unless missing is zero.
+func values(n int, base float64, step float64, decimals int, missing int) []string {
+	v := make([]string, n)
+	for i := range v {
+		if missing > 0 && i > 0 && i%missing == 0 {
+			v[i] = "OM"
+			continue
+		}
+		// a small seasonal pattern so that plots and growth rates are not trivial
+		seasonal := float64((i%4)-1) * step / 2
+		v[i] = fmt.Sprintf("%.*f", decimals, base+float64(i)*step+seasonal)
+	}
+	return v
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// returns the specs of the series in the default full database. They cover every frequency
+// handled by decode, notes, missing observations, discontinued series and Latin-1 titles.
+func databaseSpecs(until time.Time) []spec {
+	monthsSince2000 := (until.Year()-2000)*12 + int(until.Month()) - 3
+	quartersSince2000 := monthsSince2000 / 3
+
+	return []spec{
+		{code: "100001", title: "EPA. OCUPADOS. TOTAL NACIONAL", units: "MILES DE PERSONAS", source: "INE",
+			decimals: 1, frequency: 4, start: date(2000, time.January, 1),
+			values: values(quartersSince2000, 15500, 45.5, 1, 0), active: true,
+			notes: []string{"Encuesta de Poblaci\xf3n Activa."}},
+		{code: "100002", title: "EPA. PARADOS. \xc1VILA", units: "MILES DE PERSONAS", source: "INE",
+			decimals: 1, frequency: 4, start: date(2000, time.January, 1),
+			values: values(quartersSince2000, 12, 0.1, 1, 0), active: true},
+		{code: "200001", title: "IPC. \xcdNDICE GENERAL. TASA DE VARIACI\xd3N ANUAL", units: "PORCENTAJE", source: "INE",
+			decimals: 1, frequency: 12, start: date(2002, time.January, 1),
+			values: values(monthsSince2000-24, 2.1, 0.01, 1, 37), active: true},
+		{code: "300001", title: "PIB. VOLUMEN ENCADENADO", units: "MILLONES DE EUROS", source: "INE",
+			decimals: 0, frequency: 1, start: date(1995, time.January, 1),
+			values: values(until.Year()-1995, 600000, 15000, 0, 0), active: true},
+		{code: "634814", title: "PRECIO PETR\xd3LEO BRENT", units: "D\xd3LARES POR BARRIL", source: "BANCO DE ESPA\xd1A",
+			decimals: 2, frequency: 365, start: until.AddDate(0, 0, -60),
+			values: values(58, 80, 0.15, 2, 0), active: true},
+		{code: "634814q", title: "PRECIO PETR\xd3LEO BRENT. MEDIA MENSUAL", units: "D\xd3LARES POR BARRIL", source: "BANCO DE ESPA\xd1A",
+			decimals: 2, frequency: 12, start: date(2010, time.January, 1),
+			values: values(monthsSince2000-120, 70, 0.05, 2, 0), active: true},
+		{code: "400001", title: "MATRICULACI\xd3N DE TURISMOS. PLAN PIVE", units: "UNIDADES", source: "DGT",
+			decimals: 0, frequency: 12, start: date(2012, time.October, 1),
+			values: values(40, 60000, 250, 0, 0), active: false},
+	}
+}
+
+// DefaultDatabase returns the fixtures of the full database served by default. Their last
+// observations are as recent as their frequency allows at the given date.
+func DefaultDatabase(until time.Time) []Fixture {
+	var fixtures []Fixture
+	for _, s := range databaseSpecs(until) {
+		fixtures = append(fixtures, s.xer())
+	}
+	return fixtures
+}
+
+// DefaultUpdates returns the updates served by default, the most recent first: one published at
+// the given date, which revises the CPI with a new month and adds a new serie, and one published a
+// week earlier.
+func DefaultUpdates(latest time.Time) []Update {
+	latest = date(latest.Year(), latest.Month(), latest.Day())
+
+	var cpi spec
+	for _, s := range databaseSpecs(latest) {
+		if s.code == "200001" {
+			cpi = s
+		}
+	}
+	cpi.values = append(cpi.values, "2.5")
+
+	afiliados := spec{code: "500001", title: "AFILIADOS A LA SEGURIDAD SOCIAL. TOTAL", units: "MILES DE PERSONAS",
+		source: "MINISTERIO DE INCLUSI\xd3N", decimals: 1, frequency: 12, start: date(2020, time.January, 1),
+		values: values((latest.Year()-2020)*12+int(latest.Month())-2, 19000, 20, 1, 0), active: true}
+
+	brent := databaseSpecs(latest.AddDate(0, 0, -7))[4]
+
+	return []Update{
+		{Date: latest, Fixtures: []Fixture{cpi.xer(), afiliados.xer()}},
+		{Date: latest.AddDate(0, 0, -7), Fixtures: []Fixture{brent.xer()}},
+	}
+}
+
+// LoadFixtures reads the .xer files in dirPath
+func LoadFixtures(dirPath string) ([]Fixture, error) {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("emulator.LoadFixtures(): %s", err.Error())
+	}
+
+	var fixtures []Fixture
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".xer" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("emulator.LoadFixtures(): %s", err.Error())
+		}
+
+		fixtures = append(fixtures, Fixture{Code: strings.TrimSuffix(entry.Name(), ".xer"), Xer: content})
+	}
+
+	return fixtures, nil
+}
+
+// Zip returns a zip file holding the .xer files of the fixtures
+func Zip(fixtures []Fixture) ([]byte, error) {
+	var b bytes.Buffer
+
+	w := zip.NewWriter(&b)
+	for _, fixture := range fixtures {
+		f, err := w.Create(fixture.Code + ".xer")
+		if err != nil {
+			return nil, fmt.Errorf("emulator.Zip(): %s", err.Error())
+		}
+
+		_, err = f.Write(fixture.Xer)
+		if err != nil {
+			return nil, fmt.Errorf("emulator.Zip(): %s", err.Error())
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		return nil, fmt.Errorf("emulator.Zip(): %s", err.Error())
+	}
+
+	return b.Bytes(), nil
+}
+
+// Bulletin is a coyuntura bulletin listed in the bulletins page
+type Bulletin struct {
+	Date  time.Time
+	Title string
+	File  string // name of the PDF file
+}
+
+// PDF returns a minimal PDF document showing the title of the bulletin
+func (b Bulletin) PDF() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	stream := fmt.Sprintf("BT /F1 18 Tf 72 720 Td (%s) Tj ET", strings.NewReplacer("(", "\\(", ")", "\\)").Replace(b.Title))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+var monthNames = []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto",
+	"septiembre", "octubre", "noviembre", "diciembre"}
+
+// DefaultBulletins returns the monthly bulletins listed by default, the most recent first, the
+// latest one published in the month of the given date
+func DefaultBulletins(latest time.Time) []Bulletin {
+	var bulletins []Bulletin
+
+	for i := 0; i < 4; i++ {
+		d := date(latest.Year(), latest.Month(), 1).AddDate(0, -i, 0)
+		bulletins = append(bulletins, Bulletin{
+			Date:  d,
+			Title: fmt.Sprintf("Boletín de Coyuntura Económica. %s de %d", strings.Title(monthNames[d.Month()-1]), d.Year()),
+			File:  fmt.Sprintf("BCE_%04d%02d.pdf", d.Year(), d.Month()),
+		})
+	}
+
+	return bulletins
+}
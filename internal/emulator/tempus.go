@@ -0,0 +1,253 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// path of the INE Tempus JSON API, as in servicios.ine.es
+const TempusPath = "/wstempus/js/ES/"
+
+// ids of the periodicities of INE series
+const (
+	TempusMonthly   = 1
+	TempusQuarterly = 3
+	TempusAnnual    = 12
+)
+
+// TempusSerie is a serie served by the Tempus emulator
+type TempusSerie struct {
+	Code        string
+	Operation   string // code of the operation, such as IPC
+	Name        string
+	Unit        string
+	Decimals    int
+	Periodicity int // TempusMonthly, TempusQuarterly or TempusAnnual
+	Start       time.Time
+	Values      []float64 // NaN for secret values
+}
+
+// Tempus emulates the parts of the INE Tempus JSON API used by bdsicego: the series of an
+// operation, the metadata of a serie and its data
+type Tempus struct {
+	Series   []TempusSerie
+	PageSize int // series listed per page of SERIES_OPERACION
+
+	mu       sync.Mutex
+	requests map[string]int // endpoint: number of requests received
+}
+
+// NewTempus returns a Tempus emulator serving series
+func NewTempus(series []TempusSerie) *Tempus {
+	return &Tempus{Series: series, PageSize: 500, requests: make(map[string]int)}
+}
+
+// NewDefaultTempus returns a Tempus emulator serving the default INE fixtures, with data until the
+// month before latest
+func NewDefaultTempus(latest time.Time) *Tempus {
+	return NewTempus(DefaultTempusSeries(latest))
+}
+
+// DefaultTempusSeries returns a few series of the IPC and the EPA, with data until the month before
+// latest
+func DefaultTempusSeries(latest time.Time) []TempusSerie {
+	months := (latest.Year()-2002)*12 + int(latest.Month()) - 1
+	quarters := (latest.Year()-2002)*4 + (int(latest.Month())-1)/3
+
+	cpi := make([]float64, months)
+	food := make([]float64, months)
+	for i := range cpi {
+		cpi[i] = math.Round((70+0.2*float64(i))*1000) / 1000
+		food[i] = math.Round((65+0.25*float64(i))*1000) / 1000
+	}
+
+	unemployed := make([]float64, quarters)
+	for i := range unemployed {
+		unemployed[i] = math.Round((2000+15*float64(i%20))*10) / 10
+	}
+	// the first quarter is kept secret, as INE does with some data
+	unemployed[0] = math.NaN()
+
+	return []TempusSerie{
+		{Code: "IPC206449", Operation: "IPC", Name: "Total Nacional. Índice general. Índice. ", Unit: "Índice",
+			Decimals: 3, Periodicity: TempusMonthly, Start: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC), Values: cpi},
+		{Code: "IPC206450", Operation: "IPC", Name: "Total Nacional. Alimentos y bebidas no alcohólicas. Índice. ", Unit: "Índice",
+			Decimals: 3, Periodicity: TempusMonthly, Start: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC), Values: food},
+		{Code: "EPA387794", Operation: "EPA", Name: "Total Nacional. Parados. Ambos sexos. Personas. 16 y más años. ", Unit: "Miles de personas",
+			Decimals: 1, Periodicity: TempusQuarterly, Start: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC), Values: unemployed},
+	}
+}
+
+// Requests returns the number of requests received for endpoint, such as DATOS_SERIE
+func (t *Tempus) Requests(endpoint string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.requests[endpoint]
+}
+
+// metadata of a serie, as returned with det=2
+type tempusMetadata struct {
+	COD          string       `json:"COD"`
+	Nombre       string       `json:"Nombre"`
+	Decimales    int          `json:"Decimales"`
+	Operacion    tempusObject `json:"Operacion"`
+	Periodicidad tempusObject `json:"Periodicidad"`
+	Unidad       tempusObject `json:"Unidad"`
+}
+
+type tempusObject struct {
+	Id     int    `json:"Id"`
+	Nombre string `json:"Nombre"`
+	Codigo string `json:"Codigo"`
+}
+
+// a data point of DATOS_SERIE
+type tempusDatum struct {
+	Fecha     int64    `json:"Fecha"` // milliseconds since the epoch of the start of the period, in Madrid
+	FKPeriodo int      `json:"FK_Periodo"`
+	Anyo      int      `json:"Anyo"`
+	Valor     *float64 `json:"Valor"`
+	Secreto   bool     `json:"Secreto"`
+}
+
+var periodicityNames = map[int][2]string{
+	TempusMonthly:   {"Mensual", "M"},
+	TempusQuarterly: {"Trimestral", "T"},
+	TempusAnnual:    {"Anual", "A"},
+}
+
+func (s TempusSerie) metadata() tempusMetadata {
+	names := periodicityNames[s.Periodicity]
+	return tempusMetadata{
+		COD:          s.Code,
+		Nombre:       s.Name,
+		Decimales:    s.Decimals,
+		Operacion:    tempusObject{Nombre: s.Operation, Codigo: s.Operation},
+		Periodicidad: tempusObject{Id: s.Periodicity, Nombre: names[0], Codigo: names[1]},
+		Unidad:       tempusObject{Nombre: s.Unit},
+	}
+}
+
+// returns the start of the i-th period of the serie
+func (s TempusSerie) period(i int) time.Time {
+	switch s.Periodicity {
+	case TempusQuarterly:
+		return s.Start.AddDate(0, 3*i, 0)
+	case TempusAnnual:
+		return s.Start.AddDate(i, 0, 0)
+	default:
+		return s.Start.AddDate(0, i, 0)
+	}
+}
+
+// INE dates data points at midnight in Madrid, an hour or two before midnight UTC
+func madridMidnight(t time.Time) int64 {
+	offset := time.Hour
+	if t.Month() > time.March && t.Month() < time.November {
+		offset = 2 * time.Hour
+	}
+	return t.Add(-offset).UnixNano() / int64(time.Millisecond)
+}
+
+func (s TempusSerie) data(last int) []tempusDatum {
+	first := 0
+	if last > 0 && last < len(s.Values) {
+		first = len(s.Values) - last
+	}
+
+	var data []tempusDatum
+	for i := first; i < len(s.Values); i++ {
+		date := s.period(i)
+		datum := tempusDatum{Fecha: madridMidnight(date), Anyo: date.Year(), FKPeriodo: int(date.Month())}
+		if math.IsNaN(s.Values[i]) {
+			datum.Secreto = true
+		} else {
+			value := s.Values[i]
+			datum.Valor = &value
+		}
+		data = append(data, datum)
+	}
+	return data
+}
+
+func (t *Tempus) find(code string) (TempusSerie, bool) {
+	for _, s := range t.Series {
+		if strings.EqualFold(s.Code, code) {
+			return s, true
+		}
+	}
+	return TempusSerie{}, false
+}
+
+func (t *Tempus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, TempusPath), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	endpoint, code := strings.ToUpper(parts[0]), parts[1]
+
+	t.mu.Lock()
+	if t.requests == nil {
+		t.requests = make(map[string]int)
+	}
+	t.requests[endpoint]++
+	t.mu.Unlock()
+
+	var response interface{}
+	switch endpoint {
+	case "SERIES_OPERACION":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+
+		listed := []tempusMetadata{}
+		var n int
+		for _, s := range t.Series {
+			if !strings.EqualFold(s.Operation, code) {
+				continue
+			}
+			if n >= (page-1)*t.PageSize && n < page*t.PageSize {
+				listed = append(listed, s.metadata())
+			}
+			n++
+		}
+		response = listed
+
+	case "SERIE":
+		s, ok := t.find(code)
+		if !ok {
+			response = map[string]string{"status": fmt.Sprintf("El código de la serie %s no existe", code)}
+			break
+		}
+		response = s.metadata()
+
+	case "DATOS_SERIE":
+		s, ok := t.find(code)
+		if !ok {
+			response = map[string]string{"status": fmt.Sprintf("El código de la serie %s no existe", code)}
+			break
+		}
+		last, _ := strconv.Atoi(r.URL.Query().Get("nult"))
+		response = struct {
+			COD    string        `json:"COD"`
+			Nombre string        `json:"Nombre"`
+			Data   []tempusDatum `json:"Data"`
+		}{s.Code, s.Name, s.data(last)}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(response)
+}
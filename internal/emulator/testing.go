@@ -0,0 +1,38 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+)
+
+// TestConfiguration serves emu with net/http/httptest and returns a configuration pointing to it,
+// with its data, database and update paths in a temporary directory. The server is closed and the
+// directory removed when the test finishes.
+func TestConfiguration(t testing.TB, emu *Server) *config.BDSICEConfig {
+	t.Helper()
+
+	dataPath, err := ioutil.TempDir("", "bdsicego-test")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+
+	server := httptest.NewServer(emu)
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(dataPath)
+	})
+
+	configuration := &config.BDSICEConfig{
+		DataLocalPath:     dataPath,
+		DatabaseLocalPath: dataPath,
+		UpdateLocalPath:   dataPath,
+		UserAgent:         "bdsicego-test",
+	}
+	Configure(configuration, server.URL)
+
+	return configuration
+}
@@ -3,4 +3,4 @@
 package version
 
 const CmdName = "bdsicego"
-const CmdVersion = "0.0.37-28012021"
+const CmdVersion = "0.0.38-19102026"
@@ -0,0 +1,144 @@
+package plot
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/fabiansalazares/bdsicego/series"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// a figure drawn on a canvas, either a plot or a plot with a second y-axis
+type figure interface {
+	Draw(c draw.Canvas)
+}
+
+// UnitGroups returns the series grouped by their units, in the order in which each unit first
+// appears. Units that only differ in case or surrounding spaces are the same unit.
+func UnitGroups(seriesToPlot ...series.BDSICESerie) [][]series.BDSICESerie {
+	var groups [][]series.BDSICESerie
+	positions := map[string]int{}
+
+	for _, s := range seriesToPlot {
+		unit := strings.ToUpper(strings.TrimSpace(s.GetUnit()))
+		position, ok := positions[unit]
+		if !ok {
+			position = len(groups)
+			positions[unit] = position
+			groups = append(groups, nil)
+		}
+		groups[position] = append(groups[position], s)
+	}
+
+	return groups
+}
+
+// paints the line, ticks and labels of an axis in the color of the series plotted against it
+func colorAxis(a *plot.Axis, c color.Color) {
+	a.Color = c
+	a.Label.Color = c
+	a.Tick.Color = c
+	a.Tick.Label.Color = c
+}
+
+// dualPlot is a plot whose series of a second unit are plotted against an axis on its right. The
+// time axis of both plots must be the same.
+type dualPlot struct {
+	left          *plot.Plot
+	right         *plot.Plot // holds the right axis, whose series are drawn on the data area of left
+	rightPlotters []plot.Plotter
+}
+
+// Draw draws the left plot leaving room for the right axis, and then the series of the right axis
+// and the axis itself
+func (d *dualPlot) Draw(c draw.Canvas) {
+	axis := d.right.Y
+	if math.IsInf(axis.Min, 0) || math.IsInf(axis.Max, 0) {
+		axis.Min, axis.Max = 0, 1
+	}
+	if axis.Min == axis.Max {
+		axis.Min, axis.Max = axis.Min-1, axis.Max+1
+	}
+	d.right.Y = axis
+
+	// the right axis lies beyond the canvas of left, whose background it shares
+	if d.left.BackgroundColor != nil {
+		c.SetColor(d.left.BackgroundColor)
+		c.Fill(c.Rectangle.Path())
+	}
+
+	width := rightAxisWidth(axis)
+	leftCanvas := draw.Crop(c, 0, -width, 0, 0)
+	d.left.Draw(leftCanvas)
+
+	// the time axis of left is final once drawn
+	d.right.X = d.left.X
+	data := d.left.DataCanvas(leftCanvas)
+	for _, plotter := range d.rightPlotters {
+		plotter.Plot(data, d.right)
+	}
+
+	drawRightAxis(c, data, leftCanvas.Max.X, axis)
+}
+
+// returns the width of an axis drawn on the right, as plot measures the one on the left
+func rightAxisWidth(a plot.Axis) vg.Length {
+	var width vg.Length
+
+	if a.Label.Text != "" {
+		width += a.Label.Height(a.Label.Text) - a.Label.Font.Extents().Descent + a.Label.Padding
+	}
+
+	var labelWidth vg.Length
+	for _, t := range a.Tick.Marker.Ticks(a.Min, a.Max) {
+		if w := a.Tick.Label.Width(t.Label); !t.IsMinor() && w > labelWidth {
+			labelWidth = w
+		}
+	}
+	if labelWidth > 0 {
+		width += labelWidth + a.Tick.Label.Width(" ")
+	}
+
+	return width + a.Tick.Length + a.Width/2 + a.Padding
+}
+
+// draws axis at x, along the data area of the plot, with its ticks and labels to its right, as plot
+// draws the left one mirrored
+func drawRightAxis(c draw.Canvas, data draw.Canvas, x vg.Length, a plot.Axis) {
+	c.StrokeLine2(a.LineStyle, x, data.Min.Y, x, data.Max.Y)
+
+	labelStyle := a.Tick.Label
+	labelStyle.XAlign = draw.XLeft
+	descent := labelStyle.Font.Extents().Descent
+
+	for _, t := range a.Tick.Marker.Ticks(a.Min, a.Max) {
+		y := data.Y(a.Norm(t.Value))
+		if !data.ContainsY(y) {
+			continue
+		}
+
+		// minor ticks are half as long as major ones
+		length := a.Tick.Length
+		if t.IsMinor() {
+			length /= 2
+		}
+		c.StrokeLine2(a.Tick.LineStyle, x, y, x+length, y)
+
+		if !t.IsMinor() {
+			c.FillText(labelStyle, vg.Point{X: x + a.Tick.Length + labelStyle.Width(" "), Y: y - descent}, t.Label)
+		}
+	}
+
+	if a.Label.Text != "" {
+		// a quarter turn clockwise, so that the label reads towards the axis
+		style := a.Label.TextStyle
+		style.Rotation -= math.Pi / 2
+		descent := a.Label.Font.Extents().Descent
+		point := vg.Point{X: c.Max.X - a.Label.Height(a.Label.Text) - descent, Y: data.Center().Y}
+		c.FillText(style, point, a.Label.Text)
+	}
+}
@@ -0,0 +1,137 @@
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// normalizations of series plotted together, so that series in different units can be compared
+const (
+	NormalizeIndex  = "index"  // index, 100 at the first date all the series have an observation
+	NormalizeZScore = "zscore" // standard deviations from the mean of the serie
+)
+
+// ErrUnknownNormalization is returned when a normalization other than NormalizeIndex and
+// NormalizeZScore is asked for
+var ErrUnknownNormalization = errors.New("unknown normalization")
+
+// returns whether value is an observation rather than a missing one
+func observed(value float64) bool {
+	return value != series.MissingValue && !math.IsNaN(value)
+}
+
+// returns copies of the series normalized as told by normalization, along with the label of the
+// axis they are plotted against. Series are returned as they are if normalization is empty.
+func normalize(normalization string, seriesToPlot []series.BDSICESerie) ([]series.BDSICESerie, string, error) {
+	switch normalization {
+	case "":
+		return seriesToPlot, "", nil
+	case NormalizeIndex:
+		return normalizeIndex(seriesToPlot)
+	case NormalizeZScore:
+		return normalizeZScore(seriesToPlot), "Z-score", nil
+	default:
+		return nil, "", fmt.Errorf("econdata/plot: %w %q, expected %s or %s", ErrUnknownNormalization, normalization, NormalizeIndex, NormalizeZScore)
+	}
+}
+
+// returns the serie with its values replaced by those of transform, leaving missing values out
+func transformed(s series.BDSICESerie, transform func(float64) float64) series.BDSICESerie {
+	t := s
+	t.Observations = series.Observations{}
+
+	for i, value := range s.Observations.Values {
+		if !observed(value) {
+			continue
+		}
+		t.Observations.Dates = append(t.Observations.Dates, s.Observations.Dates[i])
+		t.Observations.Values = append(t.Observations.Values, transform(value))
+	}
+
+	return t
+}
+
+// indexes the series to 100 at the base date, the first one on which all of them have been
+// observed. Series whose first observation from the base date on is 0, or that have none, cannot
+// be indexed.
+func normalizeIndex(seriesToPlot []series.BDSICESerie) ([]series.BDSICESerie, string, error) {
+	var base time.Time
+	for _, s := range seriesToPlot {
+		for i, value := range s.Observations.Values {
+			if observed(value) {
+				if s.Observations.Dates[i].After(base) {
+					base = s.Observations.Dates[i]
+				}
+				break
+			}
+		}
+	}
+
+	indexed := make([]series.BDSICESerie, 0, len(seriesToPlot))
+	for _, s := range seriesToPlot {
+		baseValue := math.NaN()
+		for i, value := range s.Observations.Values {
+			if observed(value) && !s.Observations.Dates[i].Before(base) {
+				baseValue = value
+				break
+			}
+		}
+
+		if math.IsNaN(baseValue) {
+			return nil, "", fmt.Errorf("econdata/plot: %s cannot be indexed, it has no observation on or after %s", s.GetCode(), base.Format("2006-01-02"))
+		}
+		if baseValue == 0 {
+			return nil, "", fmt.Errorf("econdata/plot: %s cannot be indexed, its value is 0 on %s", s.GetCode(), base.Format("2006-01-02"))
+		}
+
+		indexed = append(indexed, transformed(s, func(value float64) float64 { return value / baseValue * 100 }))
+	}
+
+	return indexed, fmt.Sprintf("Index, %s = 100", base.Format("2006-01")), nil
+}
+
+// standardizes each serie with the mean and standard deviation of its observations. Constant
+// series are plotted at 0.
+func normalizeZScore(seriesToPlot []series.BDSICESerie) []series.BDSICESerie {
+	standardized := make([]series.BDSICESerie, 0, len(seriesToPlot))
+
+	for _, s := range seriesToPlot {
+		var sum, n float64
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, value := range s.Observations.Values {
+			if observed(value) {
+				sum += value
+				n++
+				low, high = math.Min(low, value), math.Max(high, value)
+			}
+		}
+		mean := sum / n
+
+		// the variance is computed from the deviations from the mean, as the difference between
+		// the mean of the squares and the square of the mean cancels out for series far from 0.
+		// A constant serie is told apart exactly, as its mean may differ from its value by rounding.
+		var deviation float64
+		if low < high {
+			var sumSquares float64
+			for _, value := range s.Observations.Values {
+				if observed(value) {
+					sumSquares += (value - mean) * (value - mean)
+				}
+			}
+			deviation = math.Sqrt(math.Max(sumSquares/n, 0))
+		}
+
+		standardized = append(standardized, transformed(s, func(value float64) float64 {
+			if deviation == 0 {
+				return 0
+			}
+			return (value - mean) / deviation
+		}))
+	}
+
+	return standardized
+}
@@ -3,9 +3,14 @@
 package plot
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fabiansalazares/bdsicego/series"
 
@@ -14,110 +19,312 @@ import (
 	//"gonum.org/v1/plotter"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgeps"
+	"gonum.org/v1/plot/vg/vgimg"
+	"gonum.org/v1/plot/vg/vgpdf"
+	"gonum.org/v1/plot/vg/vgsvg"
 	//	"gonum.org/v1/plotter"
 )
 
+// returns the points of the observations of a serie, leaving missing observations out
 func getXYPoints(serie series.EconSerie) *plotter.XYs {
 	data := serie.GetData()
 
-	points := make(plotter.XYs, len(data.Dates))
+	points := make(plotter.XYs, 0, len(data.Dates))
 
-	for i := range points {
-		points[i].X = float64(data.Dates[i].Unix())
-		points[i].Y = data.Values[i]
+	for i := range data.Dates {
+		if !observed(data.Values[i]) || math.IsInf(data.Values[i], 0) {
+			continue
+		}
+		points = append(points, plotter.XY{X: float64(data.Dates[i].Unix()), Y: data.Values[i]})
 	}
 
 	return &points
 }
 
-func Plot(seriesToPlot ...series.BDSICESerie) (string, error) {
-	// array of pointers to XYs objects that contain the set of X and Y points for each observation
+// Options sets the size of figures and the resolution of those saved to raster formats, which
+// take precedence over those of their style
+type Options struct {
+	Width     float64 // inches
+	Height    float64 // inches
+	DPI       int     // dots per inch of PNG, JPEG and TIFF files
+	Normalize string  // NormalizeIndex or NormalizeZScore to plot series normalized, as they are if empty
+	Style     Style   // the default style if empty
+}
 
-	var (
-		seriesPlotters []interface{}
-		seriesPoints   []*plotter.XYs
-	)
+// size in inches and resolution of figures unless configured otherwise
+const (
+	DefaultWidth  = 10
+	DefaultHeight = 4
+	DefaultDPI    = 96
+)
 
-	// create p object -> the plot
-	p, err := plot.New()
+// returns the size of figures
+func (o Options) size() (vg.Length, vg.Length) {
+	return vg.Length(o.Width) * vg.Inch, vg.Length(o.Height) * vg.Inch
+}
+
+// ErrUnknownFormat is returned when a figure is saved to a file whose extension is not a format
+// of Formats
+var ErrUnknownFormat = errors.New("unknown plot format")
+
+// Formats lists the extensions of the files figures can be saved to
+var Formats = []string{".svg", ".pdf", ".eps", ".png", ".jpg", ".jpeg", ".tif", ".tiff"}
+
+// returns options with the values of their style, or else the defaults, in place of those not set
+func (o Options) withDefaults() Options {
+	o.Style = o.Style.over(DefaultStyles[DefaultStyleName])
+
+	if o.Width <= 0 {
+		o.Width = o.Style.Width
+	}
+	if o.Height <= 0 {
+		o.Height = o.Style.Height
+	}
+	if o.DPI <= 0 {
+		o.DPI = o.Style.DPI
+	}
+
+	if o.Width <= 0 {
+		o.Width = DefaultWidth
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultHeight
+	}
+	if o.DPI <= 0 {
+		o.DPI = DefaultDPI
+	}
+	return o
+}
+
+// returns the format of a file, as told by its extension without the dot
+func format(filePath string) (string, error) {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	for _, f := range Formats {
+		if f == extension {
+			return strings.TrimPrefix(extension, "."), nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w, expected one of %s", filePath, ErrUnknownFormat, strings.Join(Formats, ", "))
+}
+
+// returns a canvas of format to draw a figure on
+func newCanvas(format string, options Options) vg.CanvasWriterTo {
+	width, height := options.size()
+
+	switch format {
+	case "svg":
+		return vgsvg.New(width, height)
+	case "pdf":
+		return vgpdf.New(width, height)
+	case "eps":
+		return vgeps.New(width, height)
+	}
+
+	c := vgimg.NewWith(vgimg.UseWH(width, height), vgimg.UseDPI(options.DPI))
+	switch format {
+	case "jpg", "jpeg":
+		return vgimg.JpegCanvas{Canvas: c}
+	case "tif", "tiff":
+		return vgimg.TiffCanvas{Canvas: c}
+	default:
+		return vgimg.PngCanvas{Canvas: c}
+	}
+}
+
+// Plot plots the series in a figure saved to a temporary PNG file, and returns the name of the file
+func Plot(options Options, seriesToPlot ...series.BDSICESerie) (string, error) {
+	// create a tmp file to save the plot to. Actually, we don't want the file handler but just the file name
+
+	tmp, err := ioutil.TempFile(os.TempDir(), "econdata-plot*.png")
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("econdata/plot: could not generate tmp file: %s", err.Error())
 	}
+	tmp.Close()
 
-	// possible addgrid (should be set up either as a function argument, or as a config option)
-	p.Add(plotter.NewGrid())
+	// save the plot to the temporal file that we just created.
+	if _, err := Save(tmp.Name(), options, seriesToPlot); err != nil {
+		return "", fmt.Errorf("econdata/plot: an error ocurred saving the plot to tmp file %s: %s", tmp.Name(), err.Error())
+	}
 
-	if len(seriesToPlot) > 1 {
-		// if there is only serie to be plotted, the y-axis can be labeled safely to the unit of the serie to plot
-		p.Title.Text = fmt.Sprintf("%s - %s", seriesToPlot[0].GetCode(), seriesToPlot[0].GetTitle())
-		p.Y.Label.Text = seriesToPlot[0].GetUnit()
+	// we return the name of the plot. plotCommand should be plotting
+	return tmp.Name(), nil
+}
+
+// Save plots each of figures, a set of series plotted together, and saves them to filePath in the
+// format told by its extension. Figures are saved as the pages of a single file for PDF, and to
+// files numbered after filePath for other formats when there is more than one, as in plot-1.png.
+// The names of the files written are returned.
+func Save(filePath string, options Options, figures ...[]series.BDSICESerie) ([]string, error) {
+	f, err := format(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("econdata/plot: %w", err)
+	}
+
+	options = options.withDefaults()
+	t, err := options.Style.compile()
+	if err != nil {
+		return nil, fmt.Errorf("econdata/plot: %s", err.Error())
+	}
+
+	var plots []figure
+	for _, seriesToPlot := range figures {
+		if len(seriesToPlot) == 0 {
+			continue
+		}
 
-	} else {
+		p, err := newPlot(t, options, seriesToPlot...)
+		if err != nil {
+			return nil, err
+		}
+		plots = append(plots, p)
+	}
 
-		// if there is more than one serie to plot, we need to check if all the series have the same units
-		// if they do have the same units, the y-axis will be labelled accordingly. Otherwise, an empty label will be added
-		differentUnits := false
+	if len(plots) == 0 {
+		return nil, fmt.Errorf("econdata/plot: no series to plot")
+	}
 
-		for i := 1; i < len(seriesToPlot); i++ {
-			if seriesToPlot[i].GetUnit() != seriesToPlot[0].GetUnit() {
-				differentUnits = true
+	if f == "pdf" {
+		c := vgpdf.New(options.size())
+		for i, p := range plots {
+			if i > 0 {
+				c.NextPage()
 			}
+			p.Draw(draw.New(c))
 		}
 
-		if differentUnits {
-			p.Title.Text = ""
-		} else {
-			p.Title.Text = seriesToPlot[0].GetTitle()
-			p.Y.Label.Text = seriesToPlot[0].GetUnit()
+		err := writeCanvas(filePath, c)
+		if err != nil {
+			return nil, err
 		}
+		return []string{filePath}, nil
 	}
 
-	// x-axis label will always be time since we are dealing with time series
-	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-1"}
-	//p.X.Label.Text = "t"
+	var written []string
+	for i, p := range plots {
+		figurePath := filePath
+		if len(plots) > 1 {
+			extension := filepath.Ext(filePath)
+			figurePath = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(filePath, extension), i+1, extension)
+		}
+
+		c := newCanvas(f, options)
+		p.Draw(draw.New(c))
 
-	// create an array of XYs objects for each serie to plot
-	for i := 0; i < len(seriesToPlot); i++ {
-		seriesPoints = append(seriesPoints, getXYPoints(seriesToPlot[i]))
+		err := writeCanvas(figurePath, c)
+		if err != nil {
+			return written, err
+		}
+		written = append(written, figurePath)
 	}
 
-	// add plotters to the plot p
+	return written, nil
+}
 
-	// plotutil.AddLinePoints nicely cycles through color codes assigning one to each line plotter object
-	// that we add to the plot object. It takes as arguments the plot to which it will be assigned,
-	// and then alternatively the LinePoints title and the XYs of the LinePoints. This is a very poor
-	// design choice because it is fully dependant on the order in which we pass the arguments
-	// So, in order to make it work, we need to create a slice of empty interface objects
-	// to which we will add alternatively the string containing the series name and the XYs themselves.
-	// For now, it works, but a better solution should be found in the future, also considering
-	// posible options to set the plotting style.
+// writes the figure drawn on c to filePath
+func writeCanvas(filePath string, c io.WriterTo) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("econdata/plot: could not create %s: %s", filePath, err.Error())
+	}
 
-	for i := 0; i < len(seriesToPlot); i++ {
+	_, err = c.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("econdata/plot: could not write %s: %s", filePath, err.Error())
+	}
 
-		seriesPlotters = append(seriesPlotters, seriesToPlot[i].GetTitle())
-		seriesPlotters = append(seriesPlotters, seriesPoints[i])
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("econdata/plot: could not write %s: %s", filePath, err.Error())
 	}
 
-	err = plotutil.AddLinePoints(p, seriesPlotters...)
+	return nil
+}
+
+// returns the figure of the series plotted together. Series in two different units are plotted
+// against an axis each, left and right, painted in the color of their first serie. Series in more
+// units share an axis without label, unless they are normalized as told by options. The figure
+// is drawn in the style of theme t.
+func newPlot(t *theme, options Options, seriesToPlot ...series.BDSICESerie) (figure, error) {
+	seriesToPlot, normalizedLabel, err := normalize(options.Normalize, seriesToPlot)
 	if err != nil {
-		return "", fmt.Errorf("econdata/plot: an error ocurred adding line and points to the plot: %s", err.Error())
+		return nil, err
 	}
 
-	// create a tmp file to save the plot to. Actually, we don't want the file handler but just the file name
+	// create p object -> the plot
+	p, err := plot.New()
+	if err != nil {
+		return nil, fmt.Errorf("econdata/plot: %s", err.Error())
+	}
 
-	tmp, err := ioutil.TempFile(os.TempDir(), "econdata-plot*.png")
+	t.apply(p)
+	if grid := t.newGrid(); grid != nil {
+		p.Add(grid)
+	}
+
+	// x-axis label will always be time since we are dealing with time series
+	//p.X.Label.Text = "t"
+
+	// if there is only serie to be plotted, the plot is titled after it
+	if len(seriesToPlot) == 1 {
+		p.Title.Text = fmt.Sprintf("%s - %s", seriesToPlot[0].GetCode(), seriesToPlot[0].GetTitle())
+	}
+
+	groups := UnitGroups(seriesToPlot...)
+	if normalizedLabel != "" {
+		groups = [][]series.BDSICESerie{seriesToPlot}
+	}
+
+	// the y-axis is labelled after the unit of the series if they all share it, or after their
+	// normalization
+	switch {
+	case normalizedLabel != "":
+		p.Y.Label.Text = normalizedLabel
+	case len(groups) <= 2:
+		p.Y.Label.Text = strings.TrimSpace(groups[0][0].GetUnit())
+	}
+
+	// colors of the style, dashes and shapes cycle, one for each serie
+	var i int
+	for _, s := range groups[0] {
+		p.Add(t.linePoints(p, s, i, "")...)
+		i++
+	}
+
+	if len(groups) != 2 {
+		for _, group := range groups[1:] {
+			for _, s := range group {
+				p.Add(t.linePoints(p, s, i, "")...)
+				i++
+			}
+		}
+		return p, nil
+	}
+
+	right, err := plot.New()
 	if err != nil {
-		return "", fmt.Errorf("econdata/plot: could not generate tmp file: %s", err.Error())
+		return nil, fmt.Errorf("econdata/plot: %s", err.Error())
 	}
+	t.apply(right)
+	right.Y.Label.Text = strings.TrimSpace(groups[1][0].GetUnit())
 
-	// save the plot to the temporal file that we just created.
-	if err := p.Save(10*vg.Inch, 4*vg.Inch, tmp.Name()); err != nil {
-		return "", fmt.Errorf("econdata/plot: an error ocurred saving the plot to tmp file %s: %s", tmp.Name(), err.Error())
+	colorAxis(&p.Y, t.color(0))
+	colorAxis(&right.Y, t.color(len(groups[0])))
+
+	var rightPlotters []plot.Plotter
+	for _, s := range groups[1] {
+		plotters := t.linePoints(p, s, i, " (right axis)")
+		right.Add(plotters...)
+		rightPlotters = append(rightPlotters, plotters...)
+		i++
 	}
 
-	// we return the name of the plot. plotCommand should be plotting
-	return tmp.Name(), nil
+	// both axes share the time axis, which must span the series of both
+	p.X.Min = math.Min(p.X.Min, right.X.Min)
+	p.X.Max = math.Max(p.X.Max, right.X.Max)
 
+	return &dualPlot{left: p, right: right, rightPlotters: rightPlotters}, nil
 }
@@ -0,0 +1,309 @@
+// Testing file for bdsicego/plot
+// We test that figures are saved in the format told by the extension, at the size and resolution
+// given, and that several figures are saved as the pages of a PDF or as numbered files
+
+package plot
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// returns a monthly serie with count observations starting at January 2000
+func testSerie(code string, count int) series.BDSICESerie {
+	s := series.BDSICESerie{SerieCode: code, Title: "SERIE " + code, Units: "Porcentaje", Frequency: 12}
+
+	for i := 0; i < count; i++ {
+		s.Observations.Dates = append(s.Observations.Dates, time.Date(2000, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC))
+		s.Observations.Values = append(s.Observations.Values, float64(i%5))
+	}
+
+	return s
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-plot")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := testSerie("A", 24), testSerie("B", 24)
+
+	// PNG files are as large as the size times the resolution
+	pngPath := filepath.Join(dir, "plot.png")
+	written, err := Save(pngPath, Options{Width: 2, Height: 1, DPI: 50}, []series.BDSICESerie{a, b})
+	if err != nil || len(written) != 1 || written[0] != pngPath {
+		t.Fatalf("Save(): unexpected files %v, %v", written, err)
+	}
+
+	f, err := os.Open(pngPath)
+	if err != nil {
+		t.Fatalf("Open(): %s", err.Error())
+	}
+	config, err := png.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("DecodeConfig(): %s", err.Error())
+	}
+	if config.Width != 100 || config.Height != 50 {
+		t.Errorf("Save(): PNG of %dx%d pixels, expected 100x50", config.Width, config.Height)
+	}
+
+	// several figures go to the pages of a single PDF file
+	pdfPath := filepath.Join(dir, "plot.pdf")
+	written, err = Save(pdfPath, Options{}, []series.BDSICESerie{a}, []series.BDSICESerie{b})
+	if err != nil || len(written) != 1 {
+		t.Fatalf("Save(): unexpected files %v, %v", written, err)
+	}
+	content, err := ioutil.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("ReadFile(): %s", err.Error())
+	}
+	if !bytes.HasPrefix(content, []byte("%PDF")) || bytes.Count(content, []byte("/Type /Page\n")) != 2 {
+		t.Errorf("Save(): expected a PDF file of 2 pages")
+	}
+
+	// and to numbered files for other formats
+	written, err = Save(filepath.Join(dir, "plot.SVG"), Options{}, []series.BDSICESerie{a}, []series.BDSICESerie{b})
+	if err != nil || len(written) != 2 || filepath.Base(written[0]) != "plot-1.SVG" || filepath.Base(written[1]) != "plot-2.SVG" {
+		t.Fatalf("Save(): unexpected files %v, %v", written, err)
+	}
+	for _, filePath := range written {
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil || !bytes.Contains(content, []byte("<svg")) {
+			t.Errorf("Save(): %s is not an SVG file", filePath)
+		}
+	}
+
+	if _, err := Save(filepath.Join(dir, "plot.gif"), Options{}, []series.BDSICESerie{a}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Save(): expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestUnitGroups(t *testing.T) {
+	a, b, c := testSerie("A", 3), testSerie("B", 3), testSerie("C", 3)
+	b.Units = " MILES DE PERSONAS"
+	c.Units = "porcentaje "
+
+	groups := UnitGroups(a, b, c)
+	if len(groups) != 2 || len(groups[0]) != 2 || groups[0][1].SerieCode != "C" || groups[1][0].SerieCode != "B" {
+		t.Errorf("UnitGroups(): unexpected groups %v", groups)
+	}
+}
+
+func TestDualAxes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-plot")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	rate, employed := testSerie("TASA", 24), testSerie("OCUPADOS", 24)
+	employed.Units = "Miles de personas"
+	for i := range employed.Observations.Values {
+		employed.Observations.Values[i] *= 1000
+	}
+
+	defaultTheme, err := DefaultStyles[DefaultStyleName].compile()
+	if err != nil {
+		t.Fatalf("compile(): %s", err.Error())
+	}
+
+	f, err := newPlot(defaultTheme, Options{}, rate, employed)
+	if err != nil {
+		t.Fatalf("newPlot(): %s", err.Error())
+	}
+	dual, ok := f.(*dualPlot)
+	if !ok {
+		t.Fatalf("newPlot(): expected a plot with two axes for two units, got %T", f)
+	}
+	if dual.left.Y.Label.Text != "Porcentaje" || dual.right.Y.Label.Text != "Miles de personas" || dual.right.Y.Max != 4000 {
+		t.Errorf("newPlot(): unexpected axes %q and %q up to %f", dual.left.Y.Label.Text, dual.right.Y.Label.Text, dual.right.Y.Max)
+	}
+
+	svgPath := filepath.Join(dir, "dual.svg")
+	if _, err := Save(svgPath, Options{}, []series.BDSICESerie{rate, employed}); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+	content, err := ioutil.ReadFile(svgPath)
+	if err != nil || !bytes.Contains(content, []byte("Miles de personas")) || !bytes.Contains(content, []byte("4000")) {
+		t.Errorf("Save(): the right axis is not in the figure")
+	}
+
+	// normalized series share an axis
+	f, err = newPlot(defaultTheme, Options{Normalize: NormalizeZScore}, rate, employed)
+	if err != nil {
+		t.Fatalf("newPlot(): %s", err.Error())
+	}
+	if _, ok := f.(*dualPlot); ok {
+		t.Errorf("newPlot(): expected normalized series to share an axis")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	a, b := testSerie("A", 6), testSerie("B", 6)
+	// values of A are 0, 1, 2, 3, 4 and 0, and B starts later
+	a.Observations.Values[0] = series.MissingValue
+	b.Observations.Values[0], b.Observations.Values[1] = series.MissingValue, series.MissingValue
+
+	indexed, label, err := normalize(NormalizeIndex, []series.BDSICESerie{a, b})
+	if err != nil {
+		t.Fatalf("normalize(): %s", err.Error())
+	}
+	if label != "Index, 2000-03 = 100" {
+		t.Errorf("normalize(): label %q", label)
+	}
+	if len(indexed[0].Observations.Values) != 5 || indexed[0].Observations.Values[1] != 100 || indexed[0].Observations.Values[2] != 150 {
+		t.Errorf("normalize(): A indexed as %v", indexed[0].Observations.Values)
+	}
+	if indexed[1].Observations.Values[0] != 100 {
+		t.Errorf("normalize(): B indexed as %v", indexed[1].Observations.Values)
+	}
+
+	standardized, _, err := normalize(NormalizeZScore, []series.BDSICESerie{b})
+	if err != nil {
+		t.Fatalf("normalize(): %s", err.Error())
+	}
+	// 2, 3, 4 and 0 have mean 2.25 and standard deviation of about 1.479
+	if z := standardized[0].Observations.Values[2]; math.Abs(z-(4-2.25)/math.Sqrt(2.1875)) > 1e-9 {
+		t.Errorf("normalize(): z-score of 4 is %f", z)
+	}
+
+	// the first observation of A from the base date on is 0 when B starts at its last one
+	b.Observations.Values = []float64{series.MissingValue, series.MissingValue, series.MissingValue, series.MissingValue, series.MissingValue, 1}
+	if _, _, err := normalize(NormalizeIndex, []series.BDSICESerie{a, b}); err == nil {
+		t.Errorf("normalize(): expected an error indexing a serie that is 0 at the base date")
+	}
+
+	// nor can a serie that ends before the base date
+	ended := testSerie("C", 6)
+	ended.Observations.Values = []float64{1, 2, series.MissingValue, series.MissingValue, series.MissingValue, series.MissingValue}
+	if _, _, err := normalize(NormalizeIndex, []series.BDSICESerie{ended, b}); err == nil {
+		t.Errorf("normalize(): expected an error indexing a serie without observations from the base date on")
+	}
+
+	// constant series, whose mean may differ from their value by rounding, are standardized to 0
+	for _, value := range []float64{0.1, 97.3, 3.3, 0} {
+		constant := testSerie("K", 24)
+		for i := range constant.Observations.Values {
+			constant.Observations.Values[i] = value
+		}
+
+		standardized, _, err := normalize(NormalizeZScore, []series.BDSICESerie{constant})
+		if err != nil {
+			t.Fatalf("normalize(): %s", err.Error())
+		}
+		for _, z := range standardized[0].Observations.Values {
+			if z != 0 {
+				t.Errorf("normalize(): constant serie at %g standardized as %v", value, standardized[0].Observations.Values)
+				break
+			}
+		}
+	}
+
+	// far from 0, small deviations are kept
+	shifted := testSerie("S", 5)
+	for i := range shifted.Observations.Values {
+		shifted.Observations.Values[i] = 1e8 + float64(i)*0.001
+	}
+	standardized, _, err = normalize(NormalizeZScore, []series.BDSICESerie{shifted})
+	if err != nil {
+		t.Fatalf("normalize(): %s", err.Error())
+	}
+	if z := standardized[0].Observations.Values[4]; math.Abs(z-math.Sqrt(2)) > 1e-3 {
+		t.Errorf("normalize(): z-score of the last value is %f, expected %f", z, math.Sqrt(2))
+	}
+
+	if _, _, err := normalize("log", []series.BDSICESerie{a}); !errors.Is(err, ErrUnknownNormalization) {
+		t.Errorf("normalize(): expected ErrUnknownNormalization, got %v", err)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-plot")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// without a file, only the built-in styles are there
+	styles, err := loadStylesFile(filepath.Join(dir, StylesFileName))
+	if err != nil || len(styles) != len(DefaultStyles) {
+		t.Fatalf("loadStylesFile(): unexpected styles %v, %v", styles.Names(), err)
+	}
+
+	stylesPath := filepath.Join(dir, StylesFileName)
+	err = ioutil.WriteFile(stylesPath, []byte(`
+default:
+  legend: top-left
+dark:
+  linewidth: 3
+slides:
+  background: "#123"
+  colors: ["#1b9e77", "#d95f02"]
+  markers: false
+  dateformat: "2006-01"
+  width: 6
+`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile(): %s", err.Error())
+	}
+
+	styles, err = loadStylesFile(stylesPath)
+	if err != nil {
+		t.Fatalf("loadStylesFile(): %s", err.Error())
+	}
+
+	// styles of the file change the built-in styles of the same name, and take the rest from default
+	defaultStyle, _ := styles.Style("")
+	if defaultStyle.Legend != "top-left" || defaultStyle.Font != "Times-Roman" || !*defaultStyle.Markers {
+		t.Errorf("Style(): unexpected default style %+v", defaultStyle)
+	}
+	dark, _ := styles.Style("dark")
+	if dark.LineWidth != 3 || dark.Background != "#202124" || *dark.Markers {
+		t.Errorf("Style(): unexpected dark style %+v", dark)
+	}
+	slides, err := styles.Style("slides")
+	if err != nil || slides.Legend != "top-left" || slides.Height != DefaultHeight || *slides.Markers || !*slides.Dashes {
+		t.Errorf("Style(): unexpected slides style %+v, %v", slides, err)
+	}
+
+	if _, err := styles.Style("poster"); !errors.Is(err, ErrUnknownStyle) {
+		t.Errorf("Style(): expected ErrUnknownStyle, got %v", err)
+	}
+
+	// invalid values are reported when the file is loaded
+	for _, invalid := range []string{"default:\n  background: white\n", "x:\n  font: Comic\n", "x:\n  legend: middle\n", "x:\n  linestyle: 2\n"} {
+		if err := ioutil.WriteFile(stylesPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("WriteFile(): %s", err.Error())
+		}
+		if _, err := loadStylesFile(stylesPath); err == nil {
+			t.Errorf("loadStylesFile(): expected an error loading %q", invalid)
+		}
+	}
+
+	// the figure is drawn in the style, whose size gives way to that of options
+	svgPath := filepath.Join(dir, "plot.svg")
+	if _, err := Save(svgPath, Options{Height: 2, Style: slides}, []series.BDSICESerie{testSerie("A", 24)}); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+	content, err := ioutil.ReadFile(svgPath)
+	if err != nil {
+		t.Fatalf("ReadFile(): %s", err.Error())
+	}
+	for _, expected := range []string{`width="432pt" height="144pt"`, "#112233", "#1B9E77", ">2000-02<"} {
+		if !bytes.Contains(bytes.ToUpper(content), bytes.ToUpper([]byte(expected))) {
+			t.Errorf("Save(): expected %s in SVG file", expected)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package plot
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/series"
+	"gopkg.in/yaml.v2"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// name of the file in the configuration directory holding user-defined plot styles
+const StylesFileName = "plotting.yml"
+
+// name of the style used when none is chosen
+const DefaultStyleName = "default"
+
+// positions of the legend, and the value that leaves it out
+var legendPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "none"}
+
+// ErrUnknownStyle is returned when a style is neither built in nor defined in plotting.yml
+var ErrUnknownStyle = errors.New("unknown plot style")
+
+// Style sets the look of figures. Colors are given as #rrggbb or #rgb, sizes of lines and fonts in
+// points, and the size of figures in inches. Fields left out of a style defined in plotting.yml
+// take the values of the built-in style of the same name, or of the default style.
+type Style struct {
+	Colors     []string `yaml:"colors"`     // of the series, in turn
+	Background string   `yaml:"background"` // of the figure
+	Foreground string   `yaml:"foreground"` // of titles, labels and axes
+	GridColor  string   `yaml:"gridcolor"`
+	LineWidth  float64  `yaml:"linewidth"`
+	Markers    *bool    `yaml:"markers"` // whether observations are marked, with a shape per serie
+	Dashes     *bool    `yaml:"dashes"`  // whether series after the first are dashed, with a pattern each
+	Grid       *bool    `yaml:"grid"`
+	Font       string   `yaml:"font"`     // Times-Roman, Helvetica or Courier, and their -Bold and -Italic variants
+	FontSize   float64  `yaml:"fontsize"` // of the ticks, titles and labels being a fifth larger
+	Legend     string   `yaml:"legend"`   // top-left, top-right, bottom-left, bottom-right or none
+	Width      float64  `yaml:"width"`
+	Height     float64  `yaml:"height"`
+	DPI        int      `yaml:"dpi"`
+	DateFormat string   `yaml:"dateformat"` // of the time axis, as Go layouts such as 2006-01
+}
+
+// Styles holds plot styles by name
+type Styles map[string]Style
+
+// returns a pointer to b, for the optional fields of styles
+func flag(b bool) *bool {
+	return &b
+}
+
+// DefaultStyles are the styles built in: default, the look plots have always had, dark, light
+// lines on a dark background, and print, in black and grays with a sans-serif font
+var DefaultStyles = Styles{
+	DefaultStyleName: {
+		Colors:     []string{"#f15a60", "#7ac36a", "#5a9bd4", "#faa75b", "#9e67ab", "#ce7058", "#d77fb4"},
+		Background: "#ffffff",
+		Foreground: "#000000",
+		GridColor:  "#808080",
+		LineWidth:  1,
+		Markers:    flag(true),
+		Dashes:     flag(true),
+		Grid:       flag(true),
+		Font:       plot.DefaultFont,
+		FontSize:   10,
+		Legend:     "bottom-right",
+		Width:      DefaultWidth,
+		Height:     DefaultHeight,
+		DPI:        DefaultDPI,
+		DateFormat: "2006-1",
+	},
+	"dark": {
+		Colors:     []string{"#8ab4f8", "#f28b82", "#81c995", "#fdd663", "#c58af9", "#78d9ec", "#fcad70"},
+		Background: "#202124",
+		Foreground: "#e8eaed",
+		GridColor:  "#5f6368",
+		LineWidth:  1.5,
+		Markers:    flag(false),
+		Dashes:     flag(false),
+		Legend:     "top-left",
+		DateFormat: "2006-01",
+	},
+	"print": {
+		Colors:     []string{"#000000", "#555555", "#999999"},
+		GridColor:  "#cccccc",
+		LineWidth:  1,
+		Markers:    flag(false),
+		Font:       "Helvetica",
+		Legend:     "top-left",
+		DateFormat: "2006-01",
+	},
+}
+
+// returns s with the fields it leaves out taken from base
+func (s Style) over(base Style) Style {
+	if len(s.Colors) == 0 {
+		s.Colors = base.Colors
+	}
+	if s.Background == "" {
+		s.Background = base.Background
+	}
+	if s.Foreground == "" {
+		s.Foreground = base.Foreground
+	}
+	if s.GridColor == "" {
+		s.GridColor = base.GridColor
+	}
+	if s.LineWidth == 0 {
+		s.LineWidth = base.LineWidth
+	}
+	if s.Markers == nil {
+		s.Markers = base.Markers
+	}
+	if s.Dashes == nil {
+		s.Dashes = base.Dashes
+	}
+	if s.Grid == nil {
+		s.Grid = base.Grid
+	}
+	if s.Font == "" {
+		s.Font = base.Font
+	}
+	if s.FontSize == 0 {
+		s.FontSize = base.FontSize
+	}
+	if s.Legend == "" {
+		s.Legend = base.Legend
+	}
+	if s.Width == 0 {
+		s.Width = base.Width
+	}
+	if s.Height == 0 {
+		s.Height = base.Height
+	}
+	if s.DPI == 0 {
+		s.DPI = base.DPI
+	}
+	if s.DateFormat == "" {
+		s.DateFormat = base.DateFormat
+	}
+	return s
+}
+
+// Names returns the names of the styles, sorted
+func (styles Styles) Names() []string {
+	var names []string
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Style returns the style of the given name, complete with the values of the default style. An
+// empty name means DefaultStyleName.
+func (styles Styles) Style(name string) (Style, error) {
+	if name == "" {
+		name = DefaultStyleName
+	}
+
+	s, ok := styles[name]
+	if !ok {
+		return Style{}, fmt.Errorf("econdata/plot: %w %q, expected one of %s", ErrUnknownStyle, name, strings.Join(styles.Names(), ", "))
+	}
+
+	return s.over(styles[DefaultStyleName]).over(DefaultStyles[DefaultStyleName]), nil
+}
+
+// LoadStyles returns the built-in styles along with those defined by the user in plotting.yml in
+// the configuration directory, if such a file exists. The file maps names to styles, and a style
+// named after a built-in one changes the fields it sets:
+//
+//   default:
+//     legend: top-left
+//   slides:
+//     font: Helvetica
+//     fontsize: 14
+//     colors: ["#1b9e77", "#d95f02", "#7570b3"]
+//     markers: false
+func LoadStyles() (Styles, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("plot.LoadStyles(): %s", err.Error())
+	}
+
+	return loadStylesFile(filepath.Join(configDir, StylesFileName))
+}
+
+// merges the built-in styles with those in the given file. A missing file is not an error.
+func loadStylesFile(filePath string) (Styles, error) {
+	styles := make(Styles, len(DefaultStyles))
+	for name, s := range DefaultStyles {
+		styles[name] = s
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return styles, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("plot.LoadStyles(): %s", err.Error())
+	}
+
+	var userStyles Styles
+	err = yaml.UnmarshalStrict(content, &userStyles)
+	if err != nil {
+		return nil, fmt.Errorf("plot.LoadStyles(): %s: %s", filePath, err.Error())
+	}
+
+	for name, s := range userStyles {
+		if builtIn, ok := styles[name]; ok {
+			s = s.over(builtIn)
+		}
+		styles[name] = s
+
+		// styles are checked when they are loaded rather than when they are used
+		complete, _ := styles.Style(name)
+		if _, err := complete.compile(); err != nil {
+			return nil, fmt.Errorf("plot.LoadStyles(): %s: style %s: %s", filePath, name, err.Error())
+		}
+	}
+
+	return styles, nil
+}
+
+// a style ready to be applied, with its colors parsed and its fonts loaded
+type theme struct {
+	Style
+	colors     []color.Color
+	background color.Color
+	foreground color.Color
+	grid       color.Color
+	tickFont   vg.Font
+	labelFont  vg.Font
+}
+
+// parses a color given as #rrggbb or #rgb
+func parseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+}
+
+// returns the theme of a complete style, or an error if any of its values is invalid
+func (s Style) compile() (*theme, error) {
+	t := &theme{Style: s}
+
+	for _, c := range s.Colors {
+		parsed, err := parseColor(c)
+		if err != nil {
+			return nil, err
+		}
+		t.colors = append(t.colors, parsed)
+	}
+	if len(t.colors) == 0 {
+		return nil, fmt.Errorf("no colors")
+	}
+
+	var err error
+	if t.background, err = parseColor(s.Background); err != nil {
+		return nil, err
+	}
+	if t.foreground, err = parseColor(s.Foreground); err != nil {
+		return nil, err
+	}
+	if t.grid, err = parseColor(s.GridColor); err != nil {
+		return nil, err
+	}
+
+	if t.tickFont, err = vg.MakeFont(s.Font, vg.Points(s.FontSize)); err != nil {
+		return nil, fmt.Errorf("invalid font %q: %s", s.Font, err.Error())
+	}
+	if t.labelFont, err = vg.MakeFont(s.Font, vg.Points(s.FontSize*1.2)); err != nil {
+		return nil, fmt.Errorf("invalid font %q: %s", s.Font, err.Error())
+	}
+
+	known := false
+	for _, position := range legendPositions {
+		known = known || position == s.Legend
+	}
+	if !known {
+		return nil, fmt.Errorf("invalid legend position %q, expected one of %s", s.Legend, strings.Join(legendPositions, ", "))
+	}
+
+	return t, nil
+}
+
+// returns the color of the i-th serie of a figure
+func (t *theme) color(i int) color.Color {
+	return t.colors[i%len(t.colors)]
+}
+
+// styles the background, text, axes and legend of p
+func (t *theme) apply(p *plot.Plot) {
+	p.BackgroundColor = t.background
+
+	p.Title.Font = t.labelFont
+	p.Title.Color = t.foreground
+
+	for _, a := range []*plot.Axis{&p.X, &p.Y} {
+		a.Color = t.foreground
+		a.Label.Font = t.labelFont
+		a.Label.Color = t.foreground
+		a.Tick.Color = t.foreground
+		a.Tick.Label.Font = t.tickFont
+		a.Tick.Label.Color = t.foreground
+	}
+	p.X.Tick.Marker = plot.TimeTicks{Format: t.DateFormat}
+
+	p.Legend.Font = t.labelFont
+	p.Legend.Color = t.foreground
+	p.Legend.Top = strings.HasPrefix(t.Legend, "top")
+	p.Legend.Left = strings.HasSuffix(t.Legend, "left")
+}
+
+// returns the grid of the style, or nil if it has none
+func (t *theme) newGrid() *plotter.Grid {
+	if !*t.Grid {
+		return nil
+	}
+
+	grid := plotter.NewGrid()
+	grid.Vertical.Color = t.grid
+	grid.Horizontal.Color = t.grid
+	return grid
+}
+
+// returns the line of serie s, the i-th of the figure, and its markers if the style has them, and
+// adds them to the legend of p unless the style leaves the legend out
+func (t *theme) linePoints(p *plot.Plot, s series.BDSICESerie, i int, legendSuffix string) []plot.Plotter {
+	// plotter.NewLine only fails on NaN and infinite values, which getXYPoints leaves out
+	points := getXYPoints(s)
+	l, _ := plotter.NewLine(points)
+	l.Color = t.color(i)
+	l.Width = vg.Points(t.LineWidth)
+	if *t.Dashes {
+		l.Dashes = plotutil.Dashes(i)
+	}
+
+	plotters := []plot.Plotter{l}
+	thumbnails := []plot.Thumbnailer{l}
+
+	if *t.Markers {
+		scatter, _ := plotter.NewScatter(points)
+		scatter.Color = t.color(i)
+		scatter.Shape = plotutil.Shape(i)
+		plotters = append(plotters, scatter)
+		thumbnails = append(thumbnails, scatter)
+	}
+
+	if t.Legend != "none" {
+		p.Legend.Add(s.GetTitle()+legendSuffix, thumbnails...)
+	}
+
+	return plotters
+}
@@ -0,0 +1,95 @@
+// package progress describes the progress of long-running operations, such as downloading,
+// decoding and building the database, as structured events. Operations report them to the Reporter
+// carried by their context, and renderers turn them into a progress bar or JSON lines.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Kind tells what an event reports
+type Kind string
+
+const (
+	KindPhase     Kind = "phase"     // a phase starts
+	KindBytes     Kind = "bytes"     // bytes of a file downloaded
+	KindExtracted Kind = "extracted" // files extracted from a zip file
+	KindDecoded   Kind = "decoded"   // series decoded
+	KindBuilt     Kind = "built"     // catalog built, with Done series
+	KindMessage   Kind = "message"   // anything else worth telling, such as a retry
+)
+
+// Phase is a step of an operation
+type Phase string
+
+const (
+	PhaseDownload Phase = "download" // downloading a file
+	PhaseValidate Phase = "validate" // checking a downloaded file
+	PhaseExtract  Phase = "extract"  // extracting a zip file
+	PhaseDecode   Phase = "decode"   // decoding .xer files
+	PhaseStore    Phase = "store"    // writing the series store
+	PhaseBuild    Phase = "build"    // building the catalog and the tree
+	PhaseUpdate   Phase = "update"   // applying an update, named after its date
+)
+
+// Event is reported as an operation progresses. Done and Total count bytes, files or series,
+// depending on Kind. Total is -1 when it is unknown.
+type Event struct {
+	Kind    Kind      `json:"Kind"`
+	Phase   Phase     `json:"Phase,omitempty"`
+	Name    string    `json:"Name,omitempty"` // file, update or bulletin the event refers to
+	Done    int64     `json:"Done"`
+	Total   int64     `json:"Total"`
+	Message string    `json:"Message,omitempty"`
+	Time    time.Time `json:"Time"`
+}
+
+// Reporter receives the events of an operation. Events are reported from the goroutine running
+// the operation, so Report should return quickly.
+type Reporter interface {
+	Report(event Event)
+}
+
+// ReporterFunc adapts a function to the Reporter interface
+type ReporterFunc func(event Event)
+
+// Report calls f(event)
+func (f ReporterFunc) Report(event Event) {
+	f(event)
+}
+
+// Discard is a Reporter that ignores every event
+var Discard Reporter = ReporterFunc(func(Event) {})
+
+type contextKey struct{}
+
+// WithReporter returns a copy of ctx carrying reporter, to which the operations given the context
+// report their progress
+func WithReporter(ctx context.Context, reporter Reporter) context.Context {
+	return context.WithValue(ctx, contextKey{}, reporter)
+}
+
+// FromContext returns the Reporter carried by ctx, or Discard if there is none
+func FromContext(ctx context.Context) Reporter {
+	if reporter, ok := ctx.Value(contextKey{}).(Reporter); ok && reporter != nil {
+		return reporter
+	}
+	return Discard
+}
+
+// StartPhase reports that phase starts, for name if it is not empty
+func StartPhase(ctx context.Context, phase Phase, name string) {
+	FromContext(ctx).Report(Event{Kind: KindPhase, Phase: phase, Name: name, Time: time.Now()})
+}
+
+// Advance reports that done out of total bytes, files or series have been processed
+func Advance(ctx context.Context, kind Kind, name string, done int64, total int64) {
+	FromContext(ctx).Report(Event{Kind: kind, Name: name, Done: done, Total: total, Time: time.Now()})
+}
+
+// Messagef reports a message, formatted as with fmt.Sprintf
+func Messagef(ctx context.Context, format string, a ...interface{}) {
+	FromContext(ctx).Report(Event{Kind: KindMessage, Message: fmt.Sprintf(format, a...), Time: time.Now()})
+}
@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	// operations given no reporter report to Discard
+	Advance(context.Background(), KindBytes, "BDSICE.zip", 1, 2)
+
+	var events []Event
+	ctx := WithReporter(context.Background(), ReporterFunc(func(event Event) {
+		events = append(events, event)
+	}))
+
+	StartPhase(ctx, PhaseDownload, "BDSICE.zip")
+	Advance(ctx, KindBytes, "BDSICE.zip", 1024, 2048)
+	Messagef(ctx, "%d update(s) to apply.", 2)
+
+	if len(events) != 3 {
+		t.Fatalf("FromContext(): expected 3 events, got %d", len(events))
+	}
+
+	if events[0].Kind != KindPhase || events[0].Phase != PhaseDownload || events[0].Time.IsZero() {
+		t.Errorf("StartPhase(): unexpected event %+v", events[0])
+	}
+
+	if events[1].Done != 1024 || events[1].Total != 2048 {
+		t.Errorf("Advance(): unexpected event %+v", events[1])
+	}
+
+	if events[2].Message != "2 update(s) to apply." {
+		t.Errorf("Messagef(): unexpected message %q", events[2].Message)
+	}
+}
+
+func TestBar(t *testing.T) {
+	var b bytes.Buffer
+	ctx := WithReporter(context.Background(), NewBar(&b))
+
+	StartPhase(ctx, PhaseDownload, "BDSICE.zip")
+	Advance(ctx, KindBytes, "BDSICE.zip", 1<<20, 4<<20)
+	Advance(ctx, KindBytes, "BDSICE.zip", 4<<20, 4<<20)
+	Advance(ctx, KindDecoded, "", 3, -1)
+	Messagef(ctx, "Catalog updated")
+
+	lines := strings.Split(b.String(), "\n")
+	if lines[0] != "Downloading BDSICE.zip..." {
+		t.Errorf("Bar: unexpected phase line %q", lines[0])
+	}
+
+	// the bar is redrawn in place, and the line ends once it is full
+	if expected := "\r[=======>                      ]  25% 1.0M/4.0M\r[==============================] 100% 4.0M/4.0M"; lines[1] != expected {
+		t.Errorf("Bar: expected %q, got %q", expected, lines[1])
+	}
+
+	// counts of unknown totals are drawn without a bar, and end their line before a message
+	if lines[2] != "\r3 series" || lines[3] != "Catalog updated" {
+		t.Errorf("Bar: unexpected lines %q", lines[2:])
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var b bytes.Buffer
+	ctx := WithReporter(context.Background(), NewJSONLines(&b))
+
+	StartPhase(ctx, PhaseDecode, "")
+	Advance(ctx, KindDecoded, "", 10, 20)
+
+	scanner := bufio.NewScanner(&b)
+	var events []Event
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("JSONLines: %q is not JSON: %s", scanner.Text(), err.Error())
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 2 || events[0].Phase != PhaseDecode || events[1].Done != 10 || events[1].Total != 20 {
+		t.Errorf("JSONLines: unexpected events %+v", events)
+	}
+}
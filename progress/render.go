@@ -0,0 +1,148 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// width of the bar drawn by Bar, in characters
+const barWidth = 30
+
+// what a phase is called in the lines printed by Bar
+var phaseTitles = map[Phase]string{
+	PhaseDownload: "Downloading",
+	PhaseValidate: "Checking",
+	PhaseExtract:  "Extracting",
+	PhaseDecode:   "Decoding",
+	PhaseStore:    "Writing series store",
+	PhaseBuild:    "Building catalog",
+	PhaseUpdate:   "Applying update of",
+}
+
+// what Done and Total count, for the kinds of event drawn as a bar
+var units = map[Kind]string{
+	KindExtracted: "files",
+	KindDecoded:   "series",
+}
+
+// Bar renders events for a terminal: phases and messages are printed on their own lines, and
+// counts are drawn as a progress bar redrawn in place
+type Bar struct {
+	w    io.Writer
+	mu   sync.Mutex
+	open bool // whether a bar is being drawn on the last line
+}
+
+// NewBar returns a Reporter drawing progress bars to w
+func NewBar(w io.Writer) *Bar {
+	return &Bar{w: w}
+}
+
+// Report renders event
+func (b *Bar) Report(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch event.Kind {
+	case KindPhase:
+		b.endLine()
+		title, ok := phaseTitles[event.Phase]
+		if !ok {
+			title = string(event.Phase)
+		}
+		if event.Name != "" {
+			title = title + " " + event.Name
+		}
+		fmt.Fprintf(b.w, "%s...\n", title)
+
+	case KindBytes, KindExtracted, KindDecoded:
+		fmt.Fprintf(b.w, "\r%s", bar(event))
+		b.open = true
+		if event.Total > 0 && event.Done >= event.Total {
+			b.endLine()
+		}
+
+	case KindBuilt:
+		b.endLine()
+		fmt.Fprintf(b.w, "Catalog built: %d series\n", event.Done)
+
+	case KindMessage:
+		b.endLine()
+		fmt.Fprintf(b.w, "%s\n", event.Message)
+	}
+}
+
+// moves to a new line if a bar has been drawn on the current one
+func (b *Bar) endLine() {
+	if b.open {
+		fmt.Fprintf(b.w, "\n")
+		b.open = false
+	}
+}
+
+// returns the line drawn for a count, such as [=========>     ]  64% 12.3M/19.2M or
+// [====>          ]  30% 3/10 files
+func bar(event Event) string {
+	count := counter(event.Kind, event.Done)
+	if event.Total <= 0 {
+		return count
+	}
+
+	done := event.Done
+	if done > event.Total {
+		done = event.Total
+	}
+
+	filled := int(int64(barWidth) * done / event.Total)
+	drawn := strings.Repeat("=", filled)
+	if filled < barWidth {
+		drawn = drawn + ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+
+	if event.Kind != KindBytes {
+		count = fmt.Sprintf("%d/%d %s", event.Done, event.Total, units[event.Kind])
+	} else {
+		count = count + "/" + counter(event.Kind, event.Total)
+	}
+
+	return fmt.Sprintf("[%s] %3d%% %s", drawn, 100*done/event.Total, count)
+}
+
+// returns n as a size for bytes, and as a number followed by the unit counted otherwise
+func counter(kind Kind, n int64) string {
+	if kind != KindBytes {
+		return fmt.Sprintf("%d %s", n, units[kind])
+	}
+
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%dK", n/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+// JSONLines renders every event as a line of JSON, for programs following the progress of an
+// operation
+type JSONLines struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONLines returns a Reporter writing events to w as JSON lines
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{encoder: json.NewEncoder(w)}
+}
+
+// Report writes event as a line of JSON
+func (j *JSONLines) Report(event Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.encoder.Encode(event)
+}
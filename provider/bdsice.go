@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// BDSICE provides the series of the BDSICE database downloaded to the database path. Its updates
+// are downloaded by the download package.
+type BDSICE struct {
+	handle *database.Handle
+}
+
+// NewBDSICE returns the provider of the series of the database of handle
+func NewBDSICE(handle *database.Handle) *BDSICE {
+	return &BDSICE{handle: handle}
+}
+
+// Namespace returns DefaultNamespace, since BDSICE codes are used without prefix
+func (b *BDSICE) Namespace() string {
+	return DefaultNamespace
+}
+
+// Catalog returns the catalog of the database, or ErrNoCatalog if it has not been downloaded
+func (b *BDSICE) Catalog(ctx context.Context) (*database.BDSICEDatabase, error) {
+	catalog, err := b.handle.Database()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("provider.BDSICE.Catalog(): %w", ErrNoCatalog)
+	} else if err != nil {
+		return nil, fmt.Errorf("provider.BDSICE.Catalog(): %w", err)
+	}
+
+	return catalog, nil
+}
+
+// Serie returns the serie identified by code from the database
+func (b *BDSICE) Serie(ctx context.Context, code string) (*series.BDSICESerie, error) {
+	return b.handle.Serie(code)
+}
+
+// Latest returns the end of the series as recorded in the catalog. Series without observations
+// are left out.
+func (b *BDSICE) Latest(ctx context.Context, codes ...string) (map[string]time.Time, error) {
+	db, err := b.handle.Database()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]time.Time, len(codes))
+	for _, code := range codes {
+		if entry, ok := db.Entries[code]; ok && entry.End != nil {
+			latest[code] = *entry.End
+		}
+	}
+
+	return latest, nil
+}
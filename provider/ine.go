@@ -0,0 +1,298 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// namespace of the series of INE
+const INENamespace = "ine"
+
+// directory within the data path holding the catalogs of the providers other than BDSICE
+const ProvidersDirName = config.ProvidersDirName
+
+// observations requested from DATOS_SERIE, enough for any serie. Tempus returns only the latest
+// one unless told otherwise.
+const ineMaxObservations = 100000
+
+// frequencies of the periodicities of INE, by id, as in series.BDSICESerie
+var ineFrequencies = map[int]int{
+	1:  12, // mensual
+	3:  4,  // trimestral
+	6:  2,  // semestral
+	12: 1,  // anual
+}
+
+// INE provides the series of the Instituto Nacional de Estadística through its Tempus JSON API.
+// Its catalog lists the series of the operations configured in ineoperations, and is kept in the
+// data path until it is refreshed. Series are fetched when they are asked for.
+type INE struct {
+	baseURL    string
+	userAgent  string
+	operations []string
+	dirPath    string // directory holding the catalog
+	client     *http.Client
+
+	mu      sync.Mutex
+	catalog *database.BDSICEDatabase
+}
+
+// NewINE returns the INE provider configured in configuration
+func NewINE(configuration *config.BDSICEConfig) *INE {
+	baseURL := configuration.INEURL
+	if baseURL == "" {
+		baseURL = config.DefaultINEURL
+	}
+
+	return &INE{
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/",
+		userAgent:  configuration.UserAgent,
+		operations: configuration.INEOperations,
+		dirPath:    filepath.Join(configuration.DataLocalPath, ProvidersDirName, INENamespace),
+		client:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Namespace returns INENamespace
+func (p *INE) Namespace() string {
+	return INENamespace
+}
+
+// metadata of a serie returned by SERIE and SERIES_OPERACION with det=2
+type ineMetadata struct {
+	COD          string    `json:"COD"`
+	Nombre       string    `json:"Nombre"`
+	Decimales    int       `json:"Decimales"`
+	Periodicidad ineObject `json:"Periodicidad"`
+	Unidad       ineObject `json:"Unidad"`
+}
+
+type ineObject struct {
+	Id     int    `json:"Id"`
+	Nombre string `json:"Nombre"`
+	Codigo string `json:"Codigo"`
+}
+
+// data of a serie returned by DATOS_SERIE
+type ineData struct {
+	COD    string `json:"COD"`
+	Nombre string `json:"Nombre"`
+	Data   []struct {
+		Fecha   int64    `json:"Fecha"`
+		Valor   *float64 `json:"Valor"`
+		Secreto bool     `json:"Secreto"`
+	} `json:"Data"`
+}
+
+// returns the serie described by metadata, without observations
+func (m ineMetadata) serie() *series.BDSICESerie {
+	return &series.BDSICESerie{
+		SerieCode: Qualify(INENamespace, m.COD),
+		Title:     strings.TrimSpace(m.Nombre),
+		Units:     strings.TrimSpace(m.Unidad.Nombre),
+		Source:    "INE",
+		Decimals:  m.Decimales,
+		Frequency: ineFrequencies[m.Periodicidad.Id],
+		Active:    true,
+		Public:    true,
+	}
+}
+
+// INE dates data points at midnight in Madrid, which is the evening before in UTC. Observations
+// are dated at midnight UTC of the day in Madrid, as BDSICE ones are.
+func ineDate(milliseconds int64) time.Time {
+	t := time.Unix(0, milliseconds*int64(time.Millisecond)).Add(12 * time.Hour).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// calls endpoint of the Tempus API for code and decodes its response into v. Tempus answers
+// requests for unknown codes with a status message rather than an error.
+func (p *INE) get(ctx context.Context, endpoint string, code string, query url.Values, v interface{}) error {
+	requestURL := p.baseURL + endpoint + "/" + url.PathEscape(code)
+	if len(query) > 0 {
+		requestURL = requestURL + "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return err
+	}
+	if p.userAgent != "" {
+		request.Header.Set("User-Agent", p.userAgent)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", code, ErrSerieNotFound)
+	} else if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", endpoint, code, response.Status)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	if json.Unmarshal(body, &status) == nil && status.Status != "" {
+		return fmt.Errorf("%s: %s: %w", code, status.Status, ErrSerieNotFound)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", endpoint, code, err.Error())
+	}
+
+	return nil
+}
+
+// Catalog returns the catalog fetched by the last Refresh, or ErrNoCatalog if it has never been
+// refreshed
+func (p *INE) Catalog(ctx context.Context) (*database.BDSICEDatabase, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.catalog != nil {
+		return p.catalog, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(p.dirPath, database.CatalogFileName)); os.IsNotExist(err) {
+		return nil, fmt.Errorf("provider.INE.Catalog(): %w", ErrNoCatalog)
+	}
+
+	catalog, err := database.LoadDatabase(&config.BDSICEConfig{DatabaseLocalPath: p.dirPath})
+	if err != nil {
+		return nil, fmt.Errorf("provider.INE.Catalog(): %w", err)
+	}
+
+	p.catalog = catalog
+	return catalog, nil
+}
+
+// Refresh lists the series of the operations configured, page by page, and keeps them as the
+// catalog of the provider
+func (p *INE) Refresh(ctx context.Context) (int, error) {
+	if len(p.operations) == 0 {
+		return 0, fmt.Errorf("provider.INE.Refresh(): no INE operations set in ineoperations in config.yml")
+	}
+
+	var listed []*series.BDSICESerie
+	for _, operation := range p.operations {
+		for page := 1; ; page++ {
+			var metadata []ineMetadata
+			err := p.get(ctx, "SERIES_OPERACION", operation, url.Values{"det": {"2"}, "page": {strconv.Itoa(page)}}, &metadata)
+			if err != nil {
+				return 0, fmt.Errorf("provider.INE.Refresh(): %w", err)
+			}
+
+			if len(metadata) == 0 {
+				break
+			}
+
+			for _, m := range metadata {
+				serie := m.serie()
+				// the catalog holds local codes, qualified by Registry.Search
+				serie.SerieCode = m.COD
+				listed = append(listed, serie)
+			}
+		}
+	}
+
+	catalog, err := database.BuildDatabase(listed)
+	if err != nil {
+		return 0, fmt.Errorf("provider.INE.Refresh(): %w", err)
+	}
+
+	err = os.MkdirAll(p.dirPath, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("provider.INE.Refresh(): %w", err)
+	}
+
+	err = catalog.Save(p.dirPath)
+	if err != nil {
+		return 0, fmt.Errorf("provider.INE.Refresh(): %w", err)
+	}
+
+	p.mu.Lock()
+	p.catalog = catalog
+	p.mu.Unlock()
+
+	return len(listed), nil
+}
+
+// Serie fetches the metadata and all the observations of the serie identified by code
+func (p *INE) Serie(ctx context.Context, code string) (*series.BDSICESerie, error) {
+	var metadata ineMetadata
+	err := p.get(ctx, "SERIE", code, url.Values{"det": {"2"}}, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("provider.INE.Serie(): %w", err)
+	}
+
+	var data ineData
+	err = p.get(ctx, "DATOS_SERIE", code, url.Values{"nult": {strconv.Itoa(ineMaxObservations)}}, &data)
+	if err != nil {
+		return nil, fmt.Errorf("provider.INE.Serie(): %w", err)
+	}
+
+	serie := metadata.serie()
+	for _, datum := range data.Data {
+		serie.Observations.Dates = append(serie.Observations.Dates, ineDate(datum.Fecha))
+
+		// secret values are missing, as OM and ND are in .xer files
+		if datum.Valor == nil || datum.Secreto {
+			serie.Observations.Values = append(serie.Observations.Values, series.MissingValue)
+			serie.ContainsNan = true
+			continue
+		}
+		serie.Observations.Values = append(serie.Observations.Values, *datum.Valor)
+	}
+
+	serie.NumberOfObservations = len(serie.Observations.Dates)
+	if serie.NumberOfObservations > 0 {
+		start := serie.Observations.Dates[0]
+		end := serie.Observations.Dates[serie.NumberOfObservations-1]
+		serie.Start, serie.End = &start, &end
+	}
+
+	return serie, nil
+}
+
+// Latest fetches the date of the latest observation of each of the series
+func (p *INE) Latest(ctx context.Context, codes ...string) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time, len(codes))
+
+	for _, code := range codes {
+		var data ineData
+		err := p.get(ctx, "DATOS_SERIE", code, url.Values{"nult": {"1"}}, &data)
+		if err != nil {
+			return nil, fmt.Errorf("provider.INE.Latest(): %w", err)
+		}
+
+		if len(data.Data) > 0 {
+			latest[code] = ineDate(data.Data[len(data.Data)-1].Fecha)
+		}
+	}
+
+	return latest, nil
+}
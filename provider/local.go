@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// namespace of the series imported from SDMX files
+const SDMXNamespace = "sdmx"
+
+// Local provides series imported into the data path, such as those read from SDMX files. Its
+// series and catalog are kept in DataLocalPath/providers/<namespace> the way those of the BDSICE
+// database are kept in its database path, so that they are searched and loaded alike.
+type Local struct {
+	namespace string
+	dirPath   string
+	handle    *database.Handle
+
+	mu sync.Mutex // serialises imports
+}
+
+// NewLocal returns the provider of the series imported into namespace
+func NewLocal(configuration *config.BDSICEConfig, namespace string) *Local {
+	dirPath := filepath.Join(configuration.DataLocalPath, ProvidersDirName, namespace)
+
+	return &Local{
+		namespace: namespace,
+		dirPath:   dirPath,
+		handle:    database.NewHandle(&config.BDSICEConfig{DatabaseLocalPath: dirPath}, 0),
+	}
+}
+
+// Namespace returns the namespace of the provider
+func (p *Local) Namespace() string {
+	return p.namespace
+}
+
+// Catalog returns the catalog of the series imported, or ErrNoCatalog if none has been imported
+func (p *Local) Catalog(ctx context.Context) (*database.BDSICEDatabase, error) {
+	if _, err := os.Stat(filepath.Join(p.dirPath, database.CatalogFileName)); os.IsNotExist(err) {
+		return nil, fmt.Errorf("provider.Local.Catalog(): %w", ErrNoCatalog)
+	}
+
+	catalog, err := p.handle.Database()
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Catalog(): %w", err)
+	}
+
+	return catalog, nil
+}
+
+// Serie returns the imported serie identified by code
+func (p *Local) Serie(ctx context.Context, code string) (*series.BDSICESerie, error) {
+	catalog, err := p.Catalog(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Serie(): %w", err)
+	}
+	if _, ok := catalog.Series[code]; !ok {
+		return nil, fmt.Errorf("provider.Local.Serie(): %s: %w", Qualify(p.namespace, code), ErrSerieNotFound)
+	}
+
+	serie, err := p.handle.Serie(code)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Serie(): %w", err)
+	}
+
+	// series from the handle are shared, and the store holds local codes
+	qualified := *serie
+	qualified.SerieCode = Qualify(p.namespace, code)
+
+	return &qualified, nil
+}
+
+// Latest returns the end of the series as recorded in the catalog. Series without observations
+// are left out.
+func (p *Local) Latest(ctx context.Context, codes ...string) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time, len(codes))
+
+	catalog, err := p.Catalog(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Latest(): %w", err)
+	}
+
+	for _, code := range codes {
+		if entry, ok := catalog.Entries[code]; ok && entry.End != nil {
+			latest[code] = *entry.End
+		}
+	}
+
+	return latest, nil
+}
+
+// Import adds seriesToImport to the provider, replacing the series with the same codes
+func (p *Local) Import(seriesToImport []*series.BDSICESerie) (*database.MergeReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, serie := range seriesToImport {
+		if serie.SerieCode == "" {
+			return nil, fmt.Errorf("provider.Local.Import(): serie %q without code", serie.Title)
+		}
+	}
+
+	err := os.MkdirAll(p.dirPath, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Import(): %w", err)
+	}
+
+	err = series.UpdateStore(filepath.Join(p.dirPath, series.StoreFileName), seriesToImport)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Import(): %w", err)
+	}
+
+	catalog := &database.BDSICEDatabase{}
+	if _, err := os.Stat(filepath.Join(p.dirPath, database.CatalogFileName)); err == nil {
+		catalog, err = database.LoadDatabase(&config.BDSICEConfig{DatabaseLocalPath: p.dirPath})
+		if err != nil {
+			return nil, fmt.Errorf("provider.Local.Import(): %w", err)
+		}
+	}
+
+	report := catalog.Merge(seriesToImport, nil)
+
+	err = catalog.Save(p.dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Local.Import(): %w", err)
+	}
+
+	p.handle.Invalidate()
+
+	return report, nil
+}
@@ -0,0 +1,171 @@
+// package provider gives a common access to the sources bdsicego pulls series from: BDSICE, whose
+// database is downloaded, and others, such as the INE Tempus API, whose series are fetched on
+// demand. Codes of series of providers other than BDSICE are prefixed by the namespace of their
+// provider, as in ine:IPC206449.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// namespace of the codes without prefix
+const DefaultNamespace = "bdsice"
+
+// separates the namespace of a code from the code local to its provider
+const separator = ":"
+
+var (
+	// ErrUnknownProvider is returned for codes prefixed by a namespace no provider has
+	ErrUnknownProvider = errors.New("unknown provider")
+
+	// ErrNoCatalog is returned by Catalog for providers whose catalog has not been fetched yet
+	ErrNoCatalog = errors.New("the catalog of the provider has not been fetched yet")
+
+	// ErrSerieNotFound is returned by Serie for codes the provider does not know
+	ErrSerieNotFound = errors.New("serie not found")
+)
+
+// Provider is a source of series. Codes given to and returned by a provider are local to it,
+// without namespace, except for the codes of the series it returns, which are qualified.
+type Provider interface {
+	// Namespace returns the prefix of the codes of the series of the provider, such as ine
+	Namespace() string
+
+	// Catalog returns the series offered by the provider
+	Catalog(ctx context.Context) (*database.BDSICEDatabase, error)
+
+	// Serie returns the serie identified by code
+	Serie(ctx context.Context, code string) (*series.BDSICESerie, error)
+
+	// Latest returns the date of the latest observation of each of the series, so that callers
+	// can tell which series have new data
+	Latest(ctx context.Context, codes ...string) (map[string]time.Time, error)
+}
+
+// Refresher is implemented by providers whose catalog is fetched on demand rather than downloaded
+// along with the series
+type Refresher interface {
+	// Refresh fetches the catalog again, and returns the number of series it lists
+	Refresh(ctx context.Context) (int, error)
+}
+
+// Split returns the namespace of code and the code local to its provider. Codes without prefix
+// belong to DefaultNamespace.
+func Split(code string) (namespace string, local string) {
+	if i := strings.Index(code, separator); i > 0 {
+		return strings.ToLower(code[:i]), code[i+1:]
+	}
+	return DefaultNamespace, code
+}
+
+// Qualify returns the code of the serie local of the provider namespace, as shown to users. Codes
+// of DefaultNamespace are left without prefix.
+func Qualify(namespace string, local string) string {
+	if namespace == DefaultNamespace {
+		return local
+	}
+	return namespace + separator + local
+}
+
+// Registry holds the providers available, and dispatches codes to them by namespace
+type Registry struct {
+	providers []Provider
+}
+
+// NewRegistry returns a registry of providers. Searches list their series in the same order.
+func NewRegistry(providers ...Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+// Providers returns the providers of the registry
+func (r *Registry) Providers() []Provider {
+	return r.providers
+}
+
+// Provider returns the provider of namespace
+func (r *Registry) Provider(namespace string) (Provider, error) {
+	for _, p := range r.providers {
+		if p.Namespace() == namespace {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("provider.Registry.Provider(): %s: %w", namespace, ErrUnknownProvider)
+}
+
+// Serie returns the serie identified by code, qualified with the namespace of its provider unless
+// it is a BDSICE serie
+func (r *Registry) Serie(ctx context.Context, code string) (*series.BDSICESerie, error) {
+	namespace, local := Split(code)
+
+	p, err := r.Provider(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	serie, err := p.Serie(ctx, local)
+	if err != nil {
+		return nil, fmt.Errorf("provider.Registry.Serie(): %w", err)
+	}
+
+	return serie, nil
+}
+
+// Search ranks the series of every provider whose catalog is available against terms, as
+// database.Rank does, and returns them with qualified codes, most relevant first. When a single
+// catalog is available its ranking is kept as it is. Otherwise results are merged by how well the
+// terms matched them, database.SearchResult.Match, since BM25 scores depend on the size and
+// vocabulary of each catalog and cannot be compared across catalogs. Results that match equally
+// well are ordered by score, and then in the order of the providers. The limit of options applies
+// to the merged results.
+func (r *Registry) Search(ctx context.Context, options database.SearchOptions, terms ...string) ([]database.SearchResult, error) {
+	var results []database.SearchResult
+	var catalogs int
+
+	// every catalog is ranked in full, since its best results by score are not necessarily its best
+	// matches
+	rankOptions := options
+	rankOptions.Limit = 0
+
+	for _, p := range r.providers {
+		catalog, err := p.Catalog(ctx)
+		if errors.Is(err, ErrNoCatalog) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("provider.Registry.Search(): %s: %w", p.Namespace(), err)
+		}
+		catalogs++
+
+		ranked, err := catalog.Rank(rankOptions, terms...)
+		if err != nil {
+			return nil, fmt.Errorf("provider.Registry.Search(): %s: %w", p.Namespace(), err)
+		}
+
+		for _, result := range ranked {
+			result.Code = Qualify(p.Namespace(), result.Code)
+			results = append(results, result)
+		}
+	}
+
+	if catalogs > 1 {
+		sort.SliceStable(results, func(i, j int) bool {
+			if results[i].Match != results[j].Match {
+				return results[i].Match > results[j].Match
+			}
+			return results[i].Score > results[j].Score
+		})
+	}
+
+	if options.Limit > 0 && len(results) > options.Limit {
+		results = results[:options.Limit]
+	}
+
+	return results, nil
+}
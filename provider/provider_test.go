@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/emulator"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// returns a configuration pointing to an emulator whose Tempus API lists the IPC and EPA series
+func testConfiguration(t *testing.T) (*config.BDSICEConfig, *emulator.Tempus) {
+	emu := emulator.NewDefault(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC))
+	// series are listed two per page, so that paging is followed
+	emu.Tempus.PageSize = 2
+
+	configuration := emulator.TestConfiguration(t, emu)
+	configuration.INEOperations = []string{"IPC", "EPA"}
+
+	return configuration, emu.Tempus
+}
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		code      string
+		namespace string
+		local     string
+	}{
+		{"100001", DefaultNamespace, "100001"},
+		{"ine:IPC206449", "ine", "IPC206449"},
+		{"INE:IPC206449", "ine", "IPC206449"},
+		{"bdsice:100001", DefaultNamespace, "100001"},
+		{":100001", DefaultNamespace, ":100001"},
+	}
+
+	for _, c := range cases {
+		namespace, local := Split(c.code)
+		if namespace != c.namespace || local != c.local {
+			t.Errorf("Split(%q): expected %q, %q, got %q, %q", c.code, c.namespace, c.local, namespace, local)
+		}
+	}
+
+	if code := Qualify(DefaultNamespace, "100001"); code != "100001" {
+		t.Errorf("Qualify(): BDSICE codes must not be prefixed, got %q", code)
+	}
+	if code := Qualify(INENamespace, "IPC206449"); code != "ine:IPC206449" {
+		t.Errorf("Qualify(): expected ine:IPC206449, got %q", code)
+	}
+}
+
+func TestINE(t *testing.T) {
+	configuration, tempus := testConfiguration(t)
+
+	ine := NewINE(configuration)
+
+	if _, err := ine.Catalog(context.Background()); !errors.Is(err, ErrNoCatalog) {
+		t.Errorf("Catalog(): expected ErrNoCatalog before the first refresh, got %v", err)
+	}
+
+	listed, err := ine.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh(): %s", err.Error())
+	}
+	if listed != 3 || tempus.Requests("SERIES_OPERACION") != 4 {
+		t.Errorf("Refresh(): expected 3 series in 4 pages, got %d in %d", listed, tempus.Requests("SERIES_OPERACION"))
+	}
+
+	// the catalog is kept in the data path
+	catalog, err := NewINE(configuration).Catalog(context.Background())
+	if err != nil {
+		t.Fatalf("Catalog(): %s", err.Error())
+	}
+	if entry := catalog.Entries["EPA387794"]; entry.Frequency != 4 || entry.Units != "Miles de personas" {
+		t.Errorf("Catalog(): unexpected entry %+v", entry)
+	}
+
+	serie, err := ine.Serie(context.Background(), "IPC206449")
+	if err != nil {
+		t.Fatalf("Serie(): %s", err.Error())
+	}
+	if serie.SerieCode != "ine:IPC206449" || serie.Frequency != 12 || serie.NumberOfObservations != 297 {
+		t.Errorf("Serie(): unexpected serie %s, frequency %d, %d observations", serie.SerieCode, serie.Frequency, serie.NumberOfObservations)
+	}
+	if start := time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC); !serie.Start.Equal(start) || serie.Observations.Values[0] != 70 {
+		t.Errorf("Serie(): expected the serie to start at %s with 70, got %s with %f", start, serie.Start, serie.Observations.Values[0])
+	}
+	// observations of summer months are dated on their first day too
+	if date := serie.Observations.Dates[6]; !date.Equal(time.Date(2002, time.July, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Serie(): expected the 7th observation on 2002-07-01, got %s", date)
+	}
+
+	unemployed, err := ine.Serie(context.Background(), "EPA387794")
+	if err != nil {
+		t.Fatalf("Serie(): %s", err.Error())
+	}
+	if !unemployed.ContainsNan || unemployed.Observations.Values[0] != series.MissingValue {
+		t.Errorf("Serie(): secret values must be missing")
+	}
+
+	if _, err := ine.Serie(context.Background(), "IPC000000"); !errors.Is(err, ErrSerieNotFound) {
+		t.Errorf("Serie(): expected ErrSerieNotFound for an unknown code, got %v", err)
+	}
+
+	latest, err := ine.Latest(context.Background(), "IPC206449", "EPA387794")
+	if err != nil {
+		t.Fatalf("Latest(): %s", err.Error())
+	}
+	if !latest["IPC206449"].Equal(time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)) || !latest["EPA387794"].Equal(time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Latest(): unexpected dates %v", latest)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	configuration, _ := testConfiguration(t)
+
+	// a BDSICE database with a single serie
+	os.MkdirAll(configuration.DatabaseLocalPath, 0755)
+	end := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	cpi := &series.BDSICESerie{SerieCode: "200001", Title: "INDICE DE PRECIOS DE CONSUMO. GENERAL", Frequency: 12, End: &end,
+		Observations: series.Observations{Dates: []time.Time{end}, Values: []float64{110}}, NumberOfObservations: 1}
+
+	if err := series.WriteStore(filepath.Join(configuration.DatabaseLocalPath, series.StoreFileName), []*series.BDSICESerie{cpi}); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+	db, _ := database.BuildDatabase([]*series.BDSICESerie{cpi})
+	if err := db.Save(configuration.DatabaseLocalPath); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	ine := NewINE(configuration)
+	registry := NewRegistry(NewBDSICE(database.NewHandle(configuration, 0)), ine)
+
+	// providers without a catalog are left out of searches
+	results, err := registry.Search(context.Background(), database.SearchOptions{}, "indice")
+	if err != nil {
+		t.Fatalf("Search(): %s", err.Error())
+	}
+	if len(results) != 1 || results[0].Code != "200001" {
+		t.Errorf("Search(): expected the BDSICE serie only, got %+v", results)
+	}
+
+	if _, err := ine.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh(): %s", err.Error())
+	}
+
+	results, err = registry.Search(context.Background(), database.SearchOptions{}, "indice", "general")
+	if err != nil {
+		t.Fatalf("Search(): %s", err.Error())
+	}
+	codes := map[string]bool{}
+	for _, result := range results {
+		codes[result.Code] = true
+	}
+	if len(results) != 2 || !codes["200001"] || !codes["ine:IPC206449"] {
+		t.Errorf("Search(): expected series of both providers, got %+v", results)
+	}
+
+	if limited, _ := registry.Search(context.Background(), database.SearchOptions{Limit: 1}, "indice", "general"); len(limited) != 1 {
+		t.Errorf("Search(): expected the limit to apply across providers, got %d results", len(limited))
+	}
+
+	// a typo matched by a provider registered first does not outrank an exact match of another
+	local := NewLocal(configuration, SDMXNamespace)
+	misspelt := &series.BDSICESerie{SerieCode: "M.I15.ES", Title: "INDIZE GENERAL", Frequency: 12}
+	if _, err := local.Import([]*series.BDSICESerie{misspelt}); err != nil {
+		t.Fatalf("Import(): %s", err.Error())
+	}
+	merged := NewRegistry(local, NewBDSICE(database.NewHandle(configuration, 0)))
+	results, err = merged.Search(context.Background(), database.SearchOptions{}, "indice", "general")
+	if err != nil {
+		t.Fatalf("Search(): %s", err.Error())
+	}
+	if len(results) != 2 || results[0].Code != "200001" || results[1].Code != "sdmx:M.I15.ES" {
+		t.Errorf("Search(): expected the exact match first, got %+v", results)
+	}
+	if limited, _ := merged.Search(context.Background(), database.SearchOptions{Limit: 1}, "indice", "general"); len(limited) != 1 || limited[0].Code != "200001" {
+		t.Errorf("Search(): expected the limit to apply once results are merged, got %+v", limited)
+	}
+
+	serie, err := registry.Serie(context.Background(), "ine:IPC206450")
+	if err != nil || serie.SerieCode != "ine:IPC206450" {
+		t.Errorf("Serie(): unexpected serie %v, %v", serie, err)
+	}
+
+	serie, err = registry.Serie(context.Background(), "200001")
+	if err != nil || serie.Title != cpi.Title {
+		t.Errorf("Serie(): unexpected serie %v, %v", serie, err)
+	}
+
+	if _, err := registry.Serie(context.Background(), "eurostat:prc_hicp"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Serie(): expected ErrUnknownProvider, got %v", err)
+	}
+
+	latest, err := NewBDSICE(database.NewHandle(configuration, 0)).Latest(context.Background(), "200001", "999999")
+	if err != nil || len(latest) != 1 || !latest["200001"].Equal(end) {
+		t.Errorf("Latest(): unexpected dates %v, %v", latest, err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	configuration, _ := testConfiguration(t)
+
+	local := NewLocal(configuration, SDMXNamespace)
+	if _, err := local.Catalog(context.Background()); !errors.Is(err, ErrNoCatalog) {
+		t.Errorf("Catalog(): expected ErrNoCatalog before any import, got %v", err)
+	}
+
+	end := time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC)
+	exchangeRate := &series.BDSICESerie{SerieCode: "EXR.Q.USD.EUR.SP00.A", Title: "US dollar/Euro", Frequency: 4, End: &end,
+		Observations: series.Observations{Dates: []time.Time{end}, Values: []float64{1.1932}}, NumberOfObservations: 1}
+	hicp := &series.BDSICESerie{SerieCode: "M.I15.ES", Title: "Harmonised index of consumer prices, Spain", Frequency: 12}
+
+	report, err := local.Import([]*series.BDSICESerie{exchangeRate})
+	if err != nil || len(report.Added) != 1 {
+		t.Fatalf("Import(): unexpected report %v, %v", report, err)
+	}
+	report, err = local.Import([]*series.BDSICESerie{exchangeRate, hicp})
+	if err != nil || len(report.Added) != 1 || len(report.Unchanged) != 1 {
+		t.Fatalf("Import(): unexpected report %v, %v", report, err)
+	}
+
+	// the BDSICE database has not been downloaded, which does not keep imported series from being found
+	registry := NewRegistry(NewBDSICE(database.NewHandle(configuration, 0)), local)
+
+	results, err := registry.Search(context.Background(), database.SearchOptions{}, "dollar")
+	if err != nil {
+		t.Fatalf("Search(): %s", err.Error())
+	}
+	if len(results) != 1 || results[0].Code != "sdmx:EXR.Q.USD.EUR.SP00.A" {
+		t.Errorf("Search(): expected the imported serie, got %+v", results)
+	}
+
+	serie, err := registry.Serie(context.Background(), "sdmx:EXR.Q.USD.EUR.SP00.A")
+	if err != nil || serie.SerieCode != "sdmx:EXR.Q.USD.EUR.SP00.A" || serie.Observations.Values[0] != 1.1932 {
+		t.Errorf("Serie(): unexpected serie %v, %v", serie, err)
+	}
+
+	if _, err := registry.Serie(context.Background(), "sdmx:EXR.M.USD.EUR.SP00.A"); !errors.Is(err, ErrSerieNotFound) {
+		t.Errorf("Serie(): expected ErrSerieNotFound, got %v", err)
+	}
+
+	// the ranking of a single catalog is kept, even where a better scored serie matches less well
+	dollarization := &series.BDSICESerie{SerieCode: "DOLLARIZATION", Title: "Dollarization", Frequency: 12}
+	if _, err := local.Import([]*series.BDSICESerie{dollarization}); err != nil {
+		t.Fatalf("Import(): %s", err.Error())
+	}
+	results, err = registry.Search(context.Background(), database.SearchOptions{}, "dollar")
+	if err != nil || len(results) != 2 || results[0].Code != "sdmx:DOLLARIZATION" || results[0].Match >= results[1].Match {
+		t.Errorf("Search(): expected the ranking of the catalog, got %+v (%v)", results, err)
+	}
+}
@@ -0,0 +1,300 @@
+// package saved keeps named searches and watchlists in the configuration directory, so that they
+// can be re-run and referred to as @name across sessions.
+package saved
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// name of the file holding saved searches and watchlists in the configuration directory
+const FileName = "saved.yml"
+
+// prefix marking a reference to a saved search or watchlist in the arguments of a command
+const ReferencePrefix = "@"
+
+// ErrNotFound is returned for names that are neither a saved search nor a watchlist
+var ErrNotFound = errors.New("no saved search or watchlist with that name")
+
+// names are used in @references on the command line, so they are kept shell-friendly
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Search holds the terms and options of a saved search, which is run again every time it is used
+type Search struct {
+	Terms   []string `yaml:"terms"`
+	Limit   int      `yaml:"limit,omitempty"`
+	Active  bool     `yaml:"active,omitempty"`
+	Current bool     `yaml:"current,omitempty"`
+}
+
+// Options returns the options to pass to database.Rank() to run the search
+func (s Search) Options() database.SearchOptions {
+	return database.SearchOptions{
+		Limit:  s.Limit,
+		Filter: database.FreshnessFilter{Active: s.Active, Current: s.Current},
+	}
+}
+
+// Collection holds the saved searches and watchlists, the latter being fixed lists of serie codes.
+// Names are shared by both, so that a reference is never ambiguous.
+type Collection struct {
+	Searches   map[string]Search   `yaml:"searches"`
+	Watchlists map[string][]string `yaml:"watchlists"`
+
+	filePath string
+}
+
+// Load reads the saved searches and watchlists from the configuration directory
+func Load() (*Collection, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("saved.Load(): %s", err.Error())
+	}
+
+	c, err := LoadFile(filepath.Join(configDir, FileName))
+	if err != nil {
+		return nil, fmt.Errorf("saved.Load(): %s", err.Error())
+	}
+
+	return c, nil
+}
+
+// LoadFile reads the saved searches and watchlists from filePath. A missing file yields an empty
+// collection, which Save() will write to filePath.
+func LoadFile(filePath string) (*Collection, error) {
+	c := &Collection{filePath: filePath}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("saved.LoadFile(): %s", err.Error())
+	}
+
+	if err == nil {
+		err = yaml.Unmarshal(content, c)
+		if err != nil {
+			return nil, fmt.Errorf("saved.LoadFile(): %s: %s", filePath, err.Error())
+		}
+	}
+
+	if c.Searches == nil {
+		c.Searches = make(map[string]Search)
+	}
+	if c.Watchlists == nil {
+		c.Watchlists = make(map[string][]string)
+	}
+
+	return c, nil
+}
+
+// Save writes the collection back to the file it was loaded from
+func (c *Collection) Save() error {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("saved.Save(): %s", err.Error())
+	}
+
+	err = utils.WriteFileAtomic(c.filePath, content)
+	if err != nil {
+		return fmt.Errorf("saved.Save(): %s", err.Error())
+	}
+
+	return nil
+}
+
+// Has reports whether name is a saved search or a watchlist
+func (c *Collection) Has(name string) bool {
+	_, isSearch := c.Searches[name]
+	_, isWatchlist := c.Watchlists[name]
+	return isSearch || isWatchlist
+}
+
+// Names returns the names of all saved searches and watchlists, sorted
+func (c *Collection) Names() []string {
+	names := make([]string, 0, len(c.Searches)+len(c.Watchlists))
+	for name := range c.Searches {
+		names = append(names, name)
+	}
+	for name := range c.Watchlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid name %q: names may contain letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// SaveSearch saves a search under name, replacing any saved search with that name
+func (c *Collection) SaveSearch(name string, search Search) error {
+	if err := checkName(name); err != nil {
+		return fmt.Errorf("saved.SaveSearch(): %s", err.Error())
+	}
+
+	if _, ok := c.Watchlists[name]; ok {
+		return fmt.Errorf("saved.SaveSearch(): %s is already a watchlist", name)
+	}
+
+	if len(search.Terms) == 0 {
+		return fmt.Errorf("saved.SaveSearch(): nothing to search for")
+	}
+
+	c.Searches[name] = search
+	return nil
+}
+
+// Watch adds codes to the watchlist name, creating it if it does not exist. Codes already in the
+// watchlist are not added twice.
+func (c *Collection) Watch(name string, codes ...string) error {
+	if err := checkName(name); err != nil {
+		return fmt.Errorf("saved.Watch(): %s", err.Error())
+	}
+
+	if _, ok := c.Searches[name]; ok {
+		return fmt.Errorf("saved.Watch(): %s is already a saved search", name)
+	}
+
+	watchlist := c.Watchlists[name]
+	for _, code := range codes {
+		if !contains(watchlist, code) {
+			watchlist = append(watchlist, code)
+		}
+	}
+
+	c.Watchlists[name] = watchlist
+	return nil
+}
+
+// Unwatch removes codes from the watchlist name
+func (c *Collection) Unwatch(name string, codes ...string) error {
+	watchlist, ok := c.Watchlists[name]
+	if !ok {
+		return fmt.Errorf("saved.Unwatch(): %s: %s", name, ErrNotFound.Error())
+	}
+
+	kept := watchlist[:0]
+	for _, code := range watchlist {
+		if !contains(codes, code) {
+			kept = append(kept, code)
+		}
+	}
+
+	c.Watchlists[name] = kept
+	return nil
+}
+
+func contains(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Rename renames a saved search or a watchlist
+func (c *Collection) Rename(oldName string, newName string) error {
+	if err := checkName(newName); err != nil {
+		return fmt.Errorf("saved.Rename(): %s", err.Error())
+	}
+
+	if c.Has(newName) {
+		return fmt.Errorf("saved.Rename(): %s already exists", newName)
+	}
+
+	if search, ok := c.Searches[oldName]; ok {
+		delete(c.Searches, oldName)
+		c.Searches[newName] = search
+		return nil
+	}
+
+	if watchlist, ok := c.Watchlists[oldName]; ok {
+		delete(c.Watchlists, oldName)
+		c.Watchlists[newName] = watchlist
+		return nil
+	}
+
+	return fmt.Errorf("saved.Rename(): %s: %s", oldName, ErrNotFound.Error())
+}
+
+// Delete removes a saved search or a watchlist
+func (c *Collection) Delete(name string) error {
+	if !c.Has(name) {
+		return fmt.Errorf("saved.Delete(): %s: %s", name, ErrNotFound.Error())
+	}
+
+	delete(c.Searches, name)
+	delete(c.Watchlists, name)
+	return nil
+}
+
+// Resolve returns the codes a name refers to: the results of running the saved search against the
+// catalog, best matches first, or the codes in the watchlist.
+func (c *Collection) Resolve(db *database.BDSICEDatabase, name string) ([]string, error) {
+	if watchlist, ok := c.Watchlists[name]; ok {
+		return append([]string{}, watchlist...), nil
+	}
+
+	search, ok := c.Searches[name]
+	if !ok {
+		return nil, fmt.Errorf("saved.Resolve(): %s: %s", name, ErrNotFound.Error())
+	}
+
+	results, err := db.Rank(search.Options(), search.Terms...)
+	if err != nil {
+		return nil, fmt.Errorf("saved.Resolve(): %s", err.Error())
+	}
+
+	codes := make([]string, 0, len(results))
+	for _, result := range results {
+		codes = append(codes, result.Code)
+	}
+
+	return codes, nil
+}
+
+// Reference returns the name in an argument such as @labour-market. ok is false if the argument is
+// not a reference.
+func Reference(arg string) (name string, ok bool) {
+	if !strings.HasPrefix(arg, ReferencePrefix) || len(arg) == len(ReferencePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(arg, ReferencePrefix), true
+}
+
+// Expand replaces the references among args by the codes they refer to. Other arguments are kept
+// as they are.
+func (c *Collection) Expand(db *database.BDSICEDatabase, args []string) ([]string, error) {
+	var expanded []string
+
+	for _, arg := range args {
+		name, ok := Reference(arg)
+		if !ok {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		codes, err := c.Resolve(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("saved.Expand(): %s", err.Error())
+		}
+		expanded = append(expanded, codes...)
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,85 @@
+package saved
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+func TestCollection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-saved")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, FileName)
+
+	c, err := LoadFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadFile(): %s", err.Error())
+	}
+
+	if err := c.SaveSearch("labour-market", Search{Terms: []string{"epa", "ocupados"}}); err != nil {
+		t.Fatalf("SaveSearch(): %s", err.Error())
+	}
+	if err := c.Watch("brent", "634814", "634814q", "634814"); err != nil {
+		t.Fatalf("Watch(): %s", err.Error())
+	}
+	if err := c.Watch("labour-market", "100001"); err == nil {
+		t.Errorf("Watch(): expected an error for a name already used by a saved search")
+	}
+	if err := c.SaveSearch("bad name", Search{Terms: []string{"epa"}}); err == nil {
+		t.Errorf("SaveSearch(): expected an error for an invalid name")
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save(): %s", err.Error())
+	}
+
+	c, err = LoadFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadFile(): %s", err.Error())
+	}
+
+	if names := c.Names(); !reflect.DeepEqual(names, []string{"brent", "labour-market"}) {
+		t.Errorf("Names(): expected [brent labour-market], got %v", names)
+	}
+
+	if err := c.Rename("brent", "oil"); err != nil {
+		t.Fatalf("Rename(): %s", err.Error())
+	}
+	if err := c.Unwatch("oil", "634814q"); err != nil {
+		t.Fatalf("Unwatch(): %s", err.Error())
+	}
+
+	db, err := database.BuildDatabase([]*series.BDSICESerie{
+		{SerieCode: "100001", Title: "EPA. OCUPADOS. TOTAL NACIONAL"},
+		{SerieCode: "100002", Title: "EPA. PARADOS. TOTAL NACIONAL"},
+		{SerieCode: "634814", Title: "PRECIO PETROLEO BRENT"},
+	})
+	if err != nil {
+		t.Fatalf("BuildDatabase(): %s", err.Error())
+	}
+
+	expanded, err := c.Expand(db, []string{"@labour-market", "200001", "@oil"})
+	if err != nil {
+		t.Fatalf("Expand(): %s", err.Error())
+	}
+	if !reflect.DeepEqual(expanded, []string{"100001", "200001", "634814"}) {
+		t.Errorf("Expand(): expected [100001 200001 634814], got %v", expanded)
+	}
+
+	if _, err := c.Expand(db, []string{"@missing"}); err == nil {
+		t.Errorf("Expand(): expected an error for an unknown name")
+	}
+
+	if err := c.Delete("oil"); err != nil || c.Has("oil") {
+		t.Errorf("Delete(): expected oil to be deleted (%v)", err)
+	}
+}
@@ -0,0 +1,397 @@
+package sdmx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// an SDMX-JSON data message. Version 1.0 messages hold the data sets and the structure at the top
+// level, and version 2.0 messages within data.
+type jsonMessage struct {
+	Header    *jsonHeader    `json:"header,omitempty"`
+	DataSets  []jsonDataSet  `json:"dataSets,omitempty"`
+	Structure *jsonStructure `json:"structure,omitempty"`
+	Data      *struct {
+		DataSets   []jsonDataSet   `json:"dataSets"`
+		Structures []jsonStructure `json:"structures"`
+	} `json:"data,omitempty"`
+}
+
+type jsonHeader struct {
+	ID       string     `json:"id"`
+	Test     bool       `json:"test"`
+	Prepared string     `json:"prepared"`
+	Sender   jsonSender `json:"sender"`
+}
+
+type jsonSender struct {
+	ID string `json:"id"`
+}
+
+type jsonDataSet struct {
+	Action string                `json:"action,omitempty"`
+	Series map[string]jsonSeries `json:"series"`
+}
+
+// the attributes of a series and the values of its observations are indices of the values of the
+// components in the structure, and keys are those of the dimensions joined by colons
+type jsonSeries struct {
+	Attributes   []*int                   `json:"attributes"`
+	Observations map[string][]interface{} `json:"observations"`
+}
+
+type jsonStructure struct {
+	Name       jsonText `json:"name,omitempty"`
+	Dimensions struct {
+		Series      []jsonComponent `json:"series"`
+		Observation []jsonComponent `json:"observation"`
+	} `json:"dimensions"`
+	Attributes struct {
+		Series      []jsonComponent `json:"series"`
+		Observation []jsonComponent `json:"observation"`
+	} `json:"attributes"`
+}
+
+type jsonComponent struct {
+	ID          string      `json:"id"`
+	Name        jsonText    `json:"name,omitempty"`
+	KeyPosition *int        `json:"keyPosition,omitempty"`
+	Role        string      `json:"role,omitempty"`
+	Values      []jsonValue `json:"values"`
+}
+
+type jsonValue struct {
+	ID   string   `json:"id,omitempty"`
+	Name jsonText `json:"name,omitempty"`
+}
+
+// a name, either a string or, as in SDMX-JSON 2.0, localised strings by language
+type jsonText string
+
+func (t *jsonText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = jsonText(s)
+		return nil
+	}
+
+	var localised map[string]string
+	if err := json.Unmarshal(b, &localised); err != nil {
+		return err
+	}
+
+	// english if given, any language otherwise, the same one every time
+	if s, ok := localised["en"]; ok {
+		*t = jsonText(s)
+		return nil
+	}
+	var languages []string
+	for language := range localised {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	if len(languages) > 0 {
+		*t = jsonText(localised[languages[0]])
+	}
+
+	return nil
+}
+
+// returns the text of a value: its id if it is coded, its name otherwise
+func (v jsonValue) text() string {
+	if v.ID != "" {
+		return v.ID
+	}
+	return string(v.Name)
+}
+
+// indices of the values of components, by value, as they are added
+type jsonValues struct {
+	values  []jsonValue
+	indices map[string]int
+}
+
+func (v *jsonValues) index(value jsonValue) int {
+	if v.indices == nil {
+		v.indices = map[string]int{}
+	}
+	text := value.text()
+	if i, ok := v.indices[text]; ok {
+		return i
+	}
+	v.indices[text] = len(v.values)
+	v.values = append(v.values, value)
+	return v.indices[text]
+}
+
+// WriteJSON writes seriesToWrite to w as an SDMX-JSON 1.0 data message. The observations of every
+// serie index the same list of time periods.
+func WriteJSON(w io.Writer, seriesToWrite []*series.BDSICESerie) error {
+	prepared := time.Now()
+	h := header(prepared)
+
+	var frequencies, codes, periods, statuses jsonValues
+	attributeIDs := []string{attributeTitle, attributeUnit, attributeDecimals, attributeSource}
+	attributeValues := make([]jsonValues, len(attributeIDs))
+
+	// time periods are sorted by date, and the same period may come from series of different
+	// frequencies, which sort by their own dates
+	type period struct {
+		text string
+		date time.Time
+	}
+	var allPeriods []period
+	seen := map[string]bool{}
+	for _, s := range seriesToWrite {
+		for _, date := range s.Observations.Dates {
+			text := formatPeriod(date, s.Frequency)
+			if !seen[text] {
+				seen[text] = true
+				allPeriods = append(allPeriods, period{text, date})
+			}
+		}
+	}
+	sort.SliceStable(allPeriods, func(i, j int) bool {
+		if allPeriods[i].date.Equal(allPeriods[j].date) {
+			return allPeriods[i].text < allPeriods[j].text
+		}
+		return allPeriods[i].date.Before(allPeriods[j].date)
+	})
+	for _, p := range allPeriods {
+		periods.index(jsonValue{ID: p.text, Name: jsonText(p.text)})
+	}
+
+	dataSet := jsonDataSet{Action: "Information", Series: map[string]jsonSeries{}}
+	for _, s := range seriesToWrite {
+		key := fmt.Sprintf("%d:%d",
+			frequencies.index(jsonValue{ID: frequencyCode(s.Frequency)}),
+			codes.index(jsonValue{ID: s.SerieCode, Name: jsonText(s.Title)}))
+
+		written := jsonSeries{
+			Attributes:   make([]*int, len(attributeIDs)),
+			Observations: map[string][]interface{}{},
+		}
+		for _, a := range serieAttributes(s) {
+			for i, id := range attributeIDs {
+				if id == a.id {
+					index := attributeValues[i].index(jsonValue{Name: jsonText(a.value)})
+					written.Attributes[i] = &index
+				}
+			}
+		}
+
+		for i, date := range s.Observations.Dates {
+			value, status := formatValue(s.Observations.Values[i], s.Decimals)
+
+			var observed interface{}
+			if status != statusMissing {
+				observed = json.Number(value)
+			}
+
+			observation := periods.index(jsonValue{ID: formatPeriod(date, s.Frequency)})
+			written.Observations[strconv.Itoa(observation)] = []interface{}{observed, statuses.index(jsonValue{ID: status})}
+		}
+
+		dataSet.Series[key] = written
+	}
+
+	structure := &jsonStructure{Name: StructureID}
+	frequencyPosition, codePosition := 0, 1
+	structure.Dimensions.Series = []jsonComponent{
+		{ID: dimensionFrequency, Name: "Frequency", KeyPosition: &frequencyPosition, Values: frequencies.values},
+		{ID: dimensionSerieCode, Name: "Series code", KeyPosition: &codePosition, Values: codes.values},
+	}
+	structure.Dimensions.Observation = []jsonComponent{
+		{ID: dimensionTime, Name: "Time period", Role: "time", Values: periods.values},
+	}
+	for i, id := range attributeIDs {
+		structure.Attributes.Series = append(structure.Attributes.Series,
+			jsonComponent{ID: id, Values: append([]jsonValue{}, attributeValues[i].values...)})
+	}
+	structure.Attributes.Observation = []jsonComponent{
+		{ID: attributeStatus, Name: "Observation status", Values: statuses.values},
+	}
+
+	message := jsonMessage{
+		Header: &jsonHeader{
+			ID:       h.ID,
+			Prepared: h.Prepared,
+			Sender:   jsonSender{ID: SenderID},
+		},
+		DataSets:  []jsonDataSet{dataSet},
+		Structure: structure,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(message); err != nil {
+		return fmt.Errorf("sdmx.WriteJSON(): %w", err)
+	}
+
+	return nil
+}
+
+// reads the series of an SDMX-JSON data message, version 1.0 or 2.0
+func readJSON(r io.Reader) ([]*series.BDSICESerie, error) {
+	var message jsonMessage
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&message); err != nil {
+		return nil, err
+	}
+
+	dataSets := message.DataSets
+	structure := message.Structure
+	if message.Data != nil {
+		dataSets = message.Data.DataSets
+		if len(message.Data.Structures) > 0 {
+			structure = &message.Data.Structures[0]
+		}
+	}
+	if structure == nil {
+		return nil, fmt.Errorf("%w: no structure", ErrUnknownFormat)
+	}
+
+	// the time period is the only observation dimension bdsicego reads
+	var timePeriods []jsonValue
+	for _, d := range structure.Dimensions.Observation {
+		if d.ID == dimensionTime || d.Role == "time" || len(structure.Dimensions.Observation) == 1 {
+			timePeriods = d.Values
+		}
+	}
+
+	var parsed []*parsedSerie
+	for _, dataSet := range dataSets {
+		// series in the order of their keys, so that reading is deterministic
+		var keys []string
+		for key := range dataSet.Series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			p, err := parseJSONSeries(structure, key, dataSet.Series[key], timePeriods)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, p)
+		}
+	}
+
+	return convert(parsed)
+}
+
+// returns the value of component at index, or nil if there is none
+func componentValue(component jsonComponent, index int) *jsonValue {
+	if index < 0 || index >= len(component.Values) {
+		return nil
+	}
+	return &component.Values[index]
+}
+
+// returns the index held by v, a number in an observation, or -1 if there is none
+func jsonIndex(v interface{}) int {
+	n, ok := v.(json.Number)
+	if !ok {
+		return -1
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// returns the serie of key within a data set
+func parseJSONSeries(structure *jsonStructure, key string, s jsonSeries, timePeriods []jsonValue) (*parsedSerie, error) {
+	p := &parsedSerie{attributes: map[string]string{}}
+
+	indices := strings.Split(key, ":")
+	if len(indices) != len(structure.Dimensions.Series) {
+		return nil, fmt.Errorf("series key %q does not match the %d dimensions of the structure", key, len(structure.Dimensions.Series))
+	}
+	for i, index := range indices {
+		position, err := strconv.Atoi(index)
+		if err != nil {
+			return nil, fmt.Errorf("series key %q: %s", key, err.Error())
+		}
+		dimension := structure.Dimensions.Series[i]
+		value := componentValue(dimension, position)
+		if value == nil {
+			return nil, fmt.Errorf("series key %q: no value %d of %s", key, position, dimension.ID)
+		}
+		p.dimensions = append(p.dimensions, keyValue{dimension.ID, value.text()})
+		if value.Name != "" && dimension.ID != dimensionSerieCode {
+			p.names = append(p.names, string(value.Name))
+		}
+	}
+
+	for i, index := range s.Attributes {
+		if index == nil || i >= len(structure.Attributes.Series) {
+			continue
+		}
+		attribute := structure.Attributes.Series[i]
+		if value := componentValue(attribute, *index); value != nil {
+			p.attributes[attribute.ID] = value.text()
+		}
+	}
+
+	// observations in the order of their time periods
+	var observationKeys []int
+	for k := range s.Observations {
+		index, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("series key %q: observation %q: %s", key, k, err.Error())
+		}
+		observationKeys = append(observationKeys, index)
+	}
+	sort.Ints(observationKeys)
+
+	for _, index := range observationKeys {
+		period := componentValue(jsonComponent{Values: timePeriods}, index)
+		if period == nil {
+			return nil, fmt.Errorf("series key %q: no time period %d", key, index)
+		}
+		observation := s.Observations[strconv.Itoa(index)]
+
+		if len(observation) == 0 {
+			continue
+		}
+
+		var value string
+		switch v := observation[0].(type) {
+		case json.Number:
+			value = v.String()
+		case string:
+			value = v
+		}
+
+		// observation attributes follow the value
+		var status string
+		for i, a := range observation[1:] {
+			if i >= len(structure.Attributes.Observation) {
+				break
+			}
+			attribute := structure.Attributes.Observation[i]
+			if attribute.ID != attributeStatus && attribute.ID != "OBS_FLAG" {
+				continue
+			}
+			if v := componentValue(attribute, jsonIndex(a)); v != nil {
+				status = strings.ToUpper(v.text())
+			}
+		}
+
+		p.periods = append(p.periods, period.text())
+		p.values = append(p.values, parseValue(value))
+		p.statuses = append(p.statuses, status)
+	}
+
+	return p, nil
+}
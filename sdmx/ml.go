@@ -0,0 +1,319 @@
+package sdmx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// namespaces of SDMX-ML 2.1
+const (
+	namespaceMessage = "http://www.sdmx.org/resources/sdmxml/schemas/v2_1/message"
+	namespaceGeneric = "http://www.sdmx.org/resources/sdmxml/schemas/v2_1/data/generic"
+	namespaceCommon  = "http://www.sdmx.org/resources/sdmxml/schemas/v2_1/common"
+)
+
+// elements of a generic data message, as written. Prefixes are written as part of the names, since
+// encoding/xml would otherwise declare the namespace again in every element.
+type mlMessage struct {
+	XMLName          xml.Name  `xml:"message:GenericData"`
+	NamespaceMessage string    `xml:"xmlns:message,attr"`
+	NamespaceGeneric string    `xml:"xmlns:generic,attr"`
+	NamespaceCommon  string    `xml:"xmlns:common,attr"`
+	Header           mlHeader  `xml:"message:Header"`
+	DataSet          mlDataSet `xml:"message:DataSet"`
+}
+
+type mlHeader struct {
+	ID        string      `xml:"message:ID"`
+	Test      bool        `xml:"message:Test"`
+	Prepared  string      `xml:"message:Prepared"`
+	Sender    mlSender    `xml:"message:Sender"`
+	Structure mlStructure `xml:"message:Structure"`
+}
+
+type mlSender struct {
+	ID string `xml:"id,attr"`
+}
+
+type mlStructure struct {
+	StructureID            string `xml:"structureID,attr"`
+	DimensionAtObservation string `xml:"dimensionAtObservation,attr"`
+	Reference              mlRef  `xml:"common:Structure>Ref"`
+}
+
+type mlRef struct {
+	AgencyID string `xml:"agencyID,attr"`
+	ID       string `xml:"id,attr"`
+	Version  string `xml:"version,attr"`
+}
+
+type mlDataSet struct {
+	StructureRef string          `xml:"structureRef,attr"`
+	Series       []mlWriteSeries `xml:"generic:Series"`
+}
+
+type mlWriteSeries struct {
+	SeriesKey  []mlWriteValue `xml:"generic:SeriesKey>generic:Value"`
+	Attributes []mlWriteValue `xml:"generic:Attributes>generic:Value"`
+	Obs        []mlWriteObs   `xml:"generic:Obs"`
+}
+
+type mlWriteValue struct {
+	ID    string `xml:"id,attr,omitempty"`
+	Value string `xml:"value,attr"`
+}
+
+type mlWriteObs struct {
+	Dimension  mlWriteValue   `xml:"generic:ObsDimension"`
+	Value      mlWriteValue   `xml:"generic:ObsValue"`
+	Attributes []mlWriteValue `xml:"generic:Attributes>generic:Value"`
+}
+
+// returns the header of the messages written at prepared
+func header(prepared time.Time) mlHeader {
+	return mlHeader{
+		ID:       SenderID + prepared.UTC().Format("20060102150405"),
+		Prepared: prepared.UTC().Format(time.RFC3339),
+		Sender:   mlSender{ID: SenderID},
+		Structure: mlStructure{
+			StructureID:            StructureID,
+			DimensionAtObservation: dimensionTime,
+			Reference:              mlRef{AgencyID: SenderID, ID: StructureID, Version: "1.0"},
+		},
+	}
+}
+
+// returns the series-level attributes of s, those with a value
+func serieAttributes(s *series.BDSICESerie) []keyValue {
+	attributes := []keyValue{
+		{attributeTitle, s.Title},
+		{attributeUnit, s.Units},
+		{attributeDecimals, strconv.Itoa(s.Decimals)},
+		{attributeSource, s.Source},
+	}
+
+	var withValue []keyValue
+	for _, a := range attributes {
+		if a.value != "" {
+			withValue = append(withValue, a)
+		}
+	}
+	return withValue
+}
+
+// WriteML writes seriesToWrite to w as an SDMX-ML 2.1 generic data message
+func WriteML(w io.Writer, seriesToWrite []*series.BDSICESerie) error {
+	message := mlMessage{
+		NamespaceMessage: namespaceMessage,
+		NamespaceGeneric: namespaceGeneric,
+		NamespaceCommon:  namespaceCommon,
+		Header:           header(time.Now()),
+		DataSet:          mlDataSet{StructureRef: StructureID},
+	}
+
+	for _, s := range seriesToWrite {
+		written := mlWriteSeries{
+			SeriesKey: []mlWriteValue{
+				{ID: dimensionFrequency, Value: frequencyCode(s.Frequency)},
+				{ID: dimensionSerieCode, Value: s.SerieCode},
+			},
+		}
+
+		for _, a := range serieAttributes(s) {
+			written.Attributes = append(written.Attributes, mlWriteValue{ID: a.id, Value: a.value})
+		}
+
+		for i, date := range s.Observations.Dates {
+			value, status := formatValue(s.Observations.Values[i], s.Decimals)
+			written.Obs = append(written.Obs, mlWriteObs{
+				Dimension:  mlWriteValue{Value: formatPeriod(date, s.Frequency)},
+				Value:      mlWriteValue{Value: value},
+				Attributes: []mlWriteValue{{ID: attributeStatus, Value: status}},
+			})
+		}
+
+		message.DataSet.Series = append(message.DataSet.Series, written)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("sdmx.WriteML(): %w", err)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(message); err != nil {
+		return fmt.Errorf("sdmx.WriteML(): %w", err)
+	}
+
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("sdmx.WriteML(): %w", err)
+	}
+
+	return nil
+}
+
+// elements of a series as read, either generic, where the key and attributes are elements, or
+// structure-specific, where they are XML attributes of the series itself. Names carry no
+// namespace, so that any prefix matches.
+type mlReadSeries struct {
+	Attrs      []xml.Attr    `xml:",any,attr"`
+	SeriesKey  []mlReadValue `xml:"SeriesKey>Value"`
+	Attributes []mlReadValue `xml:"Attributes>Value"`
+	Obs        []mlReadObs   `xml:"Obs"`
+}
+
+type mlReadValue struct {
+	ID    string `xml:"id,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type mlReadObs struct {
+	Attrs      []xml.Attr    `xml:",any,attr"`
+	Dimension  mlReadValue   `xml:"ObsDimension"`
+	Value      mlReadValue   `xml:"ObsValue"`
+	Attributes []mlReadValue `xml:"Attributes>Value"`
+}
+
+// ids of the series-level attributes usual in structure-specific messages of Eurostat and the ECB.
+// Structure-specific messages don't tell dimensions from attributes without their data structure
+// definition, so any other XML attribute of a series is taken as a dimension.
+var structureSpecificAttributes = map[string]bool{
+	attributeTitle:      true,
+	attributeTitleCompl: true,
+	attributeUnit:       true,
+	attributeUnitMult:   true,
+	attributeDecimals:   true,
+	attributeSource:     true,
+	"UNIT":              true,
+	"UNIT_INDEX_BASE":   true,
+	"COLLECTION":        true,
+	"COMPILATION":       true,
+	"COVERAGE":          true,
+	"BREAKS":            true,
+	"SOURCE_PUB":        true,
+	"TIME_FORMAT":       true,
+	"TIME_PER_COLLECT":  true,
+	"NAT_TITLE":         true,
+	"DOM_SER_IDS":       true,
+	"PUBL_ECB":          true,
+	"PUBL_MU":           true,
+	"PUBL_PUBLIC":       true,
+	"BASE_PER":          true,
+	"CONF_STATUS":       true,
+	"EMBARGO_TIME":      true,
+}
+
+// reads the series of an SDMX-ML data message, generic or structure-specific
+func readML(r io.Reader) ([]*series.BDSICESerie, error) {
+	decoder := xml.NewDecoder(r)
+
+	var dataflow string
+	var parsed []*parsedSerie
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "StructureUsage":
+			// the dataflow of the message prefixes the keys of its series
+			var usage struct {
+				Ref mlReadRef `xml:"Ref"`
+			}
+			if err := decoder.DecodeElement(&usage, &start); err != nil {
+				return nil, err
+			}
+			dataflow = usage.Ref.ID
+		case "Series":
+			var s mlReadSeries
+			if err := decoder.DecodeElement(&s, &start); err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, s.parse())
+		}
+	}
+
+	if dataflow != "" {
+		for _, p := range parsed {
+			p.prefix(dataflow)
+		}
+	}
+
+	return convert(parsed)
+}
+
+type mlReadRef struct {
+	ID string `xml:"id,attr"`
+}
+
+// returns the serie as parsed from the elements read
+func (s *mlReadSeries) parse() *parsedSerie {
+	p := &parsedSerie{attributes: map[string]string{}}
+
+	for _, v := range s.SeriesKey {
+		p.dimensions = append(p.dimensions, keyValue{v.ID, v.Value})
+	}
+	for _, v := range s.Attributes {
+		p.attributes[v.ID] = v.Value
+	}
+	for _, a := range s.Attrs {
+		// namespace declarations and xsi attributes
+		if a.Name.Space != "" || a.Name.Local == "xmlns" {
+			continue
+		}
+		if structureSpecificAttributes[a.Name.Local] {
+			p.attributes[a.Name.Local] = a.Value
+		} else {
+			p.dimensions = append(p.dimensions, keyValue{a.Name.Local, a.Value})
+		}
+	}
+
+	for _, o := range s.Obs {
+		period := o.Dimension.Value
+		value := parseValue(o.Value.Value)
+
+		var status string
+		for _, v := range o.Attributes {
+			if v.ID == attributeStatus {
+				status = v.Value
+			}
+		}
+
+		for _, a := range o.Attrs {
+			switch a.Name.Local {
+			case dimensionTime:
+				period = a.Value
+			case measureValue:
+				value = parseValue(a.Value)
+			case attributeStatus:
+				status = a.Value
+			case "OBS_FLAG":
+				// Eurostat flags observations rather than giving them a status
+				if status == "" {
+					status = strings.ToUpper(a.Value)
+				}
+			}
+		}
+
+		p.periods = append(p.periods, period)
+		p.values = append(p.values, value)
+		p.statuses = append(p.statuses, status)
+	}
+
+	return p
+}
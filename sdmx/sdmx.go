@@ -0,0 +1,375 @@
+// package sdmx reads and writes SDMX data messages, the format of the European statistical
+// ecosystem: SDMX-ML, as generic or structure-specific data, and SDMX-JSON. Series are exported
+// with the dimensions FREQ and SERIES_CODE, and their metadata as the attributes TITLE,
+// UNIT_MEASURE, DECIMALS and SOURCE_AGENCY. Series read from files of other publishers, such as
+// Eurostat or the ECB, are identified by their series key.
+package sdmx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// ids of the concepts bdsicego maps to the fields of a serie
+const (
+	dimensionFrequency  = "FREQ"
+	dimensionSerieCode  = "SERIES_CODE"
+	dimensionTime       = "TIME_PERIOD"
+	attributeTitle      = "TITLE"
+	attributeTitleCompl = "TITLE_COMPL"
+	attributeUnit       = "UNIT_MEASURE"
+	attributeUnitMult   = "UNIT_MULT"
+	attributeDecimals   = "DECIMALS"
+	attributeSource     = "SOURCE_AGENCY"
+	attributeStatus     = "OBS_STATUS"
+	measureValue        = "OBS_VALUE"
+)
+
+// id of the data structure of the messages written by bdsicego, and of their sender
+const (
+	StructureID = "BDSICE"
+	SenderID    = "BDSICEGO"
+)
+
+// observation statuses of the SDMX code list CL_OBS_STATUS that bdsicego tells apart: missing
+// observations are MissingValue in a serie, and the rest are normal values
+const (
+	statusNormal  = "A"
+	statusMissing = "M"
+)
+
+// ErrUnknownFormat is returned by Read for content that is neither SDMX-ML nor SDMX-JSON
+var ErrUnknownFormat = errors.New("not an SDMX-ML or SDMX-JSON data message")
+
+// codes of the SDMX frequencies, by the frequency of series.BDSICESerie
+var frequencyCodes = map[int]string{
+	1:   "A",
+	2:   "S",
+	4:   "Q",
+	12:  "M",
+	52:  "W",
+	365: "D",
+}
+
+// returns the SDMX code of frequency
+func frequencyCode(frequency int) string {
+	if code, ok := frequencyCodes[frequency]; ok {
+		return code
+	}
+	return "N" // not applicable
+}
+
+// returns the frequency of the SDMX code, or 0 if it is unknown
+func frequencyFromCode(code string) int {
+	code = strings.ToUpper(code)
+	// business days are daily as far as bdsicego is concerned
+	if code == "B" {
+		code = "D"
+	}
+
+	for frequency, c := range frequencyCodes {
+		if c == code {
+			return frequency
+		}
+	}
+	return 0
+}
+
+// returns the SDMX time period of an observation dated t in a serie of frequency. Quarters and
+// semesters are dated at the start of their last month in BDSICE, and so are told apart by month.
+func formatPeriod(t time.Time, frequency int) string {
+	switch frequency {
+	case 1:
+		return strconv.Itoa(t.Year())
+	case 2:
+		return fmt.Sprintf("%d-S%d", t.Year(), (int(t.Month())-1)/6+1)
+	case 4:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	case 12:
+		return t.Format("2006-01")
+	case 52:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// returns the date of an observation of the SDMX time period, dated as BDSICE does: quarters and
+// semesters at the start of their last month, weeks on their Monday. The frequency of the period
+// is returned too, as told by its format.
+func parsePeriod(period string) (time.Time, int, error) {
+	period = strings.TrimSpace(period)
+
+	// periods given as dates and times, as some publishers do
+	if len(period) > 10 && period[10] == 'T' {
+		period = period[:10]
+	}
+
+	if year, err := strconv.Atoi(period); err == nil && len(period) == 4 {
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), 1, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", period); err == nil {
+		return t, 365, nil
+	}
+	if t, err := time.Parse("2006-01", period); err == nil {
+		return t, 12, nil
+	}
+
+	parts := strings.SplitN(period, "-", 2)
+	if len(parts) == 2 && len(parts[1]) >= 2 {
+		year, yearErr := strconv.Atoi(parts[0])
+		n, nErr := strconv.Atoi(parts[1][1:])
+		if yearErr == nil && nErr == nil {
+			switch strings.ToUpper(parts[1][:1]) {
+			case "A":
+				return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC), 1, nil
+			case "S", "B":
+				if n >= 1 && n <= 2 {
+					return time.Date(year, time.Month(n*6), 1, 0, 0, 0, 0, time.UTC), 2, nil
+				}
+			case "Q":
+				if n >= 1 && n <= 4 {
+					return time.Date(year, time.Month(n*3), 1, 0, 0, 0, 0, time.UTC), 4, nil
+				}
+			case "M":
+				if n >= 1 && n <= 12 {
+					return time.Date(year, time.Month(n), 1, 0, 0, 0, 0, time.UTC), 12, nil
+				}
+			case "W":
+				if n >= 1 && n <= 53 {
+					// the 4th of January is always in the first week of its ISO year
+					jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+					monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+7*(n-1))
+					return monday, 52, nil
+				}
+			}
+		}
+	}
+
+	return time.Time{}, 0, fmt.Errorf("unknown time period %q", period)
+}
+
+// returns the value of an observation as written in SDMX, NaN for missing observations, and its
+// status
+func formatValue(value float64, decimals int) (string, string) {
+	if value == series.MissingValue || math.IsNaN(value) {
+		return "NaN", statusMissing
+	}
+	if decimals < 0 {
+		decimals = -1
+	}
+	return strconv.FormatFloat(value, 'f', decimals, 64), statusNormal
+}
+
+// a serie being read from a message: its key, attributes and observations
+type parsedSerie struct {
+	dataflow   string
+	dimensions []keyValue // in the order of the key
+	attributes map[string]string
+	names      []string // names of the values of the dimensions, where the message gives them
+	periods    []string
+	values     []float64
+	statuses   []string
+}
+
+type keyValue struct {
+	id    string
+	value string
+}
+
+// prefixes the series key with the dataflow of the message, as in EXR.M.USD.EUR.SP00.A, unless the
+// serie was exported by bdsicego
+func (p *parsedSerie) prefix(dataflow string) {
+	for _, d := range p.dimensions {
+		if d.id == dimensionSerieCode {
+			return
+		}
+	}
+	p.dataflow = dataflow
+}
+
+// turns a parsed serie into a BDSICESerie. The code of the serie is the value of SERIES_CODE for
+// series exported by bdsicego, and the series key, its dimension values joined by dots, otherwise.
+// Statuses other than normal and missing are kept in the notes of the serie.
+func (p *parsedSerie) serie() (*series.BDSICESerie, error) {
+	s := &series.BDSICESerie{Active: true, Public: true}
+
+	var key []string
+	for _, d := range p.dimensions {
+		key = append(key, d.value)
+		switch {
+		case d.id == dimensionSerieCode:
+			s.SerieCode = d.value
+		case strings.EqualFold(d.id, dimensionFrequency):
+			s.Frequency = frequencyFromCode(d.value)
+		case strings.EqualFold(d.id, "UNIT") || strings.EqualFold(d.id, attributeUnit):
+			s.Units = d.value
+		}
+	}
+	if s.SerieCode == "" {
+		if p.dataflow != "" {
+			key = append([]string{p.dataflow}, key...)
+		}
+		s.SerieCode = strings.Join(key, ".")
+	}
+
+	s.Title = p.attributes[attributeTitle]
+	if s.Title == "" {
+		s.Title = p.attributes[attributeTitleCompl]
+	}
+	if s.Title == "" && len(p.names) > 0 {
+		s.Title = strings.Join(p.names, ", ")
+	}
+	if s.Title == "" {
+		s.Title = s.SerieCode
+	}
+
+	if unit := p.attributes[attributeUnit]; unit != "" {
+		s.Units = unit
+	} else if unit := p.attributes["UNIT"]; unit != "" {
+		s.Units = unit
+	}
+	if mult := p.attributes[attributeUnitMult]; mult != "" && mult != "0" {
+		s.Units = fmt.Sprintf("%s (x10^%s)", s.Units, mult)
+	}
+
+	s.Source = p.attributes[attributeSource]
+	if decimals, err := strconv.Atoi(p.attributes[attributeDecimals]); err == nil {
+		s.Decimals = decimals
+	}
+
+	// observations may come in any order
+	order := make([]int, len(p.periods))
+	dates := make([]time.Time, len(p.periods))
+	for i, period := range p.periods {
+		date, frequency, err := parsePeriod(period)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", s.SerieCode, err.Error())
+		}
+		if s.Frequency == 0 {
+			s.Frequency = frequency
+		}
+		dates[i] = date
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return dates[order[i]].Before(dates[order[j]]) })
+
+	flagged := map[string][]string{}
+	var statuses []string
+	for _, i := range order {
+		value := p.values[i]
+		status := p.statuses[i]
+
+		if math.IsNaN(value) || status == statusMissing {
+			value = series.MissingValue
+			s.ContainsNan = true
+		} else if status != "" && status != statusNormal {
+			if _, ok := flagged[status]; !ok {
+				statuses = append(statuses, status)
+			}
+			flagged[status] = append(flagged[status], p.periods[i])
+		}
+
+		s.Observations.Dates = append(s.Observations.Dates, dates[i])
+		s.Observations.Values = append(s.Observations.Values, value)
+	}
+
+	for _, status := range statuses {
+		s.Notes = append(s.Notes, fmt.Sprintf("%s %s: %s", attributeStatus, status, strings.Join(flagged[status], ", ")))
+	}
+
+	s.NumberOfObservations = len(s.Observations.Dates)
+	if s.NumberOfObservations > 0 {
+		start := s.Observations.Dates[0]
+		end := s.Observations.Dates[s.NumberOfObservations-1]
+		s.Start, s.End = &start, &end
+	}
+
+	return s, nil
+}
+
+// returns the value of an observation read from a message, NaN if it is missing
+func parseValue(value string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "NaN") {
+		return math.NaN()
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+// Read reads the series of an SDMX-ML or SDMX-JSON data message, telling them apart by content
+func Read(r io.Reader) ([]*series.BDSICESerie, error) {
+	br := bufio.NewReader(r)
+
+	// the first character of the message tells XML from JSON
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return nil, fmt.Errorf("sdmx.Read(): %w", ErrUnknownFormat)
+		}
+		// whitespace and byte order marks may come before it
+		if unicode.IsSpace(c) || c == '\uFEFF' {
+			continue
+		}
+		br.UnreadRune()
+
+		switch c {
+		case '<':
+			seriesRead, err := readML(br)
+			if err != nil {
+				return nil, fmt.Errorf("sdmx.Read(): %w", err)
+			}
+			return seriesRead, nil
+		case '{':
+			seriesRead, err := readJSON(br)
+			if err != nil {
+				return nil, fmt.Errorf("sdmx.Read(): %w", err)
+			}
+			return seriesRead, nil
+		default:
+			return nil, fmt.Errorf("sdmx.Read(): %w", ErrUnknownFormat)
+		}
+	}
+}
+
+// ReadFile reads the series of the SDMX data message in filePath
+func ReadFile(filePath string) ([]*series.BDSICESerie, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("sdmx.ReadFile(): %w", err)
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// turns parsed series into BDSICESeries
+func convert(parsed []*parsedSerie) ([]*series.BDSICESerie, error) {
+	var converted []*series.BDSICESerie
+	for _, p := range parsed {
+		s, err := p.serie()
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, s)
+	}
+	return converted, nil
+}
@@ -0,0 +1,246 @@
+// Testing file for bdsicego/sdmx
+// We test that exported series are read back as they were, in both formats, and the reading of
+// structure-specific and SDMX-JSON messages like those of the ECB and Eurostat
+
+package sdmx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+// returns a serie of frequency with count observations, the second one missing
+func testSerie(code string, frequency int, count int) *series.BDSICESerie {
+	s := &series.BDSICESerie{
+		SerieCode:   code,
+		Title:       "TITULO DE " + code,
+		Units:       "Porcentaje",
+		Source:      "Banco de España",
+		Decimals:    2,
+		Frequency:   frequency,
+		Public:      true,
+		Active:      true,
+		ContainsNan: true,
+	}
+
+	for i := 0; i < count; i++ {
+		var date time.Time
+		switch frequency {
+		case 1:
+			date = time.Date(2000+i, time.January, 1, 0, 0, 0, 0, time.UTC)
+		case 4:
+			date = time.Date(2000, time.Month(3*(i+1)), 1, 0, 0, 0, 0, time.UTC)
+		default:
+			date = time.Date(2000, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC)
+		}
+
+		value := 1.5 + float64(i)
+		if i == 1 {
+			value = series.MissingValue
+		}
+
+		s.Observations.Dates = append(s.Observations.Dates, date)
+		s.Observations.Values = append(s.Observations.Values, value)
+	}
+
+	start := s.Observations.Dates[0]
+	end := s.Observations.Dates[count-1]
+	s.Start, s.End = &start, &end
+	s.NumberOfObservations = count
+
+	return s
+}
+
+// checks that got is the serie that was written
+func checkSerie(t *testing.T, got *series.BDSICESerie, want *series.BDSICESerie) {
+	t.Helper()
+
+	if got.SerieCode != want.SerieCode || got.Title != want.Title || got.Units != want.Units ||
+		got.Source != want.Source || got.Decimals != want.Decimals || got.Frequency != want.Frequency {
+		t.Errorf("serie %s read as %+v", want.SerieCode, got)
+	}
+	if got.ContainsNan != want.ContainsNan || got.NumberOfObservations != want.NumberOfObservations {
+		t.Errorf("serie %s: ContainsNan %v and %d observations, want %v and %d", want.SerieCode,
+			got.ContainsNan, got.NumberOfObservations, want.ContainsNan, want.NumberOfObservations)
+	}
+	for i := range want.Observations.Dates {
+		if i >= len(got.Observations.Dates) {
+			break
+		}
+		if !got.Observations.Dates[i].Equal(want.Observations.Dates[i]) || got.Observations.Values[i] != want.Observations.Values[i] {
+			t.Errorf("serie %s: observation %d is %s %f, want %s %f", want.SerieCode, i,
+				got.Observations.Dates[i], got.Observations.Values[i],
+				want.Observations.Dates[i], want.Observations.Values[i])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	written := []*series.BDSICESerie{
+		testSerie("D_1NBAF472", 12, 14),
+		testSerie("D_TRIMESTRAL", 4, 4),
+		testSerie("D_ANUAL", 1, 3),
+	}
+
+	writers := map[string]func(*bytes.Buffer) error{
+		"ML":   func(b *bytes.Buffer) error { return WriteML(b, written) },
+		"JSON": func(b *bytes.Buffer) error { return WriteJSON(b, written) },
+	}
+
+	for format, write := range writers {
+		var b bytes.Buffer
+		if err := write(&b); err != nil {
+			t.Fatalf("Write%s(): %s", format, err.Error())
+		}
+
+		read, err := Read(&b)
+		if err != nil {
+			t.Fatalf("Read() of %s: %s", format, err.Error())
+		}
+		if len(read) != len(written) {
+			t.Fatalf("Read() of %s: %d series, want %d", format, len(read), len(written))
+		}
+
+		byCode := map[string]*series.BDSICESerie{}
+		for _, s := range read {
+			byCode[s.SerieCode] = s
+		}
+		for _, want := range written {
+			got, ok := byCode[want.SerieCode]
+			if !ok {
+				t.Errorf("Read() of %s: serie %s missing", format, want.SerieCode)
+				continue
+			}
+			checkSerie(t, got, want)
+		}
+	}
+}
+
+const structureSpecific = `<?xml version="1.0" encoding="UTF-8"?>
+<message:StructureSpecificData xmlns:message="http://www.sdmx.org/resources/sdmxml/schemas/v2_1/message" xmlns:ss="http://www.sdmx.org/resources/sdmxml/schemas/v2_1/data/structurespecific" xmlns:common="http://www.sdmx.org/resources/sdmxml/schemas/v2_1/common" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <message:Header>
+    <message:ID>IREF000001</message:ID>
+    <message:Structure structureID="ECB_EXR1" dimensionAtObservation="TIME_PERIOD">
+      <common:StructureUsage><Ref agencyID="ECB" id="EXR" version="1.0"/></common:StructureUsage>
+    </message:Structure>
+  </message:Header>
+  <message:DataSet ss:structureRef="ECB_EXR1" xsi:type="ns1:DataSetType">
+    <Series FREQ="Q" CURRENCY="USD" CURRENCY_DENOM="EUR" EXR_TYPE="SP00" EXR_SUFFIX="A" TITLE="US dollar/Euro" UNIT="USD" UNIT_MULT="0" DECIMALS="4" SOURCE_AGENCY="4F0">
+      <Obs TIME_PERIOD="2020-Q2" OBS_VALUE="1.1014" OBS_STATUS="A"/>
+      <Obs TIME_PERIOD="2020-Q1" OBS_VALUE="1.1027" OBS_STATUS="A"/>
+      <Obs TIME_PERIOD="2020-Q3" OBS_VALUE="NaN" OBS_STATUS="M"/>
+      <Obs TIME_PERIOD="2020-Q4" OBS_VALUE="1.1932" OBS_STATUS="E"/>
+    </Series>
+  </message:DataSet>
+</message:StructureSpecificData>`
+
+func TestReadStructureSpecific(t *testing.T) {
+	read, err := Read(strings.NewReader(structureSpecific))
+	if err != nil {
+		t.Fatalf("Read(): %s", err.Error())
+	}
+	if len(read) != 1 {
+		t.Fatalf("Read(): %d series, want 1", len(read))
+	}
+
+	s := read[0]
+	if s.SerieCode != "EXR.Q.USD.EUR.SP00.A" || s.Title != "US dollar/Euro" || s.Units != "USD" ||
+		s.Frequency != 4 || s.Decimals != 4 || s.Source != "4F0" {
+		t.Errorf("Read(): %+v", s)
+	}
+
+	wantDates := []time.Time{
+		time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.September, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+	}
+	wantValues := []float64{1.1027, 1.1014, series.MissingValue, 1.1932}
+	for i := range wantDates {
+		if !s.Observations.Dates[i].Equal(wantDates[i]) || s.Observations.Values[i] != wantValues[i] {
+			t.Errorf("observation %d is %s %f, want %s %f", i, s.Observations.Dates[i], s.Observations.Values[i], wantDates[i], wantValues[i])
+		}
+	}
+	if !s.ContainsNan {
+		t.Errorf("ContainsNan is false with a missing observation")
+	}
+	if len(s.Notes) != 1 || s.Notes[0] != "OBS_STATUS E: 2020-Q4" {
+		t.Errorf("Notes are %q", s.Notes)
+	}
+}
+
+const eurostatJSON = `{
+  "meta": {"id": "IREF"},
+  "data": {
+    "dataSets": [{"series": {
+      "0:0:0": {"attributes": [], "observations": {"0": [110.5, null], "1": [111.2, 0], "2": [null, null]}}
+    }}],
+    "structures": [{
+      "dimensions": {
+        "series": [
+          {"id": "freq", "values": [{"id": "M", "name": {"en": "Monthly"}}]},
+          {"id": "unit", "values": [{"id": "I15", "name": {"en": "Index, 2015=100"}}]},
+          {"id": "geo", "values": [{"id": "ES", "name": {"en": "Spain"}}]}
+        ],
+        "observation": [{"id": "TIME_PERIOD", "values": [{"id": "2020-01"}, {"id": "2020-02"}, {"id": "2020-03"}]}]
+      },
+      "attributes": {"series": [], "observation": [{"id": "OBS_FLAG", "values": [{"id": "p", "name": {"en": "provisional"}}]}]}
+    }]
+  }
+}`
+
+func TestReadJSON(t *testing.T) {
+	read, err := Read(strings.NewReader(eurostatJSON))
+	if err != nil {
+		t.Fatalf("Read(): %s", err.Error())
+	}
+	if len(read) != 1 {
+		t.Fatalf("Read(): %d series, want 1", len(read))
+	}
+
+	s := read[0]
+	if s.SerieCode != "M.I15.ES" || s.Title != "Monthly, Index, 2015=100, Spain" || s.Units != "I15" || s.Frequency != 12 {
+		t.Errorf("Read(): %+v", s)
+	}
+	if s.NumberOfObservations != 3 || s.Observations.Values[2] != series.MissingValue || !s.ContainsNan {
+		t.Errorf("observations read as %+v", s.Observations)
+	}
+	if len(s.Notes) != 1 || s.Notes[0] != "OBS_STATUS P: 2020-02" {
+		t.Errorf("Notes are %q", s.Notes)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	periods := map[string]time.Time{
+		"2020":       time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"2020-A1":    time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"2020-S2":    time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+		"2020-Q3":    time.Date(2020, time.September, 1, 0, 0, 0, 0, time.UTC),
+		"2020-M07":   time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC),
+		"2020-07":    time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC),
+		"2020-W01":   time.Date(2019, time.December, 30, 0, 0, 0, 0, time.UTC),
+		"2020-07-15": time.Date(2020, time.July, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	for period, want := range periods {
+		got, frequency, err := parsePeriod(period)
+		if err != nil {
+			t.Errorf("parsePeriod(%q): %s", period, err.Error())
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("parsePeriod(%q) = %s, want %s", period, got, want)
+		}
+		if back := formatPeriod(got, frequency); back != period && period != "2020-A1" && period != "2020-M07" {
+			t.Errorf("formatPeriod(parsePeriod(%q)) = %q", period, back)
+		}
+	}
+
+	if _, _, err := parsePeriod("2020-Q5"); err == nil {
+		t.Errorf("parsePeriod(\"2020-Q5\") returned no error")
+	}
+}
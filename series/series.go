@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/fabiansalazares/bdsicego/internal/config"
@@ -124,9 +126,62 @@ func (s BDSICESerie) Max() (float64, time.Time) {
 }
 
 // loads the serie corresponding to serieCode in dbLocalPath and returns a pointer to the BDSICESerie
-// object.
+// object. Series are read from the binary store of the database, which is kept open across calls
+// until it is replaced. Databases that have not been converted yet are read from their JSON files.
 func Load(configuration *config.BDSICEConfig, serieCode string) (*BDSICESerie, error) {
 
+	storeFilePath := path.Join(configuration.DatabaseLocalPath, StoreFileName)
+
+	if info, err := os.Stat(storeFilePath); err == nil {
+		if configuration.Debug {
+			fmt.Printf("Loading BDSICESerie %s from %s\n", serieCode, storeFilePath)
+		}
+
+		serie, err := loadFromStore(storeFilePath, info, serieCode)
+		if err == nil {
+			return serie, nil
+		} else if err != ErrNotInStore {
+			return nil, fmt.Errorf("series: Load(): %s", err.Error())
+		}
+	}
+
+	return loadJSON(configuration, serieCode)
+}
+
+// the store last opened by Load, kept open so that loading many series reads its index once
+var openedStore struct {
+	sync.Mutex
+	filePath string
+	info     os.FileInfo
+	store    *Store
+}
+
+// decodes a serie from the store at filePath, opening the store again only if it is not the one
+// opened last or the file has been replaced since, as updates do
+func loadFromStore(filePath string, info os.FileInfo, serieCode string) (*BDSICESerie, error) {
+	openedStore.Lock()
+	defer openedStore.Unlock()
+
+	if openedStore.store == nil || openedStore.filePath != filePath || !os.SameFile(openedStore.info, info) ||
+		!openedStore.info.ModTime().Equal(info.ModTime()) || openedStore.info.Size() != info.Size() {
+		st, err := OpenStore(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		// series decoded from the former store remain valid once it is closed
+		if openedStore.store != nil {
+			openedStore.store.Close()
+		}
+		openedStore.filePath, openedStore.info, openedStore.store = filePath, info, st
+	}
+
+	return openedStore.store.Get(serieCode)
+}
+
+// loads a serie from its JSON file, as written by former versions of bdsicego
+func loadJSON(configuration *config.BDSICEConfig, serieCode string) (*BDSICESerie, error) {
+
 	var serie BDSICESerie
 
 	serieJsonFilePath := path.Join(configuration.DatabaseLocalPath, fmt.Sprintf("%s.json", serieCode))
@@ -148,3 +203,21 @@ func Load(configuration *config.BDSICEConfig, serieCode string) (*BDSICESerie, e
 	return &serie, nil
 
 }
+
+// loads all the series in the binary store of the database at once, sorted by code. This is much
+// faster than calling Load for each serie.
+func LoadAll(configuration *config.BDSICEConfig) ([]*BDSICESerie, error) {
+
+	st, err := OpenStore(path.Join(configuration.DatabaseLocalPath, StoreFileName))
+	if err != nil {
+		return nil, fmt.Errorf("series: LoadAll(): %s", err.Error())
+	}
+	defer st.Close()
+
+	all, err := st.All()
+	if err != nil {
+		return nil, fmt.Errorf("series: LoadAll(): %s", err.Error())
+	}
+
+	return all, nil
+}
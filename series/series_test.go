@@ -1,13 +1,18 @@
 // Testing file for bdsicego/series
-// We only test function Load() because all the other functions are currently too simple to fail
+// We test function Load() and the binary store, because all the other functions are currently too simple to fail
 
 package series
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fabiansalazares/bdsicego/internal/config"
 )
@@ -40,3 +45,232 @@ func TestLoad(t *testing.T) {
 	}
 
 }
+
+// returns a serie with count monthly observations starting at January 2000
+func testSerie(code string, count int) *BDSICESerie {
+	start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	s := &BDSICESerie{
+		SerieCode:            code,
+		Title:                "EPA. OCUPADOS. TOTAL NACIONAL " + code,
+		Units:                " MILES DE PERSONAS",
+		Source:               " INE",
+		Notes:                []string{"NOTA 1\r\n", "NOTA 2\r\n"},
+		Decimals:             1,
+		Frequency:            12,
+		Start:                &start,
+		NumberOfObservations: count,
+		Public:               true,
+		Active:               true,
+	}
+
+	for i := 0; i < count; i++ {
+		s.Observations.Dates = append(s.Observations.Dates, start.AddDate(0, i, 0))
+		s.Observations.Values = append(s.Observations.Values, 100+float64(i)*0.25)
+	}
+
+	end := s.Observations.Dates[count-1]
+	s.End = &end
+
+	return s
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-store")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	storePath := filepath.Join(dir, StoreFileName)
+
+	withMissing := testSerie("100002", 24)
+	withMissing.Observations.Values[3] = MissingValue
+	withMissing.ContainsNan = true
+
+	written := []*BDSICESerie{testSerie("100001", 12), withMissing}
+	if err := WriteStore(storePath, written); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+
+	// replace a serie, add a new one and remove another
+	updated := testSerie("100002", 36)
+	if err := UpdateStore(storePath, []*BDSICESerie{updated, testSerie("100003", 6)}, "100001"); err != nil {
+		t.Fatalf("UpdateStore(): %s", err.Error())
+	}
+
+	st, err := OpenStore(storePath)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err.Error())
+	}
+	defer st.Close()
+
+	if codes := st.Codes(); !reflect.DeepEqual(codes, []string{"100002", "100003"}) {
+		t.Errorf("Codes(): expected [100002 100003], got %v", codes)
+	}
+
+	got, err := st.Get("100002")
+	if err != nil {
+		t.Fatalf("Get(): %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, updated) {
+		t.Errorf("Get(): serie does not round trip:\nexpected %+v\ngot      %+v", updated, got)
+	}
+
+	if _, err := st.Get("100001"); err != ErrNotInStore {
+		t.Errorf("Get(): expected ErrNotInStore for a removed serie, got %v", err)
+	}
+
+	// missing observations keep the JSON sentinel value
+	if err := WriteStore(storePath, []*BDSICESerie{withMissing}); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+	st2, err := OpenStore(storePath)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err.Error())
+	}
+	defer st2.Close()
+
+	got, err = st2.Get("100002")
+	if err != nil {
+		t.Fatalf("Get(): %s", err.Error())
+	}
+	if !reflect.DeepEqual(got, withMissing) {
+		t.Errorf("Get(): serie with missing values does not round trip")
+	}
+}
+
+func TestLoadFromStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-store")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	configuration := &config.BDSICEConfig{DatabaseLocalPath: dir}
+	storePath := filepath.Join(dir, StoreFileName)
+	if err := WriteStore(storePath, []*BDSICESerie{testSerie("100001", 12), testSerie("100002", 12)}); err != nil {
+		t.Fatalf("WriteStore(): %s", err.Error())
+	}
+
+	// the store is opened once for every serie loaded from it
+	if _, err := Load(configuration, "100001"); err != nil {
+		t.Fatalf("Load(): %s", err.Error())
+	}
+	opened := openedStore.store
+	if _, err := Load(configuration, "100002"); err != nil || openedStore.store != opened {
+		t.Errorf("Load(): expected the store to be kept open, got %v", err)
+	}
+
+	// and opened again once it is replaced
+	if err := UpdateStore(storePath, []*BDSICESerie{testSerie("100001", 24)}); err != nil {
+		t.Fatalf("UpdateStore(): %s", err.Error())
+	}
+	serie, err := Load(configuration, "100001")
+	if err != nil {
+		t.Fatalf("Load(): %s", err.Error())
+	}
+	if openedStore.store == opened || len(serie.Observations.Values) != 24 {
+		t.Errorf("Load(): expected the updated serie, got %d observations", len(serie.Observations.Values))
+	}
+}
+
+func TestStoreVersionSeconds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-store")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// a store of version 1, whose index holds modification times in seconds
+	storePath := filepath.Join(dir, StoreFileName)
+	written := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := testSerie("100001", 12)
+	if err := writeRecords(storePath, []pendingRecord{{code: s.SerieCode, record: encodeRecord(s), modified: written.Unix()}}); err != nil {
+		t.Fatalf("writeRecords(): %s", err.Error())
+	}
+	data, err := ioutil.ReadFile(storePath)
+	if err != nil {
+		t.Fatalf("ReadFile(): %s", err.Error())
+	}
+	binary.LittleEndian.PutUint16(data[4:6], storeVersionSeconds)
+	if err := ioutil.WriteFile(storePath, data, 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err.Error())
+	}
+
+	// its times are read as they were written, and kept when it is updated to the current version
+	if err := UpdateStore(storePath, []*BDSICESerie{testSerie("100002", 6)}); err != nil {
+		t.Fatalf("UpdateStore(): %s", err.Error())
+	}
+
+	st, err := OpenStore(storePath)
+	if err != nil {
+		t.Fatalf("OpenStore(): %s", err.Error())
+	}
+	defer st.Close()
+
+	if version := binary.LittleEndian.Uint16(st.data[4:6]); version != storeVersion {
+		t.Errorf("UpdateStore(): expected a store of version %d, got %d", storeVersion, version)
+	}
+	if modified, _ := st.Modified("100001"); !modified.Equal(written) {
+		t.Errorf("Modified(): expected %s, got %s", written, modified)
+	}
+	if modified, _ := st.Modified("100002"); time.Since(modified) > time.Minute || time.Since(modified) < 0 {
+		t.Errorf("Modified(): expected the time of the update, got %s", modified)
+	}
+}
+
+func TestDecodeCorruptRecord(t *testing.T) {
+	// a serie without observations, whose record ends with its dates count, values count and unit
+	record := encodeRecord(&BDSICESerie{SerieCode: "100001", Title: "EPA. OCUPADOS"})
+	unit := record[len(record)-1]
+	record = record[:len(record)-3]
+
+	var scratch [binary.MaxVarintLen64]byte
+	for _, counts := range [][2]uint64{{1 << 40, 0}, {0, 1 << 40}, {0, 1<<61 + 1}} {
+		corrupt := append([]byte(nil), record...)
+		corrupt = append(corrupt, scratch[:binary.PutUvarint(scratch[:], counts[0])]...)
+		corrupt = append(corrupt, scratch[:binary.PutUvarint(scratch[:], counts[1])]...)
+		corrupt = append(corrupt, unit)
+
+		if _, err := decodeRecord(corrupt); err == nil {
+			t.Errorf("decodeRecord(): expected an error for %d dates and %d values", counts[0], counts[1])
+		}
+	}
+}
+
+func TestConvertJSONDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bdsicego-convert")
+	if err != nil {
+		t.Fatalf("TempDir(): %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	original := testSerie("100004", 48)
+	content, err := json.MarshalIndent(original, "", "   ")
+	if err != nil {
+		t.Fatalf("MarshalIndent(): %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "100004.json"), content, 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err.Error())
+	}
+
+	converted, err := ConvertJSONDirectory(dir, true)
+	if err != nil {
+		t.Fatalf("ConvertJSONDirectory(): %s", err.Error())
+	}
+	if converted != 1 {
+		t.Errorf("ConvertJSONDirectory(): expected 1 serie converted, got %d", converted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "100004.json")); !os.IsNotExist(err) {
+		t.Errorf("ConvertJSONDirectory(): JSON file was not removed")
+	}
+
+	serie, err := Load(&config.BDSICEConfig{DatabaseLocalPath: dir}, "100004")
+	if err != nil {
+		t.Fatalf("Load(): %s", err.Error())
+	}
+	if !serie.Start.Equal(*original.Start) || !reflect.DeepEqual(serie.Observations.Values, original.Observations.Values) {
+		t.Errorf("Load(): converted serie differs from the original")
+	}
+}
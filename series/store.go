@@ -0,0 +1,632 @@
+package series
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// name of the file holding the series of a database in the binary store format
+const StoreFileName = "series.bds"
+
+// MissingValue is the value given to missing observations ("OM" and "ND" in .xer files), since
+// JSON cannot represent NaN. See BDSICESerie.ContainsNan.
+const MissingValue = -99999999.999999
+
+// Binary store layout. All integers are little endian.
+//
+//	header:  magic "BDSS" | version uint16 | reserved uint16 | count uint32 | index offset uint64
+//	records: one per serie, see encodeRecord
+//	index:   count entries sorted by code:
+//	         code length uint16 | code | record offset uint64 | record length uint32 | modified int64 (nanoseconds since epoch)
+//
+// Stores of version 1 have the same layout, with modified in seconds since epoch. They are still
+// read, and are written as the current version when updated.
+const (
+	storeMagic      = "BDSS"
+	storeVersion    = 2
+	storeHeaderSize = 4 + 2 + 2 + 4 + 8
+)
+
+// version of the stores whose index holds modification times in seconds
+const storeVersionSeconds = 1
+
+// units in which the dates of a record are delta-encoded
+const (
+	periodDays    = 0 // every date falls at midnight UTC, which is the case for all the .xer series
+	periodSeconds = 1
+)
+
+// bits of the flags byte of a record
+const (
+	flagPublic = 1 << iota
+	flagPrivate
+	flagActive
+	flagContainsNan
+	flagStart
+	flagEnd
+)
+
+// ErrNotInStore is returned by Store.Get when the store does not hold the requested serie
+var ErrNotInStore = errors.New("serie not found in store")
+
+// position of a record in the store
+type storeEntry struct {
+	offset   uint64
+	length   uint32
+	modified int64
+}
+
+// Store gives random access to the series of a binary store file. The file is memory-mapped where
+// the platform allows it, so opening a store only reads its index. A Store must be closed
+// after use, and the series it returns remain valid after closing it.
+type Store struct {
+	data    []byte
+	release func() error
+	entries map[string]storeEntry
+	codes   []string
+}
+
+// OpenStore opens the binary store at filePath and reads its index
+func OpenStore(filePath string) (*Store, error) {
+	data, release, err := mapFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("series.OpenStore(): %s", err.Error())
+	}
+
+	st := &Store{data: data, release: release}
+
+	err = st.readIndex()
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("series.OpenStore(): %s: %s", filePath, err.Error())
+	}
+
+	return st, nil
+}
+
+// parses the header and the index of the store
+func (st *Store) readIndex() error {
+	if len(st.data) < storeHeaderSize || string(st.data[:4]) != storeMagic {
+		return fmt.Errorf("not a series store")
+	}
+
+	version := binary.LittleEndian.Uint16(st.data[4:6])
+	if version != storeVersion && version != storeVersionSeconds {
+		return fmt.Errorf("unsupported store version %d", version)
+	}
+
+	count := binary.LittleEndian.Uint32(st.data[8:12])
+	indexOffset := binary.LittleEndian.Uint64(st.data[12:20])
+	if indexOffset > uint64(len(st.data)) {
+		return fmt.Errorf("index offset out of range")
+	}
+
+	st.entries = make(map[string]storeEntry, count)
+	st.codes = make([]string, 0, count)
+
+	index := st.data[indexOffset:]
+	for i := uint32(0); i < count; i++ {
+		if len(index) < 2 {
+			return fmt.Errorf("truncated index")
+		}
+		codeLength := int(binary.LittleEndian.Uint16(index))
+		if len(index) < 2+codeLength+8+4+8 {
+			return fmt.Errorf("truncated index")
+		}
+
+		code := string(index[2 : 2+codeLength])
+		index = index[2+codeLength:]
+
+		entry := storeEntry{
+			offset:   binary.LittleEndian.Uint64(index),
+			length:   binary.LittleEndian.Uint32(index[8:]),
+			modified: int64(binary.LittleEndian.Uint64(index[12:])),
+		}
+		index = index[20:]
+
+		if version == storeVersionSeconds {
+			entry.modified *= int64(time.Second)
+		}
+
+		if entry.offset+uint64(entry.length) > indexOffset {
+			return fmt.Errorf("record of serie %s out of range", code)
+		}
+
+		st.entries[code] = entry
+		st.codes = append(st.codes, code)
+	}
+
+	return nil
+}
+
+// Close releases the memory mapping of the store
+func (st *Store) Close() error {
+	if st.release == nil {
+		return nil
+	}
+
+	err := st.release()
+	st.release = nil
+	st.data = nil
+
+	return err
+}
+
+// Codes returns the codes of the series in the store, sorted
+func (st *Store) Codes() []string {
+	return st.codes
+}
+
+// Has reports whether the store holds the serie identified by code
+func (st *Store) Has(code string) bool {
+	_, ok := st.entries[code]
+	return ok
+}
+
+// Modified returns the time at which the serie identified by code was written to the store
+func (st *Store) Modified(code string) (time.Time, bool) {
+	entry, ok := st.entries[code]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, entry.modified), true
+}
+
+// Get decodes the serie identified by code
+func (st *Store) Get(code string) (*BDSICESerie, error) {
+	entry, ok := st.entries[code]
+	if !ok {
+		return nil, ErrNotInStore
+	}
+
+	serie, err := decodeRecord(st.data[entry.offset : entry.offset+uint64(entry.length)])
+	if err != nil {
+		return nil, fmt.Errorf("series.Store.Get(): %s: %s", code, err.Error())
+	}
+
+	return serie, nil
+}
+
+// All decodes every serie in the store, sorted by code
+func (st *Store) All() ([]*BDSICESerie, error) {
+	all := make([]*BDSICESerie, 0, len(st.codes))
+
+	for _, code := range st.codes {
+		serie, err := st.Get(code)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, serie)
+	}
+
+	return all, nil
+}
+
+// encodes a serie as a record of the store:
+//
+//	flags byte | metadata strings and integers as varints | start and end dates if flagged |
+//	number of observations | date unit byte | first date and deltas as varints |
+//	missing mask, one bit per observation | values as float64
+func encodeRecord(s *BDSICESerie) []byte {
+	var buf bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(scratch[:], v)
+		buf.Write(scratch[:n])
+	}
+	putVarint := func(v int64) {
+		n := binary.PutVarint(scratch[:], v)
+		buf.Write(scratch[:n])
+	}
+	putString := func(str string) {
+		putUvarint(uint64(len(str)))
+		buf.WriteString(str)
+	}
+	putStrings := func(strs []string) {
+		putUvarint(uint64(len(strs)))
+		for _, str := range strs {
+			putString(str)
+		}
+	}
+
+	var flags byte
+	if s.Public {
+		flags |= flagPublic
+	}
+	if s.Private {
+		flags |= flagPrivate
+	}
+	if s.Active {
+		flags |= flagActive
+	}
+	if s.ContainsNan {
+		flags |= flagContainsNan
+	}
+	if s.Start != nil {
+		flags |= flagStart
+	}
+	if s.End != nil {
+		flags |= flagEnd
+	}
+	buf.WriteByte(flags)
+
+	putString(s.SerieCode)
+	putString(s.Title)
+	putString(s.Units)
+	putString(s.Source)
+	putStrings(s.Notes)
+	putStrings(s.Text)
+	putVarint(int64(s.Decimals))
+	putVarint(int64(s.Frequency))
+	putVarint(int64(s.NumberOfObservations))
+
+	if s.Start != nil {
+		putVarint(s.Start.Unix())
+	}
+	if s.End != nil {
+		putVarint(s.End.Unix())
+	}
+
+	dates := s.Observations.Dates
+	values := s.Observations.Values
+	putUvarint(uint64(len(dates)))
+	putUvarint(uint64(len(values)))
+
+	unit := byte(periodDays)
+	for _, date := range dates {
+		if date.Unix()%86400 != 0 {
+			unit = periodSeconds
+			break
+		}
+	}
+	buf.WriteByte(unit)
+
+	var previous int64
+	for _, date := range dates {
+		current := date.Unix()
+		if unit == periodDays {
+			current /= 86400
+		}
+		putVarint(current - previous)
+		previous = current
+	}
+
+	mask := make([]byte, (len(values)+7)/8)
+	for i, value := range values {
+		if value == MissingValue || math.IsNaN(value) {
+			mask[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	buf.Write(mask)
+
+	packed := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint64(packed[8*i:], math.Float64bits(value))
+	}
+	buf.Write(packed)
+
+	return buf.Bytes()
+}
+
+// decodes a record written by encodeRecord
+func decodeRecord(record []byte) (*BDSICESerie, error) {
+	var s BDSICESerie
+	var err error
+
+	errTruncated := fmt.Errorf("truncated record")
+
+	getUvarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Uvarint(record)
+		if n <= 0 {
+			err = errTruncated
+			return 0
+		}
+		record = record[n:]
+		return v
+	}
+	getVarint := func() int64 {
+		if err != nil {
+			return 0
+		}
+		v, n := binary.Varint(record)
+		if n <= 0 {
+			err = errTruncated
+			return 0
+		}
+		record = record[n:]
+		return v
+	}
+	getBytes := func(n uint64) []byte {
+		if err != nil {
+			return nil
+		}
+		if uint64(len(record)) < n {
+			err = errTruncated
+			return nil
+		}
+		b := record[:n]
+		record = record[n:]
+		return b
+	}
+	getString := func() string {
+		return string(getBytes(getUvarint()))
+	}
+	getStrings := func() []string {
+		n := getUvarint()
+		if err != nil || n == 0 {
+			return nil
+		}
+		// every string takes at least one byte for its length
+		if n > uint64(len(record)) {
+			err = errTruncated
+			return nil
+		}
+		strs := make([]string, 0, n)
+		for i := uint64(0); i < n && err == nil; i++ {
+			strs = append(strs, getString())
+		}
+		return strs
+	}
+
+	flagsByte := getBytes(1)
+	if err != nil {
+		return nil, err
+	}
+	flags := flagsByte[0]
+
+	s.Public = flags&flagPublic != 0
+	s.Private = flags&flagPrivate != 0
+	s.Active = flags&flagActive != 0
+	s.ContainsNan = flags&flagContainsNan != 0
+
+	s.SerieCode = getString()
+	s.Title = getString()
+	s.Units = getString()
+	s.Source = getString()
+	s.Notes = getStrings()
+	s.Text = getStrings()
+	s.Decimals = int(getVarint())
+	s.Frequency = int(getVarint())
+	s.NumberOfObservations = int(getVarint())
+
+	if flags&flagStart != 0 {
+		start := time.Unix(getVarint(), 0).UTC()
+		s.Start = &start
+	}
+	if flags&flagEnd != 0 {
+		end := time.Unix(getVarint(), 0).UTC()
+		s.End = &end
+	}
+
+	datesCount := getUvarint()
+	valuesCount := getUvarint()
+	unitByte := getBytes(1)
+	if err != nil {
+		return nil, err
+	}
+	// every date takes at least one byte and every value eight, so counts larger than what is left of
+	// the record come from a corrupt store and must not be used to allocate
+	if datesCount > uint64(len(record)) || valuesCount > uint64(len(record))/8 {
+		return nil, errTruncated
+	}
+
+	if datesCount > 0 {
+		s.Observations.Dates = make([]time.Time, datesCount)
+	}
+	var current int64
+	for i := uint64(0); i < datesCount; i++ {
+		current += getVarint()
+		if unitByte[0] == periodDays {
+			s.Observations.Dates[i] = time.Unix(current*86400, 0).UTC()
+		} else {
+			s.Observations.Dates[i] = time.Unix(current, 0).UTC()
+		}
+	}
+
+	mask := getBytes((valuesCount + 7) / 8)
+	packed := getBytes(8 * valuesCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if valuesCount > 0 {
+		s.Observations.Values = make([]float64, valuesCount)
+	}
+	for i := range s.Observations.Values {
+		if mask[i/8]&(1<<(uint(i)%8)) != 0 {
+			s.Observations.Values[i] = MissingValue
+		} else {
+			s.Observations.Values[i] = math.Float64frombits(binary.LittleEndian.Uint64(packed[8*i:]))
+		}
+	}
+
+	return &s, nil
+}
+
+// a record ready to be written to a store, either freshly encoded or copied from an older store
+type pendingRecord struct {
+	code     string
+	record   []byte
+	modified int64
+}
+
+// writes the records to filePath atomically through utils.WriteFileAtomic
+func writeRecords(filePath string, records []pendingRecord) error {
+	sort.Slice(records, func(i, j int) bool { return records[i].code < records[j].code })
+
+	var buf bytes.Buffer
+	header := make([]byte, storeHeaderSize)
+	buf.Write(header)
+
+	type position struct {
+		offset uint64
+		length uint32
+	}
+	positions := make([]position, len(records))
+
+	for i, r := range records {
+		positions[i] = position{offset: uint64(buf.Len()), length: uint32(len(r.record))}
+		buf.Write(r.record)
+	}
+
+	indexOffset := uint64(buf.Len())
+	var entry [20]byte
+	for i, r := range records {
+		var codeLength [2]byte
+		binary.LittleEndian.PutUint16(codeLength[:], uint16(len(r.code)))
+		buf.Write(codeLength[:])
+		buf.WriteString(r.code)
+
+		binary.LittleEndian.PutUint64(entry[0:], positions[i].offset)
+		binary.LittleEndian.PutUint32(entry[8:], positions[i].length)
+		binary.LittleEndian.PutUint64(entry[12:], uint64(r.modified))
+		buf.Write(entry[:])
+	}
+
+	data := buf.Bytes()
+	copy(data[0:4], storeMagic)
+	binary.LittleEndian.PutUint16(data[4:6], storeVersion)
+	binary.LittleEndian.PutUint32(data[8:12], uint32(len(records)))
+	binary.LittleEndian.PutUint64(data[12:20], indexOffset)
+
+	return utils.WriteFileAtomic(filePath, data)
+}
+
+// WriteStore writes the given series to a new binary store at filePath, replacing any existing file
+func WriteStore(filePath string, seriesToWrite []*BDSICESerie) error {
+	now := time.Now().UnixNano()
+
+	records := make([]pendingRecord, 0, len(seriesToWrite))
+	for _, s := range seriesToWrite {
+		records = append(records, pendingRecord{code: s.SerieCode, record: encodeRecord(s), modified: now})
+	}
+
+	if err := writeRecords(filePath, records); err != nil {
+		return fmt.Errorf("series.WriteStore(): %s", err.Error())
+	}
+
+	return nil
+}
+
+// UpdateStore adds the given series to the binary store at filePath, replacing the series with the
+// same code and keeping the rest untouched. Series whose codes are listed in remove are dropped.
+// The store is created if it does not exist.
+func UpdateStore(filePath string, seriesToWrite []*BDSICESerie, remove ...string) error {
+	now := time.Now().UnixNano()
+
+	replaced := make(map[string]bool, len(seriesToWrite)+len(remove))
+	records := make([]pendingRecord, 0, len(seriesToWrite))
+
+	for _, s := range seriesToWrite {
+		replaced[s.SerieCode] = true
+		records = append(records, pendingRecord{code: s.SerieCode, record: encodeRecord(s), modified: now})
+	}
+	for _, code := range remove {
+		replaced[code] = true
+	}
+
+	if _, err := os.Stat(filePath); err == nil {
+		st, err := OpenStore(filePath)
+		if err != nil {
+			return fmt.Errorf("series.UpdateStore(): %s", err.Error())
+		}
+
+		// records kept from the current store are copied as they are, since the mapping is
+		// released before the new store replaces the current one
+		for _, code := range st.codes {
+			if replaced[code] {
+				continue
+			}
+			entry := st.entries[code]
+			record := make([]byte, entry.length)
+			copy(record, st.data[entry.offset:entry.offset+uint64(entry.length)])
+			records = append(records, pendingRecord{code: code, record: record, modified: entry.modified})
+		}
+
+		st.Close()
+	}
+
+	if err := writeRecords(filePath, records); err != nil {
+		return fmt.Errorf("series.UpdateStore(): %s", err.Error())
+	}
+
+	return nil
+}
+
+// ConvertJSONDirectory migrates a directory of JSON series, as written by former versions of
+// bdsicego, into the binary store of that directory. Series already in the store are replaced.
+// If removeJSON is true, the JSON files are deleted once the store has been written.
+// It returns the number of series converted.
+func ConvertJSONDirectory(dirPath string, removeJSON bool) (int, error) {
+	files, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return 0, fmt.Errorf("series.ConvertJSONDirectory(): %s", err.Error())
+	}
+
+	var (
+		converted []*BDSICESerie
+		filePaths []string
+	)
+
+	for _, file := range files {
+		// db.json holds the catalog, not a serie
+		if filepath.Ext(file.Name()) != ".json" || file.Name() == "db.json" {
+			continue
+		}
+
+		filePath := filepath.Join(dirPath, file.Name())
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return 0, fmt.Errorf("series.ConvertJSONDirectory(): %s", err.Error())
+		}
+
+		var s BDSICESerie
+		err = json.Unmarshal(content, &s)
+		if err != nil {
+			return 0, fmt.Errorf("series.ConvertJSONDirectory(): %s: %s", filePath, err.Error())
+		}
+
+		if s.SerieCode == "" {
+			s.SerieCode = strings.TrimSuffix(file.Name(), ".json")
+		}
+
+		converted = append(converted, &s)
+		filePaths = append(filePaths, filePath)
+	}
+
+	if len(converted) == 0 {
+		return 0, nil
+	}
+
+	err = UpdateStore(filepath.Join(dirPath, StoreFileName), converted)
+	if err != nil {
+		return 0, fmt.Errorf("series.ConvertJSONDirectory(): %s", err.Error())
+	}
+
+	if removeJSON {
+		for _, filePath := range filePaths {
+			if err := os.Remove(filePath); err != nil {
+				return len(converted), fmt.Errorf("series.ConvertJSONDirectory(): %s", err.Error())
+			}
+		}
+	}
+
+	return len(converted), nil
+}
@@ -1,7 +1,431 @@
-package main
+// package tree builds a browsable taxonomy of the series in the BDSICE catalog:
+// topic -> indicator -> territory -> transformation -> series
+package tree
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
-func main() {
-	fmt.Println("tree of series")
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/internal/config"
+	"github.com/fabiansalazares/bdsicego/internal/utils"
+)
+
+// name of the file holding the taxonomy, stored next to the catalog
+const FileName = config.TreeFileName
+
+// names of the nodes used when a title does not tell the territory or the transformation of a serie
+const (
+	DefaultTerritory      = "NACIONAL"
+	DefaultTransformation = "ORIGINAL"
+)
+
+// Node is a node of the taxonomy. Inner nodes have children; the nodes of the last level, the
+// transformations, hold the codes of the series classified under them.
+type Node struct {
+	Name     string   `json:"Name"`
+	Children []*Node  `json:"Children,omitempty"`
+	Codes    []string `json:"Codes,omitempty"`
+}
+
+// Classification holds the position of a serie in the taxonomy
+type Classification struct {
+	Topic          string
+	Indicator      string
+	Territory      string
+	Transformation string
+}
+
+// topics, in order of precedence: the first rule with a keyword in the title wins, so that
+// specific topics come before the general ones their titles also name, such as Energy before
+// Consumption and sales for "CONSUMO DE ENERGIA ELECTRICA". Keywords match whole words, unless
+// they end in "*" and are stems, which match the words they begin: "INDUSTRI*" matches INDUSTRIA
+// and INDUSTRIAL. Short words are kept whole: GAS does not match GASTO or GASOLEO.
+var topicRules = []struct {
+	topic    string
+	keywords []string
+}{
+	{"Labour market", []string{"EPA", "OCUPADOS", "PARADOS", "PARO", "DESEMPLE*", "AFILIADOS", "EMPLEO", "ACTIVOS", "CONTRATOS", "SALARI*", "COSTE LABORAL", "HUELGA*"}},
+	{"Prices", []string{"IPC", "PRECIO", "PRECIOS", "DEFLACTOR", "INFLACION", "IPRI", "IPCA"}},
+	{"National accounts", []string{"PIB", "VAB", "CONTABILIDAD", "FORMACION BRUTA", "DEMANDA NACIONAL", "RENTA NACIONAL"}},
+	{"Industry", []string{"PRODUCCION INDUSTRIAL", "IPI", "INDUSTRI*", "CAPACIDAD PRODUCTIVA", "CARTERA DE PEDIDOS"}},
+	{"Construction and housing", []string{"CONSTRUCCION", "VIVIENDA*", "LICENCIAS", "VISADOS", "CEMENTO", "HIPOTECA*"}},
+	{"Foreign sector", []string{"EXPORTACION*", "IMPORTACION*", "COMERCIO EXTERIOR", "BALANZA", "ARANCEL*"}},
+	{"Tourism", []string{"TURISMO", "TURIST*", "PERNOCTACION*", "VIAJEROS", "HOTEL*"}},
+	{"Energy", []string{"PETROLEO", "ENERGIA", "ELECTRIC*", "GAS", "CARBURANTE*", "GASOLINA*"}},
+	{"Financial markets", []string{"CREDITO*", "TIPO DE INTERES", "TIPOS DE INTERES", "EURIBOR", "BOLSA", "DEPOSITOS", "TIPO DE CAMBIO", "BONO*"}},
+	{"Public sector", []string{"DEUDA", "DEFICIT", "RECAUDACION", "IMPUESTO*", "ADMINISTRACIONES PUBLICAS", "ESTADO"}},
+	{"Transport", []string{"TRANSPORTE*", "PASAJEROS", "MERCANCIAS", "TRAFICO"}},
+	{"Agriculture", []string{"AGRARI*", "AGRICOLA*", "AGRICULTURA", "GANADER*", "PESCA"}},
+	{"Consumption and sales", []string{"MATRICULACION*", "CONSUMO", "VENTAS", "COMERCIO MINORISTA", "GRANDES EMPRESAS"}},
+	{"Business and consumer surveys", []string{"CONFIANZA", "OPINION", "CLIMA", "EXPECTATIVAS"}},
+}
+
+// transformations, in order of precedence
+var transformationRules = []struct {
+	transformation string
+	keywords       []string
+}{
+	{"TASA DE VARIACION ANUAL", []string{"TASA DE VARIACION ANUAL", "T.V.A.", "TVA", "VARIACION INTERANUAL", "TASA INTERANUAL"}},
+	{"TASA DE VARIACION INTERMENSUAL", []string{"VARIACION MENSUAL", "INTERMENSUAL"}},
+	{"TASA DE VARIACION INTERTRIMESTRAL", []string{"VARIACION TRIMESTRAL", "INTERTRIMESTRAL"}},
+	{"DESESTACIONALIZADA", []string{"CVEC", "C.V.E.C.", "DESESTACIONALIZAD*", "CORREGID*"}},
+	{"TENDENCIA", []string{"TENDENCIA", "CICLO-TENDENCIA"}},
+	{"MEDIA MOVIL", []string{"MEDIA MOVIL"}},
+	{"ACUMULADA", []string{"ACUMULAD*"}},
+	{"MEDIA ANUAL", []string{"MEDIA ANUAL"}},
+}
+
+// territories found in BDSICE titles. Titles have their diacritics removed by decode.
+var territories = []string{
+	// autonomous communities
+	"ANDALUCIA", "ARAGON", "ASTURIAS", "BALEARES", "CANARIAS", "CANTABRIA", "CASTILLA Y LEON",
+	"CASTILLA-LA MANCHA", "CASTILLA LA MANCHA", "CATALUNA", "COMUNIDAD VALENCIANA", "C. VALENCIANA",
+	"EXTREMADURA", "GALICIA", "MADRID", "MURCIA", "NAVARRA", "PAIS VASCO", "LA RIOJA", "RIOJA",
+	"CEUTA", "MELILLA",
+	// provinces
+	"ALAVA", "ALBACETE", "ALICANTE", "ALMERIA", "AVILA", "BADAJOZ", "BARCELONA", "BURGOS", "CACERES",
+	"CADIZ", "CASTELLON", "CIUDAD REAL", "CORDOBA", "CORUNA", "CUENCA", "GERONA", "GIRONA", "GRANADA",
+	"GUADALAJARA", "GUIPUZCOA", "HUELVA", "HUESCA", "JAEN", "LEON", "LERIDA", "LLEIDA", "LUGO", "MALAGA",
+	"ORENSE", "OURENSE", "PALENCIA", "LAS PALMAS", "PONTEVEDRA", "SALAMANCA", "SANTA CRUZ DE TENERIFE",
+	"SEGOVIA", "SEVILLA", "SORIA", "TARRAGONA", "TERUEL", "TOLEDO", "VALENCIA", "VALLADOLID", "VIZCAYA",
+	"ZAMORA", "ZARAGOZA",
+	// other economies
+	"ZONA EURO", "UNION EUROPEA", "UE-27", "UE-28", "ALEMANIA", "FRANCIA", "ITALIA", "REINO UNIDO",
+	"PORTUGAL", "ESTADOS UNIDOS", "EEUU", "EE.UU.", "JAPON", "CHINA", "OCDE",
+}
+
+// returns the upper-cased title split in its segments, which BDSICE separates by dots
+func segments(title string) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.ToUpper(title), ". ") {
+		part = strings.Trim(strings.TrimSpace(part), ".")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// reports whether keyword appears in s as a whole word or phrase
+func containsWord(s string, keyword string) bool {
+	for i := strings.Index(s, keyword); i >= 0; {
+		before := i == 0 || !isWordChar(s[i-1])
+		end := i + len(keyword)
+		after := end == len(s) || !isWordChar(s[end])
+
+		if before && after {
+			return true
+		}
+
+		next := strings.Index(s[i+1:], keyword)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+func isWordChar(b byte) bool {
+	return (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+// reports whether s contains keyword as a whole word or phrase or, if keyword is a stem marked
+// by a trailing "*", as the beginning of a word
+func containsKeyword(s string, keyword string) bool {
+	if !strings.HasSuffix(keyword, "*") {
+		return containsWord(s, keyword)
+	}
+
+	stem := strings.TrimSuffix(keyword, "*")
+	for i := strings.Index(s, stem); i >= 0; {
+		if i == 0 || !isWordChar(s[i-1]) {
+			return true
+		}
+
+		next := strings.Index(s[i+1:], stem)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// Classify places a serie in the taxonomy using its title and code. The topic comes from keywords
+// in the title or, failing that, from the section given by the first digits of the code. Territory
+// and transformation are the segments of the title that name them; the remaining segments make up
+// the indicator.
+func Classify(code string, title string) Classification {
+	c := Classification{
+		Territory:      DefaultTerritory,
+		Transformation: DefaultTransformation,
+	}
+
+	upperTitle := strings.ToUpper(title)
+
+	for _, rule := range topicRules {
+		for _, keyword := range rule.keywords {
+			if containsKeyword(upperTitle, keyword) {
+				c.Topic = rule.topic
+				break
+			}
+		}
+		if c.Topic != "" {
+			break
+		}
+	}
+
+	if c.Topic == "" {
+		c.Topic = "Section " + sectionOf(code)
+	}
+
+	var indicator []string
+	for _, segment := range segments(title) {
+		if t, ok := matchTransformation(segment); ok {
+			c.Transformation = t
+			continue
+		}
+
+		if t, ok := matchTerritory(segment); ok && segment == t {
+			c.Territory = t
+			continue
+		} else if ok && c.Territory == DefaultTerritory {
+			c.Territory = t
+		}
+
+		if segment == "TOTAL NACIONAL" || segment == "NACIONAL" || segment == "ESPANA" {
+			continue
+		}
+
+		indicator = append(indicator, segment)
+	}
+
+	// BDSICE marks derived series with a letter after the numeric code, such as 634814q
+	if suffix := strings.TrimLeft(code, "0123456789"); suffix != "" && c.Transformation == DefaultTransformation {
+		c.Transformation = "VARIANT " + strings.ToUpper(suffix)
+	}
+
+	// indicators are named after their first two segments, which hold the source or operation and the
+	// variable. Further segments usually break down the variable and would make the level too wide.
+	if len(indicator) > 2 {
+		indicator = indicator[:2]
+	}
+	c.Indicator = strings.Join(indicator, ". ")
+	if c.Indicator == "" {
+		c.Indicator = upperTitle
+	}
+
+	return c
+}
+
+// returns the section of a serie, given by the first two digits of its code
+func sectionOf(code string) string {
+	digits := strings.TrimRight(code, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if len(digits) > 2 {
+		digits = digits[:2]
+	}
+	return digits
+}
+
+func matchTransformation(segment string) (string, bool) {
+	for _, rule := range transformationRules {
+		for _, keyword := range rule.keywords {
+			if containsKeyword(segment, keyword) {
+				return rule.transformation, true
+			}
+		}
+	}
+	return "", false
+}
+
+func matchTerritory(segment string) (string, bool) {
+	for _, territory := range territories {
+		if containsWord(segment, territory) {
+			return territory, true
+		}
+	}
+	return "", false
+}
+
+// Build returns the taxonomy of all the series in the catalog. Nodes are sorted by name and codes
+// are sorted, so that the same catalog always yields the same tree.
+func Build(db *database.BDSICEDatabase) *Node {
+	root := &Node{Name: "BDSICE"}
+
+	codes := make([]string, 0, len(db.Series))
+	for code := range db.Series {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		c := Classify(code, db.Series[code])
+		leaf := root.child(c.Topic).child(c.Indicator).child(c.Territory).child(c.Transformation)
+		leaf.Codes = append(leaf.Codes, code)
+	}
+
+	root.sort()
+
+	return root
+}
+
+// returns the child with the given name, creating it if it does not exist
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	c := &Node{Name: name}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *Node) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// Leaves returns the codes of all the series under the node, sorted
+func (n *Node) Leaves() []string {
+	leaves := append([]string{}, n.Codes...)
+	for _, c := range n.Children {
+		leaves = append(leaves, c.Leaves()...)
+	}
+	sort.Strings(leaves)
+	return leaves
+}
+
+// Prune returns a copy of the tree holding only the series for which keep returns true. Nodes left
+// without series are dropped, except for the node Prune is called on.
+func (n *Node) Prune(keep func(code string) bool) *Node {
+	pruned := &Node{Name: n.Name}
+
+	for _, code := range n.Codes {
+		if keep(code) {
+			pruned.Codes = append(pruned.Codes, code)
+		}
+	}
+
+	for _, c := range n.Children {
+		if p := c.Prune(keep); len(p.Codes) > 0 || len(p.Children) > 0 {
+			pruned.Children = append(pruned.Children, p)
+		}
+	}
+
+	return pruned
+}
+
+// Find returns the node reached by following path from n. Each element of the path is either the
+// 1-based position of a child, as printed when browsing the tree, or the case-insensitive name or
+// name prefix of a child.
+func (n *Node) Find(path ...string) (*Node, error) {
+	current := n
+
+	for _, element := range path {
+		next, err := current.find(element)
+		if err != nil {
+			return nil, fmt.Errorf("tree.Find(): %s", err.Error())
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+func (n *Node) find(element string) (*Node, error) {
+	if position, err := strconv.Atoi(element); err == nil {
+		if position < 1 || position > len(n.Children) {
+			return nil, fmt.Errorf("%s has no node number %d", n.Name, position)
+		}
+		return n.Children[position-1], nil
+	}
+
+	var prefixMatches []*Node
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Name, element) {
+			return c, nil
+		}
+		if strings.HasPrefix(strings.ToUpper(c.Name), strings.ToUpper(element)) {
+			prefixMatches = append(prefixMatches, c)
+		}
+	}
+
+	switch len(prefixMatches) {
+	case 0:
+		return nil, fmt.Errorf("%s has no node named %q", n.Name, element)
+	case 1:
+		return prefixMatches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d nodes of %s", element, len(prefixMatches), n.Name)
+	}
+}
+
+// Save writes the tree to tree.json in dbLocalPath
+func Save(dbLocalPath string, root *Node) error {
+	treeJSON, err := json.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("tree.Save(): %s", err.Error())
+	}
+
+	// written to a temporary file that replaces the tree, since the tree may be shared, as a hard
+	// link, with other states of the database
+	filePath := filepath.Join(dbLocalPath, FileName)
+	err = utils.WriteFileAtomic(filePath, treeJSON)
+	if err != nil {
+		return fmt.Errorf("tree.Save(): %s", err.Error())
+	}
+
+	return nil
+}
+
+// Load returns the tree stored with the catalog. If there is no tree, or the catalog has changed
+// since the tree was built, the tree is rebuilt from the catalog and saved.
+func Load(configuration *config.BDSICEConfig) (*Node, error) {
+	dbLocalPath := configuration.DatabaseLocalPath
+	treeFilePath := filepath.Join(dbLocalPath, FileName)
+
+	treeInfo, treeErr := os.Stat(treeFilePath)
+	catalogInfo, err := os.Stat(filepath.Join(dbLocalPath, database.CatalogFileName))
+	if err != nil {
+		return nil, fmt.Errorf("tree.Load(): %s", err.Error())
+	}
+
+	if treeErr == nil && !catalogInfo.ModTime().After(treeInfo.ModTime()) {
+		content, err := ioutil.ReadFile(treeFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("tree.Load(): %s", err.Error())
+		}
+
+		var root Node
+		if err := json.Unmarshal(content, &root); err == nil {
+			return &root, nil
+		}
+		// a corrupted tree is rebuilt below
+	}
+
+	db, err := database.LoadDatabase(configuration)
+	if err != nil {
+		return nil, fmt.Errorf("tree.Load(): %s", err.Error())
+	}
+
+	root := Build(db)
+
+	err = Save(dbLocalPath, root)
+	if err != nil {
+		return nil, fmt.Errorf("tree.Load(): %s", err.Error())
+	}
+
+	return root, nil
 }
@@ -0,0 +1,75 @@
+package tree
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fabiansalazares/bdsicego/database"
+	"github.com/fabiansalazares/bdsicego/series"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		code     string
+		title    string
+		expected Classification
+	}{
+		{"100001", "EPA. OCUPADOS. TOTAL NACIONAL", Classification{"Labour market", "EPA. OCUPADOS", "NACIONAL", "ORIGINAL"}},
+		{"100002", "EPA. OCUPADOS. AVILA", Classification{"Labour market", "EPA. OCUPADOS", "AVILA", "ORIGINAL"}},
+		{"200001", "IPC. INDICE GENERAL. TASA DE VARIACION ANUAL", Classification{"Prices", "IPC. INDICE GENERAL", "NACIONAL", "TASA DE VARIACION ANUAL"}},
+		{"634814q", "PRECIO PETROLEO BRENT", Classification{"Prices", "PRECIO PETROLEO BRENT", "NACIONAL", "VARIANT Q"}},
+		{"990001", "SERIE SIN CLASIFICAR", Classification{"Section 99", "SERIE SIN CLASIFICAR", "NACIONAL", "ORIGINAL"}},
+		// keywords match whole words, and specific topics win over general ones
+		{"300001", "MATRICULACION DE TURISMOS", Classification{"Consumption and sales", "MATRICULACION DE TURISMOS", "NACIONAL", "ORIGINAL"}},
+		{"300002", "GASTO EN CONSUMO FINAL DE LOS HOGARES", Classification{"Consumption and sales", "GASTO EN CONSUMO FINAL DE LOS HOGARES", "NACIONAL", "ORIGINAL"}},
+		{"300003", "VENTAS DE GASOLEO", Classification{"Consumption and sales", "VENTAS DE GASOLEO", "NACIONAL", "ORIGINAL"}},
+		{"300004", "CONSUMO DE ENERGIA ELECTRICA", Classification{"Energy", "CONSUMO DE ENERGIA ELECTRICA", "NACIONAL", "ORIGINAL"}},
+		{"300005", "PERNOCTACIONES HOTELERAS. TURISTAS EXTRANJEROS", Classification{"Tourism", "PERNOCTACIONES HOTELERAS. TURISTAS EXTRANJEROS", "NACIONAL", "ORIGINAL"}},
+		{"300006", "CONFIANZA DEL CONSUMIDOR. ESTADOS UNIDOS", Classification{"Business and consumer surveys", "CONFIANZA DEL CONSUMIDOR", "ESTADOS UNIDOS", "ORIGINAL"}},
+	}
+
+	for _, c := range cases {
+		if got := Classify(c.code, c.title); got != c.expected {
+			t.Errorf("Classify(%s, %q): expected %+v, got %+v", c.code, c.title, c.expected, got)
+		}
+	}
+}
+
+func TestBuildAndFind(t *testing.T) {
+	db, err := database.BuildDatabase([]*series.BDSICESerie{
+		{SerieCode: "100001", Title: "EPA. OCUPADOS. TOTAL NACIONAL"},
+		{SerieCode: "100002", Title: "EPA. OCUPADOS. AVILA"},
+		{SerieCode: "100003", Title: "EPA. OCUPADOS. AVILA. TASA DE VARIACION ANUAL"},
+		{SerieCode: "200001", Title: "IPC. INDICE GENERAL"},
+	})
+	if err != nil {
+		t.Fatalf("BuildDatabase(): %s", err.Error())
+	}
+
+	root := Build(db)
+
+	if len(root.Children) != 2 || root.Children[0].Name != "Labour market" || root.Children[1].Name != "Prices" {
+		t.Fatalf("Build(): unexpected topics %+v", root.Children)
+	}
+
+	node, err := root.Find("1", "epa", "AVILA")
+	if err != nil {
+		t.Fatalf("Find(): %s", err.Error())
+	}
+	if leaves := node.Leaves(); !reflect.DeepEqual(leaves, []string{"100002", "100003"}) {
+		t.Errorf("Leaves(): expected [100002 100003], got %v", leaves)
+	}
+
+	if _, err := root.Find("3"); err == nil {
+		t.Errorf("Find(): expected an error for a node number out of range")
+	}
+
+	if leaves := root.Leaves(); len(leaves) != 4 {
+		t.Errorf("Leaves(): expected the 4 series of the catalog, got %v", leaves)
+	}
+
+	pruned := root.Prune(func(code string) bool { return code != "200001" })
+	if len(pruned.Children) != 1 || len(pruned.Leaves()) != 3 {
+		t.Errorf("Prune(): expected the Prices topic to be dropped, got %+v", pruned.Children)
+	}
+}